@@ -0,0 +1,98 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File archive.go contains code related to archiving models when
+// they expire.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// expiresKeySuffix is appended to the key for a model to form the key which
+// holds the expiration for the model if the ArchiveOnExpire option was used.
+const expiresKeySuffix = "expires"
+
+// ArchiveOnExpire is a ModelOption which causes models of the given type to be
+// copied to an archive just before they expire (see TTL and SaveWithTTL), so
+// that expired data can still be retained for analytics or compliance. The
+// archive for a model consists of a copy of its main hash at ArchiveKey(id),
+// along with a copy of any fields which are stored outside of the main hash
+// (e.g. list and set fields) at ArchiveKey(id) + ":" + field name. Archiving a
+// model with the same id again replaces the old archive. Archived models never
+// expire and are not returned by queries.
+//
+// When this option is used, the expiration is held in a separate key instead of
+// on the model itself, and the model is archived and then deleted as if Delete
+// had been called by an ExpirationListener when the expiration is reached. That
+// means models of the type only expire while an ExpirationListener is running
+// (see ListenForExpirations). Models which expire while no listener is running
+// are not deleted until the next time they are saved with a TTL and expire.
+func ArchiveOnExpire() ModelOption {
+	return func(spec *modelSpec) error {
+		spec.archiveOnExpire = true
+		return nil
+	}
+}
+
+// ArchiveKey returns the key for the hash where the model with the given id is
+// copied when it expires if the ArchiveOnExpire option was used.
+func (mt *ModelType) ArchiveKey(id string) string {
+	return mt.spec.archiveKey(id)
+}
+
+// archiveKey returns the key for the archived hash for the model with the given
+// id. It must match the key used in scripts/archive_model.lua.
+func (ms *modelSpec) archiveKey(id string) string {
+	return ms.keyName() + ":archive:" + id
+}
+
+// expiresKey returns the key which holds the expiration for the model with the
+// given id if the ArchiveOnExpire option was used.
+func (ms *modelSpec) expiresKey(id string) string {
+	return ms.keyName() + ":" + id + ":" + expiresKeySuffix
+}
+
+// archiveAndDelete archives the model with the given id and then deletes it in
+// a single transaction. It has no effect if the model does not exist or if the
+// model was given a new expiration after the old one was reached.
+func (p *Pool) archiveAndDelete(ms *modelSpec, id string) error {
+	t := p.NewTransaction()
+	key := ms.keyName() + ":" + id
+	expiresKey := ms.expiresKey(id)
+	for _, k := range []string{key, expiresKey} {
+		if err := t.WatchKey(k); err != nil {
+			t.setError(err)
+		}
+	}
+	if t.err == nil {
+		// Check that the model exists and that it was not saved with a new TTL
+		// since the expiration was reached
+		exists, err := redis.Bool(t.conn.Do("EXISTS", key))
+		if err != nil {
+			t.setError(err)
+		}
+		expires, err := redis.Bool(t.conn.Do("EXISTS", expiresKey))
+		if err != nil {
+			t.setError(err)
+		}
+		if t.err == nil && (!exists || expires) {
+			// Nothing to do. Exec will just release the connection.
+			return t.Exec()
+		}
+	}
+	deleted := false
+	t.archiveModel(ms, id, nil)
+	t.Delete(&ModelType{spec: ms}, id, &deleted)
+	if err := t.Exec(); err != nil {
+		if _, ok := err.(WatchError); ok {
+			// The model was modified, which means it was either deleted or saved
+			// again with a new expiration
+			return nil
+		}
+		return err
+	}
+	return nil
+}
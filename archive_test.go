@@ -0,0 +1,87 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File archive_test.go tests the code in archive.go.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"testing"
+	"time"
+)
+
+type archivedModel struct {
+	Name string   `zoom:"index"`
+	Tags []string `redisType:"list"`
+	DefaultData
+}
+
+func TestArchiveOnExpire(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	archivedModels := registerTestType(t, &archivedModel{}, ArchiveOnExpire())
+	listener, err := ListenForExpirations()
+	if err != nil {
+		t.Fatalf("Unexpected error in ListenForExpirations: %s", err.Error())
+	}
+	defer func() {
+		if err := listener.Close(); err != nil {
+			t.Errorf("Unexpected error in ExpirationListener.Close: %s", err.Error())
+		}
+	}()
+
+	persistent := &archivedModel{Name: "persistent"}
+	if err := archivedModels.Save(persistent); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if ttl, err := archivedModels.TTL(persistent.Id()); err != nil {
+		t.Fatalf("Unexpected error in TTL: %s", err.Error())
+	} else if ttl != -1 {
+		t.Errorf("Expected TTL to be -1 for a persistent model but got %s", ttl)
+	}
+
+	model := &archivedModel{Name: "expiring", Tags: []string{"a", "b"}}
+	if err := archivedModels.SaveWithTTL(model, 50*time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error in SaveWithTTL: %s", err.Error())
+	}
+	if ttl, err := archivedModels.TTL(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in TTL: %s", err.Error())
+	} else if ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("Expected TTL to be between 0 and 50ms but got %s", ttl)
+	}
+
+	// Wait for the listener to archive and delete the model
+	conn := NewConn()
+	defer conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exists, err := redis.Bool(conn.Do("EXISTS", archivedModels.spec.keyName()+":"+model.Id()))
+		if err != nil {
+			t.Fatalf("Unexpected error in EXISTS: %s", err.Error())
+		}
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the expired model to be deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectSetDoesNotContain(t, archivedModels.AllIndexKey(), model.Id())
+	expectIndexDoesNotExist(t, archivedModels, model, "Name")
+	expectModelExists(t, archivedModels, persistent)
+
+	archiveKey := archivedModels.ArchiveKey(model.Id())
+	expectFieldEquals(t, archiveKey, "Name", "expiring")
+	if n, err := redis.Int(conn.Do("LLEN", archiveKey+":Tags")); err != nil {
+		t.Fatalf("Unexpected error in LLEN: %s", err.Error())
+	} else if n != len(model.Tags) {
+		t.Errorf("Expected %d archived Tags but got %d", len(model.Tags), n)
+	}
+	if err := listener.Err(); err != nil {
+		t.Errorf("Unexpected error in ExpirationListener: %s", err.Error())
+	}
+}
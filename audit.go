@@ -0,0 +1,219 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File audit.go contains code related to keeping an audit trail
+// of the changes made to each model.
+
+package zoom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"time"
+)
+
+// defaultAuditMaxLen is the number of records kept for each model if the
+// maxLen passed to Audit is 0.
+const defaultAuditMaxLen = 100
+
+// Audit is a ModelOption which causes a record to be added to the audit trail
+// for a model every time it is saved or deleted. Each record includes the
+// action, the time, the actor (see Transaction.SetActor and WithActor), and
+// the old and new values of each field which changed. The audit trail is
+// stored in a capped redis list, so only the most recent maxLen records are
+// kept. If maxLen is 0, 100 records are kept. The audit trail for a model is
+// kept after the model is deleted and can be read with ModelType.History.
+// Fields which are encrypted or compressed are not included in the records.
+// Note that DeleteAll and Rename do not add records.
+func Audit(maxLen int) ModelOption {
+	return func(spec *modelSpec) error {
+		if maxLen < 0 {
+			return fmt.Errorf("zoom: maxLen for Audit cannot be negative")
+		}
+		if maxLen == 0 {
+			maxLen = defaultAuditMaxLen
+		}
+		spec.auditMaxLen = maxLen
+		return nil
+	}
+}
+
+// AuditRecord is a single entry in the audit trail for a model.
+type AuditRecord struct {
+	// Action is either "save" or "delete"
+	Action string
+	// Id is the id of the model
+	Id string
+	// Actor is who made the change, or an empty string if it is unknown
+	Actor string
+	// Time is when the change was made, according to the clock of the client
+	Time time.Time
+	// Changes holds the change for each field which changed, keyed by field
+	// name
+	Changes map[string]FieldChange
+}
+
+// FieldChange describes a change to a single field. Old and New are the values
+// as they are stored in the database, or nil if the field was not stored (e.g.
+// New is always nil for a delete).
+type FieldChange struct {
+	Old *string
+	New *string
+}
+
+// auditRecordJSON is the format for AuditRecord stored in the database.
+type auditRecordJSON struct {
+	Action  string `json:"action"`
+	Id      string `json:"id"`
+	Actor   string `json:"actor"`
+	Time    string `json:"time"`
+	Changes map[string]struct {
+		Old *string `json:"old"`
+		New *string `json:"new"`
+	} `json:"changes"`
+}
+
+// actorKey is the context key for the actor set by WithActor
+type actorKey struct{}
+
+// WithActor returns a copy of ctx which holds actor. Any transaction created
+// with NewTransactionContext (or any of the methods which accept a context)
+// will record actor in the audit trail.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFromContext returns the actor set by WithActor, if any.
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// SetActor sets the actor (e.g. the id of a user) which is recorded in the
+// audit trail for any models saved or deleted in t. See the Audit option.
+func (t *Transaction) SetActor(actor string) {
+	t.actor = actor
+}
+
+// auditKeySuffix is appended to the key for a model to form the key for its
+// audit trail.
+const auditKeySuffix = "audit"
+
+// auditKey returns the key for the list which holds the audit trail for the
+// model with the given id.
+func (ms *modelSpec) auditKey(id string) string {
+	return ms.keyName() + ":" + id + ":" + auditKeySuffix
+}
+
+// auditFields returns the fields of ms which are included in audit records.
+func (ms *modelSpec) auditFields(fields []*fieldSpec) []*fieldSpec {
+	auditFields := []*fieldSpec{}
+	for _, fs := range fields {
+		if fs.storedInHash() && !fs.encrypted && !fs.compressed {
+			auditFields = append(auditFields, fs)
+		}
+	}
+	return auditFields
+}
+
+// auditSave adds a script to the transaction which appends a record to the
+// audit trail for mr with the new values of fields. It has no effect if the
+// type of mr does not use the Audit option.
+func (t *Transaction) auditSave(mr *modelRef, fields []*fieldSpec) {
+	if mr.spec.auditMaxLen == 0 {
+		return
+	}
+	auditFields := mr.spec.auditFields(fields)
+	names := redis.Args{}
+	values := redis.Args{}
+	for _, fs := range auditFields {
+		value, err := mr.hashValue(fs)
+		if err != nil {
+			t.setError(err)
+			return
+		}
+		names = append(names, fs.redisName)
+		values = append(values, value)
+	}
+	t.appendAuditRecord(mr.spec, "save", mr.model.Id(), append(names, values...))
+}
+
+// auditDelete adds a script to the transaction which appends a record to the
+// audit trail for the model with the given id, including the values of every
+// field before it was deleted. It has no effect if mt does not use the Audit
+// option.
+func (t *Transaction) auditDelete(mt *ModelType, id string) {
+	if mt.spec.auditMaxLen == 0 {
+		return
+	}
+	names := redis.Args{}
+	for _, fs := range mt.spec.auditFields(mt.spec.fields) {
+		names = append(names, fs.redisName)
+	}
+	t.appendAuditRecord(mt.spec, "delete", id, names)
+}
+
+// appendAuditRecord is a small function wrapper around appendAuditRecordScript.
+// It offers some type safety and helps make sure the arguments you pass through to the are correct.
+// The script will compare the given field values to the values in the main hash and push a record
+// with the differences to the audit trail for the model.
+func (t *Transaction) appendAuditRecord(ms *modelSpec, action string, id string, fieldArgs redis.Args) {
+	modelKey, err := ms.modelKey(id)
+	if err != nil {
+		t.setError(err)
+		return
+	}
+	args := redis.Args{ms.auditKey(id), modelKey, ms.auditMaxLen, action, id, t.actor, time.Now().UTC().Format(time.RFC3339Nano)}
+	t.Script(appendAuditRecordScript, append(args, fieldArgs...), nil)
+}
+
+// History returns the audit trail for the model with the given id, starting
+// with the most recent record. The ModelType must have been registered with the
+// Audit option. History returns an empty slice if there are no records for the
+// model.
+func (mt *ModelType) History(id string) ([]AuditRecord, error) {
+	if mt.spec.auditMaxLen == 0 {
+		return nil, fmt.Errorf("zoom: Error in History: %s was not registered with the Audit option", mt.Name())
+	}
+	conn := mt.spec.pool.NewConn()
+	defer conn.Close()
+	replies, err := redis.ByteSlices(conn.Do("LRANGE", mt.spec.auditKey(id), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	fieldNames := map[string]string{}
+	for _, fs := range mt.spec.fields {
+		fieldNames[fs.redisName] = fs.name
+	}
+	records := make([]AuditRecord, len(replies))
+	for i, reply := range replies {
+		var stored auditRecordJSON
+		if err := json.Unmarshal(reply, &stored); err != nil {
+			return nil, fmt.Errorf("zoom: Error in History: could not parse audit record: %s", err.Error())
+		}
+		recordTime, err := time.Parse(time.RFC3339Nano, stored.Time)
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in History: could not parse audit record: %s", err.Error())
+		}
+		record := AuditRecord{
+			Action:  stored.Action,
+			Id:      stored.Id,
+			Actor:   stored.Actor,
+			Time:    recordTime,
+			Changes: map[string]FieldChange{},
+		}
+		for redisName, change := range stored.Changes {
+			name, found := fieldNames[redisName]
+			if !found {
+				// The field was removed from the model type
+				name = redisName
+			}
+			record.Changes[name] = FieldChange{Old: change.Old, New: change.New}
+		}
+		records[i] = record
+	}
+	return records, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File audit_test.go tests the code in audit.go, i.e.
+// keeping an audit trail of the changes made to each model.
+
+package zoom
+
+import (
+	"context"
+	"testing"
+)
+
+type auditedModel struct {
+	Name   string
+	Age    int
+	Secret string `zoom:"encrypted"`
+	DefaultData
+}
+
+func TestAudit(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	auditedModels := registerTestType(t, &auditedModel{}, Audit(2))
+	if err := setEncryptionKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("Unexpected error in setEncryptionKey: %s", err.Error())
+	}
+	defer setEncryptionKey(nil)
+
+	model := &auditedModel{Name: "Alice", Age: 30, Secret: "hunter2"}
+	if err := auditedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	model.Age = 31
+	ctx := WithActor(context.Background(), "admin")
+	if err := auditedModels.SaveContext(ctx, model); err != nil {
+		t.Fatalf("Unexpected error in SaveContext: %s", err.Error())
+	}
+	history, err := auditedModels.History(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in History: %s", err.Error())
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 audit records but got %d", len(history))
+	}
+	// The most recent record should be first and should only include the
+	// field which changed.
+	latest := history[0]
+	if latest.Action != "save" || latest.Id != model.Id() || latest.Actor != "admin" {
+		t.Errorf("Audit record was incorrect: %+v", latest)
+	}
+	if len(latest.Changes) != 1 {
+		t.Errorf("Expected 1 changed field but got %d: %v", len(latest.Changes), latest.Changes)
+	}
+	expectFieldChange(t, latest, "Age", "30", "31")
+	// The first record should include every field except the encrypted one.
+	first := history[1]
+	if first.Actor != "" {
+		t.Errorf("Expected Actor to be empty but got %q", first.Actor)
+	}
+	expectFieldChange(t, first, "Name", "", "Alice")
+	if _, found := first.Changes["Secret"]; found {
+		t.Error("Expected encrypted field to not be included in the audit record")
+	}
+	if first.Time.After(latest.Time) {
+		t.Errorf("Expected records to be ordered from newest to oldest but got %s before %s", latest.Time, first.Time)
+	}
+
+	// Renaming the model should move its audit trail to the new id.
+	oldId := model.Id()
+	if _, err := auditedModels.Rename(oldId, "renamed"+oldId); err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	model.SetId("renamed" + oldId)
+	if history, err := auditedModels.History(oldId); err != nil {
+		t.Fatalf("Unexpected error in History: %s", err.Error())
+	} else if len(history) != 0 {
+		t.Errorf("Expected no audit records for the old id but got %d", len(history))
+	}
+	if history, err := auditedModels.History(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in History: %s", err.Error())
+	} else if len(history) != 2 {
+		t.Errorf("Expected 2 audit records for the new id but got %d", len(history))
+	}
+
+	// Deleting the model should add a record and trim the oldest one.
+	if _, err := auditedModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	history, err = auditedModels.History(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in History: %s", err.Error())
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 audit records but got %d", len(history))
+	}
+	if history[0].Action != "delete" {
+		t.Errorf("Expected the latest action to be delete but got %s", history[0].Action)
+	}
+	expectFieldChange(t, history[0], "Age", "31", "")
+}
+
+// expectFieldChange calls t.Errorf if record does not include a change from
+// oldValue to newValue for the given field. An empty string means nil.
+func expectFieldChange(t *testing.T, record AuditRecord, field string, oldValue string, newValue string) {
+	change, found := record.Changes[field]
+	if !found {
+		t.Errorf("Expected audit record to include a change to %s but got %v", field, record.Changes)
+		return
+	}
+	check := func(which string, got *string, expected string) {
+		switch {
+		case expected == "" && got != nil:
+			t.Errorf("Expected %s value for %s to be nil but got %q", which, field, *got)
+		case expected != "" && (got == nil || *got != expected):
+			t.Errorf("Expected %s value for %s to be %q but got %v", which, field, expected, got)
+		}
+	}
+	check("old", change.Old, oldValue)
+	check("new", change.New, newValue)
+}
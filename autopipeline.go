@@ -0,0 +1,173 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File autopipeline.go contains code related to automatically
+// batching writes into pipelines.
+
+package zoom
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AutoPipeline batches operations (e.g. Save) which are issued within a short
+// window into a single Pipeline automatically, so that many small writes take
+// a few round trips instead of one each. This can greatly improve throughput
+// for fire-and-forget workloads, at the cost of up to one window of latency
+// for each operation. Unlike a Pipeline, an AutoPipeline is safe for concurrent
+// use, so it can be shared by every goroutine which writes to the database. It
+// is created with NewAutoPipeline.
+//
+// Each method returns a Future, which can be used to wait for that operation
+// (see Future.Wait). Operations in the same batch are not atomic, but batches
+// are sent in the order that their operations were issued.
+type AutoPipeline struct {
+	pool   *Pool
+	window time.Duration
+	maxOps int
+	// mu protects the fields below
+	mu     sync.Mutex
+	pl     *Pipeline
+	numOps int
+	timer  *time.Timer
+	closed bool
+	// flushMu is held while a batch is taken and flushed, so that batches are
+	// sent in order
+	flushMu sync.Mutex
+	// err is the first error encountered while flushing
+	err   error
+	errMu sync.Mutex
+}
+
+// NewAutoPipeline returns an AutoPipeline which uses the default pool. See
+// Pool.NewAutoPipeline.
+func NewAutoPipeline(window time.Duration, maxOps int) (*AutoPipeline, error) {
+	return defaultPool.NewAutoPipeline(window, maxOps)
+}
+
+// NewAutoPipeline returns an AutoPipeline which uses p. The operations in a
+// batch are flushed once window has passed since the first of them was issued,
+// or as soon as there are maxOps of them, whichever happens first. A maxOps of
+// 0 means there is no limit on the number of operations in a batch. When maxOps
+// is reached, the operation which filled the batch waits for it to be flushed,
+// which keeps callers from issuing operations faster than they can be sent.
+// Call Close when the AutoPipeline is no longer needed, so that any remaining
+// operations are flushed.
+func (p *Pool) NewAutoPipeline(window time.Duration, maxOps int) (*AutoPipeline, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("zoom: Error in NewAutoPipeline: window must be positive but got %s", window)
+	}
+	if maxOps < 0 {
+		return nil, fmt.Errorf("zoom: Error in NewAutoPipeline: maxOps cannot be negative but got %d", maxOps)
+	}
+	return &AutoPipeline{
+		pool:   p,
+		window: window,
+		maxOps: maxOps,
+		pl:     p.NewPipeline(),
+	}, nil
+}
+
+// Save issues an operation which saves model. See ModelType.Save.
+func (ap *AutoPipeline) Save(mt *ModelType, model Model) *Future {
+	return ap.queue(func(pl *Pipeline) *Future { return pl.Save(mt, model) })
+}
+
+// Delete issues an operation which deletes the model with the given id and sets
+// the value of deleted to true iff the model existed. See ModelType.Delete.
+// deleted is set by a different goroutine, so it should not be read until the
+// operation has finished.
+func (ap *AutoPipeline) Delete(mt *ModelType, id string, deleted *bool) *Future {
+	return ap.queue(func(pl *Pipeline) *Future { return pl.Delete(mt, id, deleted) })
+}
+
+// queue adds an operation to the current batch with fn, scheduling a flush for
+// the batch if it is the first operation in it, or flushing it right away if
+// it is full.
+func (ap *AutoPipeline) queue(fn func(pl *Pipeline) *Future) *Future {
+	ap.mu.Lock()
+	if ap.closed {
+		ap.mu.Unlock()
+		f := newFuture()
+		f.err = fmt.Errorf("zoom: Error in AutoPipeline: the AutoPipeline is closed")
+		f.finish()
+		return f
+	}
+	f := fn(ap.pl)
+	if f.Done() {
+		// The operation failed before it was queued
+		ap.mu.Unlock()
+		return f
+	}
+	ap.numOps++
+	if ap.numOps == 1 {
+		ap.timer = time.AfterFunc(ap.window, func() {
+			ap.flush()
+		})
+	}
+	full := ap.maxOps > 0 && ap.numOps >= ap.maxOps
+	ap.mu.Unlock()
+	if full {
+		ap.flush()
+	}
+	return f
+}
+
+// flush sends the current batch (if any) to the database and records the
+// first error (if any).
+func (ap *AutoPipeline) flush() error {
+	ap.flushMu.Lock()
+	defer ap.flushMu.Unlock()
+	ap.mu.Lock()
+	pl := ap.pl
+	ap.pl = ap.pool.NewPipeline()
+	ap.numOps = 0
+	if ap.timer != nil {
+		ap.timer.Stop()
+		ap.timer = nil
+	}
+	ap.mu.Unlock()
+	err := pl.Flush()
+	if err != nil {
+		ap.setError(err)
+	}
+	return err
+}
+
+// Flush sends any operations which have been issued but not flushed yet to the
+// database right away, and returns the first error that occurred in them (if
+// any).
+func (ap *AutoPipeline) Flush() error {
+	return ap.flush()
+}
+
+// setError sets ap.err iff it was not already set.
+func (ap *AutoPipeline) setError(err error) {
+	ap.errMu.Lock()
+	defer ap.errMu.Unlock()
+	if ap.err == nil {
+		ap.err = err
+	}
+}
+
+// Err returns the first error that occurred in any operation which was flushed
+// in the background, if any. Errors for individual operations can be checked
+// with the Future returned for each one.
+func (ap *AutoPipeline) Err() error {
+	ap.errMu.Lock()
+	defer ap.errMu.Unlock()
+	return ap.err
+}
+
+// Close flushes any remaining operations and stops the AutoPipeline. Any
+// operations issued after Close fail. It returns the same error as Err.
+func (ap *AutoPipeline) Close() error {
+	ap.mu.Lock()
+	ap.closed = true
+	ap.mu.Unlock()
+	ap.flush()
+	return ap.Err()
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File autopipeline_test.go tests the code in autopipeline.go, i.e.
+// batching writes into pipelines automatically.
+
+package zoom
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAutoPipeline(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	ap, err := NewAutoPipeline(time.Millisecond, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error in NewAutoPipeline: %s", err.Error())
+	}
+	// Save the models concurrently, some of which will be flushed because the
+	// batch is full and some because the window has passed.
+	models := createTestModels(10)
+	futures := make([]*Future, len(models))
+	wg := sync.WaitGroup{}
+	for i, model := range models {
+		wg.Add(1)
+		go func(i int, model *testModel) {
+			defer wg.Done()
+			futures[i] = ap.Save(testModels, model)
+		}(i, model)
+	}
+	wg.Wait()
+	for i, f := range futures {
+		if err := f.Wait(); err != nil {
+			t.Errorf("Unexpected error in Save for model %d: %s", i, err.Error())
+		}
+	}
+	for _, model := range models {
+		expectModelExists(t, testModels, model)
+	}
+
+	// Delete one of the models and close the AutoPipeline before the window
+	// passes. Close should flush the remaining operation.
+	deleted := false
+	f := ap.Delete(testModels, models[0].Id(), &deleted)
+	if err := ap.Close(); err != nil {
+		t.Fatalf("Unexpected error in Close: %s", err.Error())
+	}
+	if err := f.Err(); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	if !deleted {
+		t.Error("Expected deleted to be true but it was false")
+	}
+	expectModelDoesNotExist(t, testModels, models[0])
+
+	// Operations after Close should fail
+	if err := ap.Save(testModels, models[1]).Wait(); err == nil {
+		t.Error("Expected error from Save after Close but got none")
+	}
+}
+
+func TestNewAutoPipelineValidation(t *testing.T) {
+	if _, err := NewAutoPipeline(0, 1); err == nil {
+		t.Error("Expected error with a window of 0 but got none")
+	}
+	if _, err := NewAutoPipeline(time.Millisecond, -1); err == nil {
+		t.Error("Expected error with a negative maxOps but got none")
+	}
+}
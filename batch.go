@@ -0,0 +1,393 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File batch.go contains code related to reading and writing many
+// models of the same type in a single round trip.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+)
+
+// FindByIds finds the models of the given type with the given ids and scans
+// their values into models, which must be a pointer to a slice of models with a
+// type corresponding to the ModelType. All of the commands are sent in a single
+// transaction, so finding many models takes one round trip instead of one per
+// model. FindByIds sets the length of models to len(ids), reusing any non-nil
+// elements and allocating new ones as needed, and the model at each index
+// corresponds to the id at the same index. If there is no model with some id,
+// the element at that index is set to nil instead of returning an error.
+// FindByIds returns an error if models is the wrong type or if there was a
+// problem connecting to the database.
+func (mt *ModelType) FindByIds(ids []string, models interface{}) error {
+	return runOp(&Op{Kind: FindByIdsOp, ModelName: mt.Name(), Ids: ids, Models: models}, func() error {
+		mt.recordAccess(ids...)
+		t := mt.newReadTransaction()
+		t.FindByIds(mt, ids, models)
+		return t.Exec()
+	})
+}
+
+// FindByIds finds the models of the given type with the given ids and scans
+// their values into models in an existing transaction. See
+// ModelType.FindByIds. Any errors encountered will be added to the transaction
+// and returned as an error when the transaction is executed.
+func (t *Transaction) FindByIds(mt *ModelType, ids []string, models interface{}) {
+	if err := mt.checkModelsType(models); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in FindByIds or Transaction.FindByIds: %s", err.Error()))
+		return
+	}
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in FindByIds or Transaction.FindByIds: %s", err.Error()))
+		return
+	}
+	modelsVal := reflect.ValueOf(models).Elem()
+	if modelsVal.Kind() != reflect.Slice {
+		t.setError(fmt.Errorf("zoom: Error in FindByIds or Transaction.FindByIds: models should be a pointer to a slice"))
+		return
+	}
+	// Grow or shrink the slice so that it has one element for each id
+	if modelsVal.Len() > len(ids) {
+		modelsVal.SetLen(len(ids))
+	}
+	for modelsVal.Len() < len(ids) {
+		modelsVal.Set(reflect.Append(modelsVal, reflect.Zero(mt.spec.typ)))
+	}
+	collectionFields := mt.spec.collectionFields(mt.spec.fieldNames())
+	for i, id := range ids {
+		if id == "" {
+			t.setError(fmt.Errorf("zoom: Error in FindByIds or Transaction.FindByIds: id at index %d was empty", i))
+			return
+		}
+		if modelsVal.Index(i).IsNil() {
+			modelsVal.Index(i).Set(reflect.New(mt.spec.typ.Elem()))
+		}
+		model := modelsVal.Index(i).Interface().(Model)
+		model.SetId(id)
+		mr := &modelRef{
+			spec:  mt.spec,
+			model: model,
+		}
+		fieldNames, args := mr.findArgs()
+		t.Command("HMGET", args, newScanModelOrNilHandler(fieldNames, mr, modelsVal.Index(i)))
+		for _, fs := range collectionFields {
+			t.findCollectionField(mr, fs)
+		}
+	}
+}
+
+// newScanModelOrNilHandler is like newScanModelHandler, but instead of returning
+// a ModelNotFoundError when the model does not exist, it sets dest to nil.
+func newScanModelOrNilHandler(fieldNames []string, mr *modelRef, dest reflect.Value) ReplyHandler {
+	scanModel := newScanModelHandler(fieldNames, mr)
+	return func(reply interface{}) error {
+		if err := scanModel(reply); err != nil {
+			if _, notFound := err.(ModelNotFoundError); notFound {
+				dest.Set(reflect.Zero(dest.Type()))
+				return nil
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// SaveAll writes models to the database in a single transaction, so saving many
+// models takes one round trip instead of one per model (see the package-level
+// SaveAll function for models of different types). models must be a slice of
+// models with a type corresponding to the ModelType (or a pointer to one), e.g.
+// []*Person. All of the models, including any field indexes and fields stored
+// outside of the main hash, are saved atomically using MULTI/EXEC, so either all
+// of them are saved or none of them are. Note that types which need to read from
+// the database before saving (e.g. types with unique fields or transitions)
+// still take an extra round trip for each model. SaveAll returns an error if
+// models is the wrong type or if there was a problem connecting to the
+// database.
+func (mt *ModelType) SaveAll(models interface{}) error {
+	return runOp(&Op{Kind: SaveAllOp, ModelName: mt.Name(), Models: models}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.SaveAll(mt, models)
+		return t.Exec()
+	})
+}
+
+// SaveAll writes models to the database in an existing transaction. See
+// ModelType.SaveAll. Any errors encountered will be added to the transaction and
+// returned as an error when the transaction is executed.
+func (t *Transaction) SaveAll(mt *ModelType, models interface{}) {
+	modelsVal := reflect.ValueOf(models)
+	if modelsVal.Kind() == reflect.Ptr {
+		modelsVal = modelsVal.Elem()
+	}
+	if !modelsVal.IsValid() || !typeIsSliceOrArray(modelsVal.Type()) || modelsVal.Type().Elem() != mt.spec.typ {
+		t.setError(fmt.Errorf("zoom: Error in SaveAll or Transaction.SaveAll: models should be a slice of %s but got %T", mt.spec.typ.String(), models))
+		return
+	}
+	for i := 0; i < modelsVal.Len(); i++ {
+		if modelsVal.Index(i).IsNil() {
+			t.setError(fmt.Errorf("zoom: Error in SaveAll or Transaction.SaveAll: model at index %d was nil", i))
+			return
+		}
+		t.Save(mt, modelsVal.Index(i).Interface().(Model))
+	}
+}
+
+// DeleteByIds removes the models of the given type with the given ids from the
+// database in a single transaction, including any field indexes and fields
+// stored outside of the main hash, so deleting many models takes one round trip
+// instead of one per model. The returned slice has one element for each id,
+// which is true iff a model with that id existed and was deleted. Like Delete,
+// DeleteByIds does not return an error for ids which do not exist, and only
+// returns an error if there was a problem connecting to the database.
+func (mt *ModelType) DeleteByIds(ids []string) ([]bool, error) {
+	deleted := make([]bool, len(ids))
+	err := runOp(&Op{Kind: DeleteByIdsOp, ModelName: mt.Name(), Ids: ids}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.DeleteByIds(mt, ids, deleted)
+		return t.Exec()
+	})
+	return deleted, err
+}
+
+// DeleteByIds removes the models of the given type with the given ids in an
+// existing transaction. deleted must have the same length as ids, and each
+// element will be set to true iff the model with the corresponding id was
+// deleted when the transaction is executed. See ModelType.DeleteByIds. Any
+// errors encountered will be added to the transaction and returned as an error
+// when the transaction is executed.
+func (t *Transaction) DeleteByIds(mt *ModelType, ids []string, deleted []bool) {
+	if len(deleted) != len(ids) {
+		t.setError(fmt.Errorf("zoom: Error in DeleteByIds or Transaction.DeleteByIds: len(deleted) was %d but len(ids) was %d", len(deleted), len(ids)))
+		return
+	}
+	for i, id := range ids {
+		if id == "" {
+			t.setError(fmt.Errorf("zoom: Error in DeleteByIds or Transaction.DeleteByIds: id at index %d was empty", i))
+			return
+		}
+		t.Delete(mt, id, &deleted[i])
+	}
+}
+
+// ScanFindAll is a ModelOption which causes ModelType.FindAll to read the ids
+// of all models of the given type incrementally with SSCAN, and find the models
+// batchSize at a time (see FindByIds), instead of finding every model with a
+// single SORT command. A single command for a type with millions of models can
+// block the database for a long time, during which other clients have to wait.
+// With this option, each command only does a small amount of work, at the cost
+// of more round trips. Since the models are not found atomically, models which
+// are saved or deleted while FindAll is running may or may not be included.
+// Transaction.FindAll is not affected by this option.
+func ScanFindAll(batchSize int) ModelOption {
+	return func(spec *modelSpec) error {
+		if batchSize <= 0 {
+			return fmt.Errorf("zoom: ScanFindAll batchSize must be positive but got %d", batchSize)
+		}
+		spec.scanBatchSize = batchSize
+		return nil
+	}
+}
+
+// scanAll finds all models of the given type and scans them into models, using
+// SSCAN to get the ids in batches. See ScanFindAll.
+func (mt *ModelType) scanAll(models interface{}) error {
+	if err := mt.checkModelsType(models); err != nil {
+		return fmt.Errorf("zoom: Error in FindAll: %s", err.Error())
+	}
+	modelsVal := reflect.ValueOf(models).Elem()
+	if modelsVal.Kind() != reflect.Slice {
+		return fmt.Errorf("zoom: Error in FindAll: models should be a pointer to a slice")
+	}
+	results := reflect.MakeSlice(modelsVal.Type(), 0, 0)
+	// SSCAN may return the same id more than once
+	seen := map[string]bool{}
+	if err := mt.scanBatches(mt.spec.scanBatchSize, func(batch reflect.Value) error {
+		for i := 0; i < batch.Len(); i++ {
+			model := batch.Index(i)
+			if id := model.Interface().(Model).Id(); !seen[id] {
+				seen[id] = true
+				results = reflect.Append(results, model)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("zoom: Error in FindAll: %s", err.Error())
+	}
+	modelsVal.Set(results)
+	return nil
+}
+
+// scanIds gets the ids of all models of the given type batchSize at a time,
+// using SSCAN, and calls fn with each batch. SSCAN may return the same id more
+// than once, so fn may be called with the same id more than once. If fn returns
+// an error, scanIds stops and returns it.
+func (mt *ModelType) scanIds(batchSize int, fn func(ids []string) error) error {
+	cursor := "0"
+	for {
+		var ids []string
+		t := mt.newReadTransaction()
+		t.Command("SSCAN", redis.Args{mt.AllIndexKey(), cursor, "COUNT", batchSize}, func(reply interface{}) error {
+			values, err := redis.Values(reply, nil)
+			if err != nil {
+				return err
+			}
+			_, err = redis.Scan(values, &cursor, &ids)
+			return err
+		})
+		if err := t.Exec(); err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := fn(ids); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// scanBatches finds all models of the given type batchSize at a time, using
+// SSCAN to get the ids, and calls fn with each batch. batch is a slice of
+// models of the given type which does not include models that were deleted
+// after their ids were scanned. SSCAN may return the same id more than once, so
+// fn may be called with the same model more than once. If fn returns an error,
+// scanBatches stops and returns it.
+func (mt *ModelType) scanBatches(batchSize int, fn func(batch reflect.Value) error) error {
+	return mt.scanIds(batchSize, func(ids []string) error {
+		found := reflect.New(reflect.SliceOf(mt.spec.typ))
+		t := mt.newReadTransaction()
+		t.FindByIds(mt, ids, found.Interface())
+		if err := t.Exec(); err != nil {
+			return err
+		}
+		return fn(withoutNilModels(found.Elem()))
+	})
+}
+
+// withoutNilModels returns a slice with the same elements as models, except for
+// any which are nil, e.g. because the model was deleted after its id was read.
+func withoutNilModels(models reflect.Value) reflect.Value {
+	results := reflect.MakeSlice(models.Type(), 0, models.Len())
+	for i := 0; i < models.Len(); i++ {
+		if model := models.Index(i); !model.IsNil() {
+			results = reflect.Append(results, model)
+		}
+	}
+	return results
+}
+
+// FindAllFields is like FindAll, but only the fields with the given names are
+// read from the database and scanned into models, which can greatly reduce the
+// amount of data sent over the network for models with many or large fields,
+// e.g. for a list view which only shows a few of them. Instead of using SORT to
+// get every field of every model, it reads the ids first and then sends one
+// HMGET per model, naming just the given fields, in a single transaction (or
+// one transaction per batch if the type uses the ScanFindAll option). The
+// models are not sorted in any particular order.
+//
+// Fields which are not named are left with their zero values. If the type
+// embeds DefaultData, they are treated like lazy fields which were not loaded
+// (see LoadField): saving one of the models does not write them unless they
+// were given a value other than the zero value, so their values in the
+// database are kept. At least one of the fields must be stored in the main
+// hash. FindAllFields returns an error if models is the wrong type, if
+// any of the field names do not exist, or if there was a problem connecting to
+// the database.
+func (mt *ModelType) FindAllFields(models interface{}, fieldNames ...string) error {
+	return runOp(&Op{Kind: FindAllOp, ModelName: mt.Name(), Models: models}, func() error {
+		if err := mt.checkModelsType(models); err != nil {
+			return fmt.Errorf("zoom: Error in FindAllFields: %s", err.Error())
+		}
+		modelsVal := reflect.ValueOf(models).Elem()
+		if modelsVal.Kind() != reflect.Slice {
+			return fmt.Errorf("zoom: Error in FindAllFields: models should be a pointer to a slice")
+		}
+		for _, name := range fieldNames {
+			if _, found := mt.spec.fieldsByName[name]; !found {
+				return fmt.Errorf("zoom: Error in FindAllFields: %s has no field named %s", mt.Name(), name)
+			}
+		}
+		if len(mt.spec.hashFieldNames(fieldNames)) == 0 {
+			return fmt.Errorf("zoom: Error in FindAllFields: at least one of the fields must be stored in the main hash")
+		}
+		results := reflect.MakeSlice(modelsVal.Type(), 0, 0)
+		findIds := func(ids []string) error {
+			found := reflect.MakeSlice(modelsVal.Type(), len(ids), len(ids))
+			t := mt.newReadTransaction()
+			mt.spec.findBatch(t, fieldNames, ids, found)
+			if err := t.Exec(); err != nil {
+				return err
+			}
+			found = withoutNilModels(found)
+			for i := 0; i < found.Len(); i++ {
+				mr := &modelRef{spec: mt.spec, model: found.Index(i).Interface().(Model)}
+				mr.setUnloadedFieldsExcept(fieldNames)
+			}
+			results = reflect.AppendSlice(results, found)
+			return nil
+		}
+		if mt.spec.scanBatchSize > 0 {
+			// SSCAN may return the same id more than once
+			seen := map[string]bool{}
+			if err := mt.scanIds(mt.spec.scanBatchSize, func(ids []string) error {
+				unseen := []string{}
+				for _, id := range ids {
+					if !seen[id] {
+						seen[id] = true
+						unseen = append(unseen, id)
+					}
+				}
+				return findIds(unseen)
+			}); err != nil {
+				return fmt.Errorf("zoom: Error in FindAllFields: %s", err.Error())
+			}
+		} else {
+			var ids []string
+			t := mt.newReadTransaction()
+			t.Command("SMEMBERS", redis.Args{mt.AllIndexKey()}, newScanStringsHandler(&ids))
+			if err := t.Exec(); err != nil {
+				return fmt.Errorf("zoom: Error in FindAllFields: %s", err.Error())
+			}
+			if err := findIds(ids); err != nil {
+				return fmt.Errorf("zoom: Error in FindAllFields: %s", err.Error())
+			}
+		}
+		modelsVal.Set(results)
+		return nil
+	})
+}
+
+// findBatch adds commands to t which find the models with the given ids and
+// scan the fields with the given names into the corresponding elements of dest,
+// which must be a slice with the same length as ids. Only the fields in
+// fieldNames are read, using HMGET for the fields in the main hash. Elements
+// for models which do not exist are set to nil.
+func (ms *modelSpec) findBatch(t *Transaction, fieldNames []string, ids []string, dest reflect.Value) {
+	hashFieldNames := ms.hashFieldNames(ms.withVersion(fieldNames))
+	redisNames := ms.redisNames(hashFieldNames)
+	collectionFields := ms.collectionFields(fieldNames)
+	for i, id := range ids {
+		modelVal := reflect.New(ms.typ.Elem())
+		dest.Index(i).Set(modelVal)
+		model := modelVal.Interface().(Model)
+		model.SetId(id)
+		mr := &modelRef{
+			spec:  ms,
+			model: model,
+		}
+		args := redis.Args{mr.key()}
+		for _, name := range redisNames {
+			args = append(args, name)
+		}
+		t.Command("HMGET", args, newScanModelOrNilHandler(hashFieldNames, mr, dest.Index(i)))
+		for _, fs := range collectionFields {
+			t.findCollectionField(mr, fs)
+		}
+	}
+}
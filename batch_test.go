@@ -0,0 +1,203 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File batch_test.go tests the code in batch.go.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindByIds(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveTestModels(3)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	// The order of ids should be preserved and missing models should be nil.
+	// Start with a longer slice to make sure it is trimmed.
+	got := make([]*testModel, 5)
+	ids := []string{models[2].Id(), "doesNotExist", models[0].Id()}
+	if err := testModels.FindByIds(ids, &got); err != nil {
+		t.Fatalf("Unexpected error in FindByIds: %s", err.Error())
+	}
+	expected := []*testModel{models[2], nil, models[0]}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Wrong result from FindByIds.\n\tExpected: %#v\n\tBut got:  %#v", expected, got)
+	}
+
+	if err := testModels.FindByIds([]string{""}, &got); err == nil {
+		t.Error("Expected an error in FindByIds for an empty id")
+	}
+	if err := testModels.FindByIds(ids, &[]*indexedTestModel{}); err == nil {
+		t.Error("Expected an error in FindByIds for the wrong type of models")
+	}
+}
+
+func TestModelTypeSaveAll(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models := createTestModels(3)
+	if err := testModels.SaveAll(models); err != nil {
+		t.Fatalf("Unexpected error in SaveAll: %s", err.Error())
+	}
+	for _, model := range models {
+		if model.Id() == "" {
+			t.Error("Expected SaveAll to set the id of each model")
+		}
+		expectModelExists(t, testModels, model)
+	}
+
+	// Nothing should be saved if any of the models is invalid
+	invalid := []*testModel{createTestModels(1)[0], nil}
+	if err := testModels.SaveAll(invalid); err == nil {
+		t.Error("Expected an error in SaveAll for a nil model")
+	}
+	expectModelDoesNotExist(t, testModels, invalid[0])
+	if err := testModels.SaveAll([]*indexedTestModel{}); err == nil {
+		t.Error("Expected an error in SaveAll for the wrong type of models")
+	}
+}
+
+func TestDeleteByIds(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveTestModels(3)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	deleted, err := testModels.DeleteByIds([]string{models[0].Id(), "doesNotExist", models[2].Id()})
+	if err != nil {
+		t.Fatalf("Unexpected error in DeleteByIds: %s", err.Error())
+	}
+	if expected := []bool{true, false, true}; !reflect.DeepEqual(expected, deleted) {
+		t.Errorf("Expected deleted to be %v but got %v", expected, deleted)
+	}
+	expectModelDoesNotExist(t, testModels, models[0])
+	expectModelExists(t, testModels, models[1])
+	expectModelDoesNotExist(t, testModels, models[2])
+
+	if _, err := testModels.DeleteByIds([]string{models[1].Id(), ""}); err == nil {
+		t.Error("Expected an error in DeleteByIds for an empty id")
+	}
+	expectModelExists(t, testModels, models[1])
+}
+
+type scannedModel struct {
+	Int int
+	DefaultData
+}
+
+func TestScanFindAll(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	mt := registerTestType(t, &scannedModel{}, ScanFindAll(2))
+
+	// Use more models than the batch size so that more than one batch is needed
+	expected := map[string]int{}
+	for i := 0; i < 7; i++ {
+		model := &scannedModel{Int: i}
+		if err := mt.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		expected[model.Id()] = i
+	}
+	// The id of a model which no longer exists should be skipped
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("SADD", mt.AllIndexKey(), "doesNotExist"); err != nil {
+		t.Fatalf("Unexpected error in SADD: %s", err.Error())
+	}
+
+	// Any existing elements should be replaced
+	got := []*scannedModel{{Int: 100}}
+	if err := mt.FindAll(&got); err != nil {
+		t.Fatalf("Unexpected error in FindAll: %s", err.Error())
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d models but got %d", len(expected), len(got))
+	}
+	for _, model := range got {
+		if i, found := expected[model.Id()]; !found {
+			t.Errorf("Unexpected model with id %s", model.Id())
+		} else if model.Int != i {
+			t.Errorf("Expected model %s to have Int %d but got %d", model.Id(), i, model.Int)
+		}
+	}
+
+	// FindAllFields should also find the models in batches
+	got = []*scannedModel{}
+	if err := mt.FindAllFields(&got, "Int"); err != nil {
+		t.Fatalf("Unexpected error in FindAllFields: %s", err.Error())
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d models from FindAllFields but got %d", len(expected), len(got))
+	}
+
+	if err := ScanFindAll(0)(&modelSpec{}); err == nil {
+		t.Error("Expected an error in ScanFindAll for a batch size of 0")
+	}
+}
+
+func TestFindAllFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveTestModels(5)
+	if err != nil {
+		t.Fatalf("Unexpected error saving test models: %s", err.Error())
+	}
+	expected := map[string]int{}
+	for _, model := range models {
+		expected[model.Id()] = model.Int
+	}
+	got := []*testModel{}
+	if err := testModels.FindAllFields(&got, "Int"); err != nil {
+		t.Fatalf("Unexpected error in FindAllFields: %s", err.Error())
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d models but got %d", len(expected), len(got))
+	}
+	for _, model := range got {
+		if i, found := expected[model.Id()]; !found {
+			t.Errorf("Unexpected model with id %s", model.Id())
+		} else if model.Int != i {
+			t.Errorf("Expected model %s to have Int %d but got %d", model.Id(), i, model.Int)
+		}
+		if model.String != "" || model.Bool {
+			t.Errorf("Expected only Int to be scanned but got %+v", model)
+		}
+	}
+
+	// Saving a partly loaded model should not overwrite the other fields
+	partial := got[0]
+	partial.Int++
+	if err := testModels.Save(partial); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	var original *testModel
+	for _, model := range models {
+		if model.Id() == partial.Id() {
+			original = model
+		}
+	}
+	saved := &testModel{}
+	if err := testModels.Find(partial.Id(), saved); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if saved.Int != original.Int+1 || saved.String != original.String || saved.Bool != original.Bool {
+		t.Errorf("Expected only Int to change after Save.\nOriginal: %+v\nGot:      %+v", original, saved)
+	}
+
+	if err := testModels.FindAllFields(&got, "NotAField"); err == nil {
+		t.Error("Expected an error in FindAllFields for a field which does not exist")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File benchmark_baseline_test.go contains code for comparing the results
+// of the benchmarks which do not connect to the database to a baseline, so
+// that performance regressions can be caught.
+
+package zoom
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	baselineFile      *string  = flag.String("baseline", "", "a file with the output of 'go test -bench . -benchmem' to compare the serialization benchmarks to")
+	writeBaseline     *bool    = flag.Bool("writeBaseline", false, "write the results of the serialization benchmarks to the -baseline file instead of comparing them")
+	baselineTolerance *float64 = flag.Float64("baselineTolerance", 0.25, "the fraction by which ns/op may exceed the baseline before it is considered a regression")
+)
+
+// serializationBenchmarks are the benchmarks which are compared to the
+// baseline. They do not connect to the database, so their results are stable
+// enough to compare between runs.
+var serializationBenchmarks = map[string]func(*testing.B){
+	"BenchmarkHashArgsSmall":      BenchmarkHashArgsSmall,
+	"BenchmarkHashArgsWide":       BenchmarkHashArgsWide,
+	"BenchmarkHashArgsRelations":  BenchmarkHashArgsRelations,
+	"BenchmarkScanModelSmall":     BenchmarkScanModelSmall,
+	"BenchmarkScanModelWide":      BenchmarkScanModelWide,
+	"BenchmarkScanModelRelations": BenchmarkScanModelRelations,
+}
+
+// benchmarkResult holds the numbers from a single benchmark which are compared
+// to the baseline.
+type benchmarkResult struct {
+	nsPerOp     float64
+	allocsPerOp int64
+}
+
+// TestBenchmarkBaseline runs the serialization benchmarks and compares them to
+// the results in the -baseline file. It is skipped unless -baseline is given.
+// To record a new baseline, run:
+//
+//	go test . -run=BenchmarkBaseline -baseline=baseline.txt -writeBaseline
+//
+// The output of 'go test . -run=none -bench . -benchmem' can also be used as a
+// baseline. Since ns/op depends on the machine, a baseline should only be
+// compared to results from the same machine.
+func TestBenchmarkBaseline(t *testing.T) {
+	if *baselineFile == "" {
+		t.Skip("Skipping because -baseline was not given")
+	}
+	current := map[string]benchmarkResult{}
+	lines := []string{}
+	for name, benchmark := range serializationBenchmarks {
+		result := testing.Benchmark(benchmark)
+		current[name] = benchmarkResult{
+			nsPerOp:     float64(result.T.Nanoseconds()) / float64(result.N),
+			allocsPerOp: result.AllocsPerOp(),
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s", name, result.String(), result.MemString()))
+	}
+	if *writeBaseline {
+		if err := writeLines(*baselineFile, lines); err != nil {
+			t.Fatalf("Unexpected error writing baseline: %s", err.Error())
+		}
+		return
+	}
+	f, err := os.Open(*baselineFile)
+	if err != nil {
+		t.Fatalf("Unexpected error opening baseline: %s", err.Error())
+	}
+	defer f.Close()
+	baseline, err := parseBenchmarkResults(f)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing baseline: %s", err.Error())
+	}
+	for _, regression := range compareBenchmarkResults(baseline, current, *baselineTolerance) {
+		t.Error(regression)
+	}
+}
+
+// writeLines writes each line to a new file with the given name.
+func writeLines(filename string, lines []string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// parseBenchmarkResults parses the output of 'go test -bench' and returns the
+// results for each benchmark. The suffix for GOMAXPROCS (e.g. "-8") is removed
+// from the name of each benchmark, and any lines which are not benchmark
+// results are ignored.
+func parseBenchmarkResults(r io.Reader) (map[string]benchmarkResult, error) {
+	results := map[string]benchmarkResult{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := fields[0]
+		if i := strings.LastIndex(name, "-"); i != -1 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+		result := benchmarkResult{}
+		// The fields after the number of iterations are pairs of values and units
+		for i := 2; i+1 < len(fields); i += 2 {
+			var err error
+			switch fields[i+1] {
+			case "ns/op":
+				result.nsPerOp, err = strconv.ParseFloat(fields[i], 64)
+			case "allocs/op":
+				result.allocsPerOp, err = strconv.ParseInt(fields[i], 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("could not parse result for %s: %s", name, err.Error())
+			}
+		}
+		results[name] = result
+	}
+	return results, scanner.Err()
+}
+
+// compareBenchmarkResults returns a message for each benchmark in current which
+// is slower than the same benchmark in baseline by more than the given fraction,
+// or which allocates more. Benchmarks which are not in baseline are ignored.
+func compareBenchmarkResults(baseline map[string]benchmarkResult, current map[string]benchmarkResult, tolerance float64) []string {
+	regressions := []string{}
+	for name, got := range current {
+		expected, found := baseline[name]
+		if !found {
+			continue
+		}
+		if got.nsPerOp > expected.nsPerOp*(1+tolerance) {
+			regressions = append(regressions, fmt.Sprintf("%s took %.0f ns/op but the baseline was %.0f ns/op", name, got.nsPerOp, expected.nsPerOp))
+		}
+		// Allocations do not depend on the machine, so any increase is a
+		// regression
+		if got.allocsPerOp > expected.allocsPerOp {
+			regressions = append(regressions, fmt.Sprintf("%s made %d allocs/op but the baseline was %d allocs/op", name, got.allocsPerOp, expected.allocsPerOp))
+		}
+	}
+	return regressions
+}
+
+func TestCompareBenchmarkResults(t *testing.T) {
+	output := `goos: linux
+goarch: amd64
+BenchmarkHashArgsSmall-8   	 2000000	       612 ns/op	     160 B/op	       6 allocs/op
+BenchmarkScanModelSmall    	 1000000	      1043 ns/op
+PASS
+`
+	baseline, err := parseBenchmarkResults(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("Unexpected error in parseBenchmarkResults: %s", err.Error())
+	}
+	expected := map[string]benchmarkResult{
+		"BenchmarkHashArgsSmall":  {nsPerOp: 612, allocsPerOp: 6},
+		"BenchmarkScanModelSmall": {nsPerOp: 1043},
+	}
+	if len(baseline) != len(expected) {
+		t.Fatalf("Expected %d results but got %d: %v", len(expected), len(baseline), baseline)
+	}
+	for name, result := range expected {
+		if baseline[name] != result {
+			t.Errorf("Expected result for %s to be %v but got %v", name, result, baseline[name])
+		}
+	}
+
+	current := map[string]benchmarkResult{
+		// Within the tolerance
+		"BenchmarkHashArgsSmall": {nsPerOp: 700, allocsPerOp: 6},
+		// Too slow and allocates more
+		"BenchmarkScanModelSmall": {nsPerOp: 2000, allocsPerOp: 1},
+		// Not in the baseline
+		"BenchmarkScanModelWide": {nsPerOp: 5000, allocsPerOp: 50},
+	}
+	if regressions := compareBenchmarkResults(baseline, current, 0.25); len(regressions) != 2 {
+		t.Errorf("Expected 2 regressions but got %d: %v", len(regressions), regressions)
+	}
+}
@@ -8,6 +8,7 @@ package zoom
 
 import (
 	"math/rand"
+	"reflect"
 	"testing"
 )
 
@@ -545,3 +546,228 @@ func selectUnique(num int, ids []string) []string {
 	}
 	return results
 }
+
+// wideModel is a model with many fields, used to benchmark the cost of
+// converting each field
+type wideModel struct {
+	Int1, Int2, Int3, Int4, Int5, Int6, Int7, Int8                int
+	String1, String2, String3, String4, String5, String6, String7 string
+	Bool1, Bool2, Bool3, Bool4                                    bool
+	Float1, Float2, Float3, Float4                                float64
+	Indexed                                                       int `zoom:"index"`
+	DefaultData
+}
+
+func createWideModels(n int) []*wideModel {
+	models := make([]*wideModel, n)
+	for i := range models {
+		models[i] = &wideModel{
+			Int1: randomInt(), Int2: randomInt(), Int3: randomInt(), Int4: randomInt(),
+			Int5: randomInt(), Int6: randomInt(), Int7: randomInt(), Int8: randomInt(),
+			String1: randomString(), String2: randomString(), String3: randomString(),
+			String4: randomString(), String5: randomString(), String6: randomString(),
+			String7: randomString(),
+			Bool1:   randomBool(), Bool2: randomBool(), Bool3: randomBool(), Bool4: randomBool(),
+			Float1: randomFloat(), Float2: randomFloat(), Float3: randomFloat(), Float4: randomFloat(),
+			Indexed: randomInt(),
+		}
+	}
+	return models
+}
+
+// relationModel is a model which refers to many other models, used to
+// benchmark the cost of fields which are stored outside of the main hash or
+// which need to be marshaled
+type relationModel struct {
+	Name      string
+	FriendIds []string `redisType:"list"`
+	GroupIds  []string `redisType:"set"`
+	Roles     map[string]string
+	DefaultData
+}
+
+func createRelationModels(n int) []*relationModel {
+	models := make([]*relationModel, n)
+	for i := range models {
+		model := &relationModel{
+			Name:  randomString(),
+			Roles: map[string]string{},
+		}
+		for j := 0; j < 20; j++ {
+			model.FriendIds = append(model.FriendIds, generateRandomId())
+			model.GroupIds = append(model.GroupIds, generateRandomId())
+			model.Roles[generateRandomId()] = randomString()
+		}
+		models[i] = model
+	}
+	return models
+}
+
+// registerBenchmarkModels registers wideModel and relationModel for the
+// duration of the benchmark
+func registerBenchmarkModels(b *testing.B) (wideModels *ModelType, relationModels *ModelType) {
+	return registerTestType(b, &wideModel{}), registerTestType(b, &relationModel{})
+}
+
+// BenchmarkSaveWide saves a single model with many fields
+func BenchmarkSaveWide(b *testing.B) {
+	testingSetUp()
+	defer testingTearDown()
+	wideModels, _ := registerBenchmarkModels(b)
+
+	model := createWideModels(1)[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := wideModels.Save(model); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFindWide finds a single model with many fields
+func BenchmarkFindWide(b *testing.B) {
+	testingSetUp()
+	defer testingTearDown()
+	wideModels, _ := registerBenchmarkModels(b)
+
+	model := createWideModels(1)[0]
+	if err := wideModels.Save(model); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := wideModels.Find(model.Id(), &wideModel{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkQueryWide100 runs a query which returns 100 models with many
+// fields, ordered by an indexed field
+func BenchmarkQueryWide100(b *testing.B) {
+	testingSetUp()
+	defer testingTearDown()
+	wideModels, _ := registerBenchmarkModels(b)
+
+	if err := wideModels.SaveAll(createWideModels(100)); err != nil {
+		b.Fatal(err)
+	}
+	q := wideModels.NewQuery().Order("Indexed")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := q.Run(&[]*wideModel{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSaveRelations saves a single model with list, set, and map fields
+func BenchmarkSaveRelations(b *testing.B) {
+	testingSetUp()
+	defer testingTearDown()
+	_, relationModels := registerBenchmarkModels(b)
+
+	model := createRelationModels(1)[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := relationModels.Save(model); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFindRelations finds a single model with list, set, and map fields
+func BenchmarkFindRelations(b *testing.B) {
+	testingSetUp()
+	defer testingTearDown()
+	_, relationModels := registerBenchmarkModels(b)
+
+	model := createRelationModels(1)[0]
+	if err := relationModels.Save(model); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := relationModels.Find(model.Id(), &relationModel{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The following benchmarks do not connect to the database, so they only
+// measure the reflection and serialization layers and give stable results
+// which can be compared to a baseline (see benchmark_baseline_test.go).
+
+func BenchmarkHashArgsSmall(b *testing.B) {
+	benchmarkHashArgs(b, createTestModels(1)[0])
+}
+
+func BenchmarkHashArgsWide(b *testing.B) {
+	benchmarkHashArgs(b, createWideModels(1)[0])
+}
+
+func BenchmarkHashArgsRelations(b *testing.B) {
+	benchmarkHashArgs(b, createRelationModels(1)[0])
+}
+
+func BenchmarkScanModelSmall(b *testing.B) {
+	benchmarkScanModel(b, createTestModels(1)[0])
+}
+
+func BenchmarkScanModelWide(b *testing.B) {
+	benchmarkScanModel(b, createWideModels(1)[0])
+}
+
+func BenchmarkScanModelRelations(b *testing.B) {
+	benchmarkScanModel(b, createRelationModels(1)[0])
+}
+
+// benchmarkModelRef returns a modelRef for model with a spec which is compiled
+// without registering the type
+func benchmarkModelRef(b *testing.B, model Model) *modelRef {
+	spec, err := compileModelSpec(reflect.TypeOf(model))
+	if err != nil {
+		b.Fatal(err)
+	}
+	model.SetId(generateRandomId())
+	return &modelRef{model: model, spec: spec}
+}
+
+// benchmarkHashArgs benchmarks converting model to the args for HMSET
+func benchmarkHashArgs(b *testing.B, model Model) {
+	mr := benchmarkModelRef(b, model)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := mr.mainHashArgs(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkScanModel benchmarks scanning a reply from HMGET into a model of
+// the same type as model
+func benchmarkScanModel(b *testing.B, model Model) {
+	mr := benchmarkModelRef(b, model)
+	fieldNames := mr.spec.hashFieldNames(mr.spec.fieldNames())
+	fieldValues := make([]interface{}, len(fieldNames))
+	for i, name := range fieldNames {
+		value, err := mr.hashValue(mr.spec.fieldsByName[name])
+		if err != nil {
+			b.Fatal(err)
+		}
+		// Replies from redis are always bulk strings
+		fieldValues[i] = []byte(redisArgString(value))
+	}
+	dest := &modelRef{
+		model: reflect.New(mr.spec.typ.Elem()).Interface().(Model),
+		spec:  mr.spec,
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := scanModel(fieldNames, fieldValues, dest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
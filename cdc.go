@@ -0,0 +1,105 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File cdc.go contains code related to exporting the changelog for
+// a type to external systems (change data capture).
+
+package zoom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ChangeSink is implemented by anything which can receive the changes to models
+// exported with ModelType.ExportChanges, e.g. a Kafka producer or a NATS
+// connection. zoom does not depend on any particular message broker, so a sink
+// for one can be written in a few lines. For example, a sink which publishes
+// each event to a NATS subject might look like this:
+//
+//	type natsSink struct {
+//		conn *nats.Conn
+//	}
+//
+//	func (s natsSink) Send(event zoom.ChangeEvent) error {
+//		data, err := json.Marshal(event)
+//		if err != nil {
+//			return err
+//		}
+//		return s.conn.Publish("changes."+event.ModelName, data)
+//	}
+//
+// Send may be called more than once for the same event (see
+// ModelType.ConsumeChanges), so the receiving system should tolerate
+// duplicates, e.g. by using event.StreamId to detect them.
+type ChangeSink interface {
+	// Send delivers event to the external system. It should only return nil
+	// once the event has been durably accepted. If it returns an error, the
+	// event will be sent again later.
+	Send(event ChangeEvent) error
+}
+
+// ChangeSinkFunc is an adapter which allows an ordinary function to be used as a
+// ChangeSink.
+type ChangeSinkFunc func(event ChangeEvent) error
+
+// Send calls f(event).
+func (f ChangeSinkFunc) Send(event ChangeEvent) error {
+	return f(event)
+}
+
+// jsonSink is a ChangeSink which writes each event to w as a line of JSON.
+type jsonSink struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// jsonSinkRecord is the format of each line written by a jsonSink. Unlike
+// ChangeEvent, it includes the StreamId.
+type jsonSinkRecord struct {
+	ChangeEvent
+	StreamId string `json:"streamId"`
+}
+
+// NewJSONSink returns a ChangeSink which writes each event to w as a single
+// line of JSON, with the same fields as a published ChangeEvent plus
+// "streamId". It can be used to pipe changes into command line tools, or to a
+// file which is shipped to some other system. It is safe to use the same sink
+// with more than one exporter.
+func NewJSONSink(w io.Writer) ChangeSink {
+	return &jsonSink{w: w}
+}
+
+// Send writes event to s.w as a line of JSON.
+func (s *jsonSink) Send(event ChangeEvent) error {
+	data, err := json.Marshal(jsonSinkRecord{ChangeEvent: event, StreamId: event.StreamId})
+	if err != nil {
+		return fmt.Errorf("zoom: Error encoding ChangeEvent: %s", err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// ExportChanges starts forwarding the entries in the changelog for the given
+// type to sink, so that models stored in the database can feed downstream data
+// pipelines. It uses a consumer group with the given group and consumer names
+// (see ConsumeChanges), so an entry is only acknowledged once sink.Send returns
+// nil, and entries which could not be sent are sent again later. Exporters for
+// the same sink should share a group name, and each exporter for a different
+// sink should use its own group. The type must use the StreamChanges option.
+// The exporter runs until Close is called on the returned ChangeConsumer.
+func (mt *ModelType) ExportChanges(group string, consumer string, sink ChangeSink) (*ChangeConsumer, error) {
+	if sink == nil {
+		return nil, fmt.Errorf("zoom: Error in ExportChanges: sink cannot be nil")
+	}
+	c, err := mt.ConsumeChanges(group, consumer, sink.Send)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ExportChanges: %s", err.Error())
+	}
+	return c, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File cdc_test.go tests the code in cdc.go.
+
+package zoom
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJSONSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewJSONSink(buf)
+	event := ChangeEvent{
+		ModelName: "person",
+		Id:        "abc",
+		Kind:      SaveOp,
+		Fields:    []string{"Name"},
+		StreamId:  "1-0",
+	}
+	if err := sink.Send(event); err != nil {
+		t.Fatalf("Unexpected error in Send: %s", err.Error())
+	}
+	expected := `{"model":"person","id":"abc","op":"Save","fields":["Name"],"streamId":"1-0"}` + "\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("Wrong output.\n\tExpected: %s\tBut got:  %s", expected, got)
+	}
+}
+
+func TestExportChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, StreamChanges(StreamOptions{}))
+
+	// The sink fails the first time, so the event should be sent again
+	originalMinIdleTime := consumerMinIdleTime
+	consumerMinIdleTime = 10 * time.Millisecond
+	defer func() {
+		consumerMinIdleTime = originalMinIdleTime
+	}()
+	sent := make(chan ChangeEvent, 10)
+	failed := false
+	sink := ChangeSinkFunc(func(event ChangeEvent) error {
+		if !failed {
+			failed = true
+			return errors.New("broker unavailable")
+		}
+		sent <- event
+		return nil
+	})
+	c, err := publishedModels.ExportChanges("export", "exporter", sink)
+	if err != nil {
+		t.Fatalf("Unexpected error in ExportChanges: %s", err.Error())
+	}
+	defer c.Close()
+	model := &publishedModel{Name: "Alice"}
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	select {
+	case event := <-sent:
+		if event.Id != model.Id() || event.Kind != SaveOp || event.StreamId == "" {
+			t.Errorf("Unexpected event: %#v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the event to be exported")
+	}
+
+	if _, err := publishedModels.ExportChanges("export", "exporter", nil); err == nil {
+		t.Error("Expected an error in ExportChanges for a nil sink")
+	}
+}
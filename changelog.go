@@ -0,0 +1,207 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File changelog.go contains code related to recording changes to
+// models in a redis stream.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sort"
+	"strings"
+)
+
+// StreamOptions determines how the changelog for a type is trimmed. See
+// StreamChanges.
+type StreamOptions struct {
+	// MaxLen is the maximum number of entries to keep in the stream. Older
+	// entries are removed as new ones are added. If 0, the stream is never
+	// trimmed.
+	MaxLen int
+	// Approximate causes the stream to be trimmed with "MAXLEN ~", which is
+	// much more efficient but may keep somewhat more than MaxLen entries.
+	Approximate bool
+}
+
+// StreamChanges is a ModelOption which causes every change to a model of the
+// given type to be appended to a redis stream (see
+// http://redis.io/topics/streams-intro) in the same transaction as the change
+// itself. Unlike PublishChanges, the stream gives consumers an ordered log of
+// changes which can be read (or read again) at any time. Each entry has the
+// fields "model", "id", "op", and "fields", which correspond to the fields of
+// ChangeEvent. The "fields" value is a comma-separated list of field names, and
+// is omitted along with "id" when they are empty. Each key in Meta (if any) is
+// stored in a separate field with the prefix "meta:". The key for the stream is
+// returned by ModelType.ChangelogKey. Requires redis version 5.0 or higher.
+func StreamChanges(options StreamOptions) ModelOption {
+	return func(spec *modelSpec) error {
+		if options.MaxLen < 0 {
+			return fmt.Errorf("zoom: StreamOptions.MaxLen cannot be negative but got %d", options.MaxLen)
+		}
+		spec.changelog = &options
+		return nil
+	}
+}
+
+// ChangelogKey returns the key for the stream which holds the changes to models
+// of the given type if the StreamChanges option was used.
+func (mt *ModelType) ChangelogKey() string {
+	return mt.spec.changelogKey()
+}
+
+// changelogKey returns the key for the stream which holds the changes to
+// models of the given type, i.e. zoom:changes:<name> with the KeyPrefix (if
+// any) prepended.
+func (ms *modelSpec) changelogKey() string {
+	return ms.keyPrefix() + "zoom:changes:" + ms.name
+}
+
+// changelogMetaPrefix is prepended to each key in ChangeEvent.Meta to get the
+// name of the field which holds it in a changelog entry.
+const changelogMetaPrefix = "meta:"
+
+// appendChange adds a command to the transaction which appends event to the
+// changelog if models of the given type use the StreamChanges option.
+func (t *Transaction) appendChange(ms *modelSpec, event *ChangeEvent) {
+	if ms.changelog == nil {
+		return
+	}
+	args := redis.Args{ms.changelogKey()}
+	if ms.changelog.MaxLen > 0 {
+		args = args.Add("MAXLEN")
+		if ms.changelog.Approximate {
+			args = args.Add("~")
+		}
+		args = args.Add(ms.changelog.MaxLen)
+	}
+	args = args.Add("*", "model", event.ModelName)
+	if event.Id != "" {
+		args = args.Add("id", event.Id)
+	}
+	args = args.Add("op", string(event.Kind))
+	if len(event.Fields) > 0 {
+		args = args.Add("fields", strings.Join(event.Fields, ","))
+	}
+	metaKeys := make([]string, 0, len(event.Meta))
+	for key := range event.Meta {
+		metaKeys = append(metaKeys, key)
+	}
+	sort.Strings(metaKeys)
+	for _, key := range metaKeys {
+		args = args.Add(changelogMetaPrefix+key, event.Meta[key])
+	}
+	t.Command("XADD", args, nil)
+}
+
+// changelogBatchSize is the number of entries read from the changelog at once.
+const changelogBatchSize = 100
+
+// ReplayChanges calls handler for each entry in the changelog for the given type
+// which was added after the entry with the given id, in order, so that a
+// consumer which was offline can catch up on the changes it missed. If fromId is
+// empty or "0", all the entries in the changelog are replayed. The type must use
+// the StreamChanges option. Consumers should store the StreamId of the last
+// event they handled and use it as fromId the next time. ReplayChanges returns
+// the StreamId of the last event which was handled successfully (or fromId if
+// there were none). If handler returns an error, ReplayChanges stops and returns
+// the error. Note that entries which were trimmed from the stream (see
+// StreamOptions) cannot be replayed.
+func (mt *ModelType) ReplayChanges(fromId string, handler func(ChangeEvent) error) (string, error) {
+	if mt.spec.changelog == nil {
+		return fromId, fmt.Errorf("zoom: Error in ReplayChanges: %s was not registered with the StreamChanges option", mt.Name())
+	}
+	lastId := fromId
+	if lastId == "" {
+		lastId = "0"
+	}
+	conn := mt.spec.pool.NewConn()
+	defer conn.Close()
+	for {
+		reply, err := conn.Do("XREAD", "COUNT", changelogBatchSize, "STREAMS", mt.spec.changelogKey(), lastId)
+		if err != nil {
+			return lastId, fmt.Errorf("zoom: Error in ReplayChanges: %s", err.Error())
+		}
+		if reply == nil {
+			// There are no more entries
+			return lastId, nil
+		}
+		events, err := parseXReadReply(reply)
+		if err != nil {
+			return lastId, fmt.Errorf("zoom: Error in ReplayChanges: %s", err.Error())
+		}
+		if len(events) == 0 {
+			return lastId, nil
+		}
+		for _, event := range events {
+			if err := handler(event); err != nil {
+				return lastId, err
+			}
+			lastId = event.StreamId
+		}
+	}
+}
+
+// parseXReadReply converts the reply from XREAD or XREADGROUP for a single
+// changelog into events.
+func parseXReadReply(reply interface{}) ([]ChangeEvent, error) {
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	// Each stream is a two-element array of its key and its entries
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil || len(stream) != 2 {
+		return nil, fmt.Errorf("unexpected reply from database: %v", streams[0])
+	}
+	entries, err := redis.Values(stream[1], nil)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]ChangeEvent, 0, len(entries))
+	for _, entry := range entries {
+		event, err := parseChangelogEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// parseChangelogEntry converts a single stream entry, which is a two-element
+// array of its id and its fields, into a ChangeEvent.
+func parseChangelogEntry(entry interface{}) (ChangeEvent, error) {
+	event := ChangeEvent{}
+	values, err := redis.Values(entry, nil)
+	if err != nil || len(values) != 2 {
+		return event, fmt.Errorf("unexpected stream entry: %v", entry)
+	}
+	if event.StreamId, err = redis.String(values[0], nil); err != nil {
+		return event, err
+	}
+	fields, err := redis.StringMap(values[1], nil)
+	if err != nil {
+		return event, err
+	}
+	event.ModelName = fields["model"]
+	event.Id = fields["id"]
+	event.Kind = OpKind(fields["op"])
+	if fields["fields"] != "" {
+		event.Fields = strings.Split(fields["fields"], ",")
+	}
+	for name, value := range fields {
+		if strings.HasPrefix(name, changelogMetaPrefix) {
+			if event.Meta == nil {
+				event.Meta = map[string]string{}
+			}
+			event.Meta[strings.TrimPrefix(name, changelogMetaPrefix)] = value
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File changelog_test.go tests the code in changelog.go.
+
+package zoom
+
+import (
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"testing"
+)
+
+func TestStreamChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, StreamChanges(StreamOptions{MaxLen: 2}))
+
+	model := &publishedModel{Name: "Alice"}
+	for _, status := range []string{"new", "active", "inactive"} {
+		model.Status = status
+		if err := publishedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+	if _, err := publishedModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+
+	conn := NewConn()
+	defer conn.Close()
+	entries, err := redis.Values(conn.Do("XRANGE", publishedModels.ChangelogKey(), "-", "+"))
+	if err != nil {
+		t.Fatalf("Unexpected error in XRANGE: %s", err.Error())
+	}
+	// The stream should have been trimmed to the last two changes
+	expected := [][]string{
+		{"model", publishedModels.Name(), "id", model.Id(), "op", "Save", "fields", "Name,Status"},
+		{"model", publishedModels.Name(), "id", model.Id(), "op", "Delete"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries but got %d", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		values, err := redis.Values(entry, nil)
+		if err != nil || len(values) != 2 {
+			t.Fatalf("Unexpected entry in stream: %v", entry)
+		}
+		fields, err := redis.Strings(values[1], nil)
+		if err != nil {
+			t.Fatalf("Unexpected error reading entry fields: %s", err.Error())
+		}
+		if !reflect.DeepEqual(expected[i], fields) {
+			t.Errorf("Wrong entry %d.\n\tExpected: %v\n\tBut got:  %v", i, expected[i], fields)
+		}
+	}
+}
+
+func TestStreamChangesInvalidOptions(t *testing.T) {
+	spec := &modelSpec{}
+	if err := StreamChanges(StreamOptions{MaxLen: -1})(spec); err == nil {
+		t.Error("Expected an error for a negative MaxLen")
+	}
+}
+
+func TestReplayChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, StreamChanges(StreamOptions{}))
+	models := []*publishedModel{{Name: "Alice"}, {Name: "Bob"}, {Name: "Carol"}}
+	for _, model := range models {
+		if err := publishedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+
+	// Replay everything
+	events := []ChangeEvent{}
+	lastId, err := publishedModels.ReplayChanges("", func(event ChangeEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in ReplayChanges: %s", err.Error())
+	}
+	if len(events) != len(models) {
+		t.Fatalf("Expected %d events but got %d", len(models), len(events))
+	}
+	for i, event := range events {
+		if event.Id != models[i].Id() || event.Kind != SaveOp || event.StreamId == "" {
+			t.Errorf("Unexpected event %d: %#v", i, event)
+		}
+	}
+	if lastId != events[2].StreamId {
+		t.Errorf("Expected lastId to be %s but got %s", events[2].StreamId, lastId)
+	}
+
+	// Replay from a checkpoint
+	replayed := []string{}
+	if _, err := publishedModels.ReplayChanges(events[0].StreamId, func(event ChangeEvent) error {
+		replayed = append(replayed, event.Id)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error in ReplayChanges: %s", err.Error())
+	}
+	expected := []string{models[1].Id(), models[2].Id()}
+	if !reflect.DeepEqual(expected, replayed) {
+		t.Errorf("Expected to replay %v but got %v", expected, replayed)
+	}
+
+	// An error from the handler should stop the replay
+	handlerErr := errors.New("stop")
+	lastId, err = publishedModels.ReplayChanges("", func(event ChangeEvent) error {
+		if event.Id == models[1].Id() {
+			return handlerErr
+		}
+		return nil
+	})
+	if err != handlerErr {
+		t.Errorf("Expected the error from the handler but got %v", err)
+	}
+	if lastId != events[0].StreamId {
+		t.Errorf("Expected lastId to be %s but got %s", events[0].StreamId, lastId)
+	}
+}
+
+func TestParseChangelogEntry(t *testing.T) {
+	entry := []interface{}{
+		[]byte("1-0"),
+		[]interface{}{[]byte("model"), []byte("Person"), []byte("id"), []byte("abc"), []byte("op"), []byte("Save"), []byte("fields"), []byte("Name,Age")},
+	}
+	got, err := parseChangelogEntry(entry)
+	if err != nil {
+		t.Fatalf("Unexpected error in parseChangelogEntry: %s", err.Error())
+	}
+	expected := ChangeEvent{ModelName: "Person", Id: "abc", Kind: SaveOp, Fields: []string{"Name", "Age"}, StreamId: "1-0"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Wrong ChangeEvent.\n\tExpected: %#v\n\tBut got:  %#v", expected, got)
+	}
+}
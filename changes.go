@@ -0,0 +1,175 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File changes.go contains code related to tracking changes to
+// models, so that only the fields which have changed need to be
+// written when a model is saved.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// modelSnapshot holds the values of the fields of a model as they were when
+// the model was last found or saved. The values are stored in the same format
+// that is used in the main hash and keyed by field name.
+type modelSnapshot struct {
+	id     string
+	values map[string]string
+}
+
+// snapshotter is implemented by models which can hold a snapshot. Any model
+// which embeds DefaultData satisfies snapshotter.
+type snapshotter interface {
+	getSnapshot() *modelSnapshot
+	setSnapshot(*modelSnapshot)
+}
+
+var snapshotterType = reflect.TypeOf((*snapshotter)(nil)).Elem()
+
+// getSnapshot returns the snapshot for the model, or nil if the model has not
+// been found or saved.
+func (d *DefaultData) getSnapshot() *modelSnapshot {
+	return d.snapshot
+}
+
+// setSnapshot sets the snapshot for the model.
+func (d *DefaultData) setSnapshot(snapshot *modelSnapshot) {
+	d.snapshot = snapshot
+}
+
+// TrackChanges is a ModelOption which causes zoom to remember the values of the
+// fields of a model whenever it is found or saved. When the model is saved again,
+// only the fields which have changed since then (along with their indexes) are
+// written to the database, instead of every field. Fields which were not retrieved
+// (e.g. because of a query's Include or Exclude modifiers) and fields with the
+// redisType struct tag are always considered changed. The model type must embed
+// DefaultData.
+func TrackChanges() ModelOption {
+	return func(spec *modelSpec) error {
+		if !spec.typ.Implements(snapshotterType) {
+			return fmt.Errorf("zoom: TrackChanges requires a model type which embeds DefaultData. %s does not", spec.typ.String())
+		}
+		spec.trackChanges = true
+		return nil
+	}
+}
+
+// takeSnapshot records the current values of each field in fieldNames which is
+// stored in the main hash. It has no effect if the model type does not track
+// changes.
+func (mr *modelRef) takeSnapshot(fieldNames []string) error {
+	if !mr.spec.trackChanges {
+		return nil
+	}
+	snapshot := &modelSnapshot{
+		id:     mr.model.Id(),
+		values: map[string]string{},
+	}
+	for _, name := range fieldNames {
+		fs, found := mr.spec.fieldsByName[name]
+		if !found || !fs.storedInHash() {
+			continue
+		}
+		value, err := mr.hashValue(fs)
+		if err != nil {
+			return err
+		}
+		snapshot.values[fs.name] = snapshotValue(value)
+	}
+	mr.model.(snapshotter).setSnapshot(snapshot)
+	return nil
+}
+
+// changedFields returns the fields which have changed since the model was last
+// found or saved. If the model type does not track changes or if there is no
+// snapshot for the model, it returns all fields.
+func (mr *modelRef) changedFields() ([]*fieldSpec, error) {
+	if !mr.spec.trackChanges {
+		return mr.spec.fields, nil
+	}
+	snapshot := mr.model.(snapshotter).getSnapshot()
+	if snapshot == nil || snapshot.id != mr.model.Id() {
+		return mr.spec.fields, nil
+	}
+	changed := []*fieldSpec{}
+	for _, fs := range mr.spec.fields {
+		oldValue, found := snapshot.values[fs.name]
+		if !found {
+			changed = append(changed, fs)
+			continue
+		}
+		value, err := mr.hashValue(fs)
+		if err != nil {
+			return nil, err
+		}
+		if snapshotValue(value) != oldValue {
+			changed = append(changed, fs)
+		}
+	}
+	return changed, nil
+}
+
+// ChangedFields returns the names of the fields of model which have changed since
+// it was last found or saved, so that application code can act on specific
+// changes (e.g. only sending an email when the Email field changed). The type of
+// model must have been registered with the default pool using the TrackChanges
+// option. If the model has not been found or saved yet, every field is considered
+// changed. Fields which were not retrieved (e.g. because of a query's Include or
+// Exclude modifiers) and fields with the redisType struct tag are always
+// considered changed. Use ModelType.ChangedFields for types registered with a
+// different Pool.
+func ChangedFields(model Model) ([]string, error) {
+	mt, err := defaultPool.modelTypeOf(model)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ChangedFields: %s", err.Error())
+	}
+	return mt.ChangedFields(model)
+}
+
+// ChangedFields returns the names of the fields of model which have changed since
+// it was last found or saved. The ModelType must have been registered with the
+// TrackChanges option. See the package-level ChangedFields function for more
+// information.
+func (mt *ModelType) ChangedFields(model Model) ([]string, error) {
+	if err := mt.checkModelType(model); err != nil {
+		return nil, fmt.Errorf("zoom: Error in ChangedFields: %s", err.Error())
+	}
+	if !mt.spec.trackChanges {
+		return nil, fmt.Errorf("zoom: Error in ChangedFields: %s was not registered with the TrackChanges option", mt.Name())
+	}
+	mr := &modelRef{
+		spec:  mt.spec,
+		model: model,
+	}
+	fields, err := mr.changedFields()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(fields))
+	for i, fs := range fields {
+		names[i] = fs.name
+	}
+	return names, nil
+}
+
+// snapshotValue converts value, which should be the output of hashValue, to a
+// string that can be compared to other snapshot values.
+func snapshotValue(value interface{}) string {
+	if valueBytes, ok := value.([]byte); ok {
+		return string(valueBytes)
+	}
+	return fmt.Sprint(value)
+}
+
+// newTakeSnapshotHandler returns a ReplyHandler which ignores the reply and
+// records the current values of the fields in fieldNames for mr.model. It is
+// used to update the snapshot after a model has been saved.
+func newTakeSnapshotHandler(mr *modelRef, fieldNames []string) ReplyHandler {
+	return func(interface{}) error {
+		return mr.takeSnapshot(fieldNames)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File changes_test.go tests the code in changes.go, i.e.
+// tracking which fields have changed since a model was found.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+// trackedModel is a model type that is only used for testing
+// the TrackChanges option
+type trackedModel struct {
+	Int    int    `zoom:"index"`
+	String string `zoom:"index"`
+	DefaultData
+}
+
+func TestTrackChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	trackedModels := registerTestType(t, &trackedModel{}, TrackChanges())
+
+	// Save a model and then find it to capture a snapshot
+	model := &trackedModel{Int: 1, String: "foo"}
+	if err := trackedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	modelCopy := &trackedModel{}
+	if err := trackedModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+
+	// Nothing should be considered changed right after Find
+	mr := &modelRef{spec: trackedModels.spec, model: modelCopy}
+	if changed, err := mr.changedFields(); err != nil {
+		t.Errorf("Unexpected error in changedFields: %s", err.Error())
+	} else if len(changed) != 0 {
+		t.Errorf("Expected no changed fields but got %d", len(changed))
+	}
+
+	// Change the String field in the database directly, then change only the
+	// Int field on the copy and save it. The String field should not be
+	// overwritten because it was not changed.
+	conn := NewConn()
+	defer conn.Close()
+	key, _ := trackedModels.ModelKey(model.Id())
+	if _, err := conn.Do("HSET", key, "String", "bar"); err != nil {
+		t.Fatalf("Unexpected error in HSET: %s", err.Error())
+	}
+	modelCopy.Int = 2
+	if changed, err := mr.changedFields(); err != nil {
+		t.Errorf("Unexpected error in changedFields: %s", err.Error())
+	} else if len(changed) != 1 || changed[0].name != "Int" {
+		t.Errorf("Expected only Int to be changed but got %v", changed)
+	}
+	if err := trackedModels.Save(modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectFieldEquals(t, key, "Int", 2)
+	expectFieldEquals(t, key, "String", "bar")
+	expectIndexExists(t, trackedModels, modelCopy, "Int")
+}
+
+// customIdModel implements Model without embedding DefaultData
+type customIdModel struct {
+	Int int
+	id  string
+}
+
+func (m *customIdModel) Id() string      { return m.id }
+func (m *customIdModel) SetId(id string) { m.id = id }
+
+func TestTrackChangesRequiresDefaultData(t *testing.T) {
+	if _, err := RegisterWithOptions(&customIdModel{}, TrackChanges()); err == nil {
+		t.Error("Expected error when using TrackChanges on a type without DefaultData but got none")
+	}
+	if typeIsRegistered(reflect.TypeOf(&customIdModel{})) {
+		t.Error("Expected type to not be registered after an error in RegisterWithOptions")
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	trackedModels := registerTestType(t, &trackedModel{}, TrackChanges())
+
+	// Every field of a new model should be considered changed
+	model := &trackedModel{Int: 1, String: "a"}
+	expectChangedFields(t, model, []string{"Int", "String"})
+	if err := trackedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectChangedFields(t, model, []string{})
+
+	// Only the fields which were modified since the model was found should
+	// be considered changed
+	found := &trackedModel{}
+	if err := trackedModels.Find(model.Id(), found); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	found.String = "b"
+	expectChangedFields(t, found, []string{"String"})
+
+	// Types which do not track changes should result in an error
+	if _, err := ChangedFields(createTestModels(1)[0]); err == nil {
+		t.Error("Expected an error when calling ChangedFields for a type without TrackChanges but got none")
+	}
+}
+
+// expectChangedFields calls t.Errorf if ChangedFields does not return expected
+// for model.
+func expectChangedFields(t *testing.T, model Model, expected []string) {
+	got, err := ChangedFields(model)
+	if err != nil {
+		t.Fatalf("Unexpected error in ChangedFields: %s", err.Error())
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ChangedFields was incorrect.\nExpected: %v\nGot:      %v", expected, got)
+	}
+}
@@ -0,0 +1,505 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File gen.go contains code related to the gen command, which generates
+// typed wrappers for model types so that mistakes in field names and the
+// types of models are caught by the compiler.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// runGen runs the gen command with the given arguments, which do not include
+// the name of the command, and returns the exit code. It is typically invoked
+// with go generate, e.g.:
+//
+//	//go:generate zoom gen -type=Person,Post
+func runGen(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("zoom gen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	typeNames := flags.String("type", "", "comma-separated list of model type names (required)")
+	output := flags.String("output", "", "output file name (default <dir>/<type>_zoom.go)")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, "Usage:\n  zoom gen -type=<type>[,<type>...] [-output <file>] [dir]\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *typeNames == "" || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+	src, err := generate(dir, types, "zoom gen "+strings.Join(args, " "))
+	if err != nil {
+		fmt.Fprintf(stderr, "zoom: %s\n", err.Error())
+		return 1
+	}
+	outputFile := *output
+	if outputFile == "" {
+		outputFile = filepath.Join(dir, strings.ToLower(types[0])+"_zoom.go")
+	}
+	if err := ioutil.WriteFile(outputFile, src, 0644); err != nil {
+		fmt.Fprintf(stderr, "zoom: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// genPackage holds everything needed to generate the code for a package.
+type genPackage struct {
+	Command string
+	Name    string
+	// Imports holds the import specs (e.g. `"time"`) needed for the types of
+	// indexed fields
+	Imports []string
+	Types   []*genType
+}
+
+// genType holds everything needed to generate the code for a model type.
+type genType struct {
+	Name   string
+	Plural string
+	Fields []*genField
+}
+
+// genField holds everything needed to generate the code for a field of a model
+// type.
+type genField struct {
+	// Name is the name of the field as used in queries, e.g. "Address.City" for
+	// a field of a nested struct with the flatten option, and Ident is the same
+	// name as a valid identifier, e.g. "AddressCity"
+	Name  string
+	Ident string
+	// Indexed is true if the field has the index or unique option, in which case
+	// ValueType is the type of the values it can be filtered by
+	Indexed   bool
+	ValueType string
+}
+
+// IndexedFields returns the fields of t which are indexed.
+func (t *genType) IndexedFields() []*genField {
+	fields := []*genField{}
+	for _, field := range t.Fields {
+		if field.Indexed {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// generate parses the package in dir and returns the formatted source code for
+// the given model types. command is written in the header of the generated
+// code.
+func generate(dir string, typeNames []string, command string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected exactly one package in %s but found %d", dir, len(pkgs))
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+	g := &generator{
+		fset:    fset,
+		structs: map[string]*ast.StructType{},
+		files:   map[string]*ast.File{},
+		imports: map[string]bool{},
+	}
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+					g.structs[typeSpec.Name.Name] = structType
+					g.files[typeSpec.Name.Name] = file
+				}
+			}
+		}
+	}
+	data := &genPackage{
+		Command: command,
+		Name:    pkg.Name,
+	}
+	for _, name := range typeNames {
+		structType, found := g.structs[name]
+		if !found {
+			return nil, fmt.Errorf("could not find struct type %s in package %s", name, pkg.Name)
+		}
+		t := &genType{
+			Name:   name,
+			Plural: plural(name),
+		}
+		if err := g.addFields(t, name, structType, ""); err != nil {
+			return nil, err
+		}
+		data.Types = append(data.Types, t)
+	}
+	for spec := range g.imports {
+		data.Imports = append(data.Imports, spec)
+	}
+	sort.Strings(data.Imports)
+	buf := &bytes.Buffer{}
+	if err := genTemplate.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid code: %s", err.Error())
+	}
+	return src, nil
+}
+
+// generator collects information about the struct types in a package.
+type generator struct {
+	fset    *token.FileSet
+	structs map[string]*ast.StructType
+	// files holds the file in which each struct type is declared
+	files map[string]*ast.File
+	// imports holds the import specs needed by the generated code
+	imports map[string]bool
+}
+
+// addFields adds the fields of structType, which is declared as structName, to
+// t, following the same rules as zoom does when the model type is registered.
+// namePrefix is prepended to the name of each field, and is used for nested
+// structs with the flatten option.
+func (g *generator) addFields(t *genType, structName string, structType *ast.StructType, namePrefix string) error {
+	for _, field := range structType.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			tagValue, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(tagValue)
+		}
+		names := []string{}
+		if len(field.Names) == 0 {
+			// An embedded field is named after its type
+			name := embeddedTypeName(field.Type)
+			if name == "DefaultData" {
+				continue
+			}
+			names = append(names, name)
+		}
+		for _, ident := range field.Names {
+			names = append(names, ident.Name)
+		}
+		if tag.Get("redis") == "-" {
+			continue
+		}
+		indexed, flatten := false, false
+		for _, op := range strings.Split(tag.Get("zoom"), ",") {
+			switch op {
+			case "index", "unique":
+				indexed = true
+			case "flatten":
+				flatten = true
+			}
+		}
+		for _, name := range names {
+			if name == "_" || !ast.IsExported(name) {
+				continue
+			}
+			if flatten {
+				ident, ok := field.Type.(*ast.Ident)
+				nested, found := (*ast.StructType)(nil), false
+				if ok {
+					nested, found = g.structs[ident.Name]
+				}
+				if !found {
+					return fmt.Errorf("cannot generate code for %s.%s because it has the flatten option and its type is not a struct declared in the same package", structName, name)
+				}
+				if err := g.addFields(t, ident.Name, nested, namePrefix+name+"."); err != nil {
+					return err
+				}
+				continue
+			}
+			genField := &genField{
+				Name:    namePrefix + name,
+				Ident:   strings.Replace(namePrefix, ".", "", -1) + name,
+				Indexed: indexed,
+			}
+			if indexed {
+				valueType, err := g.valueType(field.Type, g.files[structName])
+				if err != nil {
+					return err
+				}
+				genField.ValueType = valueType
+			}
+			t.Fields = append(t.Fields, genField)
+		}
+	}
+	return nil
+}
+
+// embeddedTypeName returns the name of the type of an embedded field.
+func embeddedTypeName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedTypeName(expr.X)
+	case *ast.SelectorExpr:
+		return expr.Sel.Name
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// valueType returns the type of the values which an indexed field with the
+// given type can be filtered by, as source code. It is the type of the field
+// with any pointers removed. If the type is declared in another package, the
+// import from file is added to the imports for the generated code.
+func (g *generator) valueType(expr ast.Expr, file *ast.File) (string, error) {
+	for {
+		star, ok := expr.(*ast.StarExpr)
+		if !ok {
+			break
+		}
+		expr = star.X
+	}
+	if selector, ok := expr.(*ast.SelectorExpr); ok {
+		if pkgIdent, ok := selector.X.(*ast.Ident); ok {
+			spec, found := findImport(file, pkgIdent.Name)
+			if !found {
+				return "", fmt.Errorf("could not find the import for package %s", pkgIdent.Name)
+			}
+			g.imports[spec] = true
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := printer.Fprint(buf, g.fset, expr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// findImport returns the import spec (e.g. `"time"` or `t "time"`) from file
+// for the package which is referred to as name.
+func findImport(file *ast.File, name string) (string, bool) {
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return spec.Name.Name + " " + spec.Path.Value, true
+			}
+			continue
+		}
+		// Assume that the package name is the last element of the path
+		if path[strings.LastIndex(path, "/")+1:] == name {
+			return spec.Path.Value, true
+		}
+	}
+	return "", false
+}
+
+// plural returns the plural form of the English noun name, which is used in the
+// names of generated methods, e.g. FindAllPeople. It only handles the common
+// cases.
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "Person"):
+		return strings.TrimSuffix(name, "Person") + "People"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "z"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsAny(name[len(name)-2:len(name)-1], "aeiouAEIOU"):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+var genTemplate = template.Must(template.New("gen").Parse(`// Code generated by "{{.Command}}"; DO NOT EDIT.
+
+package {{.Name}}
+
+import (
+	"github.com/albrow/zoom"
+{{range .Imports}}	{{.}}
+{{end}})
+{{range $t := .Types}}
+// {{$t.Name}}Field is the name of a field of {{$t.Name}}, which can be used in
+// {{$t.Name}}Query.Include and {{$t.Name}}Query.Exclude.
+type {{$t.Name}}Field string
+
+// The fields of {{$t.Name}}.
+const (
+{{range $t.Fields}}	{{$t.Name}}Field{{.Ident}} {{$t.Name}}Field = "{{.Name}}"
+{{end}})
+{{if $t.IndexedFields}}
+// {{$t.Name}}Index is the name of an indexed field of {{$t.Name}}, which can be
+// used in {{$t.Name}}Query.Order and {{$t.Name}}Query.OrderDesc.
+type {{$t.Name}}Index string
+
+// The indexed fields of {{$t.Name}}.
+const (
+{{range $t.IndexedFields}}	{{$t.Name}}Index{{.Ident}} {{$t.Name}}Index = "{{.Name}}"
+{{end}})
+{{end}}
+// {{$t.Name}}Store wraps the ModelType for {{$t.Name}} with methods which accept
+// and return *{{$t.Name}} instead of interface{} values. All the methods of
+// ModelType can still be used.
+type {{$t.Name}}Store struct {
+	*zoom.ModelType
+}
+
+// New{{$t.Name}}Store returns a {{$t.Name}}Store for mt, which must be the
+// ModelType that {{$t.Name}} was registered as.
+func New{{$t.Name}}Store(mt *zoom.ModelType) *{{$t.Name}}Store {
+	return &{{$t.Name}}Store{ModelType: mt}
+}
+
+// Find{{$t.Name}} returns the {{$t.Name}} with the given id. See ModelType.Find.
+func (s *{{$t.Name}}Store) Find{{$t.Name}}(id string) (*{{$t.Name}}, error) {
+	model := &{{$t.Name}}{}
+	if err := s.ModelType.Find(id, model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// FindAll{{$t.Plural}} returns every {{$t.Name}}. See ModelType.FindAll.
+func (s *{{$t.Name}}Store) FindAll{{$t.Plural}}() ([]*{{$t.Name}}, error) {
+	models := []*{{$t.Name}}{}
+	if err := s.ModelType.FindAll(&models); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// Query{{$t.Plural}} returns a new query for {{$t.Name}}. See ModelType.NewQuery.
+func (s *{{$t.Name}}Store) Query{{$t.Plural}}() *{{$t.Name}}Query {
+	return &{{$t.Name}}Query{query: s.ModelType.NewQuery()}
+}
+
+// {{$t.Name}}Query wraps a query for {{$t.Name}} with methods which accept the
+// names of fields as {{$t.Name}}Field{{if $t.IndexedFields}} or {{$t.Name}}Index values, and filter
+// values with the type of the field{{else}} values{{end}}.
+type {{$t.Name}}Query struct {
+	query *zoom.Query
+}
+
+// Query returns the underlying query.
+func (q *{{$t.Name}}Query) Query() *zoom.Query {
+	return q.query
+}
+
+// String satisfies fmt.Stringer and prints out the query.
+func (q *{{$t.Name}}Query) String() string {
+	return q.query.String()
+}
+{{if $t.IndexedFields}}
+// Order sorts the results by field in ascending order. See Query.Order.
+func (q *{{$t.Name}}Query) Order(field {{$t.Name}}Index) *{{$t.Name}}Query {
+	q.query.Order(string(field))
+	return q
+}
+
+// OrderDesc sorts the results by field in descending order. See Query.Order.
+func (q *{{$t.Name}}Query) OrderDesc(field {{$t.Name}}Index) *{{$t.Name}}Query {
+	q.query.Order("-" + string(field))
+	return q
+}
+{{end}}{{range $t.IndexedFields}}
+// Filter{{.Ident}} only returns models whose {{.Name}} field matches the given
+// operator (one of "=", "!=", ">", "<", ">=", or "<=") and value. See
+// Query.Filter.
+func (q *{{$t.Name}}Query) Filter{{.Ident}}(op string, value {{.ValueType}}) *{{$t.Name}}Query {
+	q.query.Filter("{{.Name}} "+op, value)
+	return q
+}
+{{end}}
+// Limit sets an upper limit on the number of results. See Query.Limit.
+func (q *{{$t.Name}}Query) Limit(amount uint) *{{$t.Name}}Query {
+	q.query.Limit(amount)
+	return q
+}
+
+// Offset sets the index of the first result. See Query.Offset.
+func (q *{{$t.Name}}Query) Offset(amount uint) *{{$t.Name}}Query {
+	q.query.Offset(amount)
+	return q
+}
+
+// Include only reads the given fields. See Query.Include.
+func (q *{{$t.Name}}Query) Include(fields ...{{$t.Name}}Field) *{{$t.Name}}Query {
+	for _, field := range fields {
+		q.query.Include(string(field))
+	}
+	return q
+}
+
+// Exclude does not read the given fields. See Query.Exclude.
+func (q *{{$t.Name}}Query) Exclude(fields ...{{$t.Name}}Field) *{{$t.Name}}Query {
+	for _, field := range fields {
+		q.query.Exclude(string(field))
+	}
+	return q
+}
+
+// Run runs the query and returns the results. See Query.Run.
+func (q *{{$t.Name}}Query) Run() ([]*{{$t.Name}}, error) {
+	models := []*{{$t.Name}}{}
+	if err := q.query.Run(&models); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// RunOne runs the query and returns the first result. See Query.RunOne.
+func (q *{{$t.Name}}Query) RunOne() (*{{$t.Name}}, error) {
+	model := &{{$t.Name}}{}
+	if err := q.query.RunOne(model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Count returns the number of models which match the query. See Query.Count.
+func (q *{{$t.Name}}Query) Count() (uint, error) {
+	return q.query.Count()
+}
+
+// Ids returns the ids of the models which match the query. See Query.Ids.
+func (q *{{$t.Name}}Query) Ids() ([]string, error) {
+	return q.query.Ids()
+}
+{{end}}`))
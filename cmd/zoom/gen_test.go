@@ -0,0 +1,163 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File gen_test.go tests the gen command.
+
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const genTestSource = `package models
+
+import (
+	"github.com/albrow/zoom"
+	t "time"
+)
+
+type Person struct {
+	Name     string ` + "`zoom:\"index\"`" + `
+	Age      *int   ` + "`zoom:\"index\"`" + `
+	Born     t.Time ` + "`zoom:\"index\"`" + `
+	Address  Address ` + "`zoom:\"flatten\"`" + `
+	Password string ` + "`redis:\"-\"`" + `
+	secret   string
+	zoom.DefaultData
+}
+
+type Address struct {
+	City string ` + "`zoom:\"index\"`" + `
+	Zip  string
+}
+
+type Category struct {
+	Title string
+	zoom.DefaultData
+}
+`
+
+// writeGenTestPackage writes genTestSource to a new temporary directory and
+// returns the directory.
+func writeGenTestPackage(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "zoomgen")
+	if err != nil {
+		t.Fatalf("Unexpected error in ioutil.TempDir: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "models.go"), []byte(genTestSource), 0644); err != nil {
+		t.Fatalf("Unexpected error in ioutil.WriteFile: %s", err.Error())
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writeGenTestPackage(t)
+	defer os.RemoveAll(dir)
+	src, err := generate(dir, []string{"Person", "Category"}, "zoom gen -type=Person,Category")
+	if err != nil {
+		t.Fatalf("Unexpected error in generate: %s", err.Error())
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", src, 0); err != nil {
+		t.Fatalf("Generated code could not be parsed: %s\n%s", err.Error(), src)
+	}
+	expected := []string{
+		`// Code generated by "zoom gen -type=Person,Category"; DO NOT EDIT.`,
+		`t "time"`,
+		`PersonFieldName        PersonField = "Name"`,
+		`PersonFieldAddressCity PersonField = "Address.City"`,
+		`PersonFieldAddressZip  PersonField = "Address.Zip"`,
+		`PersonIndexAddressCity PersonIndex = "Address.City"`,
+		`func (s *PersonStore) FindPerson(id string) (*Person, error)`,
+		`func (s *PersonStore) FindAllPeople() ([]*Person, error)`,
+		`func (s *PersonStore) QueryPeople() *PersonQuery`,
+		`func (q *PersonQuery) FilterAge(op string, value int) *PersonQuery`,
+		`func (q *PersonQuery) FilterBorn(op string, value t.Time) *PersonQuery`,
+		`q.query.Filter("Address.City "+op, value)`,
+		`func (q *PersonQuery) Run() ([]*Person, error)`,
+		`func (s *CategoryStore) FindAllCategories() ([]*Category, error)`,
+	}
+	for _, want := range expected {
+		if !bytes.Contains(src, []byte(want)) {
+			t.Errorf("Expected generated code to contain %q but it did not:\n%s", want, src)
+		}
+	}
+	unexpected := []string{
+		"PersonFieldPassword",
+		"PersonFieldsecret",
+		"PersonFieldDefaultData",
+		"PersonIndexAddressZip",
+		// Category has no indexed fields
+		"CategoryIndex",
+		"func (q *CategoryQuery) Order",
+	}
+	for _, notWant := range unexpected {
+		if bytes.Contains(src, []byte(notWant)) {
+			t.Errorf("Expected generated code to not contain %q but it did:\n%s", notWant, src)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := writeGenTestPackage(t)
+	defer os.RemoveAll(dir)
+	if _, err := generate(dir, []string{"Animal"}, "zoom gen -type=Animal"); err == nil {
+		t.Error("Expected an error for a type which does not exist but got none")
+	}
+	source := "package models\n\ntype Person struct {\n\tAddress *Address `zoom:\"flatten\"`\n}\n\ntype Address struct {\n\tCity string\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "models.go"), []byte(source), 0644); err != nil {
+		t.Fatalf("Unexpected error in ioutil.WriteFile: %s", err.Error())
+	}
+	if _, err := generate(dir, []string{"Person"}, "zoom gen -type=Person"); err == nil {
+		t.Error("Expected an error for a flattened field which is not a struct but got none")
+	}
+}
+
+func TestRunGen(t *testing.T) {
+	dir := writeGenTestPackage(t)
+	defer os.RemoveAll(dir)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if code := run([]string{"gen", "-type=Person", dir}, stdout, stderr); code != 0 {
+		t.Fatalf("Expected exit code 0 but got %d: %s", code, stderr.String())
+	}
+	src, err := ioutil.ReadFile(filepath.Join(dir, "person_zoom.go"))
+	if err != nil {
+		t.Fatalf("Unexpected error reading generated file: %s", err.Error())
+	}
+	if !strings.HasPrefix(string(src), "// Code generated by \"zoom gen -type=Person "+dir+"\"; DO NOT EDIT.") {
+		t.Errorf("Generated file had the wrong header:\n%s", src)
+	}
+	// Running gen again should work even though the package now contains the
+	// generated file.
+	if code := run([]string{"gen", "-type=Person", dir}, stdout, stderr); code != 0 {
+		t.Errorf("Expected exit code 0 the second time but got %d: %s", code, stderr.String())
+	}
+	if code := run([]string{"gen", dir}, stdout, stderr); code != 2 {
+		t.Errorf("Expected exit code 2 without -type but got %d", code)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	testCases := map[string]string{
+		"User":       "Users",
+		"Person":     "People",
+		"Category":   "Categories",
+		"Day":        "Days",
+		"Address":    "Addresses",
+		"Box":        "Boxes",
+		"Match":      "Matches",
+		"BlogPerson": "BlogPeople",
+	}
+	for name, want := range testCases {
+		if got := plural(name); got != want {
+			t.Errorf("plural(%q): expected %q but got %q", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// Command zoom inspects the models which zoom has stored in a redis
+// database, e.g. for debugging in production. Since it does not have access
+// to the Go types for the models, it finds them by looking at the keys zoom
+// uses.
+//
+// Usage:
+//
+//	zoom [flags] types                   list each model type and its key pattern
+//	zoom [flags] count [type...]         count the models of each type
+//	zoom [flags] dump <type> <id>        print a model as JSON
+//	zoom [flags] index <type> <field>    print the contents of a field index
+//	zoom gen -type=<type>[,<type>...]    generate typed wrappers for model types
+//
+// The connection is configured with the same environment variables as
+// zoom.ConfigFromEnv (e.g. REDIS_URL and ZOOM_KEY_PREFIX), which can be
+// overridden with the -url and -prefix flags. The index command accepts a
+// -limit flag for the maximum number of entries to print (100 by default, or 0
+// for no limit).
+//
+// The gen command does not connect to redis. It parses the Go package in the
+// current directory (or the directory given after the flags) and writes typed
+// wrappers for the given model types to <type>_zoom.go (or the file given by
+// the -output flag), e.g. FindPerson and QueryPeople methods which return
+// *Person and []*Person values, and constants for the names of fields. It is
+// intended to be used with go generate:
+//
+//	//go:generate zoom gen -type=Person
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/albrow/zoom"
+	"github.com/garyburd/redigo/redis"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// errUsage is returned by commands which were given the wrong arguments.
+var errUsage = errors.New("invalid arguments")
+
+const usage = `Usage:
+  zoom [flags] types                   list each model type and its key pattern
+  zoom [flags] count [type...]         count the models of each type
+  zoom [flags] dump <type> <id>        print a model as JSON
+  zoom [flags] index <type> <field>    print the contents of a field index
+  zoom gen -type=<type>[,<type>...]    generate typed wrappers for model types
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command given by args, writing the output to stdout and any
+// errors to stderr, and returns the exit code.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("zoom", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	url := flags.String("url", "", "the URL of the redis server, e.g. redis://localhost:6379/0")
+	prefix := flags.String("prefix", "", "the KeyPrefix used by zoom")
+	limit := flags.Int("limit", 100, "the maximum number of index entries to print, or 0 for no limit")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if flags.Arg(0) == "gen" {
+		return runGen(flags.Args()[1:], stderr)
+	}
+	config, err := zoom.ConfigFromEnv()
+	if err != nil {
+		fmt.Fprintf(stderr, "zoom: %s\n", err.Error())
+		return 1
+	}
+	if *url != "" {
+		config.URL = *url
+	}
+	if *prefix != "" {
+		config.KeyPrefix = *prefix
+	}
+	cmd := flags.Arg(0)
+	cmdArgs := flags.Args()[1:]
+	var fn func(c *client, args []string) error
+	switch cmd {
+	case "types":
+		fn = func(c *client, args []string) error { return c.types(stdout) }
+	case "count":
+		fn = func(c *client, args []string) error { return c.count(stdout, args) }
+	case "dump":
+		fn = func(c *client, args []string) error { return c.dump(stdout, args) }
+	case "index":
+		fn = func(c *client, args []string) error { return c.index(stdout, args, *limit) }
+	default:
+		fmt.Fprintf(stderr, "zoom: unknown command %q\n", cmd)
+		flags.Usage()
+		return 2
+	}
+	pool, err := zoom.NewPool(config)
+	if err != nil {
+		fmt.Fprintf(stderr, "zoom: %s\n", err.Error())
+		return 1
+	}
+	defer pool.Close()
+	conn := pool.NewConn()
+	defer conn.Close()
+	c := &client{conn: conn, prefix: config.KeyPrefix}
+	if err := fn(c, cmdArgs); err != nil {
+		if err == errUsage {
+			flags.Usage()
+			return 2
+		}
+		fmt.Fprintf(stderr, "zoom: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// client runs commands using a single connection.
+type client struct {
+	conn   redis.Conn
+	prefix string
+}
+
+// typeNames returns the names of every model type in the database, sorted
+// alphabetically. A model type exists if there is a set of all its ids.
+func (c *client) typeNames() ([]string, error) {
+	keys, err := c.scan(c.prefix + "*:all")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, key := range keys {
+		keyType, err := redis.String(c.conn.Do("TYPE", key))
+		if err != nil {
+			return nil, err
+		}
+		if keyType != "set" {
+			// e.g. the main hash for a model whose id is "all"
+			continue
+		}
+		names = append(names, typeNameFromKey(key, c.prefix))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// typeNameFromKey returns the name of the model type for the given key for the
+// set of all ids.
+func typeNameFromKey(key string, prefix string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(key, prefix), ":all")
+}
+
+// scan returns all the keys which match pattern, using SCAN so that the
+// database is not blocked.
+func (c *client) scan(pattern string) ([]string, error) {
+	results := []string{}
+	cursor := "0"
+	for {
+		values, err := redis.Values(c.conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+		if err != nil {
+			return nil, err
+		}
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return nil, err
+		}
+		results = append(results, keys...)
+		if cursor == "0" {
+			return results, nil
+		}
+	}
+}
+
+// types prints the name of each model type and the pattern for the keys of its
+// models.
+func (c *client) types(w io.Writer) error {
+	names, err := c.typeNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s%s:<id>\n", name, c.prefix, name)
+	}
+	return nil
+}
+
+// count prints the number of models of each of the given types, or of every
+// type if none are given.
+func (c *client) count(w io.Writer, names []string) error {
+	if len(names) == 0 {
+		var err error
+		names, err = c.typeNames()
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		count, err := redis.Int(c.conn.Do("SCARD", c.prefix+name+":all"))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\n", name, count)
+	}
+	return nil
+}
+
+// dumpedModel is the JSON representation of a model printed by dump.
+type dumpedModel struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+	// Fields holds the contents of the main hash, exactly as they are stored
+	Fields map[string]string `json:"fields"`
+	// Collections holds any list or set fields which are stored outside of the
+	// main hash
+	Collections map[string][]string `json:"collections,omitempty"`
+}
+
+// dump prints the model with the given type and id as JSON.
+func (c *client) dump(w io.Writer, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	name, id := args[0], args[1]
+	key := c.prefix + name + ":" + id
+	fields, err := redis.StringMap(c.conn.Do("HGETALL", key))
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("could not find %s with id %s", name, id)
+	}
+	model := dumpedModel{
+		Type:   name,
+		Id:     id,
+		Fields: fields,
+	}
+	collectionKeys, err := c.scan(escapePattern(key) + ":*")
+	if err != nil {
+		return err
+	}
+	for _, collectionKey := range collectionKeys {
+		keyType, err := redis.String(c.conn.Do("TYPE", collectionKey))
+		if err != nil {
+			return err
+		}
+		var values []string
+		switch keyType {
+		case "list":
+			values, err = redis.Strings(c.conn.Do("LRANGE", collectionKey, 0, -1))
+		case "set":
+			values, err = redis.Strings(c.conn.Do("SMEMBERS", collectionKey))
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if model.Collections == nil {
+			model.Collections = map[string][]string{}
+		}
+		model.Collections[strings.TrimPrefix(collectionKey, key+":")] = values
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(model)
+}
+
+// escapePattern escapes any characters in s which have a special meaning in
+// the patterns used by SCAN.
+func escapePattern(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+	return replacer.Replace(s)
+}
+
+// index prints up to limit entries of the index for the given type and field,
+// in order. Entries in string indexes are printed as the value and the id, and
+// entries in numeric and boolean indexes as the score and the id.
+func (c *client) index(w io.Writer, args []string, limit int) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	name, field := args[0], args[1]
+	key := c.prefix + name + ":" + field
+	keyType, err := redis.String(c.conn.Do("TYPE", key))
+	if err != nil {
+		return err
+	}
+	if keyType != "zset" {
+		return fmt.Errorf("there is no index for %s.%s", name, field)
+	}
+	values, err := redis.Strings(c.conn.Do("ZRANGE", key, 0, limit-1, "WITHSCORES"))
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(values); i += 2 {
+		fmt.Fprintln(w, formatIndexEntry(values[i], values[i+1]))
+	}
+	return nil
+}
+
+// formatIndexEntry returns a line describing the given member and score of an
+// index. Members of string indexes consist of the value and the id separated
+// by a null character.
+func formatIndexEntry(member string, score string) string {
+	if i := strings.LastIndex(member, "\x00"); i != -1 {
+		return fmt.Sprintf("%q\t%s", member[:i], member[i+1:])
+	}
+	return fmt.Sprintf("%s\t%s", score, member)
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File main_test.go tests the parts of the zoom command which do not
+// require a database connection.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunUsage(t *testing.T) {
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{}, want: "Usage:"},
+		{args: []string{"foo"}, want: `unknown command "foo"`},
+		{args: []string{"-foo", "types"}, want: "flag provided but not defined"},
+	}
+	for _, tc := range testCases {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		if code := run(tc.args, stdout, stderr); code != 2 {
+			t.Errorf("Expected exit code 2 for args %v but got %d", tc.args, code)
+		}
+		if !strings.Contains(stderr.String(), tc.want) {
+			t.Errorf("Expected stderr for args %v to contain %q but got:\n%s", tc.args, tc.want, stderr.String())
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("Expected no output on stdout for args %v but got:\n%s", tc.args, stdout.String())
+		}
+	}
+}
+
+func TestTypeNameFromKey(t *testing.T) {
+	testCases := []struct {
+		key    string
+		prefix string
+		want   string
+	}{
+		{key: "Person:all", prefix: "", want: "Person"},
+		{key: "app:Person:all", prefix: "app:", want: "Person"},
+		{key: "app:Person:all", prefix: "", want: "app:Person"},
+	}
+	for _, tc := range testCases {
+		if got := typeNameFromKey(tc.key, tc.prefix); got != tc.want {
+			t.Errorf("typeNameFromKey(%q, %q): expected %q but got %q", tc.key, tc.prefix, tc.want, got)
+		}
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+	got := escapePattern(`Person:a*b?[c]\d`)
+	want := `Person:a\*b\?\[c\]\\d`
+	if got != want {
+		t.Errorf("Expected %q but got %q", want, got)
+	}
+}
+
+func TestFormatIndexEntry(t *testing.T) {
+	testCases := []struct {
+		member string
+		score  string
+		want   string
+	}{
+		{member: "abc", score: "42", want: "42\tabc"},
+		{member: "Bob\x00abc", score: "0", want: "\"Bob\"\tabc"},
+		{member: "\x00\x00abc", score: "0", want: "\"\\x00\"\tabc"},
+	}
+	for _, tc := range testCases {
+		if got := formatIndexEntry(tc.member, tc.score); got != tc.want {
+			t.Errorf("formatIndexEntry(%q, %q): expected %q but got %q", tc.member, tc.score, tc.want, got)
+		}
+	}
+}
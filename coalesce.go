@@ -0,0 +1,143 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File coalesce.go contains code related to limiting the rate at
+// which change events are published for each model.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sync"
+	"time"
+)
+
+// CoalesceChanges is a ModelOption which causes at most one ChangeEvent to be
+// published for each model of the given type per window, so that subscribers
+// are not overwhelmed by models which are saved many times per second. It only
+// has an effect if the PublishChanges option is also used. The first change to
+// a model is published right away. Any further changes during the window are
+// merged into a single pending event (with the fields from every save), which
+// is published once the window ends, so subscribers always find out about the
+// latest state of the model. Events for DeleteAll are never coalesced.
+//
+// Windows are tracked by the database, so the limit applies to changes made by
+// every process. Pending events are published by a timer in the process which
+// made the change. If that process exits first, they are published the next
+// time a change to a model of the same type is coalesced by any process. If
+// publishing the pending events fails, the error is passed to the
+// BackgroundError connection hooks and the timer retries a limited number of
+// times. Coalescing does not affect the changelog (see StreamChanges), which still
+// records every change. Requires redis version 3.2 or higher.
+func CoalesceChanges(window time.Duration) ModelOption {
+	return func(spec *modelSpec) error {
+		if window < time.Millisecond {
+			return fmt.Errorf("zoom: CoalesceChanges window must be at least 1ms but got %s", window)
+		}
+		spec.coalescer = &coalescer{window: window}
+		return nil
+	}
+}
+
+// coalesceFlushPolicy determines how long a coalescer waits before trying to
+// publish pending events again after an error, and how many times it tries.
+// After MaxAttempts failures in a row it stops until the next change to a model
+// of the type is coalesced.
+var coalesceFlushPolicy = RetryPolicy{
+	MaxAttempts: 10,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// coalescer holds the window for a type which uses the CoalesceChanges option,
+// whether a flush has been scheduled for it, and the number of flushes which
+// have failed in a row.
+type coalescer struct {
+	window    time.Duration
+	mu        sync.Mutex
+	scheduled bool
+	failures  int
+}
+
+// coalesceWindowKey returns the key for a sorted set which holds the id of each
+// model with a current coalescing window, scored by when the window ends in
+// milliseconds since the epoch.
+func (ms *modelSpec) coalesceWindowKey() string {
+	return ms.internalKey("coalesce")
+}
+
+// coalescedEventsKey returns the key for a hash which holds the pending event
+// for each model, encoded as JSON and keyed by id.
+func (ms *modelSpec) coalescedEventsKey() string {
+	return ms.internalKey("coalesced")
+}
+
+// newScheduleFlushHandler returns a ReplyHandler which schedules a flush for
+// the given type if the reply from the coalesce_change script means the event
+// is pending.
+func (c *coalescer) newScheduleFlushHandler(ms *modelSpec) ReplyHandler {
+	return func(reply interface{}) error {
+		published, err := redis.Int(reply, nil)
+		if err != nil {
+			return err
+		}
+		if published == 0 {
+			c.mu.Lock()
+			c.failures = 0
+			c.mu.Unlock()
+			c.scheduleFlush(ms, c.window)
+		}
+		return nil
+	}
+}
+
+// scheduleFlush publishes any pending events for the given type after delay,
+// unless a flush has already been scheduled.
+func (c *coalescer) scheduleFlush(ms *modelSpec, delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scheduled {
+		return
+	}
+	c.scheduled = true
+	time.AfterFunc(delay, func() {
+		c.flush(ms)
+	})
+}
+
+// flush publishes the pending events for the given type whose windows have
+// ended, and schedules another flush if any events are still pending. If there
+// is an error, it is passed to the BackgroundError hooks for the pool and the
+// flush is retried according to coalesceFlushPolicy. flush does nothing if the
+// pool has been closed or the type has been unregistered.
+func (c *coalescer) flush(ms *modelSpec) {
+	c.mu.Lock()
+	c.scheduled = false
+	c.mu.Unlock()
+	if spec, found := ms.pool.specForName(ms.name); !found || spec != ms || ms.pool.isClosed() {
+		return
+	}
+	pending := 0
+	t := ms.pool.NewTransaction()
+	t.flushCoalescedChanges(ms, newScanIntHandler(&pending))
+	if err := t.Exec(); err != nil {
+		policy := coalesceFlushPolicy
+		c.mu.Lock()
+		c.failures++
+		failures := c.failures
+		c.mu.Unlock()
+		if failures < policy.MaxAttempts {
+			c.scheduleFlush(ms, c.window+policy.backoff(failures))
+		}
+		ms.pool.runBackgroundErrorHooks(fmt.Errorf("zoom: Error publishing coalesced changes for %s (attempt %d of %d): %s", ms.name, failures, policy.MaxAttempts, err.Error()))
+		return
+	}
+	c.mu.Lock()
+	c.failures = 0
+	c.mu.Unlock()
+	if pending > 0 {
+		c.scheduleFlush(ms, c.window)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File coalesce_test.go tests the code in coalesce.go.
+
+package zoom
+
+import (
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"testing"
+	"time"
+)
+
+func TestCoalesceChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, CoalesceChanges(100*time.Millisecond))
+	s, err := publishedModels.Subscribe()
+	if err != nil {
+		t.Fatalf("Unexpected error in Subscribe: %s", err.Error())
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Unexpected error in Subscription.Close: %s", err.Error())
+		}
+	}()
+
+	// The first save is published right away and the rest are merged into a
+	// single event which is published when the window ends.
+	model := &publishedModel{Name: "Alice"}
+	for _, status := range []string{"new", "active", "inactive", "deleted"} {
+		model.Status = status
+		if err := publishedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+	expected := ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      SaveOp,
+		Fields:    []string{"Name", "Status"},
+	}
+	expectChangeEvent(t, s, expected)
+	expectChangeEvent(t, s, expected)
+	select {
+	case event := <-s.Events:
+		t.Errorf("Expected no more events but got %#v", event)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Once the window has ended, the next change is published right away
+	if _, err := publishedModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	select {
+	case event := <-s.Events:
+		if event.Kind != DeleteOp {
+			t.Errorf("Expected a DeleteOp event but got %#v", event)
+		}
+	case <-time.After(50 * time.Millisecond):
+		t.Error("Expected the delete to be published right away")
+	}
+}
+
+func TestCoalesceChangesRename(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, CoalesceChanges(100*time.Millisecond))
+	s, err := publishedModels.Subscribe()
+	if err != nil {
+		t.Fatalf("Unexpected error in Subscribe: %s", err.Error())
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Unexpected error in Subscription.Close: %s", err.Error())
+		}
+	}()
+
+	// The second save is pending when the model is renamed, so it should be
+	// published with the new id when the window ends.
+	model := &publishedModel{Name: "Alice"}
+	for _, status := range []string{"new", "active"} {
+		model.Status = status
+		if err := publishedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+	oldId := model.Id()
+	if _, err := publishedModels.Rename(oldId, "renamed"+oldId); err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	expected := ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        oldId,
+		Kind:      SaveOp,
+		Fields:    []string{"Name", "Status"},
+	}
+	expectChangeEvent(t, s, expected)
+	expected.Id = "renamed" + oldId
+	expectChangeEvent(t, s, expected)
+}
+
+func TestCoalesceChangesInvalidWindow(t *testing.T) {
+	spec := &modelSpec{}
+	if err := CoalesceChanges(0)(spec); err == nil {
+		t.Error("Expected an error for a window of 0")
+	}
+}
+
+func TestCoalesceFlushErrors(t *testing.T) {
+	if flushCoalescedChangesScript == nil {
+		// The script is never run, since every connection fails
+		flushCoalescedChangesScript = redis.NewScript(0, "return 0")
+		defer func() {
+			flushCoalescedChangesScript = nil
+		}()
+	}
+	originalPolicy := coalesceFlushPolicy
+	coalesceFlushPolicy = RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	defer func() {
+		coalesceFlushPolicy = originalPolicy
+	}()
+	pool, err := NewPool(&Configuration{Driver: errorDriver{err: errors.New("connection refused")}})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	errs := make(chan error, 10)
+	pool.AddConnectionHooks(ConnectionHooks{
+		BackgroundError: func(err error) {
+			errs <- err
+		},
+	})
+	mt, err := pool.RegisterWithOptions(&publishedModel{}, PublishChanges(), CoalesceChanges(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error in RegisterWithOptions: %s", err.Error())
+	}
+
+	// The flush should be retried until MaxAttempts and then stop
+	mt.spec.coalescer.flush(mt.spec)
+	for i := 0; i < coalesceFlushPolicy.MaxAttempts; i++ {
+		select {
+		case <-errs:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d errors but got %d", coalesceFlushPolicy.MaxAttempts, i)
+		}
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("Expected no more retries but got error: %s", err.Error())
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Once the pool is closed, pending flushes should do nothing
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Unexpected error in Close: %s", err.Error())
+	}
+	mt.spec.coalescer.flush(mt.spec)
+	select {
+	case err := <-errs:
+		t.Errorf("Expected no flush after Close but got error: %s", err.Error())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
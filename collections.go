@@ -0,0 +1,214 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File collections.go contains code related to fields which are
+// stored in a separate redis list or set instead of the main hash
+// for the model, i.e. fields with the redisType struct tag.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+)
+
+// saveCollectionField adds commands to the transaction for saving the field identified
+// by fs in a separate list or set. Any existing values in the list or set are replaced.
+func (t *Transaction) saveCollectionField(mr *modelRef, fs *fieldSpec) {
+	key := mr.spec.fieldKey(mr.model.Id(), fs)
+	t.Command("DEL", redis.Args{key}, nil)
+	elems, err := collectionArgs(mr.specFieldValue(fs), mr.spec.marshalerUnmarshalerFor(fs))
+	if err != nil {
+		t.setError(err)
+		return
+	}
+	if len(elems) > 0 {
+		t.Command(fs.collectionAddCommand(), redis.Args{key}.Add(elems...), nil)
+	}
+}
+
+// findCollectionField adds a command to the transaction which will retrieve the
+// field identified by fs, which must be stored in a separate list or set, and scan
+// the result into the corresponding field of mr.model.
+func (t *Transaction) findCollectionField(mr *modelRef, fs *fieldSpec) {
+	key := mr.spec.fieldKey(mr.model.Id(), fs)
+	var args redis.Args
+	var command string
+	switch fs.kind {
+	case listField:
+		command, args = "LRANGE", redis.Args{key, 0, -1}
+	case setField:
+		command, args = "SMEMBERS", redis.Args{key}
+	}
+	t.Command(command, args, newScanCollectionHandler(mr.specFieldValue(fs), mr.spec.marshalerUnmarshalerFor(fs)))
+}
+
+// collectionAddCommand returns the name of the redis command used to add elements
+// to the list or set which stores the field.
+func (fs *fieldSpec) collectionAddCommand() string {
+	if fs.kind == setField {
+		return "SADD"
+	}
+	return "RPUSH"
+}
+
+// PushToField atomically appends values to the end of the field identified by
+// fieldName for the model with the given id. The field must have the
+// `redisType:"list"` struct tag, and each value must have the same type as the
+// elements of the field. Because the field is stored as a redis list, PushToField
+// uses a single RPUSH command and does not require rewriting the entire list. It
+// returns an error if the field is not a list field, if any of the values are the
+// wrong type, or if there was a problem connecting to the database.
+func (mt *ModelType) PushToField(id string, fieldName string, values ...interface{}) error {
+	return runOp(&Op{Kind: PushToFieldOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.PushToField(mt, id, fieldName, values...)
+		return t.Exec()
+	})
+}
+
+// PushToField appends values to the end of the field identified by fieldName in an
+// existing transaction. See ModelType.PushToField for more information. Any errors
+// encountered will be added to the transaction and returned as an error when the
+// transaction is executed.
+func (t *Transaction) PushToField(mt *ModelType, id string, fieldName string, values ...interface{}) {
+	fs, err := mt.spec.checkCollectionField(fieldName, listField, values)
+	if err != nil {
+		t.setError(fmt.Errorf("zoom: Error in PushToField: %s", err.Error()))
+		return
+	}
+	if id == "" {
+		t.setError(fmt.Errorf("zoom: Error in PushToField: id was empty"))
+		return
+	}
+	elems, err := collectionArgs(reflect.ValueOf(values), mt.spec.marshalerUnmarshalerFor(fs))
+	if err != nil {
+		t.setError(err)
+		return
+	}
+	if len(elems) == 0 {
+		return
+	}
+	t.Command("RPUSH", redis.Args{mt.spec.fieldKey(id, fs)}.Add(elems...), mt.spec.newForgetTrackedHandler(mt.spec.keyName()+":"+id, nil))
+	t.recordCollectionChange(mt, id, fs)
+}
+
+// AddToSetField atomically adds values to the field identified by fieldName for the
+// model with the given id. The field must have the `redisType:"set"` struct tag, and
+// each value must have the same type as the elements of the field. Because the field
+// is stored as a redis set, AddToSetField uses a single SADD command. Values which are
+// already members of the set are ignored. It returns an error if the field is not
+// a set field, if any of the values are the wrong type, or if there was a problem
+// connecting to the database.
+func (mt *ModelType) AddToSetField(id string, fieldName string, values ...interface{}) error {
+	return runOp(&Op{Kind: AddToSetFieldOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.AddToSetField(mt, id, fieldName, values...)
+		return t.Exec()
+	})
+}
+
+// AddToSetField adds values to the field identified by fieldName in an existing
+// transaction. See ModelType.AddToSetField for more information. Any errors
+// encountered will be added to the transaction and returned as an error when the
+// transaction is executed.
+func (t *Transaction) AddToSetField(mt *ModelType, id string, fieldName string, values ...interface{}) {
+	if fs := t.setFieldCommand("AddToSetField", "SADD", mt, id, fieldName, values, mt.spec.newForgetTrackedHandler(mt.spec.keyName()+":"+id, nil)); fs != nil {
+		t.recordCollectionChange(mt, id, fs)
+	}
+}
+
+// RemoveFromSetField atomically removes values from the field identified by fieldName
+// for the model with the given id. The field must have the `redisType:"set"` struct
+// tag, and each value must have the same type as the elements of the field. Values
+// which are not members of the set are ignored. It returns an error if the field
+// is not a set field, if any of the values are the wrong type, or if there was a
+// problem connecting to the database.
+func (mt *ModelType) RemoveFromSetField(id string, fieldName string, values ...interface{}) error {
+	return runOp(&Op{Kind: RemoveFromSetFieldOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.RemoveFromSetField(mt, id, fieldName, values...)
+		return t.Exec()
+	})
+}
+
+// RemoveFromSetField removes values from the field identified by fieldName in an
+// existing transaction. See ModelType.RemoveFromSetField for more information. Any
+// errors encountered will be added to the transaction and returned as an error when
+// the transaction is executed.
+func (t *Transaction) RemoveFromSetField(mt *ModelType, id string, fieldName string, values ...interface{}) {
+	if fs := t.setFieldCommand("RemoveFromSetField", "SREM", mt, id, fieldName, values, mt.spec.newForgetTrackedHandler(mt.spec.keyName()+":"+id, nil)); fs != nil {
+		t.recordCollectionChange(mt, id, fs)
+	}
+}
+
+// SetFieldContains returns true iff value is a member of the field identified by
+// fieldName for the model with the given id. The field must have the
+// `redisType:"set"` struct tag, and value must have the same type as the elements of
+// the field. It uses a single SISMEMBER command, so the model itself is not retrieved.
+// It returns an error if the field is not a set field, if value is the wrong type, or
+// if there was a problem connecting to the database.
+func (mt *ModelType) SetFieldContains(id string, fieldName string, value interface{}) (bool, error) {
+	contains := false
+	err := runOp(&Op{Kind: SetFieldContainsOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.SetFieldContains(mt, id, fieldName, value, &contains)
+		return t.Exec()
+	})
+	return contains, err
+}
+
+// SetFieldContains checks whether value is a member of the field identified by
+// fieldName in an existing transaction. The value of contains will be set when the
+// transaction is executed. See ModelType.SetFieldContains for more information. Any
+// errors encountered will be added to the transaction and returned as an error when
+// the transaction is executed.
+func (t *Transaction) SetFieldContains(mt *ModelType, id string, fieldName string, value interface{}, contains *bool) {
+	t.setFieldCommand("SetFieldContains", "SISMEMBER", mt, id, fieldName, []interface{}{value}, newScanBoolHandler(contains))
+}
+
+// setFieldCommand adds a command to the transaction which operates on the set
+// which stores the field identified by fieldName. The values will be converted
+// to a format suitable for redis and passed to the command as arguments after the
+// key for the set. caller is the name of the exported method, used in error messages.
+// It returns the spec for the field if the command was added and nil otherwise.
+func (t *Transaction) setFieldCommand(caller string, command string, mt *ModelType, id string, fieldName string, values []interface{}, handler ReplyHandler) *fieldSpec {
+	fs, err := mt.spec.checkCollectionField(fieldName, setField, values)
+	if err != nil {
+		t.setError(fmt.Errorf("zoom: Error in %s: %s", caller, err.Error()))
+		return nil
+	}
+	if id == "" {
+		t.setError(fmt.Errorf("zoom: Error in %s: id was empty", caller))
+		return nil
+	}
+	elems, err := collectionArgs(reflect.ValueOf(values), mt.spec.marshalerUnmarshalerFor(fs))
+	if err != nil {
+		t.setError(err)
+		return nil
+	}
+	if len(elems) == 0 {
+		return nil
+	}
+	t.Command(command, redis.Args{mt.spec.fieldKey(id, fs)}.Add(elems...), handler)
+	return fs
+}
+
+// recordCollectionChange adds commands to the transaction which append a record
+// to the audit trail (if any) and record a ChangeEvent for the model with the
+// given id after the field identified by fs was modified in place. Like the
+// other fields which are stored outside of the main hash, the values of the
+// field are not included in the audit record.
+func (t *Transaction) recordCollectionChange(mt *ModelType, id string, fs *fieldSpec) {
+	if mt.spec.auditMaxLen != 0 {
+		t.appendAuditRecord(mt.spec, "save", id, nil)
+	}
+	t.recordChange(mt.spec, &ChangeEvent{
+		ModelName: mt.spec.name,
+		Id:        id,
+		Kind:      SaveOp,
+		Fields:    []string{fs.name},
+	}, nil)
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File compression.go contains code related to compressing fields
+// with the "compress" option in their zoom struct tag.
+
+package zoom
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// gzipMagic is the header that begins every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressValue compresses data using gzip.
+func compressValue(data []byte) ([]byte, error) {
+	var buff bytes.Buffer
+	w := gzip.NewWriter(&buff)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// decompressValue reverses compressValue. If data does not start with the gzip
+// header, it is assumed to have been saved before the field was compressed and is
+// returned as is.
+func decompressValue(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
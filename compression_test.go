@@ -0,0 +1,71 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File compression_test.go tests the code in compression.go, i.e.
+// compressing fields with the "compress" option.
+
+package zoom
+
+import (
+	"bytes"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// compressedModel is a model type that is only used for testing
+// compressed fields
+type compressedModel struct {
+	Body  string `zoom:"compress"`
+	Bytes []byte `zoom:"compress"`
+	DefaultData
+}
+
+func TestCompressedFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	compressedModels := registerTestType(t, &compressedModel{})
+
+	model := &compressedModel{
+		Body:  strings.Repeat(randomString(), 100),
+		Bytes: bytes.Repeat([]byte(randomString()), 100),
+	}
+	if err := compressedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The stored value should be gzipped and smaller than the original
+	conn := NewConn()
+	defer conn.Close()
+	key, _ := compressedModels.ModelKey(model.Id())
+	gotBody, err := redis.Bytes(conn.Do("HGET", key, "Body"))
+	if err != nil {
+		t.Fatalf("Unexpected error in HGET: %s", err.Error())
+	}
+	if !bytes.HasPrefix(gotBody, gzipMagic) || len(gotBody) >= len(model.Body) {
+		t.Errorf("Expected Body to be compressed but got %d bytes: %q", len(gotBody), gotBody)
+	}
+
+	modelCopy := &compressedModel{}
+	if err := compressedModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+
+	// Values which were saved before the field was compressed should still
+	// be readable
+	if _, err := conn.Do("HSET", key, "Body", "uncompressed"); err != nil {
+		t.Fatalf("Unexpected error in HSET: %s", err.Error())
+	}
+	if err := compressedModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if modelCopy.Body != "uncompressed" {
+		t.Errorf("Expected Body to be %q but got %q", "uncompressed", modelCopy.Body)
+	}
+}
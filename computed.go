@@ -0,0 +1,51 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File computed.go contains code related to computed (or derived)
+// fields, which are set by a function just before a model is saved.
+
+package zoom
+
+import (
+	"fmt"
+)
+
+// ComputeFunc is a function which sets the values of one or more fields of
+// model based on its other fields, e.g. setting a Slug field from a Title field.
+// model will always be of the registered type, so it is safe to use a type
+// assertion. If a ComputeFunc returns an error, the model will not be saved and
+// Save returns a HookError.
+type ComputeFunc func(model Model) error
+
+// ComputeFields is a ModelOption which causes fn to be called with each model of
+// the given type just before it is saved. The fields set by fn are ordinary
+// fields, so they are stored and can be indexed and queried like any other field.
+// ComputeFields may be used more than once, in which case each ComputeFunc is
+// called in the order given. Since fn is called before determining which fields
+// have changed, computed fields are saved as expected when used with
+// TrackChanges.
+func ComputeFields(fn ComputeFunc) ModelOption {
+	return func(spec *modelSpec) error {
+		if fn == nil {
+			return fmt.Errorf("zoom: ComputeFields requires a non-nil ComputeFunc")
+		}
+		spec.computeFuncs = append(spec.computeFuncs, fn)
+		return nil
+	}
+}
+
+// computeFields calls each ComputeFunc for mr.spec with mr.model.
+func (mr *modelRef) computeFields() error {
+	for _, fn := range mr.spec.computeFuncs {
+		if err := fn(mr.model); err != nil {
+			return HookError{
+				ModelName: mr.spec.name,
+				Id:        mr.model.Id(),
+				Hook:      "ComputeFields",
+				Err:       err,
+			}
+		}
+	}
+	return nil
+}
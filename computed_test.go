@@ -0,0 +1,63 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File computed_test.go tests the code in computed.go, i.e.
+// computed fields which are set just before saving.
+
+package zoom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type computedModel struct {
+	Title string
+	Slug  string `zoom:"index"`
+	DefaultData
+}
+
+func TestComputeFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	computedModels := registerTestType(t, &computedModel{}, ComputeFields(func(model Model) error {
+		m := model.(*computedModel)
+		if m.Title == "" {
+			return errors.New("Title is required")
+		}
+		m.Slug = strings.Replace(strings.ToLower(m.Title), " ", "-", -1)
+		return nil
+	}))
+
+	model := &computedModel{Title: "Hello World"}
+	if err := computedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if model.Slug != "hello-world" {
+		t.Errorf("Expected Slug to be computed as %q but got %q", "hello-world", model.Slug)
+	}
+
+	// The computed field should be indexed like any other field
+	var found []*computedModel
+	if err := computedModels.NewQuery().Filter("Slug =", "hello-world").Run(&found); err != nil {
+		t.Fatalf("Unexpected error in Query.Run: %s", err.Error())
+	}
+	if len(found) != 1 || found[0].Id() != model.Id() {
+		t.Errorf("Expected query to find the model with the computed Slug but got %v", found)
+	}
+
+	// If the ComputeFunc returns an error, nothing should be saved
+	if err := computedModels.Save(&computedModel{}); err == nil {
+		t.Error("Expected an error from the ComputeFunc but got none")
+	}
+	count, err := computedModels.Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 model to be saved but got %d", count)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File connection_hooks.go contains code related to hooks which
+// run when there is a problem with a connection to the database.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"strings"
+)
+
+// ConnectionHooks is a set of functions which are called when zoom detects a
+// problem with a connection to the database. They can be used for logging,
+// alerting, or circuit-breaking. Any of the functions may be nil. Hooks can be
+// added to the default pool with AddConnectionHooks or to any other pool with
+// Pool.AddConnectionHooks. The functions may be called concurrently from
+// multiple goroutines.
+type ConnectionHooks struct {
+	// ConnectionDropped is called when a connection is found to be broken,
+	// either by the health check when it is taken from the pool or because an
+	// operation failed with a network error. err is the error which caused the
+	// connection to be dropped.
+	ConnectionDropped func(err error)
+	// PoolExhausted is called when a connection could not be taken from the
+	// pool because MaxActive connections are in use and Wait is false.
+	PoolExhausted func()
+	// Failover is called when the database rejects a command with a READONLY
+	// error. This typically means the server at Address was demoted to a
+	// replica during a failover (e.g. one initiated by Redis Sentinel). err is
+	// the error returned by the database.
+	Failover func(err error)
+	// BackgroundError is called when a task which zoom runs in the background,
+	// such as publishing coalesced change events (see CoalesceChanges), fails
+	// and there is no caller to return the error to.
+	BackgroundError func(err error)
+}
+
+// AddConnectionHooks adds hooks which will run when there is a problem with a
+// connection from the default pool. It is not safe to call AddConnectionHooks
+// concurrently with other zoom functions, so it should typically be called
+// during application startup.
+func AddConnectionHooks(hooks ConnectionHooks) {
+	defaultPool.AddConnectionHooks(hooks)
+}
+
+// AddConnectionHooks is like the package-level AddConnectionHooks function but
+// adds hooks for p instead of the default pool.
+func (p *Pool) AddConnectionHooks(hooks ConnectionHooks) {
+	p.connectionHooks = append(p.connectionHooks, hooks)
+}
+
+// checkConn calls the PoolExhausted hooks if conn could not be taken from the
+// pool because it was exhausted. It returns conn.
+func (p *Pool) checkConn(conn redis.Conn) redis.Conn {
+	if len(p.connectionHooks) > 0 && conn.Err() == redis.ErrPoolExhausted {
+		for _, hooks := range p.connectionHooks {
+			if hooks.PoolExhausted != nil {
+				hooks.PoolExhausted()
+			}
+		}
+	}
+	return conn
+}
+
+// checkError calls the appropriate hooks if err, which was returned from an
+// operation on conn, indicates a problem with the connection.
+func (p *Pool) checkError(conn redis.Conn, err error) {
+	if redisErr, ok := err.(redis.Error); ok {
+		if strings.HasPrefix(string(redisErr), "READONLY") {
+			for _, hooks := range p.connectionHooks {
+				if hooks.Failover != nil {
+					hooks.Failover(err)
+				}
+			}
+		}
+		return
+	}
+	if connErr := conn.Err(); connErr != nil && connErr != redis.ErrPoolExhausted {
+		p.runConnectionDroppedHooks(connErr)
+	}
+}
+
+// runBackgroundErrorHooks calls each BackgroundError hook with err.
+func (p *Pool) runBackgroundErrorHooks(err error) {
+	for _, hooks := range p.connectionHooks {
+		if hooks.BackgroundError != nil {
+			hooks.BackgroundError(err)
+		}
+	}
+}
+
+// runConnectionDroppedHooks calls each ConnectionDropped hook with err.
+func (p *Pool) runConnectionDroppedHooks(err error) {
+	for _, hooks := range p.connectionHooks {
+		if hooks.ConnectionDropped != nil {
+			hooks.ConnectionDropped(err)
+		}
+	}
+}
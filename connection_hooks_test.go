@@ -0,0 +1,50 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File connection_hooks_test.go tests the code in connection_hooks.go,
+// i.e. running hooks when there is a problem with a connection.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"testing"
+)
+
+func TestConnectionHooks(t *testing.T) {
+	dropped, exhausted, failovers := 0, 0, 0
+	p := &Pool{state: &poolState{networkRetries: 1}}
+	p.AddConnectionHooks(ConnectionHooks{
+		ConnectionDropped: func(err error) { dropped++ },
+		PoolExhausted:     func() { exhausted++ },
+		Failover:          func(err error) { failovers++ },
+	})
+
+	// A transaction which is retried because of a broken connection should
+	// cause the ConnectionDropped hooks to run
+	calls := 0
+	tx := newTransaction(p, newBrokenConnGetter(1, &calls))
+	tx.Command("HGET", redis.Args{"key", "field"}, nil)
+	if err := tx.Exec(); err != nil {
+		t.Fatalf("Unexpected error in Exec: %s", err.Error())
+	}
+	if dropped != 1 {
+		t.Errorf("Expected ConnectionDropped to be called once but got %d", dropped)
+	}
+
+	// An exhausted pool should cause the PoolExhausted hooks to run
+	p.checkConn(brokenConn{err: redis.ErrPoolExhausted, calls: &calls})
+	if exhausted != 1 {
+		t.Errorf("Expected PoolExhausted to be called once but got %d", exhausted)
+	}
+
+	// A READONLY error should cause the Failover hooks to run
+	p.checkError(brokenConn{calls: &calls}, redis.Error("READONLY You can't write against a read only replica."))
+	if failovers != 1 {
+		t.Errorf("Expected Failover to be called once but got %d", failovers)
+	}
+	if dropped != 1 || exhausted != 1 {
+		t.Errorf("Expected other hooks not to be called again but got dropped = %d, exhausted = %d", dropped, exhausted)
+	}
+}
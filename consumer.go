@@ -0,0 +1,274 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File consumer.go contains code related to processing the changelog
+// for a type with a redis consumer group.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// consumerBlockTimeout is how long a ChangeConsumer waits for new entries
+	// before checking whether it has been closed. It should be less than the
+	// ReadTimeout for the pool (if any).
+	consumerBlockTimeout = time.Second
+	// consumerMinIdleTime is how long an entry must be pending (i.e. delivered
+	// but not acknowledged) before it is claimed and handled again.
+	consumerMinIdleTime = 30 * time.Second
+)
+
+// ChangeConsumer handles the entries in the changelog for a type as part of a
+// consumer group. It is created with ModelType.ConsumeChanges.
+type ChangeConsumer struct {
+	spec     *modelSpec
+	group    string
+	consumer string
+	handler  func(ChangeEvent) error
+	// err is the first error encountered by the consumer
+	err   error
+	errMu sync.Mutex
+	// stop is closed to stop the consumer and done is closed when it has
+	// stopped
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ConsumeChanges starts a background goroutine which calls handler for entries
+// in the changelog for the given type as the consumer with the given name in
+// the given consumer group (see http://redis.io/topics/streams-intro). The
+// group is created if it does not already exist, in which case it starts with
+// the oldest entry in the changelog. Each entry is delivered to only one
+// consumer in the group, so a pool of workers (in one or more processes) can
+// share the load by using the same group and different consumer names. An entry
+// is acknowledged when handler returns nil. If handler returns an error, or the
+// consumer stops before handler returns, the entry stays pending and is claimed
+// and handled again by some consumer in the group once it has been pending for
+// 30 seconds. This means each entry is usually handled exactly once, but may be
+// handled more than once, so handler should be idempotent. When a consumer
+// starts, it first handles any entries which are still pending for its name,
+// so a worker which restarts with the same name picks up where it left off. The
+// type must use the StreamChanges option. The consumer runs until Close is
+// called.
+func (mt *ModelType) ConsumeChanges(group string, consumer string, handler func(ChangeEvent) error) (*ChangeConsumer, error) {
+	if mt.spec.changelog == nil {
+		return nil, fmt.Errorf("zoom: Error in ConsumeChanges: %s was not registered with the StreamChanges option", mt.Name())
+	}
+	if group == "" || consumer == "" {
+		return nil, fmt.Errorf("zoom: Error in ConsumeChanges: group and consumer cannot be empty")
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("zoom: Error in ConsumeChanges: handler cannot be nil")
+	}
+	conn := mt.spec.pool.NewConn()
+	_, err := conn.Do("XGROUP", "CREATE", mt.spec.changelogKey(), group, "0", "MKSTREAM")
+	conn.Close()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("zoom: Error in ConsumeChanges: %s", err.Error())
+	}
+	c := &ChangeConsumer{
+		spec:     mt.spec,
+		group:    group,
+		consumer: consumer,
+		handler:  handler,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+// run handles the entries which are pending for c, then handles new and
+// claimed entries until c is closed.
+func (c *ChangeConsumer) run() {
+	defer close(c.done)
+	if err := c.handlePending(); err != nil {
+		c.setError(err)
+	}
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		if err := c.claimIdle(); err != nil {
+			c.setError(err)
+		}
+		if err := c.readNew(); err != nil {
+			c.setError(err)
+			// Avoid spinning if the database is unavailable
+			select {
+			case <-c.stop:
+				return
+			case <-time.After(consumerBlockTimeout):
+			}
+		}
+	}
+}
+
+// handlePending handles the entries which were delivered to c (or an earlier
+// consumer with the same name) but not acknowledged.
+func (c *ChangeConsumer) handlePending() error {
+	lastId := "0"
+	for {
+		events, err := c.readGroup(lastId, false)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		for _, event := range events {
+			select {
+			case <-c.stop:
+				return nil
+			default:
+			}
+			c.handle(event)
+			lastId = event.StreamId
+		}
+	}
+}
+
+// readNew waits for entries which have not been delivered to any consumer in
+// the group and handles them.
+func (c *ChangeConsumer) readNew() error {
+	events, err := c.readGroup(">", true)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		c.handle(event)
+	}
+	return nil
+}
+
+// readGroup reads entries after the given id with XREADGROUP. If block is true,
+// it waits up to consumerBlockTimeout for new entries.
+func (c *ChangeConsumer) readGroup(id string, block bool) ([]ChangeEvent, error) {
+	args := redis.Args{"GROUP", c.group, c.consumer, "COUNT", changelogBatchSize}
+	if block {
+		args = args.Add("BLOCK", int64(consumerBlockTimeout/time.Millisecond))
+	}
+	args = args.Add("STREAMS", c.spec.changelogKey(), id)
+	conn := c.spec.pool.NewConn()
+	defer conn.Close()
+	reply, err := conn.Do("XREADGROUP", args...)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error())
+	}
+	if reply == nil {
+		return nil, nil
+	}
+	events, err := parseXReadReply(reply)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error())
+	}
+	return events, nil
+}
+
+// claimIdle claims the entries which have been pending for any consumer in the
+// group for at least consumerMinIdleTime and handles them.
+func (c *ChangeConsumer) claimIdle() error {
+	key := c.spec.changelogKey()
+	minIdle := int64(consumerMinIdleTime / time.Millisecond)
+	conn := c.spec.pool.NewConn()
+	defer conn.Close()
+	pending, err := redis.Values(conn.Do("XPENDING", key, c.group, "-", "+", changelogBatchSize))
+	if err != nil {
+		return fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error())
+	}
+	// Each pending entry is an array of its id, consumer, idle time in
+	// milliseconds, and number of deliveries
+	args := redis.Args{key, c.group, c.consumer, minIdle}
+	numIds := 0
+	for _, p := range pending {
+		var id, consumer string
+		var idle, deliveries int64
+		fields, err := redis.Values(p, nil)
+		if err != nil {
+			return fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error())
+		}
+		if _, err := redis.Scan(fields, &id, &consumer, &idle, &deliveries); err != nil {
+			return fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error())
+		}
+		if idle >= minIdle {
+			args = args.Add(id)
+			numIds++
+		}
+	}
+	if numIds == 0 {
+		return nil
+	}
+	entries, err := redis.Values(conn.Do("XCLAIM", args...))
+	if err != nil {
+		return fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error())
+	}
+	for _, entry := range entries {
+		values, ok := entry.([]interface{})
+		if !ok || len(values) != 2 || values[1] == nil {
+			// The entry was trimmed from the stream after it was delivered, so
+			// it can never be handled.
+			if ok && len(values) > 0 {
+				conn.Do("XACK", key, c.group, values[0])
+			}
+			continue
+		}
+		event, err := parseChangelogEntry(entry)
+		if err != nil {
+			return fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error())
+		}
+		c.handle(event)
+	}
+	return nil
+}
+
+// handle calls the handler for event and acknowledges it if the handler was
+// successful.
+func (c *ChangeConsumer) handle(event ChangeEvent) {
+	if err := c.handler(event); err != nil {
+		c.setError(err)
+		return
+	}
+	conn := c.spec.pool.NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("XACK", c.spec.changelogKey(), c.group, event.StreamId); err != nil {
+		c.setError(fmt.Errorf("zoom: Error in ChangeConsumer: %s", err.Error()))
+	}
+}
+
+// setError sets the error for c if it does not already have one.
+func (c *ChangeConsumer) setError(err error) {
+	c.errMu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.errMu.Unlock()
+}
+
+// Err returns the first error encountered by the consumer, if any, including
+// errors returned by the handler. Errors do not stop the consumer.
+func (c *ChangeConsumer) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// Close stops the consumer and waits for it to finish handling the current
+// entry (if any). Entries which were delivered to the consumer but not yet
+// handled remain pending. It returns the same error as Err.
+func (c *ChangeConsumer) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+	return c.Err()
+}
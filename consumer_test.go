@@ -0,0 +1,136 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File consumer_test.go tests the code in consumer.go.
+
+package zoom
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumeChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, StreamChanges(StreamOptions{}))
+
+	// Start two consumers in the same group and make sure each event is
+	// handled exactly once.
+	handled := map[string]int{}
+	handledMu := sync.Mutex{}
+	handler := func(event ChangeEvent) error {
+		handledMu.Lock()
+		handled[event.Id]++
+		handledMu.Unlock()
+		return nil
+	}
+	consumers := []*ChangeConsumer{}
+	for _, name := range []string{"a", "b"} {
+		c, err := publishedModels.ConsumeChanges("workers", name, handler)
+		if err != nil {
+			t.Fatalf("Unexpected error in ConsumeChanges: %s", err.Error())
+		}
+		consumers = append(consumers, c)
+	}
+	models := []*publishedModel{{Name: "Alice"}, {Name: "Bob"}, {Name: "Carol"}}
+	for _, model := range models {
+		if err := publishedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		handledMu.Lock()
+		count := len(handled)
+		handledMu.Unlock()
+		if count == len(models) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for events. Handled: %v", handled)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, c := range consumers {
+		if err := c.Close(); err != nil {
+			t.Errorf("Unexpected error in Close: %s", err.Error())
+		}
+	}
+	for _, model := range models {
+		if handled[model.Id()] != 1 {
+			t.Errorf("Expected event for %s to be handled once but got %d", model.Id(), handled[model.Id()])
+		}
+	}
+}
+
+func TestConsumeChangesClaim(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	originalMinIdleTime := consumerMinIdleTime
+	consumerMinIdleTime = 10 * time.Millisecond
+	defer func() {
+		consumerMinIdleTime = originalMinIdleTime
+	}()
+	publishedModels := registerPublishedModels(t, StreamChanges(StreamOptions{}))
+	model := &publishedModel{Name: "Alice"}
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The first time the event is handled it fails, so it should stay pending
+	// and be claimed again.
+	handlerErr := errors.New("failed")
+	attempts := make(chan ChangeEvent, 10)
+	numAttempts := 0
+	c, err := publishedModels.ConsumeChanges("workers", "a", func(event ChangeEvent) error {
+		numAttempts++
+		attempts <- event
+		if numAttempts == 1 {
+			return handlerErr
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in ConsumeChanges: %s", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-attempts:
+			if event.Id != model.Id() {
+				t.Errorf("Expected event for %s but got %#v", model.Id(), event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for attempt %d", i+1)
+		}
+	}
+	if err := c.Close(); err != handlerErr {
+		t.Errorf("Expected the error from the handler but got %v", err)
+	}
+
+	// After the second attempt succeeded, nothing should be pending
+	conn := NewConn()
+	defer conn.Close()
+	reply, err := conn.Do("XPENDING", publishedModels.ChangelogKey(), "workers", "-", "+", 10)
+	if err != nil {
+		t.Fatalf("Unexpected error in XPENDING: %s", err.Error())
+	}
+	if pending, _ := reply.([]interface{}); len(pending) != 0 {
+		t.Errorf("Expected no pending entries but got %v", pending)
+	}
+}
+
+func TestConsumeChangesRequiresStream(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t)
+	if _, err := publishedModels.ConsumeChanges("workers", "a", func(ChangeEvent) error { return nil }); err == nil {
+		t.Error("Expected an error for a type without the StreamChanges option")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File context.go contains code related to respecting the deadlines
+// and cancellation of a context.Context, including variants of the
+// most common operations which accept a context.
+
+package zoom
+
+import (
+	"context"
+	"github.com/garyburd/redigo/redis"
+)
+
+// contextConn wraps a redis.Conn so that Do, Send, Flush, and Receive return
+// ctx.Err() as soon as ctx is done instead of waiting for the database. The
+// interrupted operation keeps running in the background, and the underlying
+// connection is not returned to the pool until it finishes, so that a reply
+// which arrives late is never read by someone else.
+type contextConn struct {
+	redis.Conn
+	ctx context.Context
+	// pending is closed when an interrupted operation finishes. It is nil
+	// if no operation was interrupted.
+	pending chan struct{}
+}
+
+// newContextConn returns a connection which respects the deadline and
+// cancellation of ctx.
+func newContextConn(ctx context.Context, conn redis.Conn) redis.Conn {
+	return &contextConn{Conn: conn, ctx: ctx}
+}
+
+// wait calls fn and waits for it to return or for c.ctx to be done, whichever
+// happens first. It returns c.ctx.Err() if fn was not called or did not
+// return in time.
+func (c *contextConn) wait(fn func()) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if c.ctx.Done() == nil {
+		// The context can never be canceled, so there is no need for a
+		// separate goroutine
+		fn()
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-c.ctx.Done():
+		c.pending = done
+		return c.ctx.Err()
+	}
+}
+
+func (c *contextConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	var reply interface{}
+	var err error
+	if ctxErr := c.wait(func() { reply, err = c.Conn.Do(commandName, args...) }); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return reply, err
+}
+
+func (c *contextConn) Send(commandName string, args ...interface{}) error {
+	var err error
+	if ctxErr := c.wait(func() { err = c.Conn.Send(commandName, args...) }); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (c *contextConn) Flush() error {
+	var err error
+	if ctxErr := c.wait(func() { err = c.Conn.Flush() }); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (c *contextConn) Receive() (interface{}, error) {
+	var reply interface{}
+	var err error
+	if ctxErr := c.wait(func() { reply, err = c.Conn.Receive() }); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return reply, err
+}
+
+// Close returns the underlying connection to the pool. If an operation was
+// interrupted, the connection is returned in the background once the operation
+// finishes.
+func (c *contextConn) Close() error {
+	if c.pending != nil {
+		go func() {
+			<-c.pending
+			c.Conn.Close()
+		}()
+		return nil
+	}
+	return c.Conn.Close()
+}
+
+// NewTransactionContext is like NewTransaction but the returned transaction
+// respects the deadline and cancellation of ctx. If ctx is done before the
+// transaction finishes executing, Exec returns ctx.Err(). Note that if ctx is
+// done after the transaction was sent to the database, the transaction may
+// still be committed.
+func NewTransactionContext(ctx context.Context) *Transaction {
+	return defaultPool.NewTransactionContext(ctx)
+}
+
+// NewTransactionContext is like the package-level NewTransactionContext
+// function but uses p instead of the default pool.
+func (p *Pool) NewTransactionContext(ctx context.Context) *Transaction {
+	return withContext(ctx, p.NewTransaction())
+}
+
+// withContext changes the connection used by t so that it respects the
+// deadline and cancellation of ctx and then returns t.
+func withContext(ctx context.Context, t *Transaction) *Transaction {
+	t.conn = newContextConn(ctx, t.conn)
+	t.actor = actorFromContext(ctx)
+	newConn := t.newConn
+	t.newConn = func() redis.Conn {
+		return newContextConn(ctx, newConn())
+	}
+	return t
+}
+
+// SaveContext is like Save but respects the deadline and cancellation of ctx.
+func (mt *ModelType) SaveContext(ctx context.Context, model Model) error {
+	return runOp(&Op{Kind: SaveOp, ModelName: mt.Name(), Model: model, Context: ctx}, func() error {
+		t := mt.spec.pool.NewTransactionContext(ctx)
+		t.Save(mt, model)
+		return t.Exec()
+	})
+}
+
+// FindContext is like Find but respects the deadline and cancellation of ctx.
+func (mt *ModelType) FindContext(ctx context.Context, id string, model Model) error {
+	return runOp(&Op{Kind: FindOp, ModelName: mt.Name(), Id: id, Model: model, Context: ctx}, func() error {
+		t := withContext(ctx, mt.newReadTransaction())
+		t.Find(mt, id, model)
+		return t.Exec()
+	})
+}
+
+// FindAllContext is like FindAll but respects the deadline and cancellation of
+// ctx.
+func (mt *ModelType) FindAllContext(ctx context.Context, models interface{}) error {
+	return runOp(&Op{Kind: FindAllOp, ModelName: mt.Name(), Models: models, Context: ctx}, func() error {
+		t := withContext(ctx, mt.newReadTransaction())
+		t.FindAll(mt, models)
+		return t.Exec()
+	})
+}
+
+// CountContext is like Count but respects the deadline and cancellation of ctx.
+func (mt *ModelType) CountContext(ctx context.Context) (int, error) {
+	count := 0
+	err := runOp(&Op{Kind: CountOp, ModelName: mt.Name(), Context: ctx}, func() error {
+		t := withContext(ctx, mt.newReadTransaction())
+		t.Count(mt, &count)
+		return t.Exec()
+	})
+	return count, err
+}
+
+// DeleteContext is like Delete but respects the deadline and cancellation of
+// ctx.
+func (mt *ModelType) DeleteContext(ctx context.Context, id string) (bool, error) {
+	deleted := false
+	err := runOp(&Op{Kind: DeleteOp, ModelName: mt.Name(), Id: id, Context: ctx}, func() error {
+		t := mt.spec.pool.NewTransactionContext(ctx)
+		t.Delete(mt, id, &deleted)
+		return t.Exec()
+	})
+	return deleted, err
+}
+
+// RunContext is like Run but respects the deadline and cancellation of ctx.
+func (q *Query) RunContext(ctx context.Context, models interface{}) error {
+	return runOp(q.newOp(QueryRunOp, models, ctx), func() error {
+		return q.run(func() *Transaction { return withContext(ctx, q.newReadTransaction()) }, models)
+	})
+}
+
+// IdsContext is like Ids but respects the deadline and cancellation of ctx.
+func (q *Query) IdsContext(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := runOp(q.newOp(QueryIdsOp, nil, ctx), func() error {
+		var err error
+		ids, err = q.ids(func() *Transaction { return withContext(ctx, q.newReadTransaction()) })
+		return err
+	})
+	return ids, err
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File context_test.go tests the code in context.go, i.e.
+// respecting the deadlines and cancellation of a context.
+
+package zoom
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestContextOperations(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	ctx := context.Background()
+	model := createTestModels(1)[0]
+	if err := testModels.SaveContext(ctx, model); err != nil {
+		t.Fatalf("Unexpected error in SaveContext: %s", err.Error())
+	}
+	modelCopy := &testModel{}
+	if err := testModels.FindContext(ctx, model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in FindContext: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+	gotModels := []*testModel{}
+	if err := testModels.NewQuery().RunContext(ctx, &gotModels); err != nil {
+		t.Fatalf("Unexpected error in RunContext: %s", err.Error())
+	}
+	if len(gotModels) != 1 {
+		t.Errorf("Expected 1 model from RunContext but got %d", len(gotModels))
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	model := createTestModels(1)[0]
+	if err := testModels.SaveContext(ctx, model); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from SaveContext but got: %v", err)
+	}
+	if count, err := testModels.Count(); err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	} else if count != 0 {
+		t.Errorf("Expected no models to be saved but got %d", count)
+	}
+	if _, err := testModels.NewQuery().IdsContext(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from IdsContext but got: %v", err)
+	}
+}
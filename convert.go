@@ -8,8 +8,10 @@
 package zoom
 
 import (
+	"errors"
 	"fmt"
 	"github.com/garyburd/redigo/redis"
+	"math"
 	"reflect"
 	"strconv"
 )
@@ -23,39 +25,97 @@ import (
 // not the redis names which may be custom.
 func scanModel(fieldNames []string, fieldValues []interface{}, mr *modelRef) error {
 	ms := mr.spec
+	// Run any migrations if the model was saved with an older schema version
+	migrated, err := mr.migrate(fieldNames, fieldValues)
+	if err != nil {
+		return err
+	}
+	// Set the id first, since the key of the model is needed to decrypt
+	// encrypted fields. The Id signified by the field name "-" since that
+	// cannot possibly collide with other field names.
+	for i, fieldName := range fieldNames {
+		if fieldName == "-" {
+			id, err := redis.String(fieldValues[i], nil)
+			if err != nil {
+				return err
+			}
+			mr.model.SetId(id)
+		}
+	}
 	for i, reply := range fieldValues {
 		fieldName := fieldNames[i]
-		replyBytes, err := redis.Bytes(reply, nil)
-		if err != nil {
-			return err
-		}
-		if fieldName == "-" {
-			// The Id signified by the field name "-" since that cannot
-			// possibly collide with other field names.
-			mr.model.SetId(string(replyBytes))
+		if fieldName == versionFieldName || fieldName == "-" {
 			continue
 		}
 		fs, found := ms.fieldsByName[fieldName]
 		if !found {
 			return fmt.Errorf("zoom: Error in scanModel: Could not find field %s in %T", fieldName, mr.model)
 		}
-		fieldVal := mr.fieldValue(fieldName)
-		switch fs.kind {
-		case primativeField:
-			if err := scanPrimativeVal(replyBytes, fieldVal); err != nil {
-				return err
-			}
-		case pointerField:
-			if err := scanPointerVal(replyBytes, fieldVal); err != nil {
-				return err
-			}
-		default:
-			if err := scanInconvertibleVal(replyBytes, fieldVal); err != nil {
-				return err
-			}
+		if err := mr.scanField(fs, reply); err != nil {
+			return err
 		}
 	}
-	return nil
+	// Remember which lazy fields were not loaded, so they are not overwritten
+	// when the model is saved
+	mr.setUnloadedFields(fieldNames)
+	if migrated {
+		// The model does not match what is stored in the database, so it should
+		// be saved in full next time
+		if ms.trackChanges {
+			mr.model.(snapshotter).setSnapshot(nil)
+		}
+		return nil
+	}
+	// Remember the values we just scanned so we can tell which fields have
+	// changed when the model is saved
+	return mr.takeSnapshot(fieldNames)
+}
+
+// scanField converts reply, which should be the value of the field identified
+// by fs in the main hash (or nil if the field is not in the hash), to the
+// type of the field and sets the field of mr.model to the converted value.
+func (mr *modelRef) scanField(fs *fieldSpec, reply interface{}) error {
+	fieldVal := mr.specFieldValue(fs)
+	if reply == nil {
+		// The field does not exist in the main hash, either because it is a nil
+		// pointer stored with NullAbsent or because it was added to the model
+		// type after the model was saved. In the latter case the default value
+		// (if any) is used.
+		if fs.hasDefault() {
+			fs.setDefault(fieldVal)
+		} else {
+			fieldVal.Set(reflect.Zero(fieldVal.Type()))
+		}
+		return nil
+	}
+	replyBytes, err := redis.Bytes(reply, nil)
+	if err != nil {
+		return err
+	}
+	if fs.encrypted && len(replyBytes) > 0 {
+		replyBytes, err = decryptValue(replyBytes, encryptionAAD(mr.key(), fs))
+		if err != nil {
+			return err
+		}
+	}
+	if fs.compressed && len(replyBytes) > 0 {
+		replyBytes, err = decompressValue(replyBytes)
+		if err != nil {
+			return err
+		}
+	}
+	if fieldVal.Kind() == reflect.Ptr && mr.spec.getNullStrategy() == NullSentinel && string(replyBytes) == getSettings().nullSentinel {
+		fieldVal.Set(reflect.Zero(fieldVal.Type()))
+		return nil
+	}
+	switch fs.kind {
+	case primativeField:
+		return scanPrimativeVal(replyBytes, fieldVal)
+	case pointerField:
+		return scanPointerVal(replyBytes, fieldVal)
+	default:
+		return scanInconvertibleVal(replyBytes, fieldVal, mr.spec.marshalerUnmarshalerFor(fs))
+	}
 }
 
 // scanPrimativeVal converts a slice of bytes response from redis into the type of dest
@@ -66,13 +126,13 @@ func scanPrimativeVal(src []byte, dest reflect.Value) error {
 	}
 	switch dest.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		srcInt, err := strconv.ParseInt(string(src), 10, 0)
+		srcInt, err := parseIntBytes(src)
 		if err != nil {
 			return fmt.Errorf("zoom: could not convert %s to int.", string(src))
 		}
 		dest.SetInt(srcInt)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		srcUint, err := strconv.ParseUint(string(src), 10, 0)
+		srcUint, err := parseUintBytes(src)
 		if err != nil {
 			return fmt.Errorf("zoom: could not convert %s to uint.", string(src))
 		}
@@ -85,22 +145,92 @@ func scanPrimativeVal(src []byte, dest reflect.Value) error {
 		}
 		dest.SetFloat(srcFloat)
 	case reflect.Bool:
-		srcBool, err := strconv.ParseBool(string(src))
+		srcBool, err := parseBoolBytes(src)
 		if err != nil {
 			return fmt.Errorf("zoom: could not convert %s to bool.", string(src))
 		}
 		dest.SetBool(srcBool)
 	case reflect.String:
 		dest.SetString(string(src))
-	case reflect.Slice, reflect.Array:
-		// Slice or array of bytes
-		dest.SetBytes(src)
+	case reflect.Slice:
+		// Slice of bytes. Copy src since it may be reused by the connection.
+		dest.SetBytes(append([]byte{}, src...))
+	case reflect.Array:
+		// Array of bytes. Any extra bytes in src are ignored.
+		reflect.Copy(dest, reflect.ValueOf(src))
 	default:
 		return fmt.Errorf("zoom: don't know how to scan primative type: %T.\n", src)
 	}
 	return nil
 }
 
+// errInvalidNumber is returned by parseIntBytes and parseUintBytes if the
+// input is not a valid number. The caller is expected to return a more
+// descriptive error.
+var errInvalidNumber = errors.New("zoom: invalid number")
+
+// parseUintBytes is like strconv.ParseUint(string(src), 10, 64) but does not
+// need to convert src to a string, which would allocate. Since it is called
+// for every numeric field of every model that is found, this makes a
+// noticeable difference for read-heavy workloads.
+func parseUintBytes(src []byte) (uint64, error) {
+	if len(src) == 0 {
+		return 0, errInvalidNumber
+	}
+	var n uint64
+	for _, c := range src {
+		if c < '0' || c > '9' {
+			return 0, errInvalidNumber
+		}
+		if n > math.MaxUint64/10 {
+			return 0, errInvalidNumber
+		}
+		n *= 10
+		d := uint64(c - '0')
+		if n+d < n {
+			return 0, errInvalidNumber
+		}
+		n += d
+	}
+	return n, nil
+}
+
+// parseIntBytes is like strconv.ParseInt(string(src), 10, 64) but does not
+// need to convert src to a string. See parseUintBytes.
+func parseIntBytes(src []byte) (int64, error) {
+	negative := false
+	if len(src) > 0 && (src[0] == '-' || src[0] == '+') {
+		negative = src[0] == '-'
+		src = src[1:]
+	}
+	n, err := parseUintBytes(src)
+	if err != nil {
+		return 0, err
+	}
+	if negative {
+		if n > -math.MinInt64 {
+			return 0, errInvalidNumber
+		}
+		return -int64(n), nil
+	}
+	if n > math.MaxInt64 {
+		return 0, errInvalidNumber
+	}
+	return int64(n), nil
+}
+
+// parseBoolBytes is like strconv.ParseBool(string(src)) but does not need to
+// convert src to a string.
+func parseBoolBytes(src []byte) (bool, error) {
+	switch string(src) {
+	case "1", "t", "T", "true", "TRUE", "True":
+		return true, nil
+	case "0", "f", "F", "false", "FALSE", "False":
+		return false, nil
+	}
+	return false, fmt.Errorf("zoom: invalid bool %q", src)
+}
+
 // scanPointerVal works like scanVal but expects dest to be a pointer to some primative
 // type
 func scanPointerVal(src []byte, dest reflect.Value) error {
@@ -108,15 +238,66 @@ func scanPointerVal(src []byte, dest reflect.Value) error {
 	return scanPrimativeVal(src, dest.Elem())
 }
 
-// scanIncovertibleVal unmarshals src into dest. For now it uses the defaultMarshalerUnmarshaler,
-// but in the future users may be able to specify a custom MarshalerUnmarshaler.
-func scanInconvertibleVal(src []byte, dest reflect.Value) error {
+// scanIncovertibleVal unmarshals src into dest using the given MarshalerUnmarshaler.
+func scanInconvertibleVal(src []byte, dest reflect.Value, mu MarshalerUnmarshaler) error {
 	if len(src) == 0 {
 		return nil // skip blanks
 	}
-	// TODO: account for json, msgpack or other custom fallbacks
-	if err := defaultMarshalerUnmarshaler.Unmarshal(src, dest.Addr().Interface()); err != nil {
+	if err := mu.Unmarshal(src, dest.Addr().Interface()); err != nil {
 		return err
 	}
 	return nil
 }
+
+// collectionArgs converts each element of val, which must be a slice, into a format
+// suitable for redis and returns the results as args. Primative elements are used
+// as is and all other elements are marshaled using mu.
+func collectionArgs(val reflect.Value, mu MarshalerUnmarshaler) (redis.Args, error) {
+	args := redis.Args{}
+	for i := 0; i < val.Len(); i++ {
+		elem := val.Index(i)
+		if elem.Kind() == reflect.Interface {
+			elem = elem.Elem()
+		}
+		if typeIsPrimative(elem.Type()) {
+			args = args.Add(elem.Interface())
+		} else {
+			valBytes, err := mu.Marshal(elem.Interface())
+			if err != nil {
+				return nil, err
+			}
+			args = args.Add(valBytes)
+		}
+	}
+	return args, nil
+}
+
+// scanCollectionVal converts each reply in replies to the type of the elements of dest,
+// which must be a slice, and then sets dest to a new slice containing the converted
+// values. Elements which are not primatives are unmarshaled using mu. If there are no
+// replies, dest is set to nil.
+func scanCollectionVal(replies []interface{}, dest reflect.Value, mu MarshalerUnmarshaler) error {
+	if len(replies) == 0 {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+	elemType := dest.Type().Elem()
+	result := reflect.MakeSlice(dest.Type(), len(replies), len(replies))
+	for i, reply := range replies {
+		replyBytes, err := redis.Bytes(reply, nil)
+		if err != nil {
+			return err
+		}
+		if typeIsPrimative(elemType) {
+			if err := scanPrimativeVal(replyBytes, result.Index(i)); err != nil {
+				return err
+			}
+		} else {
+			if err := scanInconvertibleVal(replyBytes, result.Index(i), mu); err != nil {
+				return err
+			}
+		}
+	}
+	dest.Set(result)
+	return nil
+}
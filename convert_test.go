@@ -133,3 +133,87 @@ func testConvertType(t *testing.T, modelType *ModelType, model Model) {
 		t.Errorf("Unexpected error saving an empty model: %s", err.Error())
 	}
 }
+
+func TestConvertBytes(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	type bytesModel struct {
+		Bytes      []byte
+		Array      [4]byte
+		BytesPtr   *[]byte
+		IndexBytes []byte `zoom:"index"`
+		DefaultData
+	}
+	bytesModels, err := Register(&bytesModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	binary := []byte{0x00, 0xff, 'N', 'U', 'L', 'L', 0x1f, 0x8b}
+	model := &bytesModel{
+		Bytes:      binary,
+		Array:      [4]byte{0x00, 0x01, 0xfe, 0xff},
+		BytesPtr:   &binary,
+		IndexBytes: []byte(randomString()),
+	}
+	if err := bytesModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// Bytes should be stored as is, with no encoding
+	key, _ := bytesModels.ModelKey(model.Id())
+	expectFieldEquals(t, key, "Bytes", binary)
+	expectFieldEquals(t, key, "Array", []byte{0x00, 0x01, 0xfe, 0xff})
+	expectIndexExists(t, bytesModels, model, "IndexBytes")
+
+	modelCopy := &bytesModel{}
+	if err := bytesModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	ints := map[string]int64{
+		"0":                    0,
+		"42":                   42,
+		"+42":                  42,
+		"-42":                  -42,
+		"9223372036854775807":  9223372036854775807,
+		"-9223372036854775808": -9223372036854775808,
+	}
+	for src, expected := range ints {
+		if got, err := parseIntBytes([]byte(src)); err != nil {
+			t.Errorf("Unexpected error in parseIntBytes(%q): %s", src, err.Error())
+		} else if got != expected {
+			t.Errorf("Expected parseIntBytes(%q) to be %d but got %d", src, expected, got)
+		}
+	}
+	for _, src := range []string{"", "-", "4.2", "1e3", "0x10", "9223372036854775808", "-9223372036854775809"} {
+		if _, err := parseIntBytes([]byte(src)); err == nil {
+			t.Errorf("Expected an error in parseIntBytes(%q)", src)
+		}
+	}
+	if got, err := parseUintBytes([]byte("18446744073709551615")); err != nil {
+		t.Errorf("Unexpected error in parseUintBytes: %s", err.Error())
+	} else if got != 18446744073709551615 {
+		t.Errorf("Expected parseUintBytes to return the max uint64 but got %d", got)
+	}
+	for _, src := range []string{"-1", "18446744073709551616"} {
+		if _, err := parseUintBytes([]byte(src)); err == nil {
+			t.Errorf("Expected an error in parseUintBytes(%q)", src)
+		}
+	}
+	for src, expected := range map[string]bool{"1": true, "true": true, "0": false, "false": false} {
+		if got, err := parseBoolBytes([]byte(src)); err != nil {
+			t.Errorf("Unexpected error in parseBoolBytes(%q): %s", src, err.Error())
+		} else if got != expected {
+			t.Errorf("Expected parseBoolBytes(%q) to be %v but got %v", src, expected, got)
+		}
+	}
+	if _, err := parseBoolBytes([]byte("yes")); err == nil {
+		t.Error("Expected an error in parseBoolBytes for an invalid bool")
+	}
+}
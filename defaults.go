@@ -0,0 +1,61 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File defaults.go contains code related to default field values,
+// which are declared with the "default=<value>" option in the zoom
+// struct tag.
+
+package zoom
+
+import (
+	"reflect"
+)
+
+// scanDefaultVal parses src, the default value from a struct tag, and sets
+// dest to the result. dest must be a primative or a pointer to a primative.
+// Note that since options in the zoom struct tag are separated by commas,
+// default values cannot contain commas.
+func scanDefaultVal(src string, dest reflect.Value) error {
+	if dest.Kind() == reflect.Ptr {
+		return scanPointerVal([]byte(src), dest)
+	}
+	return scanPrimativeVal([]byte(src), dest)
+}
+
+// hasDefault returns true iff the field has a default value.
+func (fs *fieldSpec) hasDefault() bool {
+	return fs.defaultValue.IsValid()
+}
+
+// setDefault sets fieldVal to the default value for fs. For pointer fields,
+// fieldVal is set to a new pointer so that models never share the default.
+func (fs *fieldSpec) setDefault(fieldVal reflect.Value) {
+	if fs.defaultValue.Kind() == reflect.Ptr {
+		ptr := reflect.New(fs.defaultValue.Type().Elem())
+		ptr.Elem().Set(fs.defaultValue.Elem())
+		fieldVal.Set(ptr)
+		return
+	}
+	fieldVal.Set(fs.defaultValue)
+}
+
+// setDefaults sets any zero-valued fields of mr.model which have a default
+// value to the default. A field is zero-valued if it is a nil pointer or has
+// the zero value for its type.
+func (mr *modelRef) setDefaults() {
+	for _, fs := range mr.spec.fields {
+		if !fs.hasDefault() {
+			continue
+		}
+		fieldVal := mr.specFieldValue(fs)
+		if isZero(fieldVal) {
+			fs.setDefault(fieldVal)
+		}
+	}
+}
+
+// isZero returns true iff val has the zero value for its type.
+func isZero(val reflect.Value) bool {
+	return reflect.DeepEqual(val.Interface(), reflect.Zero(val.Type()).Interface())
+}
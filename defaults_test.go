@@ -0,0 +1,128 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File defaults_test.go tests the code in defaults.go, i.e.
+// default field values declared in struct tags.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+type defaultsModel struct {
+	Status  string  `zoom:"default=active"`
+	Retries int     `zoom:"default=3"`
+	Enabled *bool   `zoom:"default=true"`
+	Score   float64 `zoom:"default=1.5"`
+	Name    string
+	DefaultData
+}
+
+func TestDefaultsOnSave(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	defaultsModels := registerTestType(t, &defaultsModel{})
+
+	// Zero-valued fields should be set to their defaults, but fields which
+	// were set explicitly should not be changed.
+	model := &defaultsModel{Retries: 5, Name: "Bob"}
+	if err := defaultsModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	enabled := true
+	expected := &defaultsModel{
+		Status:      "active",
+		Retries:     5,
+		Enabled:     &enabled,
+		Score:       1.5,
+		Name:        "Bob",
+		DefaultData: model.DefaultData,
+	}
+	if !reflect.DeepEqual(model, expected) {
+		t.Errorf("Model was incorrect after Save.\nExpected: %+v\nGot:      %+v", expected, model)
+	}
+	found := &defaultsModel{}
+	if err := defaultsModels.Find(model.Id(), found); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", expected, found)
+	}
+}
+
+func TestDefaultsOnFind(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	defaultsModels := registerTestType(t, &defaultsModel{})
+
+	// Simulate a model which was saved before the Status and Enabled fields
+	// were added to the type. Fields which are stored with their zero value
+	// should not be replaced with the default.
+	key, err := defaultsModels.ModelKey("legacy")
+	if err != nil {
+		t.Fatalf("Unexpected error in ModelKey: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("HMSET", key, "Retries", 0, "Score", 2.5, "Name", "Alice"); err != nil {
+		t.Fatalf("Unexpected error in HMSET: %s", err.Error())
+	}
+	if _, err := conn.Do("SADD", defaultsModels.AllIndexKey(), "legacy"); err != nil {
+		t.Fatalf("Unexpected error in SADD: %s", err.Error())
+	}
+	found := &defaultsModel{}
+	if err := defaultsModels.Find("legacy", found); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	enabled := true
+	expected := &defaultsModel{
+		Status:  "active",
+		Retries: 0,
+		Enabled: &enabled,
+		Score:   2.5,
+		Name:    "Alice",
+	}
+	expected.SetId("legacy")
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", expected, found)
+	}
+}
+
+func TestDefaultsInvalid(t *testing.T) {
+	type invalidDefaultModel struct {
+		Count int `zoom:"default=lots"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&invalidDefaultModel{})); err == nil {
+		t.Error("Expected an error for an invalid default value but got none")
+	}
+	type unsupportedDefaultModel struct {
+		Tags []string `zoom:"default=a"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&unsupportedDefaultModel{})); err == nil {
+		t.Error("Expected an error for a default value on an unsupported type but got none")
+	}
+}
+
+func TestSetDefaultsSharesNoPointers(t *testing.T) {
+	spec, err := compileModelSpec(reflect.TypeOf(&defaultsModel{}))
+	if err != nil {
+		t.Fatalf("Unexpected error in compileModelSpec: %s", err.Error())
+	}
+	first, second := &defaultsModel{}, &defaultsModel{}
+	(&modelRef{spec: spec, model: first}).setDefaults()
+	(&modelRef{spec: spec, model: second}).setDefaults()
+	if first.Enabled == nil || second.Enabled == nil {
+		t.Fatal("Expected Enabled to be set to the default but it was nil")
+	}
+	*first.Enabled = false
+	if !*second.Enabled {
+		t.Error("Expected models to have separate pointers for default values")
+	}
+}
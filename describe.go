@@ -0,0 +1,185 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File describe.go contains code related to describing the schema of
+// registered model types at runtime, e.g. for tools and admin UIs.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// idPlaceholder is used in place of the id in the key patterns returned by
+// Describe.
+const idPlaceholder = "<id>"
+
+// ModelDescription describes a registered model type, as compiled by zoom when
+// the type was registered. It is returned by ModelType.Describe.
+type ModelDescription struct {
+	// Name is the name the type was registered with.
+	Name string
+	// GoType is the Go type of the models, e.g. "*models.User".
+	GoType string
+	// KeyPattern is the pattern for the key of the main hash for each model,
+	// with "<id>" in place of the id, e.g. "User:<id>".
+	KeyPattern string
+	// AllIndexKey is the key for the set of the ids of all models of the type.
+	AllIndexKey string
+	// Fields describes each field of the type which zoom stores, in the order
+	// in which they are declared. The fields of nested structs with the flatten
+	// option are included individually.
+	Fields []FieldDescription
+	// SchemaVersion is the version set by the SchemaVersion option, or 0.
+	SchemaVersion int
+	// TTL is the expiration set by the TTL option, or 0.
+	TTL time.Duration
+}
+
+// FieldDescription describes a single field of a registered model type. Zoom
+// does not have relations between model types (models usually refer to each
+// other by storing ids in string fields), so they are not described.
+type FieldDescription struct {
+	// Name is the name of the field in Go, e.g. "Address.City" for a field of a
+	// nested struct with the flatten option. It is the name used in queries.
+	Name string
+	// RedisName is the name of the field in the main hash, or the suffix of the
+	// key for a list or set field.
+	RedisName string
+	// GoType is the Go type of the field, e.g. "*int".
+	GoType string
+	// Kind is how the field is stored: "primative", "pointer", or
+	// "inconvertible" for fields stored in the main hash, or "list" or "set"
+	// for fields stored in a separate list or set.
+	Kind string
+	// Index is the kind of index on the field: "numeric", "string",
+	// "boolean", or "" if the field is not indexed. IndexKey is the key for the
+	// sorted set which holds the index.
+	Index    string
+	IndexKey string
+	// KeyPattern is the pattern for the key of the list or set for each model,
+	// with "<id>" in place of the id, for list and set fields. It is empty for
+	// fields stored in the main hash.
+	KeyPattern string
+	// The following are true iff the field has the corresponding option in its
+	// zoom struct tag.
+	Unique     bool
+	Encrypted  bool
+	Compressed bool
+	Lazy       bool
+	// HasDefault is true iff the field has a default value, and Default is the
+	// default value formatted with fmt.Sprint.
+	HasDefault bool
+	Default    string
+	// Transitions is set if the UseTransitions option was used for the field.
+	// It maps each state to the states which may follow it, in sorted order.
+	Transitions map[string][]string
+}
+
+// String returns the name of the field kind as used in FieldDescription.
+func (kind fieldKind) String() string {
+	switch kind {
+	case primativeField:
+		return "primative"
+	case pointerField:
+		return "pointer"
+	case inconvertibleField:
+		return "inconvertible"
+	case listField:
+		return "list"
+	case setField:
+		return "set"
+	}
+	return fmt.Sprintf("fieldKind(%d)", int(kind))
+}
+
+// String returns the name of the index kind as used in FieldDescription.
+func (kind indexKind) String() string {
+	switch kind {
+	case noIndex:
+		return ""
+	case numericIndex:
+		return "numeric"
+	case stringIndex:
+		return "string"
+	case booleanIndex:
+		return "boolean"
+	}
+	return fmt.Sprintf("indexKind(%d)", int(kind))
+}
+
+// RegisteredTypes returns every model type registered with the default pool,
+// sorted by name.
+func RegisteredTypes() []*ModelType {
+	return defaultPool.RegisteredTypes()
+}
+
+// RegisteredTypes returns every model type registered with p, sorted by name.
+func (p *Pool) RegisteredTypes() []*ModelType {
+	specs := p.specs()
+	types := make([]*ModelType, len(specs))
+	for i, spec := range specs {
+		types[i] = &ModelType{spec: spec}
+	}
+	return types
+}
+
+// Describe returns a description of the model type, including each of its
+// fields, how they are stored, and how they are indexed. The description is a
+// copy, so changing it does not affect the model type.
+func (mt *ModelType) Describe() *ModelDescription {
+	ms := mt.spec
+	desc := &ModelDescription{
+		Name:          ms.name,
+		GoType:        ms.typ.String(),
+		KeyPattern:    ms.keyName() + ":" + idPlaceholder,
+		AllIndexKey:   ms.allIndexKey(),
+		Fields:        make([]FieldDescription, len(ms.fields)),
+		SchemaVersion: ms.version,
+		TTL:           ms.ttl,
+	}
+	for i, fs := range ms.fields {
+		field := FieldDescription{
+			Name:       fs.name,
+			RedisName:  fs.redisName,
+			GoType:     fs.typ.String(),
+			Kind:       fs.kind.String(),
+			Index:      fs.indexKind.String(),
+			Unique:     fs.unique,
+			Encrypted:  fs.encrypted,
+			Compressed: fs.compressed,
+			Lazy:       fs.lazy,
+			HasDefault: fs.hasDefault(),
+		}
+		if fs.indexKind != noIndex {
+			field.IndexKey, _ = ms.fieldIndexKey(fs.name)
+		}
+		if !fs.storedInHash() {
+			field.KeyPattern = ms.fieldKey(idPlaceholder, fs)
+		}
+		if field.HasDefault {
+			defaultValue := fs.defaultValue
+			if defaultValue.Kind() == reflect.Ptr {
+				defaultValue = defaultValue.Elem()
+			}
+			field.Default = fmt.Sprint(defaultValue.Interface())
+		}
+		if fs.transitions != nil {
+			field.Transitions = map[string][]string{}
+			for from, tos := range fs.transitions {
+				states := []string{}
+				for to := range tos {
+					states = append(states, to)
+				}
+				sort.Strings(states)
+				field.Transitions[from] = states
+			}
+		}
+		desc.Fields[i] = field
+	}
+	return desc
+}
@@ -0,0 +1,136 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File describe_test.go tests the code for describing registered model
+// types.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type describeTestModel struct {
+	Email   string   `zoom:"unique"`
+	Age     *int     `redis:"age" zoom:"index"`
+	Tags    []string `redisType:"set"`
+	Notes   string   `zoom:"compress,lazy"`
+	Role    string   `zoom:"default=member"`
+	Status  string
+	Address describeTestAddress `zoom:"flatten"`
+	DefaultData
+}
+
+type describeTestAddress struct {
+	City string `zoom:"index"`
+}
+
+func TestDescribe(t *testing.T) {
+	pool, err := NewPool(&Configuration{KeyPrefix: "app:"})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	mt, err := pool.RegisterWithOptions(&describeTestModel{},
+		SchemaVersion(2),
+		TTL(time.Hour),
+		UseTransitions("Status", Transitions{"": {"open"}, "open": {"closed", "archived"}}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error in RegisterWithOptions: %s", err.Error())
+	}
+	got := mt.Describe()
+	expected := &ModelDescription{
+		Name:          "describeTestModel",
+		GoType:        "*zoom.describeTestModel",
+		KeyPattern:    "app:describeTestModel:<id>",
+		AllIndexKey:   "app:describeTestModel:all",
+		SchemaVersion: 2,
+		TTL:           time.Hour,
+		Fields: []FieldDescription{
+			{
+				Name:      "Email",
+				RedisName: "Email",
+				GoType:    "string",
+				Kind:      "primative",
+				Index:     "string",
+				IndexKey:  "app:describeTestModel:Email",
+				Unique:    true,
+			},
+			{
+				Name:      "Age",
+				RedisName: "age",
+				GoType:    "*int",
+				Kind:      "pointer",
+				Index:     "numeric",
+				IndexKey:  "app:describeTestModel:age",
+			},
+			{
+				Name:       "Tags",
+				RedisName:  "Tags",
+				GoType:     "[]string",
+				Kind:       "set",
+				KeyPattern: "app:describeTestModel:<id>:Tags",
+			},
+			{
+				Name:       "Notes",
+				RedisName:  "Notes",
+				GoType:     "string",
+				Kind:       "primative",
+				Compressed: true,
+				Lazy:       true,
+			},
+			{
+				Name:       "Role",
+				RedisName:  "Role",
+				GoType:     "string",
+				Kind:       "primative",
+				HasDefault: true,
+				Default:    "member",
+			},
+			{
+				Name:        "Status",
+				RedisName:   "Status",
+				GoType:      "string",
+				Kind:        "primative",
+				Transitions: map[string][]string{"": {"open"}, "open": {"archived", "closed"}},
+			},
+			{
+				Name:      "Address.City",
+				RedisName: "Address.City",
+				GoType:    "string",
+				Kind:      "primative",
+				Index:     "string",
+				IndexKey:  "app:describeTestModel:Address.City",
+			},
+		},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Description was incorrect.\nExpected: %+v\nGot:      %+v", expected, got)
+	}
+}
+
+func TestRegisteredTypes(t *testing.T) {
+	pool, err := NewPool(&Configuration{})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	if types := pool.RegisteredTypes(); len(types) != 0 {
+		t.Errorf("Expected no registered types but got %d", len(types))
+	}
+	if _, err := pool.RegisterName("b", &testModel{}); err != nil {
+		t.Fatalf("Unexpected error in RegisterName: %s", err.Error())
+	}
+	if _, err := pool.RegisterName("a", &indexedTestModel{}); err != nil {
+		t.Fatalf("Unexpected error in RegisterName: %s", err.Error())
+	}
+	got := []string{}
+	for _, mt := range pool.RegisteredTypes() {
+		got = append(got, mt.Name())
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v but got %v", expected, got)
+	}
+}
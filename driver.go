@@ -0,0 +1,76 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File driver.go contains code related to the Driver interface,
+// which allows zoom to use a redis client other than redigo.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// Driver is the interface zoom uses to get connections to the database. By
+// default zoom uses a *redis.Pool from redigo, which satisfies Driver, but you
+// can provide your own in the Configuration to use a different redis client
+// (e.g. go-redis). Connections returned by Get must satisfy the redis.Conn
+// interface, and their replies must use the same types as redigo: int64 for
+// integers, []byte for bulk strings, []interface{} for arrays, nil for null
+// replies, and redis.Error for error replies. Get should not return nil. If a
+// connection can not be established, it should return a redis.Conn whose
+// methods all return the error.
+type Driver interface {
+	// Get returns a connection. zoom calls Close on the connection when
+	// it is done with it.
+	Get() redis.Conn
+	// Close releases any resources used by the driver.
+	Close() error
+}
+
+// errorDriver is a Driver which always returns connections that fail with err.
+type errorDriver struct {
+	err error
+}
+
+func (d errorDriver) Get() redis.Conn {
+	return errorConn{err: d.err}
+}
+
+func (d errorDriver) Close() error {
+	return nil
+}
+
+// errorConn is a redis.Conn whose methods all return err.
+type errorConn struct {
+	err error
+}
+
+func (c errorConn) Close() error {
+	return nil
+}
+
+func (c errorConn) Err() error {
+	return c.err
+}
+
+func (c errorConn) Do(string, ...interface{}) (interface{}, error) {
+	return nil, c.err
+}
+
+func (c errorConn) Send(string, ...interface{}) error {
+	return c.err
+}
+
+func (c errorConn) Flush() error {
+	return c.err
+}
+
+func (c errorConn) Receive() (interface{}, error) {
+	return nil, c.err
+}
+
+// Driver returns the Driver used by p to get connections to the database.
+func (p *Pool) Driver() Driver {
+	return p.getState().driver
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File driver_test.go tests the code in driver.go, i.e.
+// using a custom Driver to get connections.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"testing"
+)
+
+// countingDriver is a Driver used for testing. It wraps another Driver and
+// counts the number of connections that were requested.
+type countingDriver struct {
+	Driver
+	gets int
+}
+
+func (d *countingDriver) Get() redis.Conn {
+	d.gets++
+	return d.Driver.Get()
+}
+
+func TestCustomDriver(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	driver := &countingDriver{Driver: defaultPool.Driver()}
+	driverPool, err := NewPool(&Configuration{Driver: driver})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	defer removeLastPool()
+	if driverPool.Driver() != driver {
+		t.Errorf("Expected Driver to return the custom driver but got %v", driverPool.Driver())
+	}
+	driverModels, err := driverPool.Register(&testModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	model := createTestModels(1)[0]
+	if err := driverModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	modelCopy := &testModel{}
+	if err := driverModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+	if driver.gets != 2 {
+		t.Errorf("Expected the custom driver to be used for 2 connections but got %d", driver.gets)
+	}
+}
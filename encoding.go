@@ -0,0 +1,259 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File encoding.go contains code related to checking whether the
+// main hash for each model can use the compact hash encoding.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"strconv"
+)
+
+// EncodingLimits are the limits which determine whether redis stores a hash with
+// the compact encoding (called listpack in newer versions of redis and ziplist in
+// older ones), which uses much less memory than the hashtable encoding. A hash is
+// converted to the hashtable encoding as soon as it has more than MaxEntries
+// fields or any of its values is longer than MaxValueSize bytes.
+type EncodingLimits struct {
+	// MaxEntries is the value of hash-max-listpack-entries (or
+	// hash-max-ziplist-entries).
+	MaxEntries int
+	// MaxValueSize is the value of hash-max-listpack-value (or
+	// hash-max-ziplist-value).
+	MaxValueSize int
+}
+
+// DefaultEncodingLimits are the limits redis uses if they are not changed in
+// the config. They are used by AdviseEncoding if the limits cannot be read
+// from the database, e.g. because the CONFIG command is disabled.
+var DefaultEncodingLimits = EncodingLimits{
+	MaxEntries:   128,
+	MaxValueSize: 64,
+}
+
+// maxNumberSize is the maximum length of a number or boolean which is stored
+// in the main hash.
+const maxNumberSize = 24
+
+// EncodingAdvice describes how well a model type fits in the compact hash
+// encoding and suggests how to improve it. It is returned by AdviseEncoding.
+type EncodingAdvice struct {
+	// ModelName is the name of the model type.
+	ModelName string
+	// Limits are the limits the model type was checked against.
+	Limits EncodingLimits
+	// NumFields is the number of fields which are stored in the main hash for
+	// each model, including any fields zoom uses internally.
+	NumFields int
+	// SampleSize is the number of models which were sampled.
+	SampleSize int
+	// NumNonCompact is the number of sampled models whose main hash was not
+	// stored with the compact encoding.
+	NumNonCompact int
+	// MaxValueSizes is the size in bytes of the longest value in the sampled
+	// models for each field, keyed by field name. It only includes fields which
+	// were set in at least one sampled model.
+	MaxValueSizes map[string]int
+	// Warnings explains each reason that models of the type may not be stored
+	// with the compact encoding, along with a suggestion for fixing it. It is
+	// empty if there are none.
+	Warnings []string
+}
+
+// AdviseEncoding checks every model type registered with the default pool. See
+// Pool.AdviseEncoding.
+func AdviseEncoding(sampleSize int) ([]*EncodingAdvice, error) {
+	return defaultPool.AdviseEncoding(sampleSize)
+}
+
+// AdviseEncoding checks every model type registered with p and returns the
+// advice for each one, sorted by model name. See ModelType.AdviseEncoding.
+func (p *Pool) AdviseEncoding(sampleSize int) ([]*EncodingAdvice, error) {
+	specs := p.specs()
+	results := make([]*EncodingAdvice, 0, len(specs))
+	for _, spec := range specs {
+		mt := &ModelType{spec: spec}
+		advice, err := mt.AdviseEncoding(sampleSize)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, advice)
+	}
+	return results, nil
+}
+
+// AdviseEncoding checks whether models of the given type are likely to be stored
+// with the memory-efficient compact hash encoding, and warns about the fields or
+// settings which prevent it. The number of fields is checked against the limits
+// configured in the database. Since the size of most values is only known at
+// runtime, up to sampleSize random models are read from the database to find the
+// longest value for each field. The advice is only as good as the sample, so
+// sampleSize should be large enough to include unusually long values. It may be
+// 0, in which case only the number of fields is checked.
+func (mt *ModelType) AdviseEncoding(sampleSize int) (*EncodingAdvice, error) {
+	if sampleSize < 0 {
+		return nil, fmt.Errorf("zoom: Error in AdviseEncoding: sampleSize cannot be negative but got %d", sampleSize)
+	}
+	conn := mt.spec.pool.NewConn()
+	defer conn.Close()
+	advice := mt.spec.newEncodingAdvice(getEncodingLimits(conn))
+	if sampleSize > 0 {
+		ids, err := redis.Strings(conn.Do("SRANDMEMBER", mt.spec.allIndexKey(), sampleSize))
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in AdviseEncoding: %s", err.Error())
+		}
+		for _, id := range ids {
+			key := mt.spec.keyName() + ":" + id
+			encoding, err := redis.String(conn.Do("OBJECT", "ENCODING", key))
+			if err == redis.ErrNil {
+				// The model was deleted after its id was sampled
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("zoom: Error in AdviseEncoding: %s", err.Error())
+			}
+			fields, err := redis.StringMap(conn.Do("HGETALL", key))
+			if err != nil {
+				return nil, fmt.Errorf("zoom: Error in AdviseEncoding: %s", err.Error())
+			}
+			advice.addSample(mt.spec, fields, encoding)
+		}
+	}
+	advice.Warnings = mt.spec.encodingWarnings(advice)
+	return advice, nil
+}
+
+// getEncodingLimits reads the limits for the compact hash encoding from the
+// database, falling back to DefaultEncodingLimits for any limit that cannot be
+// read.
+func getEncodingLimits(conn redis.Conn) EncodingLimits {
+	limits := DefaultEncodingLimits
+	if n, ok := getConfigInt(conn, "hash-max-listpack-entries", "hash-max-ziplist-entries"); ok {
+		limits.MaxEntries = n
+	}
+	if n, ok := getConfigInt(conn, "hash-max-listpack-value", "hash-max-ziplist-value"); ok {
+		limits.MaxValueSize = n
+	}
+	return limits
+}
+
+// getConfigInt returns the value of the first of the given config parameters
+// which the database knows about. ok is false if none of them could be read.
+func getConfigInt(conn redis.Conn, params ...string) (n int, ok bool) {
+	for _, param := range params {
+		values, err := redis.Strings(conn.Do("CONFIG", "GET", param))
+		if err != nil || len(values) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(values[1])
+		if err != nil {
+			continue
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// newEncodingAdvice returns advice for ms with the fields which do not depend
+// on a sample filled in.
+func (ms *modelSpec) newEncodingAdvice(limits EncodingLimits) *EncodingAdvice {
+	numFields := 0
+	for _, fs := range ms.fields {
+		if fs.storedInHash() {
+			numFields++
+		}
+	}
+	if ms.version != 0 {
+		numFields++
+	}
+	return &EncodingAdvice{
+		ModelName:     ms.name,
+		Limits:        limits,
+		NumFields:     numFields,
+		MaxValueSizes: map[string]int{},
+	}
+}
+
+// addSample adds the contents of the main hash for one model, along with the
+// encoding redis reported for it, to the advice.
+func (advice *EncodingAdvice) addSample(ms *modelSpec, fields map[string]string, encoding string) {
+	advice.SampleSize++
+	if encoding != "listpack" && encoding != "ziplist" {
+		advice.NumNonCompact++
+	}
+	for _, fs := range ms.fields {
+		value, found := fields[fs.redisName]
+		if !found {
+			continue
+		}
+		if size, seen := advice.MaxValueSizes[fs.name]; !seen || len(value) > size {
+			advice.MaxValueSizes[fs.name] = len(value)
+		}
+	}
+}
+
+// encodingWarnings returns the warnings for advice, which should have been
+// created by ms.newEncodingAdvice.
+func (ms *modelSpec) encodingWarnings(advice *EncodingAdvice) []string {
+	warnings := []string{}
+	limits := advice.Limits
+	if advice.NumFields > limits.MaxEntries {
+		warnings = append(warnings, fmt.Sprintf("%s stores %d fields in its main hash, which is more than the limit of %d entries. Consider moving rarely used fields to a separate model type, or increasing hash-max-listpack-entries.", ms.name, advice.NumFields, limits.MaxEntries))
+	}
+	for _, fs := range ms.fields {
+		if !fs.storedInHash() {
+			continue
+		}
+		size, sampled := advice.MaxValueSizes[fs.name]
+		switch {
+		case sampled && size > limits.MaxValueSize:
+			msg := fmt.Sprintf("%s.%s has values of up to %d bytes, which is more than the limit of %d bytes.", ms.name, fs.name, size, limits.MaxValueSize)
+			if !fs.compressed && canCompressField(fs) {
+				msg += ` Consider adding the "compress" option to its zoom struct tag, or moving it to a separate model type.`
+			} else {
+				msg += " Consider moving it to a separate model type."
+			}
+			warnings = append(warnings, msg)
+		case !sampled && !fieldHasBoundedSize(fs, limits.MaxValueSize):
+			// Only warn about the fields which could be long if nothing was
+			// sampled, since otherwise the sample tells us more
+			if advice.SampleSize == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s.%s may have values which are longer than the limit of %d bytes. Use a sample to check the actual sizes.", ms.name, fs.name, limits.MaxValueSize))
+			}
+		}
+	}
+	if advice.NumNonCompact > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d of %d sampled models of type %s are stored with the hashtable encoding.", advice.NumNonCompact, advice.SampleSize, ms.name))
+	}
+	return warnings
+}
+
+// fieldHasBoundedSize returns true iff every value of the field is known to be
+// no longer than maxSize bytes when it is stored in the main hash, which is
+// only true for numbers and booleans which are stored as plain text.
+func fieldHasBoundedSize(fs *fieldSpec, maxSize int) bool {
+	if fs.kind == inconvertibleField || fs.encrypted || fs.compressed || fs.marshalerUnmarshaler != nil || maxSize < maxNumberSize {
+		return false
+	}
+	typ := fs.typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// canCompressField returns true iff the "compress" option may be used for the
+// field, i.e. if it is not indexed.
+func canCompressField(fs *fieldSpec) bool {
+	return fs.indexKind == noIndex
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File encoding_test.go tests the code in encoding.go.
+
+package zoom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type encodingModel struct {
+	Count   int
+	Name    string
+	Indexed string `zoom:"index"`
+	DefaultData
+}
+
+func TestAdviseEncoding(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	encodingModels := registerTestType(t, &encodingModel{})
+	longName := strings.Repeat("a", 1000)
+	models := []*encodingModel{
+		{Count: 1, Name: "short", Indexed: "short"},
+		{Count: 2, Name: longName, Indexed: "short"},
+	}
+	for _, model := range models {
+		if err := encodingModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+	advice, err := encodingModels.AdviseEncoding(10)
+	if err != nil {
+		t.Fatalf("Unexpected error in AdviseEncoding: %s", err.Error())
+	}
+	if advice.NumFields != 3 {
+		t.Errorf("Expected NumFields to be 3 but got %d", advice.NumFields)
+	}
+	if advice.SampleSize != 2 {
+		t.Errorf("Expected SampleSize to be 2 but got %d", advice.SampleSize)
+	}
+	if advice.NumNonCompact != 1 {
+		t.Errorf("Expected NumNonCompact to be 1 but got %d", advice.NumNonCompact)
+	}
+	if got := advice.MaxValueSizes["Name"]; got != len(longName) {
+		t.Errorf("Expected MaxValueSizes[Name] to be %d but got %d", len(longName), got)
+	}
+	if len(advice.Warnings) != 2 {
+		t.Fatalf("Expected 2 warnings but got %d: %v", len(advice.Warnings), advice.Warnings)
+	}
+	if !strings.Contains(advice.Warnings[0], "Name") || !strings.Contains(advice.Warnings[0], `"compress"`) {
+		t.Errorf("Expected a warning suggesting compressing Name but got: %s", advice.Warnings[0])
+	}
+
+	// The pool-level function should include the type
+	all, err := AdviseEncoding(0)
+	if err != nil {
+		t.Fatalf("Unexpected error in AdviseEncoding: %s", err.Error())
+	}
+	found := false
+	for _, a := range all {
+		if a.ModelName == encodingModels.Name() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected AdviseEncoding to include %s", encodingModels.Name())
+	}
+}
+
+func TestEncodingWarnings(t *testing.T) {
+	spec, err := compileModelSpec(reflect.TypeOf(&encodingModel{}))
+	if err != nil {
+		t.Fatalf("Unexpected error in compileModelSpec: %s", err.Error())
+	}
+	limits := EncodingLimits{MaxEntries: 2, MaxValueSize: 64}
+
+	// Without a sample, there should be a warning for too many fields and for
+	// each string field, but not for the int field
+	advice := spec.newEncodingAdvice(limits)
+	warnings := spec.encodingWarnings(advice)
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings but got %d: %v", len(warnings), warnings)
+	}
+	if !strings.Contains(warnings[0], "3 fields") {
+		t.Errorf("Expected a warning about the number of fields but got: %s", warnings[0])
+	}
+	for _, warning := range warnings {
+		if strings.Contains(warning, "Count") {
+			t.Errorf("Expected no warning for Count but got: %s", warning)
+		}
+	}
+
+	// With a sample, only the fields with long values should have warnings,
+	// and indexed fields cannot be compressed
+	advice = spec.newEncodingAdvice(limits)
+	advice.addSample(spec, map[string]string{"Count": "1", "Name": "short", "Indexed": strings.Repeat("a", 65)}, "hashtable")
+	warnings = spec.encodingWarnings(advice)
+	if len(warnings) != 3 {
+		t.Fatalf("Expected 3 warnings but got %d: %v", len(warnings), warnings)
+	}
+	if !strings.Contains(warnings[1], "Indexed") || strings.Contains(warnings[1], `"compress"`) {
+		t.Errorf("Expected a warning for Indexed without suggesting compression but got: %s", warnings[1])
+	}
+	if !strings.Contains(warnings[2], "1 of 1") {
+		t.Errorf("Expected a warning about the encoding but got: %s", warnings[2])
+	}
+}
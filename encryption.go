@@ -0,0 +1,138 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File encryption.go contains code related to encrypting fields
+// with the "encrypted" option in their zoom struct tag.
+
+package zoom
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"io"
+)
+
+// newEncryptionAEAD returns an AEAD which uses AES-GCM with the given key, which
+// must be 16, 24, or 32 bytes long. If key is empty, it returns nil.
+func newEncryptionAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: invalid EncryptionKey: %s", err.Error())
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: invalid EncryptionKey: %s", err.Error())
+	}
+	return aead, nil
+}
+
+// encryptionAAD returns the additional data which is authenticated along with
+// the value of the field identified by fs for the model with the given key. It
+// binds each ciphertext to its model and field, so that a ciphertext which is
+// moved to a different field or model (e.g. by someone with write access to the
+// database) fails to decrypt.
+func encryptionAAD(modelKey string, fs *fieldSpec) []byte {
+	return []byte(modelKey + nullString + fs.redisName)
+}
+
+// encryptValue encrypts plaintext with AES-GCM, authenticating additionalData
+// along with it (see encryptionAAD). The random nonce is prepended to the
+// returned ciphertext.
+func encryptValue(plaintext []byte, additionalData []byte) ([]byte, error) {
+	encryptionAEAD := getSettings().encryptionAEAD
+	if encryptionAEAD == nil {
+		return nil, fmt.Errorf("zoom: cannot encrypt field because no EncryptionKey was provided in the Configuration")
+	}
+	nonce := make([]byte, encryptionAEAD.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return encryptionAEAD.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// decryptValue reverses encryptValue. additionalData must be the same as when
+// the value was encrypted.
+func decryptValue(ciphertext []byte, additionalData []byte) ([]byte, error) {
+	encryptionAEAD := getSettings().encryptionAEAD
+	if encryptionAEAD == nil {
+		return nil, fmt.Errorf("zoom: cannot decrypt field because no EncryptionKey was provided in the Configuration")
+	}
+	nonceSize := encryptionAEAD.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("zoom: cannot decrypt field because the stored value is too short")
+	}
+	plaintext, err := encryptionAEAD.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: cannot decrypt field: %s", err.Error())
+	}
+	return plaintext, nil
+}
+
+// reencryptForRename immediately reads the encrypted fields of the model with
+// oldId and returns the arguments for an HMSET command which stores them again
+// for the model with newId, since encrypted values are bound to the key of the
+// model. The command should be added to t after the command which renames the
+// model. The old and new keys are watched, so the transaction is aborted if
+// either is changed in the meantime. It returns nil if ms does not have any
+// encrypted fields, if the model with oldId does not have any encrypted values,
+// or if a model with newId already exists (in which case the rename itself
+// fails).
+func (t *Transaction) reencryptForRename(ms *modelSpec, oldId string, newId string) (redis.Args, error) {
+	fields := []*fieldSpec{}
+	for _, fs := range ms.fields {
+		if fs.encrypted && fs.storedInHash() {
+			fields = append(fields, fs)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	oldKey := ms.keyName() + ":" + oldId
+	newKey := ms.keyName() + ":" + newId
+	for _, key := range []string{oldKey, newKey} {
+		if err := t.WatchKey(key); err != nil {
+			return nil, err
+		}
+	}
+	newExists, err := redis.Bool(t.conn.Do("EXISTS", newKey))
+	if err != nil || newExists {
+		return nil, err
+	}
+	args := redis.Args{oldKey}
+	for _, fs := range fields {
+		args = args.Add(fs.redisName)
+	}
+	values, err := redis.Values(t.conn.Do("HMGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	hashArgs := redis.Args{newKey}
+	for i, fs := range fields {
+		ciphertext, err := redis.Bytes(values[i], nil)
+		if err == redis.ErrNil || (err == nil && len(ciphertext) == 0) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		plaintext, err := decryptValue(ciphertext, encryptionAAD(oldKey, fs))
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err = encryptValue(plaintext, encryptionAAD(newKey, fs))
+		if err != nil {
+			return nil, err
+		}
+		hashArgs = hashArgs.Add(fs.redisName, ciphertext)
+	}
+	if len(hashArgs) == 1 {
+		return nil, nil
+	}
+	return hashArgs, nil
+}
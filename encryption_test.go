@@ -0,0 +1,177 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File encryption_test.go tests the code in encryption.go, i.e.
+// encrypting fields with the "encrypted" option.
+
+package zoom
+
+import (
+	"bytes"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"testing"
+)
+
+// encryptedModel is a model type that is only used for testing
+// encrypted fields
+type encryptedModel struct {
+	Email  string         `zoom:"encrypted"`
+	Age    *int           `zoom:"encrypted"`
+	Extra  map[string]int `zoom:"encrypted"`
+	Public string
+	DefaultData
+}
+
+func TestEncryptedFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	if err := setEncryptionKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("Unexpected error in setEncryptionKey: %s", err.Error())
+	}
+	defer setEncryptionKey(nil)
+	encryptedModels := registerTestType(t, &encryptedModel{})
+
+	age := randomInt()
+	model := &encryptedModel{
+		Email:  "secret@example.com",
+		Age:    &age,
+		Extra:  map[string]int{"a": randomInt()},
+		Public: randomString(),
+	}
+	if err := encryptedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The plaintext should not appear in the database, but unencrypted fields
+	// should be stored as usual
+	conn := NewConn()
+	defer conn.Close()
+	key, _ := encryptedModels.ModelKey(model.Id())
+	gotEmail, err := redis.Bytes(conn.Do("HGET", key, "Email"))
+	if err != nil {
+		t.Fatalf("Unexpected error in HGET: %s", err.Error())
+	}
+	if bytes.Contains(gotEmail, []byte(model.Email)) {
+		t.Errorf("Expected Email to be encrypted but got %q", gotEmail)
+	}
+	expectFieldEquals(t, key, "Public", model.Public)
+
+	modelCopy := &encryptedModel{}
+	if err := encryptedModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+
+	// Finding the model without the key should fail
+	setEncryptionKey(nil)
+	if err := encryptedModels.Find(model.Id(), &encryptedModel{}); err == nil {
+		t.Error("Expected error when finding an encrypted model without a key but got none")
+	}
+}
+
+func TestEncryptedIndexThrowsError(t *testing.T) {
+	type encryptedIndexModel struct {
+		Email string `zoom:"encrypted,index"`
+		DefaultData
+	}
+	if _, err := Register(&encryptedIndexModel{}); err == nil {
+		t.Error("Expected error when registering a model with an encrypted index but got none")
+	}
+}
+
+func TestEncryptionAAD(t *testing.T) {
+	if err := setEncryptionKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("Unexpected error in setEncryptionKey: %s", err.Error())
+	}
+	defer setEncryptionKey(nil)
+	email := &fieldSpec{redisName: "Email"}
+	public := &fieldSpec{redisName: "Public"}
+	ciphertext, err := encryptValue([]byte("secret"), encryptionAAD("encryptedModel:a", email))
+	if err != nil {
+		t.Fatalf("Unexpected error in encryptValue: %s", err.Error())
+	}
+	plaintext, err := decryptValue(ciphertext, encryptionAAD("encryptedModel:a", email))
+	if err != nil {
+		t.Fatalf("Unexpected error in decryptValue: %s", err.Error())
+	}
+	if string(plaintext) != "secret" {
+		t.Errorf("Expected plaintext to be secret but got %q", plaintext)
+	}
+	// The ciphertext should not decrypt for a different field or model
+	if _, err := decryptValue(ciphertext, encryptionAAD("encryptedModel:a", public)); err == nil {
+		t.Error("Expected error decrypting a value for a different field but got none")
+	}
+	if _, err := decryptValue(ciphertext, encryptionAAD("encryptedModel:b", email)); err == nil {
+		t.Error("Expected error decrypting a value for a different model but got none")
+	}
+}
+
+func TestEncryptedFieldsSwapped(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	if err := setEncryptionKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("Unexpected error in setEncryptionKey: %s", err.Error())
+	}
+	defer setEncryptionKey(nil)
+	encryptedModels := registerTestType(t, &encryptedModel{})
+
+	models := []*encryptedModel{{Email: "a@example.com"}, {Email: "b@example.com"}}
+	for _, model := range models {
+		if err := encryptedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+
+	// Copy the encrypted Email of the first model to the second
+	conn := NewConn()
+	defer conn.Close()
+	keyA, _ := encryptedModels.ModelKey(models[0].Id())
+	keyB, _ := encryptedModels.ModelKey(models[1].Id())
+	ciphertext, err := redis.Bytes(conn.Do("HGET", keyA, "Email"))
+	if err != nil {
+		t.Fatalf("Unexpected error in HGET: %s", err.Error())
+	}
+	if _, err := conn.Do("HSET", keyB, "Email", ciphertext); err != nil {
+		t.Fatalf("Unexpected error in HSET: %s", err.Error())
+	}
+	if err := encryptedModels.Find(models[1].Id(), &encryptedModel{}); err == nil {
+		t.Error("Expected error when finding a model with a swapped ciphertext but got none")
+	}
+}
+
+func TestEncryptedFieldsRename(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	if err := setEncryptionKey([]byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatalf("Unexpected error in setEncryptionKey: %s", err.Error())
+	}
+	defer setEncryptionKey(nil)
+	encryptedModels := registerTestType(t, &encryptedModel{})
+
+	model := &encryptedModel{Email: "secret@example.com", Public: randomString()}
+	if err := encryptedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	renamed, err := encryptedModels.Rename(model.Id(), "newId")
+	if err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	if !renamed {
+		t.Fatal("Expected model to be renamed")
+	}
+	model.SetId("newId")
+	modelCopy := &encryptedModel{}
+	if err := encryptedModels.Find("newId", modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File env.go contains code related to reading configuration
+// from environment variables.
+
+package zoom
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InitFromEnv is like Init but reads the configuration from environment
+// variables. See ConfigFromEnv for the variables which are supported.
+func InitFromEnv() error {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	return Init(config)
+}
+
+// ConfigFromEnv returns a Configuration created from the following
+// environment variables. Any variables which are not set (or are empty) fall
+// back to their default values.
+//
+//	REDIS_URL                  URL
+//	ZOOM_POOL_SIZE             MaxActive
+//	ZOOM_MAX_IDLE              MaxIdle
+//	ZOOM_IDLE_TIMEOUT          IdleTimeout, e.g. "4m"
+//	ZOOM_WAIT                  Wait, e.g. "true"
+//	ZOOM_CONNECT_TIMEOUT       ConnectTimeout
+//	ZOOM_READ_TIMEOUT          ReadTimeout
+//	ZOOM_WRITE_TIMEOUT         WriteTimeout
+//	ZOOM_WAIT_FOR_CONNECTION   WaitForConnection
+//	ZOOM_NETWORK_RETRIES       NetworkRetries
+//	ZOOM_REPLICA_ADDRESSES     ReplicaAddresses, separated by commas
+//	ZOOM_KEY_PREFIX            KeyPrefix
+//
+// Durations are parsed with time.ParseDuration and booleans are parsed with
+// strconv.ParseBool. ConfigFromEnv returns an error if any of the variables
+// have an invalid value.
+func ConfigFromEnv() (*Configuration, error) {
+	return configFromEnv(os.Getenv)
+}
+
+// configFromEnv creates a Configuration using getenv to get the value of each
+// environment variable.
+func configFromEnv(getenv func(string) string) (*Configuration, error) {
+	config := &Configuration{
+		URL:       getenv("REDIS_URL"),
+		KeyPrefix: getenv("ZOOM_KEY_PREFIX"),
+	}
+	if addresses := getenv("ZOOM_REPLICA_ADDRESSES"); addresses != "" {
+		for _, address := range strings.Split(addresses, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				config.ReplicaAddresses = append(config.ReplicaAddresses, address)
+			}
+		}
+	}
+	ints := map[string]*int{
+		"ZOOM_POOL_SIZE":       &config.MaxActive,
+		"ZOOM_MAX_IDLE":        &config.MaxIdle,
+		"ZOOM_NETWORK_RETRIES": &config.NetworkRetries,
+	}
+	for name, dest := range ints {
+		if value := getenv(name); value != "" {
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, envError(name, value, err)
+			}
+			*dest = i
+		}
+	}
+	durations := map[string]*time.Duration{
+		"ZOOM_IDLE_TIMEOUT":    &config.IdleTimeout,
+		"ZOOM_CONNECT_TIMEOUT": &config.ConnectTimeout,
+		"ZOOM_READ_TIMEOUT":    &config.ReadTimeout,
+		"ZOOM_WRITE_TIMEOUT":   &config.WriteTimeout,
+	}
+	for name, dest := range durations {
+		if value := getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, envError(name, value, err)
+			}
+			*dest = d
+		}
+	}
+	bools := map[string]*bool{
+		"ZOOM_WAIT":                &config.Wait,
+		"ZOOM_WAIT_FOR_CONNECTION": &config.WaitForConnection,
+	}
+	for name, dest := range bools {
+		if value := getenv(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, envError(name, value, err)
+			}
+			*dest = b
+		}
+	}
+	return config, nil
+}
+
+// envError returns an error indicating that the environment variable with the
+// given name had an invalid value.
+func envError(name string, value string, err error) error {
+	return fmt.Errorf("zoom: Error in ConfigFromEnv: invalid value %q for %s: %s", value, name, err.Error())
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File env_test.go tests the code in env.go, i.e.
+// reading configuration from environment variables.
+
+package zoom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"REDIS_URL":                "redis://:secret@example.com:6380/2",
+		"ZOOM_POOL_SIZE":           "50",
+		"ZOOM_MAX_IDLE":            "5",
+		"ZOOM_IDLE_TIMEOUT":        "2m",
+		"ZOOM_WAIT":                "true",
+		"ZOOM_CONNECT_TIMEOUT":     "1s",
+		"ZOOM_READ_TIMEOUT":        "500ms",
+		"ZOOM_WRITE_TIMEOUT":       "250ms",
+		"ZOOM_WAIT_FOR_CONNECTION": "1",
+		"ZOOM_NETWORK_RETRIES":     "3",
+		"ZOOM_REPLICA_ADDRESSES":   "replica1:6379, replica2:6379",
+		"ZOOM_KEY_PREFIX":          "myapp:",
+	}
+	getenv := func(name string) string {
+		return env[name]
+	}
+	config, err := configFromEnv(getenv)
+	if err != nil {
+		t.Fatalf("Unexpected error in configFromEnv: %s", err.Error())
+	}
+	expected := &Configuration{
+		URL:               "redis://:secret@example.com:6380/2",
+		MaxActive:         50,
+		MaxIdle:           5,
+		IdleTimeout:       2 * time.Minute,
+		Wait:              true,
+		ConnectTimeout:    time.Second,
+		ReadTimeout:       500 * time.Millisecond,
+		WriteTimeout:      250 * time.Millisecond,
+		WaitForConnection: true,
+		NetworkRetries:    3,
+		ReplicaAddresses:  []string{"replica1:6379", "replica2:6379"},
+		KeyPrefix:         "myapp:",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Configuration was incorrect.\nExpected: %+v\nGot:      %+v", expected, config)
+	}
+
+	// Variables which are not set should result in zero values
+	config, err = configFromEnv(func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("Unexpected error in configFromEnv: %s", err.Error())
+	}
+	if !reflect.DeepEqual(config, &Configuration{}) {
+		t.Errorf("Expected an empty Configuration but got %+v", config)
+	}
+
+	// Invalid values should result in an error
+	env = map[string]string{"ZOOM_POOL_SIZE": "lots"}
+	if _, err := configFromEnv(getenv); err == nil {
+		t.Error("Expected an error for an invalid ZOOM_POOL_SIZE but got none")
+	} else if !strings.Contains(err.Error(), "ZOOM_POOL_SIZE") {
+		t.Errorf("Expected error to mention ZOOM_POOL_SIZE but got: %s", err.Error())
+	}
+}
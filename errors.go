@@ -7,6 +7,11 @@
 
 package zoom
 
+import (
+	"fmt"
+	"strings"
+)
+
 // ModelNotFoundError is returned from Find and Query methods if a model
 // that fits the given criteria is not found.
 type ModelNotFoundError struct {
@@ -16,3 +21,25 @@ type ModelNotFoundError struct {
 func (e ModelNotFoundError) Error() string {
 	return "zoom: ModelNotFoundError: " + e.Msg
 }
+
+// AlreadyExistsError is returned from SaveIfNotExists if a model with the
+// same type and id already exists in the database.
+type AlreadyExistsError struct {
+	Msg string
+}
+
+func (e AlreadyExistsError) Error() string {
+	return "zoom: AlreadyExistsError: " + e.Msg
+}
+
+// WatchError is returned from Exec if one or more watched keys were modified
+// by some other client after Watch or WatchKey was called but before the
+// transaction was executed. When this happens, none of the commands in the
+// transaction are executed.
+type WatchError struct {
+	keys []string
+}
+
+func (e WatchError) Error() string {
+	return fmt.Sprintf("zoom: WatchError: Transaction aborted because one or more watched keys (%s) were modified", strings.Join(e.keys, ", "))
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File event_hooks.go contains code related to hooks which can
+// transform or enrich change events before they are recorded.
+
+package zoom
+
+// ChangeEventHook is called before a ChangeEvent is published or appended to the
+// changelog (see PublishChanges and StreamChanges), so that the event can be
+// tailored to its consumers. A hook may modify event, e.g. by adding the id of
+// a tenant to event.Meta or removing sensitive fields from event.Fields. model
+// is the model which was saved, or nil for deletes and for changes to a single
+// list or set field (e.g. PushToField), and must not be modified.
+// If a hook returns false, the event is dropped and neither published nor
+// appended to the changelog, and any remaining hooks are not called. Since the
+// event is recorded in the same transaction as the change, hooks should be
+// fast and should not access the database.
+type ChangeEventHook func(event *ChangeEvent, model Model) bool
+
+// AddChangeEventHooks adds hooks which will run before each change event for
+// a type registered with the default pool is recorded. It is not safe to call
+// AddChangeEventHooks concurrently with other zoom functions, so it should
+// typically be called during application startup.
+func AddChangeEventHooks(hooks ...ChangeEventHook) {
+	defaultPool.AddChangeEventHooks(hooks...)
+}
+
+// AddChangeEventHooks is like the package-level AddChangeEventHooks function but
+// adds hooks for p instead of the default pool. Hooks run in the order they
+// were added.
+func (p *Pool) AddChangeEventHooks(hooks ...ChangeEventHook) {
+	p.changeEventHooks = append(p.changeEventHooks, hooks...)
+}
+
+// runChangeEventHooks calls the ChangeEventHooks for the pool of the given type
+// in order. It returns false if any of them dropped the event.
+func runChangeEventHooks(ms *modelSpec, event *ChangeEvent, model Model) bool {
+	if ms.pool == nil {
+		return true
+	}
+	for _, hook := range ms.pool.changeEventHooks {
+		if !hook(event, model) {
+			return false
+		}
+	}
+	return true
+}
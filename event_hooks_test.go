@@ -0,0 +1,81 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File event_hooks_test.go tests the code in event_hooks.go.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangeEventHooks(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, StreamChanges(StreamOptions{}))
+	AddChangeEventHooks(
+		// Drop events for models with a secret name
+		func(event *ChangeEvent, model Model) bool {
+			return model == nil || model.(*publishedModel).Name != "secret"
+		},
+		// Add a tenant and hide the Status field
+		func(event *ChangeEvent, model Model) bool {
+			event.Meta = map[string]string{"tenant": "acme"}
+			fields := []string{}
+			for _, field := range event.Fields {
+				if field != "Status" {
+					fields = append(fields, field)
+				}
+			}
+			event.Fields = fields
+			return true
+		},
+	)
+	defer func() {
+		defaultPool.changeEventHooks = nil
+	}()
+	s, err := publishedModels.Subscribe()
+	if err != nil {
+		t.Fatalf("Unexpected error in Subscribe: %s", err.Error())
+	}
+	defer s.Close()
+
+	if err := publishedModels.Save(&publishedModel{Name: "secret", Status: "active"}); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	model := &publishedModel{Name: "Alice", Status: "active"}
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expected := ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      SaveOp,
+		Fields:    []string{"Name"},
+		Meta:      map[string]string{"tenant": "acme"},
+	}
+	// The event for the secret model should have been dropped
+	expectChangeEvent(t, s, expected)
+	select {
+	case event := <-s.Events:
+		t.Errorf("Expected no more events but got %#v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The changelog should match
+	events := []ChangeEvent{}
+	if _, err := publishedModels.ReplayChanges("", func(event ChangeEvent) error {
+		event.StreamId = ""
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error in ReplayChanges: %s", err.Error())
+	}
+	if !reflect.DeepEqual([]ChangeEvent{expected}, events) {
+		t.Errorf("Wrong changelog.\n\tExpected: %#v\n\tBut got:  %#v", []ChangeEvent{expected}, events)
+	}
+}
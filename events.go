@@ -0,0 +1,315 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File events.go contains code related to publishing events when
+// models are changed and subscribing to them.
+
+package zoom
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sync"
+)
+
+// subscriptionBufferSize is the number of events which can be received by a
+// Subscription before they are read from the Events channel.
+const subscriptionBufferSize = 100
+
+// PublishChanges is a ModelOption which causes a ChangeEvent to be published
+// whenever a model of the given type is saved or deleted, so that other
+// processes can react to changes in real time (see ModelType.Subscribe). Each
+// event is published with PUBLISH in the same transaction as the change itself,
+// so it is only published if the change succeeds. Events are not stored, so
+// subscribers which are not connected when an event is published will miss it.
+func PublishChanges() ModelOption {
+	return func(spec *modelSpec) error {
+		spec.publishChanges = true
+		return nil
+	}
+}
+
+// DiffChanges is a ModelOption which causes zoom to compare the new value of
+// each field to the value stored in the database whenever a model of the given
+// type is saved, so that the Fields of the resulting ChangeEvent only include
+// the fields whose values actually changed. Combined with
+// ModelType.SubscribeFields, this lets subscribers ignore saves which did not
+// change the fields they care about. Fields which are stored outside of the
+// main hash (e.g. lists) are always considered changed. The main hash for the
+// model is watched while the old values are read, so models of the given type
+// can only be saved in a Transaction (see NewTransaction). It has no effect
+// unless the PublishChanges or StreamChanges option is also used.
+func DiffChanges() ModelOption {
+	return func(spec *modelSpec) error {
+		spec.diffChanges = true
+		return nil
+	}
+}
+
+// ChangeEvent describes a change to one or more models of a registered type.
+type ChangeEvent struct {
+	// ModelName is the name of the registered type.
+	ModelName string `json:"model"`
+	// Id is the id of the model which was changed. It is empty for DeleteAllOp.
+	Id string `json:"id,omitempty"`
+	// Kind is SaveOp, DeleteOp, or DeleteAllOp.
+	Kind OpKind `json:"op"`
+	// Fields holds the names of the fields which were saved. If the type uses
+	// the TrackChanges or DiffChanges option, only the fields which changed are
+	// included. It is empty for deletes.
+	Fields []string `json:"fields,omitempty"`
+	// Meta holds any extra information added by a ChangeEventHook, e.g. the
+	// id of the tenant which owns the model. It is empty unless a hook sets it.
+	Meta map[string]string `json:"meta,omitempty"`
+	// StreamId is the id of the entry in the changelog if the event was read
+	// from the changelog (see StreamChanges). It is empty otherwise.
+	StreamId string `json:"-"`
+}
+
+// changesChannel returns the name of the channel where change events for
+// models of the given type are published.
+func (ms *modelSpec) changesChannel() string {
+	return ms.keyName() + ":changes"
+}
+
+// recordChange adds commands to the transaction which publish event and append
+// it to the changelog, depending on which options are used by the given type.
+// model is the model which was saved, or nil for deletes. Any ChangeEventHooks
+// are run first, and if one of them drops the event, nothing is recorded.
+func (t *Transaction) recordChange(ms *modelSpec, event *ChangeEvent, model Model) {
+	if !ms.publishChanges && ms.changelog == nil {
+		return
+	}
+	if !runChangeEventHooks(ms, event, model) {
+		return
+	}
+	t.publishChange(ms, event)
+	t.appendChange(ms, event)
+}
+
+// publishChange adds a command to the transaction which publishes event if
+// models of the given type use the PublishChanges option.
+func (t *Transaction) publishChange(ms *modelSpec, event *ChangeEvent) {
+	if !ms.publishChanges {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.setError(fmt.Errorf("zoom: Error encoding ChangeEvent: %s", err.Error()))
+		return
+	}
+	if ms.coalescer != nil && event.Id != "" {
+		t.coalesceChange(ms, event.Id, data, ms.coalescer.newScheduleFlushHandler(ms))
+		return
+	}
+	t.Command("PUBLISH", redis.Args{ms.changesChannel(), data}, nil)
+}
+
+// diffFields returns the fields in fields whose new values for mr.model differ
+// from the values stored in the database. If the type does not use the
+// DiffChanges option (or does not record changes), it returns fields unchanged.
+func (t *Transaction) diffFields(mr *modelRef, fields []*fieldSpec) ([]*fieldSpec, error) {
+	if !mr.spec.diffChanges || (!mr.spec.publishChanges && mr.spec.changelog == nil) {
+		return fields, nil
+	}
+	if t.conn == nil {
+		return nil, fmt.Errorf("zoom: %s uses the DiffChanges option, so it can only be saved in a Transaction", mr.spec.name)
+	}
+	key := mr.key()
+	if err := t.WatchKey(key); err != nil {
+		return nil, err
+	}
+	args := redis.Args{key}
+	hashFields := []*fieldSpec{}
+	for _, fs := range fields {
+		if fs.storedInHash() {
+			args = append(args, fs.redisName)
+			hashFields = append(hashFields, fs)
+		}
+	}
+	if len(hashFields) == 0 {
+		return fields, nil
+	}
+	oldValues, err := redis.Values(t.conn.Do("HMGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	unchanged := map[*fieldSpec]bool{}
+	for i, fs := range hashFields {
+		value, err := mr.hashValue(fs)
+		if err != nil {
+			return nil, err
+		}
+		if oldValues[i] == nil {
+			// The field was not stored. Nil pointers are not stored if the type
+			// uses NullAbsent.
+			if value == getSettings().nullSentinel && mr.spec.getNullStrategy() == NullAbsent {
+				unchanged[fs] = true
+			}
+			continue
+		}
+		oldValue, err := redis.String(oldValues[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		if redisArgString(value) == oldValue {
+			unchanged[fs] = true
+		}
+	}
+	changed := []*fieldSpec{}
+	for _, fs := range fields {
+		if !unchanged[fs] {
+			changed = append(changed, fs)
+		}
+	}
+	return changed, nil
+}
+
+// redisArgString returns the string that value is converted to when it is sent
+// to the database as an argument to a command.
+func redisArgString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// fieldSpecNames returns the names of the given fields.
+func fieldSpecNames(fields []*fieldSpec) []string {
+	names := make([]string, len(fields))
+	for i, fs := range fields {
+		names[i] = fs.name
+	}
+	return names
+}
+
+// Subscription receives the change events for a registered type. It is created
+// with ModelType.Subscribe.
+type Subscription struct {
+	// Events receives each event as it is published. It is closed when the
+	// subscription is closed.
+	Events <-chan ChangeEvent
+	events chan ChangeEvent
+	// closeEvents ensures events is only closed once
+	closeEvents sync.Once
+	// fields is set if the subscription was created with SubscribeFields
+	fields map[string]bool
+	*subscriber
+}
+
+// Subscribe returns a Subscription which receives a ChangeEvent every time a
+// model of the given type is saved or deleted by any process. The type must
+// use the PublishChanges option. Events should be read from the Events channel
+// promptly, since the subscription stops receiving new events while the
+// channel is full. If the connection is lost, the subscription reconnects
+// automatically, but any events published in the meantime are missed. Call
+// Close when the subscription is no longer needed.
+func (mt *ModelType) Subscribe() (*Subscription, error) {
+	s, err := mt.subscribe(nil)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in Subscribe: %s", err.Error())
+	}
+	return s, nil
+}
+
+// SubscribeFields is like Subscribe but the Subscription only receives events
+// for saves which changed at least one of the fields with the given names, as
+// well as every delete. It is most useful when the type also uses the
+// TrackChanges or DiffChanges option. Otherwise every field is considered
+// changed whenever a model is saved.
+func (mt *ModelType) SubscribeFields(fieldNames ...string) (*Subscription, error) {
+	if len(fieldNames) == 0 {
+		return nil, fmt.Errorf("zoom: Error in SubscribeFields: at least one field name is required")
+	}
+	fields := map[string]bool{}
+	for _, name := range fieldNames {
+		if _, found := mt.spec.fieldsByName[name]; !found {
+			return nil, fmt.Errorf("zoom: Error in SubscribeFields: %s has no field named %s", mt.Name(), name)
+		}
+		fields[name] = true
+	}
+	s, err := mt.subscribe(fields)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in SubscribeFields: %s", err.Error())
+	}
+	return s, nil
+}
+
+// subscribe returns a started Subscription for the given type. If fields is not
+// nil, saves which did not change any of the fields are ignored.
+func (mt *ModelType) subscribe(fields map[string]bool) (*Subscription, error) {
+	if !mt.spec.publishChanges {
+		return nil, fmt.Errorf("%s was not registered with the PublishChanges option", mt.Name())
+	}
+	events := make(chan ChangeEvent, subscriptionBufferSize)
+	s := &Subscription{
+		Events: events,
+		events: events,
+		fields: fields,
+	}
+	sub, err := mt.spec.pool.newSubscriber("SUBSCRIBE", []string{mt.spec.changesChannel()}, nil, s.handle)
+	if err != nil {
+		return nil, err
+	}
+	s.subscriber = sub
+	sub.start()
+	return s, nil
+}
+
+// matches returns true iff event should be sent to s.Events.
+func (s *Subscription) matches(event ChangeEvent) bool {
+	if s.fields == nil || event.Kind != SaveOp {
+		return true
+	}
+	for _, name := range event.Fields {
+		if s.fields[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// handle decodes a message and sends it to s.events.
+func (s *Subscription) handle(_ string, data []byte) {
+	event := ChangeEvent{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		s.setError(fmt.Errorf("zoom: Error decoding ChangeEvent: %s", err.Error()))
+		return
+	}
+	if !s.matches(event) {
+		return
+	}
+	select {
+	case s.events <- event:
+	case <-s.closed:
+	}
+}
+
+// Err returns the first error encountered by the subscription, if any,
+// including errors from connections which were lost and then reestablished.
+func (s *Subscription) Err() error {
+	return s.subscriber.Err()
+}
+
+// Close stops the subscription and closes the Events channel. It returns the
+// same error as Err.
+func (s *Subscription) Close() error {
+	err := s.subscriber.Close()
+	s.closeEvents.Do(func() {
+		close(s.events)
+	})
+	return err
+}
@@ -0,0 +1,208 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File events_test.go tests the code in events.go.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type publishedModel struct {
+	Name   string
+	Status string
+	DefaultData
+}
+
+// registerPublishedModels registers publishedModel with the given options in
+// addition to PublishChanges for the duration of the test.
+func registerPublishedModels(t *testing.T, options ...ModelOption) *ModelType {
+	return registerTestType(t, &publishedModel{}, append([]ModelOption{PublishChanges()}, options...)...)
+}
+
+// expectChangeEvent receives an event from s and reports an error via t.Errorf
+// if it does not equal expected.
+func expectChangeEvent(t *testing.T, s *Subscription, expected ChangeEvent) {
+	select {
+	case got, ok := <-s.Events:
+		if !ok {
+			t.Fatalf("Expected %v but Events was closed. Err: %v", expected, s.Err())
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("Wrong ChangeEvent.\n\tExpected: %#v\n\tBut got:  %#v", expected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %v", expected)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t)
+	s, err := publishedModels.Subscribe()
+	if err != nil {
+		t.Fatalf("Unexpected error in Subscribe: %s", err.Error())
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Unexpected error in Subscription.Close: %s", err.Error())
+		}
+	}()
+
+	model := &publishedModel{Name: "Alice", Status: "active"}
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectChangeEvent(t, s, ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      SaveOp,
+		Fields:    []string{"Name", "Status"},
+	})
+	if _, err := publishedModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	expectChangeEvent(t, s, ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      DeleteOp,
+	})
+	if _, err := publishedModels.DeleteAll(); err != nil {
+		t.Fatalf("Unexpected error in DeleteAll: %s", err.Error())
+	}
+	expectChangeEvent(t, s, ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Kind:      DeleteAllOp,
+	})
+
+	// Types without the PublishChanges option cannot be subscribed to
+	if _, err := testModels.Subscribe(); err == nil {
+		t.Error("Expected an error in Subscribe for a type without PublishChanges")
+	}
+}
+
+func TestSubscribeFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t, DiffChanges())
+	s, err := publishedModels.SubscribeFields("Status")
+	if err != nil {
+		t.Fatalf("Unexpected error in SubscribeFields: %s", err.Error())
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Unexpected error in Subscription.Close: %s", err.Error())
+		}
+	}()
+
+	// Every field of a new model is considered changed
+	model := &publishedModel{Name: "Alice", Status: "active"}
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectChangeEvent(t, s, ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      SaveOp,
+		Fields:    []string{"Name", "Status"},
+	})
+	// Saving without changing Status should not send an event, so the next
+	// event should be for the save which changed Status.
+	model.Name = "Alicia"
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	model.Status = "inactive"
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectChangeEvent(t, s, ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      SaveOp,
+		Fields:    []string{"Status"},
+	})
+	if _, err := publishedModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	expectChangeEvent(t, s, ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      DeleteOp,
+	})
+
+	if _, err := publishedModels.SubscribeFields("Age"); err == nil {
+		t.Error("Expected an error in SubscribeFields for a field which does not exist")
+	}
+}
+
+func TestRedisArgString(t *testing.T) {
+	testCases := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"foo", "foo"},
+		{[]byte("bar"), "bar"},
+		{true, "1"},
+		{false, "0"},
+		{42, "42"},
+		{-3.5, "-3.5"},
+		{nil, ""},
+	}
+	for _, tc := range testCases {
+		if got := redisArgString(tc.value); got != tc.expected {
+			t.Errorf("redisArgString(%#v): expected %q but got %q", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t)
+	s, err := publishedModels.Subscribe()
+	if err != nil {
+		t.Fatalf("Unexpected error in Subscribe: %s", err.Error())
+	}
+	defer s.Close()
+
+	// Kill the connection used by the subscription
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("CLIENT", "KILL", "TYPE", "pubsub"); err != nil {
+		t.Fatalf("Unexpected error in CLIENT KILL: %s", err.Error())
+	}
+
+	// Keep saving until the subscription has reconnected and receives an event
+	model := &publishedModel{Name: "Bob"}
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := publishedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		select {
+		case event, ok := <-s.Events:
+			if !ok {
+				t.Fatalf("Expected Events to stay open but it was closed. Err: %v", s.Err())
+			}
+			if event.Id != model.Id() {
+				t.Errorf("Expected event for %s but got %#v", model.Id(), event)
+			}
+			if s.Err() == nil {
+				t.Error("Expected Err to report the lost connection")
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Timed out waiting for the subscription to reconnect")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File expiration.go contains code related to cleaning up after
+// models which have expired, so that they are no longer returned
+// by queries.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"strings"
+)
+
+// ExpirationListener removes models from the set of all models and from any
+// field indexes after they expire. It is created with ListenForExpirations.
+type ExpirationListener struct {
+	*subscriber
+}
+
+// ListenForExpirations starts an ExpirationListener for the default pool. See
+// Pool.ListenForExpirations.
+func ListenForExpirations() (*ExpirationListener, error) {
+	return defaultPool.ListenForExpirations()
+}
+
+// ListenForExpirations starts a background goroutine which is notified by the
+// database whenever a key expires (see http://redis.io/topics/notifications).
+// When the main hash for a model registered with p expires, e.g. because of the
+// TTL option or SaveWithTTL, the listener removes the model id from the set of
+// all models and from any field indexes, and deletes any fields which are
+// stored outside of the main hash. Without a listener, expired models are still
+// counted and returned as empty models by queries. For types which use the
+// ArchiveOnExpire option, the listener is also responsible for archiving and
+// deleting models when they expire.
+//
+// Keyspace notifications for expired keys are enabled with CONFIG SET if
+// needed. If CONFIG is not available (as is the case with some hosted redis
+// services), notify-keyspace-events must already include "Ex". Since the
+// database only sends notifications to connected clients, models which expire
+// while no listener is connected are not cleaned up. If the connection is lost,
+// the listener reconnects automatically. Only models of types which are
+// registered before the listener receives the notification are cleaned up.
+// Removing an expired model from a string index requires checking every member
+// of the index, so it may be slow for large indexes. The listener runs until
+// Close is called, and each expiration is handled by every running listener,
+// so most applications only need one.
+func (p *Pool) ListenForExpirations() (*ExpirationListener, error) {
+	channel := fmt.Sprintf("__keyevent@%d__:expired", p.getState().config.Database)
+	onConnect := func(conn redis.Conn) error {
+		return enableNotifications(conn, "Ex")
+	}
+	l := &ExpirationListener{}
+	sub, err := p.newSubscriber("SUBSCRIBE", []string{channel}, onConnect, func(_ string, data []byte) {
+		if err := p.removeExpiredKey(string(data)); err != nil {
+			l.setError(err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ListenForExpirations: %s", err.Error())
+	}
+	l.subscriber = sub
+	sub.start()
+	return l, nil
+}
+
+// removeExpiredKey removes the model whose main hash was identified by key
+// from the set of all models and any field indexes. It has no effect if key
+// does not belong to a model registered with p.
+func (p *Pool) removeExpiredKey(key string) error {
+	for _, spec := range p.specs() {
+		prefix := spec.keyName() + ":"
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		id := strings.TrimPrefix(key, prefix)
+		if spec.archiveOnExpire {
+			if strings.HasSuffix(id, ":"+expiresKeySuffix) {
+				if err := p.archiveAndDelete(spec, strings.TrimSuffix(id, ":"+expiresKeySuffix)); err != nil {
+					return fmt.Errorf("zoom: Error archiving expired model %s: %s", key, err.Error())
+				}
+			}
+			continue
+		}
+		// key may also be a list or set field for some model, in which case the
+		// id will not be in the set of all ids and the script has no effect
+		t := p.NewTransaction()
+		t.removeExpiredModel(spec, id, nil)
+		if err := t.Exec(); err != nil {
+			return fmt.Errorf("zoom: Error removing expired model %s: %s", key, err.Error())
+		}
+	}
+	return nil
+}
+
+// Err returns the first error encountered by the listener, if any. Errors that
+// occur while removing an expired model or when the connection is lost do not
+// stop the listener.
+func (l *ExpirationListener) Err() error {
+	return l.subscriber.Err()
+}
+
+// Close stops the listener and waits for it to finish handling the current
+// expiration, if any. It returns the same error as Err.
+func (l *ExpirationListener) Close() error {
+	return l.subscriber.Close()
+}
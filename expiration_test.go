@@ -0,0 +1,69 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File expiration_test.go tests the code in expiration.go.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"testing"
+	"time"
+)
+
+func TestListenForExpirations(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	listener, err := ListenForExpirations()
+	if err != nil {
+		t.Fatalf("Unexpected error in ListenForExpirations: %s", err.Error())
+	}
+	defer func() {
+		if err := listener.Close(); err != nil {
+			t.Errorf("Unexpected error in ExpirationListener.Close: %s", err.Error())
+		}
+	}()
+
+	models, err := createAndSaveIndexedTestModels(1)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	expiring := createIndexedTestModels(1)[0]
+	if err := indexedTestModels.SaveWithTTL(expiring, 10*time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error in SaveWithTTL: %s", err.Error())
+	}
+
+	// Wait for the listener to remove the expired model
+	conn := NewConn()
+	defer conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		found, err := redis.Bool(conn.Do("SISMEMBER", indexedTestModels.AllIndexKey(), expiring.Id()))
+		if err != nil {
+			t.Fatalf("Unexpected error in SISMEMBER: %s", err.Error())
+		}
+		if !found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected expired model to be removed from the set of all models")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, fieldName := range []string{"Int", "String", "Bool"} {
+		expectIndexDoesNotExist(t, indexedTestModels, expiring, fieldName)
+		expectIndexExists(t, indexedTestModels, models[0], fieldName)
+	}
+	count, err := indexedTestModels.Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 1 {
+		t.Errorf("Expected Count to be 1 but got %d", count)
+	}
+	if err := listener.Err(); err != nil {
+		t.Errorf("Unexpected error in ExpirationListener: %s", err.Error())
+	}
+}
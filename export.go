@@ -0,0 +1,74 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File export.go contains code related to dumping every model of a
+// type to an io.Writer.
+
+package zoom
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// ExportFormat is the format used by ModelType.Export.
+type ExportFormat int
+
+const (
+	// JSONLinesFormat writes each model as a single line of JSON (also known
+	// as newline-delimited JSON). Each line is an object with the id of the
+	// model in "id" and the model itself, encoded with encoding/json, in
+	// "model", e.g. {"id":"...","model":{"Name":"Bob","Age":25}}.
+	JSONLinesFormat ExportFormat = iota
+)
+
+// defaultExportBatchSize is the number of models found at a time by Export
+// for types which do not use the ScanFindAll option.
+var defaultExportBatchSize = 1000
+
+// exportRecord is the format of each line written by Export with
+// JSONLinesFormat.
+type exportRecord struct {
+	Id    string `json:"id"`
+	Model Model  `json:"model"`
+}
+
+// Export writes every model of the given type to w in the given format, e.g.
+// for nightly dumps of large types. The models are found incrementally with
+// SSCAN, a batch at a time (see ScanFindAll), and written as soon as they are
+// found, so the whole type is never held in memory and other clients are not
+// blocked while it runs. The batch size passed to ScanFindAll is used if the
+// type was registered with that option, and otherwise 1,000 models are found
+// at a time. Since the models are not found atomically, models which are saved
+// or deleted while Export is running may or may not be included, and if the
+// set of all models grows or shrinks a lot during the export, the same model
+// may be written more than once. w is not closed when Export returns.
+func (mt *ModelType) Export(w io.Writer, format ExportFormat) error {
+	if format != JSONLinesFormat {
+		return fmt.Errorf("zoom: Error in Export: unsupported format %d", format)
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	batchSize := mt.spec.scanBatchSize
+	if batchSize == 0 {
+		batchSize = defaultExportBatchSize
+	}
+	if err := mt.scanBatches(batchSize, func(batch reflect.Value) error {
+		for i := 0; i < batch.Len(); i++ {
+			model := batch.Index(i).Interface().(Model)
+			// Encode adds the newline after each record
+			if err := enc.Encode(exportRecord{Id: model.Id(), Model: model}); err != nil {
+				return err
+			}
+		}
+		// Flush after each batch so that slow exports still make progress
+		return bw.Flush()
+	}); err != nil {
+		return fmt.Errorf("zoom: Error in Export: %s", err.Error())
+	}
+	return nil
+}
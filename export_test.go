@@ -0,0 +1,66 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File export_test.go tests the code in export.go.
+
+package zoom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Use a small batch size so that more than one batch is needed
+	oldBatchSize := defaultExportBatchSize
+	defaultExportBatchSize = 2
+	defer func() {
+		defaultExportBatchSize = oldBatchSize
+	}()
+
+	models, err := createAndSaveTestModels(5)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	expected := map[string]*testModel{}
+	for _, model := range models {
+		expected[model.Id()] = model
+	}
+	buf := &bytes.Buffer{}
+	if err := testModels.Export(buf, JSONLinesFormat); err != nil {
+		t.Fatalf("Unexpected error in Export: %s", err.Error())
+	}
+	got := map[string]*testModel{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var record struct {
+			Id    string     `json:"id"`
+			Model *testModel `json:"model"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Unexpected error decoding %q: %s", scanner.Text(), err.Error())
+		}
+		record.Model.SetId(record.Id)
+		got[record.Id] = record.Model
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d models but got %d", len(expected), len(got))
+	}
+	for id, model := range expected {
+		if gotModel, found := got[id]; !found {
+			t.Errorf("Model with id %s was not exported", id)
+		} else if gotModel.Int != model.Int || gotModel.String != model.String || gotModel.Bool != model.Bool {
+			t.Errorf("Exported model was incorrect.\nExpected: %+v\nGot:      %+v", model, gotModel)
+		}
+	}
+
+	if err := testModels.Export(&bytes.Buffer{}, ExportFormat(-1)); err == nil {
+		t.Error("Expected an error in Export for an unsupported format")
+	}
+}
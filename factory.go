@@ -0,0 +1,346 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File factory.go contains code related to building and saving models
+// with random field values, e.g. for tests.
+
+package zoom
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Factory builds models of a registered type with random but valid field
+// values, optionally overriding some of them, and can save them to the
+// database. It is intended for tests, e.g.
+//
+//	users, err := zoom.NewFactory(&User{}).With("Age", 30).CreateN(10)
+//
+// A Factory is created with NewFactory. With and WithFunc return a new Factory
+// and do not change the one they are called on, so a Factory can be used as a
+// base for others. The methods of a Factory are safe for concurrent use.
+type Factory struct {
+	pool      *Pool
+	spec      *modelSpec
+	overrides []factoryOverride
+	// seq counts the models built by this factory and every factory derived
+	// from it, and is passed to the functions given to WithFunc
+	seq *int64
+	// err is the first error that occurred while creating the factory (if any).
+	// It is returned by all the methods which build models.
+	err error
+}
+
+// factoryOverride is a value for a field which overrides the random one. Either
+// value or fn is set.
+type factoryOverride struct {
+	fs    *fieldSpec
+	value reflect.Value
+	fn    func(n int) interface{}
+}
+
+// NewFactory returns a Factory for the registered type of model, which is only
+// used to determine the type. The type must be registered with the default
+// pool.
+//
+// By default, each field of a model built by the factory has a random value:
+//   - Numbers, strings, bools, byte slices, and times are random.
+//   - Pointers to any of those point to a new random value.
+//   - Slices and arrays of any of those have three random elements.
+//   - Fields with a default value (see the "default" struct tag option) are
+//     left empty, so that they are set to the default when saved.
+//   - Fields with transitions (see UseTransitions) are set to one of the
+//     allowed initial states.
+//   - Any other fields, e.g. maps, structs, unexported fields, and fields which
+//     use a custom MarshalerUnmarshaler or implement Valuer, are left empty.
+//
+// Random strings are long enough that they are very unlikely to collide, but
+// random numbers for small types (e.g. int8) may collide. Use WithFunc to set
+// unique fields which have such types.
+func NewFactory(model Model) *Factory {
+	return defaultPool.NewFactory(model)
+}
+
+// NewFactory is like the package-level NewFactory function but uses p instead
+// of the default pool. The type of model must be registered with p.
+func (p *Pool) NewFactory(model Model) *Factory {
+	f := &Factory{
+		pool: p,
+		seq:  new(int64),
+	}
+	spec, found := p.specForType(reflect.TypeOf(model))
+	if !found {
+		f.err = fmt.Errorf("zoom: Error in NewFactory: Type %T has not been registered", model)
+		return f
+	}
+	f.spec = spec
+	return f
+}
+
+// With returns a new Factory which sets the field with the given name to value
+// instead of a random value. value must be assignable or convertible to the
+// type of the field. If the field does not exist or value has the wrong type,
+// the error is returned when the new Factory is used to build models.
+func (f *Factory) With(fieldName string, value interface{}) *Factory {
+	g := f.derive()
+	if g.err != nil {
+		return g
+	}
+	fs, err := g.fieldSpec("With", fieldName)
+	if err != nil {
+		g.err = err
+		return g
+	}
+	val, err := convertFactoryValue(fs, value)
+	if err != nil {
+		g.err = fmt.Errorf("zoom: Error in Factory.With: %s", err.Error())
+		return g
+	}
+	g.overrides = append(g.overrides, factoryOverride{fs: fs, value: val})
+	return g
+}
+
+// WithFunc returns a new Factory which sets the field with the given name to
+// the value returned by fn instead of a random value, e.g. to give each model a
+// unique email address. The argument to fn is a sequence number, which starts
+// at 0 and is incremented for each model built by this factory, the factory
+// it was derived from, and any factories derived from them. The value returned
+// by fn must be assignable or convertible to the type of the field.
+func (f *Factory) WithFunc(fieldName string, fn func(n int) interface{}) *Factory {
+	g := f.derive()
+	if g.err != nil {
+		return g
+	}
+	fs, err := g.fieldSpec("WithFunc", fieldName)
+	if err != nil {
+		g.err = err
+		return g
+	}
+	g.overrides = append(g.overrides, factoryOverride{fs: fs, fn: fn})
+	return g
+}
+
+// derive returns a copy of f which can be changed without affecting f.
+func (f *Factory) derive() *Factory {
+	g := *f
+	g.overrides = append([]factoryOverride{}, f.overrides...)
+	return &g
+}
+
+// fieldSpec returns the fieldSpec for the field with the given name. method is
+// the name of the method which was called, for error messages.
+func (f *Factory) fieldSpec(method string, fieldName string) (*fieldSpec, error) {
+	fs, found := f.spec.fieldsByName[fieldName]
+	if !found {
+		return nil, fmt.Errorf("zoom: Error in Factory.%s: %s has no field named %s", method, f.spec.typ.String(), fieldName)
+	}
+	return fs, nil
+}
+
+// convertFactoryValue converts value to the type of the field for fs.
+func convertFactoryValue(fs *fieldSpec, value interface{}) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(fs.typ), nil
+	}
+	val := reflect.ValueOf(value)
+	switch {
+	case val.Type().AssignableTo(fs.typ):
+		return val, nil
+	case val.Type().ConvertibleTo(fs.typ):
+		return val.Convert(fs.typ), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %#v (type %T) as the value for %s, which has type %s", value, value, fs.name, fs.typ.String())
+}
+
+// Build returns a new model with random field values and any overrides, but
+// does not save it. The model does not have an id until it is saved.
+func (f *Factory) Build() (Model, error) {
+	models, err := f.BuildN(1)
+	if err != nil {
+		return nil, err
+	}
+	return models[0], nil
+}
+
+// BuildN returns n new models with random field values and any overrides, but
+// does not save them. See Build.
+func (f *Factory) BuildN(n int) ([]Model, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	models := make([]Model, n)
+	for i := range models {
+		model, err := f.build()
+		if err != nil {
+			return nil, err
+		}
+		models[i] = model
+	}
+	return models, nil
+}
+
+// build returns a single new model.
+func (f *Factory) build() (Model, error) {
+	seq := int(atomic.AddInt64(f.seq, 1) - 1)
+	mr := &modelRef{
+		model: reflect.New(f.spec.typ.Elem()).Interface().(Model),
+		spec:  f.spec,
+	}
+	for _, fs := range f.spec.fields {
+		randomizeField(fs, mr.specFieldValue(fs))
+	}
+	for _, override := range f.overrides {
+		val := override.value
+		if override.fn != nil {
+			var err error
+			val, err = convertFactoryValue(override.fs, override.fn(seq))
+			if err != nil {
+				return nil, fmt.Errorf("zoom: Error in Factory.WithFunc: %s", err.Error())
+			}
+		}
+		mr.specFieldValue(override.fs).Set(val)
+	}
+	return mr.model, nil
+}
+
+// Create is like Build but also saves the model.
+func (f *Factory) Create() (Model, error) {
+	models, err := f.CreateN(1)
+	if err != nil {
+		return nil, err
+	}
+	return models[0], nil
+}
+
+// CreateN is like BuildN but also saves the models, in a single transaction.
+func (f *Factory) CreateN(n int) ([]Model, error) {
+	models, err := f.BuildN(n)
+	if err != nil {
+		return nil, err
+	}
+	mt := &ModelType{spec: f.spec}
+	t := f.pool.NewTransaction()
+	for _, model := range models {
+		t.Save(mt, model)
+	}
+	if err := t.Exec(); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// factoryCollectionLen is the number of elements in the random value for a
+// slice field.
+const factoryCollectionLen = 3
+
+// factoryTimeRange is the range of random times, which are between
+// factoryTimeRange ago and now.
+const factoryTimeRange = 365 * 24 * time.Hour
+
+// randomizeField sets val, the value of the field for fs, to a random value
+// which is valid for the field. See NewFactory for the rules.
+func randomizeField(fs *fieldSpec, val reflect.Value) {
+	switch {
+	case !val.CanSet(), fs.hasDefault():
+		return
+	case fs.transitions != nil:
+		if states := initialStates(fs.transitions); len(states) > 0 {
+			val.SetString(states[rand.Intn(len(states))])
+		}
+		return
+	case typeIsTime(fs.typ):
+		randomizeValue(val)
+		return
+	case fs.marshalerUnmarshaler != nil, typeIsValuerScanner(fs.typ):
+		return
+	}
+	randomizeValue(val)
+}
+
+// initialStates returns the states which a new model with the given
+// transitions may have, in sorted order.
+func initialStates(transitions map[string]map[string]bool) []string {
+	set := map[string]bool{}
+	if initial, found := transitions[""]; found {
+		set = initial
+	} else {
+		for from, tos := range transitions {
+			set[from] = true
+			for to := range tos {
+				set[to] = true
+			}
+		}
+	}
+	states := []string{}
+	for state := range set {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// randomizeValue sets val to a random value if it has a supported type, and
+// otherwise leaves it unchanged.
+func randomizeValue(val reflect.Value) {
+	typ := val.Type()
+	switch {
+	case typ == timeType:
+		// Times are stored with nanosecond precision in UTC
+		val.Set(reflect.ValueOf(time.Now().Add(-time.Duration(rand.Int63n(int64(factoryTimeRange)))).UTC()))
+		return
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		val.SetBytes([]byte(randomString()))
+		return
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		val.SetString(randomString())
+	case reflect.Bool:
+		val.SetBool(randomBool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Use a non-negative value which fits in the type
+		val.SetInt(rand.Int63() >> uint(64-typ.Bits()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		val.SetUint(uint64(rand.Int63()) >> uint(64-typ.Bits()))
+	case reflect.Float32, reflect.Float64:
+		// Use a value which can be represented exactly by either type
+		val.SetFloat(float64(float32(rand.Intn(1000000)) / 100))
+	case reflect.Ptr:
+		if canRandomize(typ.Elem()) {
+			elem := reflect.New(typ.Elem())
+			randomizeValue(elem.Elem())
+			val.Set(elem)
+		}
+	case reflect.Slice:
+		if canRandomize(typ.Elem()) {
+			slice := reflect.MakeSlice(typ, factoryCollectionLen, factoryCollectionLen)
+			for i := 0; i < slice.Len(); i++ {
+				randomizeValue(slice.Index(i))
+			}
+			val.Set(slice)
+		}
+	case reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			randomizeValue(val.Index(i))
+		}
+	}
+}
+
+// canRandomize returns true iff randomizeValue can set a value of type typ to a
+// random value.
+func canRandomize(typ reflect.Type) bool {
+	if typ == timeType {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return canRandomize(typ.Elem())
+	}
+	return typeIsPrimative(typ)
+}
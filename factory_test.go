@@ -0,0 +1,191 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File factory_test.go tests the code for building models with random
+// field values.
+
+package zoom
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type factoryTestModel struct {
+	Int      int
+	Int8     int8
+	Uint16   uint16
+	Float32  float32
+	String   string
+	Bool     bool
+	Bytes    []byte
+	Time     time.Time
+	TimePtr  *time.Time
+	IntPtr   *int
+	Strings  []string `redisType:"list"`
+	Map      map[string]int
+	Status   string
+	Default  string             `zoom:"default=foo"`
+	Address  factoryTestAddress `zoom:"flatten"`
+	unexport int
+	DefaultData
+}
+
+type factoryTestAddress struct {
+	City string
+}
+
+// newFactoryTestPool returns a new pool with factoryTestModel registered. The
+// pool is not used to connect to the database, so tests which use it do not
+// require one.
+func newFactoryTestPool(t *testing.T) *Pool {
+	pool, err := NewPool(&Configuration{})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	transitions := Transitions{
+		"":       {"draft"},
+		"draft":  {"posted"},
+		"posted": {"archived"},
+	}
+	if _, err := pool.RegisterWithOptions(&factoryTestModel{}, UseTransitions("Status", transitions)); err != nil {
+		t.Fatalf("Unexpected error in RegisterWithOptions: %s", err.Error())
+	}
+	return pool
+}
+
+func TestFactoryBuild(t *testing.T) {
+	pool := newFactoryTestPool(t)
+	models, err := pool.NewFactory(&factoryTestModel{}).BuildN(2)
+	if err != nil {
+		t.Fatalf("Unexpected error in BuildN: %s", err.Error())
+	}
+	if len(models) != 2 {
+		t.Fatalf("Expected 2 models but got %d", len(models))
+	}
+	model := models[0].(*factoryTestModel)
+	if model.Id() != "" {
+		t.Errorf("Expected model to not have an id before it is saved but got %s", model.Id())
+	}
+	if model.String == "" || model.String == models[1].(*factoryTestModel).String {
+		t.Errorf("Expected random distinct strings but got %q and %q", model.String, models[1].(*factoryTestModel).String)
+	}
+	if len(model.Bytes) == 0 {
+		t.Error("Expected Bytes to be set")
+	}
+	if model.Int < 0 || model.Int8 < 0 {
+		t.Errorf("Expected non-negative ints but got %d and %d", model.Int, model.Int8)
+	}
+	if model.Time.IsZero() || model.Time.After(time.Now()) || model.Time.Location() != time.UTC {
+		t.Errorf("Expected Time to be a time in the past in UTC but got %v", model.Time)
+	}
+	if model.TimePtr == nil || model.IntPtr == nil {
+		t.Error("Expected pointer fields to be set")
+	}
+	if len(model.Strings) != factoryCollectionLen {
+		t.Errorf("Expected Strings to have %d elements but got %v", factoryCollectionLen, model.Strings)
+	}
+	if model.Map != nil {
+		t.Errorf("Expected Map to be left empty but got %v", model.Map)
+	}
+	if model.Status != "draft" {
+		t.Errorf("Expected Status to be the initial state draft but got %q", model.Status)
+	}
+	if model.Default != "" {
+		t.Errorf("Expected field with a default to be left empty but got %q", model.Default)
+	}
+	if model.Address.City == "" {
+		t.Error("Expected field of flattened struct to be set")
+	}
+	if model.unexport != 0 {
+		t.Errorf("Expected unexported field to be left empty but got %d", model.unexport)
+	}
+}
+
+func TestFactoryWith(t *testing.T) {
+	pool := newFactoryTestPool(t)
+	base := pool.NewFactory(&factoryTestModel{})
+	custom := base.With("Int", 30).With("Uint16", 7).With("Address.City", "Paris").With("IntPtr", nil).
+		WithFunc("String", func(n int) interface{} {
+			return fmt.Sprintf("user%d@example.com", n)
+		})
+	models, err := custom.BuildN(3)
+	if err != nil {
+		t.Fatalf("Unexpected error in BuildN: %s", err.Error())
+	}
+	for i, m := range models {
+		model := m.(*factoryTestModel)
+		if model.Int != 30 || model.Uint16 != 7 || model.Address.City != "Paris" || model.IntPtr != nil {
+			t.Errorf("Overrides were not applied to model %d: %+v", i, model)
+		}
+		if expected := fmt.Sprintf("user%d@example.com", i); model.String != expected {
+			t.Errorf("Expected String of model %d to be %s but got %s", i, expected, model.String)
+		}
+	}
+	// The sequence is shared with factories derived from base
+	model, err := custom.With("Bool", true).Build()
+	if err != nil {
+		t.Fatalf("Unexpected error in Build: %s", err.Error())
+	}
+	if got := model.(*factoryTestModel).String; got != "user3@example.com" {
+		t.Errorf("Expected the sequence to continue with user3@example.com but got %s", got)
+	}
+	// With should not have changed base
+	model, err = base.Build()
+	if err != nil {
+		t.Fatalf("Unexpected error in Build: %s", err.Error())
+	}
+	if model.(*factoryTestModel).Address.City == "Paris" {
+		t.Error("Expected With to not change the factory it was called on")
+	}
+}
+
+func TestFactoryErrors(t *testing.T) {
+	pool := newFactoryTestPool(t)
+	testCases := map[string]*Factory{
+		"unregistered type": pool.NewFactory(&testModel{}),
+		"unknown field":     pool.NewFactory(&factoryTestModel{}).With("Name", "Bob"),
+		"wrong type":        pool.NewFactory(&factoryTestModel{}).With("Int", "thirty"),
+		"wrong type in WithFunc": pool.NewFactory(&factoryTestModel{}).WithFunc("Bool", func(n int) interface{} {
+			return n
+		}),
+		"error before With": pool.NewFactory(&factoryTestModel{}).With("Name", "Bob").With("Int", 30),
+	}
+	for desc, factory := range testCases {
+		if _, err := factory.Build(); err == nil {
+			t.Errorf("Expected an error for %s but got none", desc)
+		}
+	}
+}
+
+func TestFactoryCreateN(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := NewFactory(&indexedTestModel{}).With("Int", 30).CreateN(10)
+	if err != nil {
+		t.Fatalf("Unexpected error in CreateN: %s", err.Error())
+	}
+	for _, model := range models {
+		if model.(*indexedTestModel).Int != 30 {
+			t.Errorf("Expected Int to be 30 but got %d", model.(*indexedTestModel).Int)
+		}
+		got := &indexedTestModel{}
+		if err := indexedTestModels.Find(model.Id(), got); err != nil {
+			t.Errorf("Unexpected error in Find: %s", err.Error())
+			continue
+		}
+		if err := expectModelsToBeEqual([]*indexedTestModel{model.(*indexedTestModel)}, []*indexedTestModel{got}, false); err != nil {
+			t.Error(err)
+		}
+	}
+	count, err := indexedTestModels.NewQuery().Filter("Int =", 30).Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 10 {
+		t.Errorf("Expected 10 models with Int = 30 but got %d", count)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File fixtures.go contains code related to loading models described
+// in fixture files, e.g. for tests and demos.
+
+package zoom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// fixture is a single model described in a fixture file.
+type fixture struct {
+	// file is the name of the file in which the fixture was described
+	file     string
+	typeName string
+	// name is the symbolic name of the fixture, which is used to refer to it
+	// from other fixtures
+	name   string
+	fields map[string]interface{}
+}
+
+// LoadFixtures reads the fixture file at path, or every fixture file in path
+// if it is a directory, and saves the models they describe in a single
+// transaction. Fixture files may be JSON (with the extension .json) or YAML
+// (with the extension .yml or .yaml). Each one holds an object which maps the
+// names of registered model types to the models of that type, keyed by a
+// symbolic name. The fields of each model are decoded with encoding/json, so
+// they can use the same field names and json struct tags as usual. For
+// example:
+//
+//	{
+//		"Person": {
+//			"alice": {"Name": "Alice", "Age": 30},
+//			"bob":   {"$id": "123", "Name": "Bob", "Age": 25}
+//		},
+//		"Post": {
+//			"hello": {"Title": "Hello", "AuthorId": {"$ref": "alice"}}
+//		}
+//	}
+//
+// The id of each model is its symbolic name unless it has an "$id" field, so
+// the same fixtures always produce the same data. Anywhere a field value is an
+// object of the form {"$ref": "<name>"}, it is replaced by the id of the model
+// with that symbolic name, which lets fixtures refer to each other in any
+// order and across files. Symbolic names must be unique across all the files
+// which are loaded. LoadFixtures returns the models which were saved, keyed by
+// their symbolic names. Nothing is saved if any fixture is invalid, e.g. if it
+// has an unknown field or an unknown reference.
+func LoadFixtures(path string) (map[string]Model, error) {
+	return defaultPool.LoadFixtures(path)
+}
+
+// LoadFixtures is like the package-level LoadFixtures function but uses p
+// instead of the default pool. All the model types in the fixtures must be
+// registered with p.
+func (p *Pool) LoadFixtures(path string) (map[string]Model, error) {
+	files, err := fixtureFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in LoadFixtures: %s", err.Error())
+	}
+	fixtures := []*fixture{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in LoadFixtures: %s", err.Error())
+		}
+		fileFixtures, err := parseFixtures(file, data)
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in LoadFixtures: %s", err.Error())
+		}
+		fixtures = append(fixtures, fileFixtures...)
+	}
+	models, err := p.buildFixtures(fixtures)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in LoadFixtures: %s", err.Error())
+	}
+	t := p.NewTransaction()
+	for _, f := range fixtures {
+		model := models[f.name]
+		mt, err := p.modelTypeOf(model)
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in LoadFixtures: %s", err.Error())
+		}
+		t.Save(mt, model)
+	}
+	if err := t.Exec(); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// fixtureFiles returns the fixture files at path. If path is a directory, they
+// are the files in it with a supported extension, in alphabetical order.
+// Otherwise path itself is the only file.
+func fixtureFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(info.Name())) {
+		case ".json", ".yml", ".yaml":
+			files = append(files, filepath.Join(path, info.Name()))
+		}
+	}
+	return files, nil
+}
+
+// parseFixtures parses the contents of a fixture file. The format is
+// determined by the extension of file. The fixtures are sorted by type name
+// and then by symbolic name, so that they are always saved in the same order.
+func parseFixtures(file string, data []byte) ([]*fixture, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+	case ".yml", ".yaml":
+		// Convert the YAML to JSON so that both formats are decoded the same way
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", file, err.Error())
+		}
+		v, err := jsonCompatibleYAML(v)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", file, err.Error())
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", file, err.Error())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture file %s (the extension must be .json, .yml, or .yaml)", file)
+	}
+	var types map[string]map[string]map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers exactly as they were written, since they are encoded again
+	// and decoded into the fields of the models later
+	dec.UseNumber()
+	if err := dec.Decode(&types); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", file, err.Error())
+	}
+	fixtures := []*fixture{}
+	for typeName, models := range types {
+		for name, fields := range models {
+			fixtures = append(fixtures, &fixture{
+				file:     file,
+				typeName: typeName,
+				name:     name,
+				fields:   fields,
+			})
+		}
+	}
+	sort.Sort(fixturesByTypeAndName(fixtures))
+	return fixtures, nil
+}
+
+// fixturesByTypeAndName sorts fixtures by type name and then by symbolic name.
+type fixturesByTypeAndName []*fixture
+
+func (fs fixturesByTypeAndName) Len() int      { return len(fs) }
+func (fs fixturesByTypeAndName) Swap(i, j int) { fs[i], fs[j] = fs[j], fs[i] }
+func (fs fixturesByTypeAndName) Less(i, j int) bool {
+	if fs[i].typeName != fs[j].typeName {
+		return fs[i].typeName < fs[j].typeName
+	}
+	return fs[i].name < fs[j].name
+}
+
+// jsonCompatibleYAML converts the maps in a value decoded by the yaml package,
+// which have keys of type interface{}, to maps with string keys, so that the
+// value can be encoded as JSON.
+func jsonCompatibleYAML(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("keys must be strings but got %v", key)
+			}
+			converted, err := jsonCompatibleYAML(value)
+			if err != nil {
+				return nil, err
+			}
+			result[keyString] = converted
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			converted, err := jsonCompatibleYAML(value)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	}
+	return v, nil
+}
+
+// buildFixtures creates a model for each fixture, with any references replaced
+// by ids, and returns the models keyed by their symbolic names. It returns an
+// error if the type of a fixture has not been registered with p, if a symbolic
+// name is used more than once, or if a fixture cannot be decoded into a model.
+func (p *Pool) buildFixtures(fixtures []*fixture) (map[string]Model, error) {
+	// Determine the id for each fixture first, since any fixture may refer to
+	// any other
+	ids := map[string]string{}
+	files := map[string]string{}
+	for _, f := range fixtures {
+		if otherFile, found := files[f.name]; found {
+			return nil, fmt.Errorf("the fixture %s is defined more than once (in %s and %s)", f.name, otherFile, f.file)
+		}
+		files[f.name] = f.file
+		ids[f.name] = f.name
+		if id, found := f.fields["$id"]; found {
+			idString, ok := id.(string)
+			if !ok || idString == "" {
+				return nil, fmt.Errorf("the $id of fixture %s must be a non-empty string", f.name)
+			}
+			ids[f.name] = idString
+		}
+	}
+	models := map[string]Model{}
+	for _, f := range fixtures {
+		spec, found := p.specForName(f.typeName)
+		if !found {
+			return nil, fmt.Errorf("the type %s of fixture %s has not been registered", f.typeName, f.name)
+		}
+		fields := map[string]interface{}{}
+		for fieldName, value := range f.fields {
+			if fieldName == "$id" {
+				continue
+			}
+			resolved, err := resolveFixtureRefs(value, ids)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s in fixture %s: %s", fieldName, f.name, err.Error())
+			}
+			fields[fieldName] = resolved
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		model := reflect.New(spec.typ.Elem()).Interface().(Model)
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(model); err != nil {
+			return nil, fmt.Errorf("could not decode fixture %s into %s: %s", f.name, spec.typ.String(), err.Error())
+		}
+		model.SetId(ids[f.name])
+		models[f.name] = model
+	}
+	return models, nil
+}
+
+// resolveFixtureRefs returns a copy of value in which every object of the form
+// {"$ref": "<name>"} is replaced by ids[name]. It returns an error if a name is
+// not in ids.
+func resolveFixtureRefs(value interface{}, ids map[string]string) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if ref, found := value["$ref"]; found && len(value) == 1 {
+			name, ok := ref.(string)
+			if !ok {
+				return nil, fmt.Errorf("$ref must be a string but got %v", ref)
+			}
+			id, found := ids[name]
+			if !found {
+				return nil, fmt.Errorf("could not find fixture %s", name)
+			}
+			return id, nil
+		}
+		result := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			resolved, err := resolveFixtureRefs(v, ids)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = resolved
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, v := range value {
+			resolved, err := resolveFixtureRefs(v, ids)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+		return result, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File fixtures_test.go tests the code for loading fixture files.
+
+package zoom
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFixtureFiles writes files, which maps file names to their contents, to
+// a new temporary directory and returns the directory.
+func writeFixtureFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "zoomfixtures")
+	if err != nil {
+		t.Fatalf("Unexpected error in ioutil.TempDir: %s", err.Error())
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error in ioutil.WriteFile: %s", err.Error())
+		}
+	}
+	return dir
+}
+
+func TestLoadFixtures(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	dir := writeFixtureFiles(t, map[string]string{
+		"models.json": `{
+			"testModel": {
+				"alice": {"Int": 30, "String": "Alice", "Bool": true},
+				"bob": {"$id": "bob-id", "Int": 25, "String": {"$ref": "carol"}}
+			}
+		}`,
+		"indexed.yml": "indexedTestModel:\n  carol:\n    Int: 9007199254740993\n    String:\n      $ref: bob\n",
+		"README.md":   "not a fixture file",
+	})
+	defer os.RemoveAll(dir)
+	models, err := LoadFixtures(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error in LoadFixtures: %s", err.Error())
+	}
+	expected := map[string]Model{
+		"alice": &testModel{Int: 30, String: "Alice", Bool: true},
+		"bob":   &testModel{Int: 25, String: "carol"},
+		"carol": &indexedTestModel{Int: 9007199254740993, String: "bob-id"},
+	}
+	expected["alice"].SetId("alice")
+	expected["bob"].SetId("bob-id")
+	expected["carol"].SetId("carol")
+	if !reflect.DeepEqual(expected, models) {
+		t.Errorf("Returned models were incorrect.\nExpected: %v\nGot:      %v", expected, models)
+	}
+	for name, model := range expected {
+		mt := testModels
+		got := Model(&testModel{})
+		if _, ok := model.(*indexedTestModel); ok {
+			mt = indexedTestModels
+			got = &indexedTestModel{}
+		}
+		if err := mt.Find(model.Id(), got); err != nil {
+			t.Errorf("Unexpected error in Find for fixture %s: %s", name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(model, got) {
+			t.Errorf("Saved model for fixture %s was incorrect.\nExpected: %v\nGot:      %v", name, model, got)
+		}
+	}
+}
+
+func TestLoadFixturesErrors(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	testCases := map[string]string{
+		"unknown field":        `{"testModel": {"alice": {"Name": "Alice"}}}`,
+		"unknown reference":    `{"testModel": {"alice": {"String": {"$ref": "dave"}}}}`,
+		"unregistered type":    `{"Person": {"alice": {"Name": "Alice"}}}`,
+		"wrong type for field": `{"testModel": {"alice": {"Int": "thirty"}}}`,
+		"invalid $id":          `{"testModel": {"alice": {"$id": 42}}}`,
+		"invalid JSON":         `{"testModel": `,
+	}
+	for desc, contents := range testCases {
+		dir := writeFixtureFiles(t, map[string]string{
+			"valid.json":   `{"testModel": {"bob": {"Int": 1}}}`,
+			"invalid.json": contents,
+		})
+		if _, err := LoadFixtures(dir); err == nil {
+			t.Errorf("Expected an error for %s but got none", desc)
+		}
+		os.RemoveAll(dir)
+	}
+	// The fixtures in valid.json should not have been saved
+	count, err := testModels.Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("Expected no models to be saved but got %d", count)
+	}
+
+	dir := writeFixtureFiles(t, map[string]string{
+		"a.json": `{"testModel": {"alice": {"Int": 1}}}`,
+		"b.json": `{"indexedTestModel": {"alice": {"Int": 2}}}`,
+	})
+	defer os.RemoveAll(dir)
+	if _, err := LoadFixtures(dir); err == nil {
+		t.Error("Expected an error for a duplicate fixture name but got none")
+	}
+	if _, err := LoadFixtures(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a file which does not exist but got none")
+	}
+}
+
+func TestParseFixtures(t *testing.T) {
+	fixtures, err := parseFixtures("models.json", []byte(`{
+		"b": {"y": {"Int": 12345678901234567890}, "x": {}},
+		"a": {"z": {"String": "foo"}}
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error in parseFixtures: %s", err.Error())
+	}
+	got := []string{}
+	for _, f := range fixtures {
+		got = append(got, f.typeName+"."+f.name)
+	}
+	expected := []string{"a.z", "b.x", "b.y"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Fixtures were not sorted correctly. Expected %v but got %v", expected, got)
+	}
+	if num, ok := fixtures[2].fields["Int"].(json.Number); !ok || num.String() != "12345678901234567890" {
+		t.Errorf("Expected number to be preserved exactly but got %v", fixtures[2].fields["Int"])
+	}
+	if _, err := parseFixtures("models.txt", []byte("{}")); err == nil {
+		t.Error("Expected an error for an unsupported extension but got none")
+	}
+}
+
+func TestResolveFixtureRefs(t *testing.T) {
+	ids := map[string]string{"alice": "1", "bob": "2"}
+	value := map[string]interface{}{
+		"Author":  map[string]interface{}{"$ref": "alice"},
+		"Readers": []interface{}{map[string]interface{}{"$ref": "alice"}, map[string]interface{}{"$ref": "bob"}},
+		"Other":   map[string]interface{}{"$ref": "bob", "Extra": "not a reference"},
+		"Title":   "Hello",
+	}
+	got, err := resolveFixtureRefs(value, ids)
+	if err != nil {
+		t.Fatalf("Unexpected error in resolveFixtureRefs: %s", err.Error())
+	}
+	expected := map[string]interface{}{
+		"Author":  "1",
+		"Readers": []interface{}{"1", "2"},
+		"Other":   map[string]interface{}{"$ref": "bob", "Extra": "not a reference"},
+		"Title":   "Hello",
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v but got %v", expected, got)
+	}
+}
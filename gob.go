@@ -0,0 +1,153 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File gob.go contains code related to registering types with the
+// gob package, which is needed for fields that contain interfaces.
+
+package zoom
+
+import (
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// RegisterGobTypes registers the concrete type of each value with the gob package
+// (see gob.Register). Zoom automatically registers the concrete types it finds
+// when saving fields which contain interfaces, but a process which only finds
+// models must register them itself before calling Find, e.g. in an init function.
+// It returns an error instead of panicking if a type cannot be registered.
+func RegisterGobTypes(values ...interface{}) error {
+	for _, value := range values {
+		if err := registerGobType(reflect.TypeOf(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	// gobRegisteredTypes holds the base types of the types which have been
+	// registered with gob
+	gobRegisteredTypes = map[reflect.Type]bool{}
+	// gobInterfaceTypes caches the result of typeContainsInterface
+	gobInterfaceTypes = map[reflect.Type]bool{}
+	gobTypesMutex     = sync.Mutex{}
+)
+
+// registerGobType registers typ with the gob package if it has not been registered
+// already. gob names a type after its base type and cannot tell T and *T apart
+// once they have been sent through an interface, so only the first of T, *T,
+// **T, etc. to be seen is registered.
+func registerGobType(typ reflect.Type) (err error) {
+	if typ == nil {
+		return nil
+	}
+	base := typ
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+	gobTypesMutex.Lock()
+	defer gobTypesMutex.Unlock()
+	if gobRegisteredTypes[base] {
+		return nil
+	}
+	defer func() {
+		// gob.Register panics if the name of typ is already registered to another type
+		if r := recover(); r != nil {
+			err = fmt.Errorf("zoom: could not register %s with gob: %v", typ.String(), r)
+		}
+	}()
+	gob.Register(reflect.Zero(typ).Interface())
+	gobRegisteredTypes[base] = true
+	return nil
+}
+
+// typeContainsInterface returns true iff values of type typ can contain interface
+// values, e.g. because typ is a map with interface values or a struct with an
+// interface field. The result is cached.
+func typeContainsInterface(typ reflect.Type) bool {
+	gobTypesMutex.Lock()
+	result, found := gobInterfaceTypes[typ]
+	gobTypesMutex.Unlock()
+	if found {
+		return result
+	}
+	result = typeContainsInterfaceVisited(typ, map[reflect.Type]bool{})
+	gobTypesMutex.Lock()
+	gobInterfaceTypes[typ] = result
+	gobTypesMutex.Unlock()
+	return result
+}
+
+func typeContainsInterfaceVisited(typ reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[typ] {
+		return false
+	}
+	visited[typ] = true
+	switch typ.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return typeContainsInterfaceVisited(typ.Elem(), visited)
+	case reflect.Map:
+		return typeContainsInterfaceVisited(typ.Key(), visited) || typeContainsInterfaceVisited(typ.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			// gob ignores unexported fields
+			if field := typ.Field(i); field.PkgPath == "" && typeContainsInterfaceVisited(field.Type, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// registerGobTypesIn walks val and registers the concrete type of every non-nil
+// interface value it contains with gob, so that gob can encode it.
+func registerGobTypesIn(val reflect.Value) error {
+	if !val.IsValid() || !typeContainsInterface(val.Type()) {
+		return nil
+	}
+	switch val.Kind() {
+	case reflect.Interface:
+		if val.IsNil() {
+			return nil
+		}
+		if err := registerGobType(val.Elem().Type()); err != nil {
+			return err
+		}
+		return registerGobTypesIn(val.Elem())
+	case reflect.Ptr:
+		if val.IsNil() {
+			return nil
+		}
+		return registerGobTypesIn(val.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			if err := registerGobTypesIn(val.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range val.MapKeys() {
+			if err := registerGobTypesIn(key); err != nil {
+				return err
+			}
+			if err := registerGobTypesIn(val.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			if val.Type().Field(i).PkgPath == "" {
+				if err := registerGobTypesIn(val.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
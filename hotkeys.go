@@ -0,0 +1,188 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File hotkeys.go contains code related to finding the models which
+// are accessed most often.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TrackHotKeys is a ModelOption which causes the number of times each model of
+// the given type is accessed to be counted, so that operators can find the
+// models responsible for skewed load (see ModelType.HotKeys) and decide what to
+// cache. Calls to Find, FindByIds, and Save on the ModelType count as accesses,
+// including finds which are served from a local cache and finds for models
+// which do not exist. Methods on Transaction are not counted. Deleting or
+// renaming a model removes or moves its count.
+//
+// To keep the overhead low, only a random sample of accesses is recorded, e.g.
+// 1 in 100 if sampleRate is 0.01, and each one is counted as 1/sampleRate
+// accesses. Recorded accesses are collected in memory and sent to the database
+// in the background about every 100ms, so they do not add a round trip to the
+// access itself. Any counts which have not been sent yet when the process exits
+// are lost. If sending them fails, the error is passed to the BackgroundError
+// connection hooks. Only the 1000 models with the highest counts are kept.
+// sampleRate must be greater than 0 and at most 1.
+func TrackHotKeys(sampleRate float64) ModelOption {
+	return func(spec *modelSpec) error {
+		if sampleRate <= 0 || sampleRate > 1 {
+			return fmt.Errorf("zoom: TrackHotKeys sampleRate must be greater than 0 and at most 1 but got %v", sampleRate)
+		}
+		spec.hotKeys = &hotKeyCounter{sampleRate: sampleRate, pending: map[string]float64{}}
+		return nil
+	}
+}
+
+const (
+	// hotKeysFlushInterval is how long recorded accesses are collected in
+	// memory before they are sent to the database.
+	hotKeysFlushInterval = 100 * time.Millisecond
+	// hotKeysMaxLen is the maximum number of models whose access counts are
+	// kept for each type. When there are more, the models with the lowest
+	// counts are removed.
+	hotKeysMaxLen = 1000
+)
+
+// hotKeyCounter holds the sample rate for a type which uses the TrackHotKeys
+// option, the accesses which have been recorded but not sent to the database
+// yet, and whether a flush has been scheduled for them.
+type hotKeyCounter struct {
+	sampleRate float64
+	mu         sync.Mutex
+	pending    map[string]float64
+	scheduled  bool
+}
+
+// HotKey is the id of a model and the number of times it was accessed. It is
+// returned by ModelType.HotKeys.
+type HotKey struct {
+	Id string
+	// Count is an estimate of the number of times the model was accessed since
+	// the counts were last reset, based on the sampled accesses.
+	Count int64
+}
+
+// hotKeysKey returns the key for a sorted set which holds the id of each model
+// which was accessed, scored by the estimated number of accesses.
+func (ms *modelSpec) hotKeysKey() string {
+	return ms.internalKey("hotkeys")
+}
+
+// recordAccess counts an access to each model with the given ids if the type
+// uses the TrackHotKeys option and the access is sampled. The counts are sent
+// to the database by a flush which runs in the background.
+func (mt *ModelType) recordAccess(ids ...string) {
+	c := mt.spec.hotKeys
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	recorded := false
+	for _, id := range ids {
+		if id != "" && rand.Float64() < c.sampleRate {
+			c.pending[id] += 1 / c.sampleRate
+			recorded = true
+		}
+	}
+	if recorded && !c.scheduled {
+		c.scheduled = true
+		time.AfterFunc(hotKeysFlushInterval, func() {
+			if err := c.flush(mt.spec); err != nil {
+				mt.spec.pool.runBackgroundErrorHooks(fmt.Errorf("zoom: Error recording hot keys for %s: %s", mt.spec.name, err.Error()))
+			}
+		})
+	}
+	c.mu.Unlock()
+}
+
+// forget discards any counts for the model with the given id which have not
+// been sent to the database yet, so that a deleted or renamed model is not
+// added back by the next flush.
+func (c *hotKeyCounter) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// flush sends the pending counts for the given type to the database in a
+// single transaction and removes the models with the lowest counts if there
+// are more than hotKeysMaxLen. flush does nothing if the pool has been closed
+// or the type has been unregistered.
+func (c *hotKeyCounter) flush(ms *modelSpec) error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = map[string]float64{}
+	c.scheduled = false
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	if spec, found := ms.pool.specForName(ms.name); !found || spec != ms || ms.pool.isClosed() {
+		return nil
+	}
+	t := ms.pool.NewTransaction()
+	for id, count := range pending {
+		t.Command("ZINCRBY", redis.Args{ms.hotKeysKey(), count, id}, nil)
+	}
+	t.Command("ZREMRANGEBYRANK", redis.Args{ms.hotKeysKey(), 0, -hotKeysMaxLen - 1}, nil)
+	return t.Exec()
+}
+
+// HotKeys returns the n models of the given type which were accessed most often
+// since the counts were last reset, starting with the most accessed. The type
+// must use the TrackHotKeys option. Any counts recorded by this process which
+// have not been sent to the database yet are sent first. Since accesses are
+// sampled, models which are rarely accessed may not be included at all, and the
+// counts for models with few accesses are not very accurate.
+func (mt *ModelType) HotKeys(n int) ([]HotKey, error) {
+	if mt.spec.hotKeys == nil {
+		return nil, fmt.Errorf("zoom: Error in HotKeys: %s was not registered with the TrackHotKeys option", mt.Name())
+	}
+	if err := mt.spec.hotKeys.flush(mt.spec); err != nil {
+		return nil, fmt.Errorf("zoom: Error in HotKeys: %s", err.Error())
+	}
+	if n <= 0 {
+		return []HotKey{}, nil
+	}
+	conn := mt.spec.pool.NewConn()
+	defer conn.Close()
+	values, err := redis.Strings(conn.Do("ZREVRANGE", mt.spec.hotKeysKey(), 0, n-1, "WITHSCORES"))
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in HotKeys: %s", err.Error())
+	}
+	hotKeys := make([]HotKey, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in HotKeys: could not parse score %q: %s", values[i+1], err.Error())
+		}
+		hotKeys = append(hotKeys, HotKey{Id: values[i], Count: int64(math.Floor(score + 0.5))})
+	}
+	return hotKeys, nil
+}
+
+// ResetHotKeys resets the access counts for every model of the given type,
+// e.g. to find the hot keys for a specific period of time.
+func (mt *ModelType) ResetHotKeys() error {
+	if c := mt.spec.hotKeys; c != nil {
+		c.mu.Lock()
+		c.pending = map[string]float64{}
+		c.mu.Unlock()
+	}
+	conn := mt.spec.pool.NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("DEL", mt.spec.hotKeysKey()); err != nil {
+		return fmt.Errorf("zoom: Error in ResetHotKeys: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File hotkeys_test.go tests the code in hotkeys.go.
+
+package zoom
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestHotKeys(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Record every access so that the counts are exact
+	mt := registerPublishedModels(t, TrackHotKeys(1))
+
+	models := []*publishedModel{{Name: "hot"}, {Name: "warm"}, {Name: "cold"}}
+	for _, model := range models {
+		if err := mt.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := mt.Find(models[0].Id(), &publishedModel{}); err != nil {
+			t.Fatalf("Unexpected error in Find: %s", err.Error())
+		}
+	}
+	if err := mt.FindByIds([]string{models[0].Id(), models[1].Id()}, &[]*publishedModel{}); err != nil {
+		t.Fatalf("Unexpected error in FindByIds: %s", err.Error())
+	}
+
+	hotKeys, err := mt.HotKeys(2)
+	if err != nil {
+		t.Fatalf("Unexpected error in HotKeys: %s", err.Error())
+	}
+	expected := []HotKey{
+		{Id: models[0].Id(), Count: 5},
+		{Id: models[1].Id(), Count: 2},
+	}
+	if !reflect.DeepEqual(expected, hotKeys) {
+		t.Errorf("Wrong hot keys.\n\tExpected: %v\n\tBut got:  %v", expected, hotKeys)
+	}
+
+	// Renaming a model should move its count and deleting it should remove it
+	oldId := models[1].Id()
+	if _, err := mt.Rename(oldId, "renamed"+oldId); err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	models[1].SetId("renamed" + oldId)
+	if _, err := mt.Delete(models[0].Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	hotKeys, err = mt.HotKeys(2)
+	if err != nil {
+		t.Fatalf("Unexpected error in HotKeys: %s", err.Error())
+	}
+	expected = []HotKey{
+		{Id: models[1].Id(), Count: 2},
+		{Id: models[2].Id(), Count: 1},
+	}
+	if !reflect.DeepEqual(expected, hotKeys) {
+		t.Errorf("Wrong hot keys after Rename and Delete.\n\tExpected: %v\n\tBut got:  %v", expected, hotKeys)
+	}
+
+	// Only the models with the highest counts should be kept
+	ids := make([]string, hotKeysMaxLen+1)
+	for i := range ids {
+		ids[i] = "missing" + strconv.Itoa(i)
+	}
+	if err := mt.FindByIds(ids, &[]*publishedModel{}); err != nil {
+		t.Fatalf("Unexpected error in FindByIds: %s", err.Error())
+	}
+	if hotKeys, err := mt.HotKeys(hotKeysMaxLen + 10); err != nil {
+		t.Fatalf("Unexpected error in HotKeys: %s", err.Error())
+	} else if len(hotKeys) != hotKeysMaxLen {
+		t.Errorf("Expected %d hot keys but got %d", hotKeysMaxLen, len(hotKeys))
+	} else if hotKeys[0].Id != models[1].Id() {
+		t.Errorf("Expected the model with the highest count to be kept but got %v", hotKeys[0])
+	}
+
+	if err := mt.ResetHotKeys(); err != nil {
+		t.Fatalf("Unexpected error in ResetHotKeys: %s", err.Error())
+	}
+	if hotKeys, err := mt.HotKeys(2); err != nil {
+		t.Fatalf("Unexpected error in HotKeys: %s", err.Error())
+	} else if len(hotKeys) != 0 {
+		t.Errorf("Expected no hot keys after ResetHotKeys but got %v", hotKeys)
+	}
+
+	if _, err := testModels.HotKeys(1); err == nil {
+		t.Error("Expected an error in HotKeys for a type without the TrackHotKeys option")
+	}
+	if err := TrackHotKeys(0)(&modelSpec{}); err == nil {
+		t.Error("Expected an error in TrackHotKeys for a sample rate of 0")
+	}
+}
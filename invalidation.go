@@ -0,0 +1,57 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File invalidation.go contains code related to keeping local caches
+// of models up to date by broadcasting invalidation messages, for
+// databases which do not support client tracking.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// invalidationBusChannel is the channel where invalidation messages are
+// published for types which use the UseInvalidationBus option. The KeyPrefix
+// for the pool is prepended to it.
+const invalidationBusChannel = "zoom:invalidate"
+
+// UseInvalidationBus is a ModelOption which causes zoom to keep a local cache of
+// the models of the given type, just like UseClientTracking. The difference is
+// that instead of relying on the database to track which models are cached,
+// zoom publishes an invalidation message whenever a model of the type is saved,
+// deleted, or renamed, and every process which uses zoom with the same database
+// removes the model from its cache when it receives the message. This works
+// with versions of redis older than 6 and with proxies which do not support
+// client tracking, but changes made by clients which do not use zoom (and
+// models which expire) are not detected. The messages are published in the same
+// transaction as the change itself. See UseClientTracking for other details.
+func UseInvalidationBus() ModelOption {
+	return func(spec *modelSpec) error {
+		spec.invalidationBus = true
+		return nil
+	}
+}
+
+// usesClientTracking returns true iff any of the types registered with p use
+// the UseClientTracking option.
+func (p *Pool) usesClientTracking() bool {
+	for _, spec := range p.specs() {
+		if spec.clientTracking {
+			return true
+		}
+	}
+	return false
+}
+
+// publishInvalidation adds a command to the transaction which tells every
+// process to remove the model with the given key from its local cache, if
+// models of the given type use the UseInvalidationBus option. If key is "*",
+// every process removes all the entries from its cache.
+func (t *Transaction) publishInvalidation(ms *modelSpec, key string) {
+	if !ms.invalidationBus || !ms.usesLocalCache() {
+		return
+	}
+	t.Command("PUBLISH", redis.Args{ms.keyPrefix() + invalidationBusChannel, key}, nil)
+}
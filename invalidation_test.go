@@ -0,0 +1,79 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File invalidation_test.go tests the code in invalidation.go.
+
+package zoom
+
+import (
+	"testing"
+	"time"
+)
+
+// invalidationBusModel is a model type that is only used for testing
+// the UseInvalidationBus option
+type invalidationBusModel struct {
+	Int    int
+	String string
+	DefaultData
+}
+
+// expectNotCached waits for the entry for key to be removed from the cache for
+// tr and reports an error via t.Fatal if it is not.
+func expectNotCached(t *testing.T, tr *tracker, key string) {
+	for i := 0; i < 1000; i++ {
+		tr.entriesMu.Lock()
+		_, cached := tr.entries[key]
+		tr.entriesMu.Unlock()
+		if !cached {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected %s to be removed from the cache", key)
+}
+
+func TestInvalidationBus(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	busModels := registerTestType(t, &invalidationBusModel{}, UseInvalidationBus())
+	model := &invalidationBusModel{Int: randomInt(), String: randomString()}
+	if err := busModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	key, _ := busModels.ModelKey(model.Id())
+	tr, err := defaultPool.getTracker(false)
+	if err != nil {
+		t.Fatalf("Unexpected error in getTracker: %s", err.Error())
+	}
+	defer defaultPool.stopTracker(tr)
+	find := func() {
+		if err := busModels.Find(model.Id(), &invalidationBusModel{}); err != nil {
+			t.Fatalf("Unexpected error in Find: %s", err.Error())
+		}
+		tr.entriesMu.Lock()
+		_, cached := tr.entries[key]
+		tr.entriesMu.Unlock()
+		if !cached {
+			t.Fatal("Expected model to be cached after Find")
+		}
+	}
+
+	// A message from another process should invalidate the cache
+	find()
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("PUBLISH", invalidationBusChannel, key); err != nil {
+		t.Fatalf("Unexpected error in PUBLISH: %s", err.Error())
+	}
+	expectNotCached(t, tr, key)
+
+	// DeleteAll should clear the cache for every process
+	find()
+	if _, err := busModels.DeleteAll(); err != nil {
+		t.Fatalf("Unexpected error in DeleteAll: %s", err.Error())
+	}
+	expectNotCached(t, tr, key)
+}
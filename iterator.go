@@ -0,0 +1,197 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File iterator.go contains code related to iterating over the
+// results of a query in batches.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Prefetch causes an iterator for the query (see Iter) to find up to n batches
+// of models in the background while the caller processes the current batch,
+// hiding the latency of the database during large scans. If n is 0 (the
+// default), each batch is found when Next is called. Prefetch has no effect on
+// the other query finishers.
+func (q *Query) Prefetch(n uint) *Query {
+	q.prefetch = n
+	return q
+}
+
+// QueryIterator iterates over the models which match a query, batchSize at a
+// time. It is created with Query.Iter.
+type QueryIterator struct {
+	q         *Query
+	batchSize int
+	// ids is set by the first call to Next, and next is the index in ids of
+	// the first model in the next batch
+	ids     []string
+	started bool
+	next    int
+	// batches receives the batches found in the background if the query uses
+	// Prefetch
+	batches chan iteratorBatch
+	// stop is closed to stop finding batches in the background and done is
+	// closed when it has stopped
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// iteratorBatch is a batch of models found in the background, or the error
+// encountered while finding it.
+type iteratorBatch struct {
+	models reflect.Value
+	err    error
+}
+
+// Iter returns a QueryIterator which finds the models that match the query
+// batchSize at a time, so that large result sets can be processed without
+// holding all of them in memory. The ids of the models are found when Next is
+// first called, and the models in each batch are found in a separate
+// transaction, so the results are not read atomically and a model which is
+// deleted after the ids were found is skipped. Use Prefetch to find the next
+// batches in the background. If batchSize is 0, 100 models are found at a time.
+// Close should be called if the iterator is not used until Next returns false.
+//
+// A typical loop looks like this:
+//
+//	iter := People.NewQuery().Order("Age").Prefetch(2).Iter(1000)
+//	defer iter.Close()
+//	people := []*Person{}
+//	for iter.Next(&people) {
+//		// process people
+//	}
+//	if err := iter.Err(); err != nil {
+//		// handle err
+//	}
+func (q *Query) Iter(batchSize uint) *QueryIterator {
+	if batchSize == 0 {
+		batchSize = 100
+	}
+	return &QueryIterator{
+		q:         q,
+		batchSize: int(batchSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Next scans the next batch of models into models, which must be a pointer to
+// a slice of models with a type corresponding to the query, replacing its
+// previous contents. It returns false when there are no more models or if
+// there was an error, in which case Err returns the error. The slice may be
+// shorter than the batch size (or empty) if some models were deleted.
+func (it *QueryIterator) Next(models interface{}) bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.q.modelSpec.checkModelsType(models); err != nil {
+		it.err = fmt.Errorf("zoom: Error in QueryIterator.Next: %s", err.Error())
+		return false
+	}
+	modelsVal := reflect.ValueOf(models).Elem()
+	if modelsVal.Kind() != reflect.Slice {
+		it.err = fmt.Errorf("zoom: Error in QueryIterator.Next: models should be a pointer to a slice")
+		return false
+	}
+	if !it.started {
+		it.started = true
+		ids, err := it.q.Ids()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.ids = ids
+		if it.q.prefetch > 0 {
+			it.batches = make(chan iteratorBatch, it.q.prefetch-1)
+			go it.prefetch()
+		} else {
+			close(it.done)
+		}
+	}
+	var batch iteratorBatch
+	if it.batches != nil {
+		var ok bool
+		if batch, ok = <-it.batches; !ok {
+			return false
+		}
+	} else {
+		if it.next >= len(it.ids) {
+			return false
+		}
+		batch = it.findBatch(it.next)
+		it.next += it.batchSize
+	}
+	if batch.err != nil {
+		it.err = batch.err
+		return false
+	}
+	modelsVal.Set(batch.models)
+	return true
+}
+
+// prefetch finds each batch in turn and sends it to it.batches until there are
+// no more batches or the iterator is closed. Since it.batches has a buffer of
+// it.q.prefetch-1, up to it.q.prefetch batches are found ahead of the caller.
+func (it *QueryIterator) prefetch() {
+	defer close(it.done)
+	defer close(it.batches)
+	for start := 0; start < len(it.ids); start += it.batchSize {
+		batch := it.findBatch(start)
+		select {
+		case it.batches <- batch:
+		case <-it.stop:
+			return
+		}
+		if batch.err != nil {
+			return
+		}
+	}
+}
+
+// findBatch finds the models in the batch which starts at the given index in
+// it.ids. Models which no longer exist are not included.
+func (it *QueryIterator) findBatch(start int) iteratorBatch {
+	stop := start + it.batchSize
+	if stop > len(it.ids) {
+		stop = len(it.ids)
+	}
+	ids := it.ids[start:stop]
+	found := reflect.MakeSlice(reflect.SliceOf(it.q.modelSpec.typ), len(ids), len(ids))
+	t := it.q.newReadTransaction()
+	it.q.findBatch(t, ids, found)
+	if err := t.Exec(); err != nil {
+		return iteratorBatch{err: err}
+	}
+	models := reflect.MakeSlice(found.Type(), 0, len(ids))
+	for i := 0; i < found.Len(); i++ {
+		if model := found.Index(i); !model.IsNil() {
+			models = reflect.Append(models, model)
+		}
+	}
+	return iteratorBatch{models: models}
+}
+
+// Err returns the error which caused Next to return false, if any.
+func (it *QueryIterator) Err() error {
+	return it.err
+}
+
+// Close stops finding batches in the background (if Prefetch was used) and
+// waits for the current batch to finish. It is safe to call Close more than
+// once, and it does not need to be called if Next has returned false.
+func (it *QueryIterator) Close() {
+	it.closeOnce.Do(func() {
+		close(it.stop)
+	})
+	if it.started {
+		<-it.done
+	}
+}
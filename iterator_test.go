@@ -0,0 +1,71 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File iterator_test.go tests the code in iterator.go.
+
+package zoom
+
+import (
+	"testing"
+)
+
+func TestQueryIterator(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, prefetch := range []uint{0, 1, 3} {
+		q := indexedTestModels.NewQuery().Order("Int").Prefetch(prefetch)
+		expected := expectedResultsForQuery(q, models)
+		iter := q.Iter(3)
+		got := []*indexedTestModel{}
+		batch := []*indexedTestModel{}
+		numBatches := 0
+		for iter.Next(&batch) {
+			numBatches++
+			got = append(got, batch...)
+		}
+		if err := iter.Err(); err != nil {
+			t.Fatalf("Unexpected error in QueryIterator for query %s: %s", q, err.Error())
+		}
+		iter.Close()
+		if numBatches != 4 {
+			t.Errorf("Expected 4 batches for query %s but got %d", q, numBatches)
+		}
+		if err := expectModelsToBeEqual(expected, got, true); err != nil {
+			t.Errorf("Wrong results for query %s: %s", q, err.Error())
+		}
+	}
+}
+
+func TestQueryIteratorClose(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	if _, err := createAndSaveIndexedTestModels(10); err != nil {
+		t.Fatal(err)
+	}
+	// Stopping after the first batch should not block, even though the
+	// remaining batches are being found in the background
+	iter := indexedTestModels.NewQuery().Prefetch(2).Iter(1)
+	batch := []*indexedTestModel{}
+	if !iter.Next(&batch) {
+		t.Fatalf("Expected Next to return true. Err: %v", iter.Err())
+	}
+	iter.Close()
+	iter.Close()
+
+	// Using the wrong type should cause an error
+	iter = indexedTestModels.NewQuery().Iter(1)
+	defer iter.Close()
+	if iter.Next(&[]*testModel{}) {
+		t.Error("Expected Next to return false for the wrong type of models")
+	}
+	if iter.Err() == nil {
+		t.Error("Expected Err to return an error for the wrong type of models")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File keys.go contains code related to inspecting the keys zoom uses to
+// store a single model.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+)
+
+// KeyInfo describes a single key which zoom uses to store a model. It is
+// returned by ModelType.Keys.
+type KeyInfo struct {
+	// Key is the full key in redis, including the KeyPrefix (if any).
+	Key string
+	// Type is the redis data type of the key: "hash", "list", "set", "zset",
+	// or "string".
+	Type string
+	// Role describes what the key is used for: "hash" for the main hash,
+	// "field" for a list or set field, "protobuf", "audit", "expires",
+	// "archive", "all" for the set of all ids, "index" for a field index,
+	// "schedule" for scheduled deletions, "hotkeys", "coalesce" for the window
+	// of pending change events, or "coalesced" for the pending events
+	// themselves.
+	Role string
+	// Field is the name of the field for "field" and "index" keys.
+	Field string
+	// Shared is true iff the key also holds data for other models of the same
+	// type, e.g. a field index. Only Member belongs to the model, so a cleanup
+	// script should remove Member from the key instead of deleting the key.
+	Shared bool
+	// Member is the member of a shared set or sorted set (or the field of a
+	// shared hash) which belongs to the model. For string indexes it includes
+	// the value of the field, so it is empty if the field does not have a
+	// value in the database.
+	Member string
+	// Exists is true iff the key (or Member for shared keys) currently exists
+	// in the database.
+	Exists bool
+}
+
+// Keys returns every key which zoom uses to store the model with the given
+// id, including the main hash, the keys for list and set fields, and the keys
+// used by options such as Audit and ArchiveOnExpire, as well as each shared
+// key which the model is a member of, such as the set of all ids and the field
+// indexes. Zoom does not have relations between model types, so there are no
+// keys for them. The keys which belong to a model are the same whether or not
+// it exists, but Keys reads the database to find the members of string
+// indexes and whether each key exists, which makes it useful for debugging
+// and for writing targeted cleanup scripts.
+func (mt *ModelType) Keys(id string) ([]KeyInfo, error) {
+	if id == "" {
+		return nil, fmt.Errorf("zoom: Error in Keys: id was empty")
+	}
+	keys := mt.spec.keyInfos(id)
+	conn := mt.spec.pool.NewConn()
+	defer conn.Close()
+	if err := mt.spec.fillStringIndexMembers(conn, id, keys); err != nil {
+		return nil, fmt.Errorf("zoom: Error in Keys: %s", err.Error())
+	}
+	for _, info := range keys {
+		var err error
+		switch {
+		case !info.Shared:
+			err = conn.Send("EXISTS", info.Key)
+		case info.Member == "":
+			// The model is not in the index, so there is nothing to check
+			continue
+		case info.Type == "set":
+			err = conn.Send("SISMEMBER", info.Key, info.Member)
+		case info.Type == "zset":
+			err = conn.Send("ZSCORE", info.Key, info.Member)
+		case info.Type == "hash":
+			err = conn.Send("HEXISTS", info.Key, info.Member)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in Keys: %s", err.Error())
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, fmt.Errorf("zoom: Error in Keys: %s", err.Error())
+	}
+	for i, info := range keys {
+		if info.Shared && info.Member == "" {
+			continue
+		}
+		reply, err := conn.Receive()
+		if err != nil {
+			return nil, fmt.Errorf("zoom: Error in Keys: %s", err.Error())
+		}
+		if info.Type == "zset" && info.Shared {
+			keys[i].Exists = reply != nil
+		} else {
+			keys[i].Exists, _ = redis.Bool(reply, nil)
+		}
+	}
+	return keys, nil
+}
+
+// keyInfos returns the keys which are used to store the model with the given
+// id, without reading the database. The Member of string indexes is left
+// empty, since it depends on the value of the field. See fillStringIndexMembers.
+func (ms *modelSpec) keyInfos(id string) []KeyInfo {
+	keys := []KeyInfo{{Key: ms.keyName() + ":" + id, Type: "hash", Role: "hash"}}
+	for _, fs := range ms.fields {
+		switch fs.kind {
+		case listField:
+			keys = append(keys, KeyInfo{Key: ms.fieldKey(id, fs), Type: "list", Role: "field", Field: fs.name})
+		case setField:
+			keys = append(keys, KeyInfo{Key: ms.fieldKey(id, fs), Type: "set", Role: "field", Field: fs.name})
+		}
+	}
+	if ms.storeProtobuf {
+		keys = append(keys, KeyInfo{Key: ms.protobufKey(id), Type: "string", Role: "protobuf"})
+	}
+	if ms.auditMaxLen > 0 {
+		keys = append(keys, KeyInfo{Key: ms.auditKey(id), Type: "list", Role: "audit"})
+	}
+	if ms.archiveOnExpire {
+		keys = append(keys,
+			KeyInfo{Key: ms.expiresKey(id), Type: "string", Role: "expires"},
+			KeyInfo{Key: ms.archiveKey(id), Type: "hash", Role: "archive"},
+		)
+	}
+	keys = append(keys, KeyInfo{Key: ms.allIndexKey(), Type: "set", Role: "all", Shared: true, Member: id})
+	for _, fs := range ms.fields {
+		if fs.indexKind == noIndex {
+			continue
+		}
+		indexKey, _ := ms.fieldIndexKey(fs.name)
+		info := KeyInfo{Key: indexKey, Type: "zset", Role: "index", Field: fs.name, Shared: true}
+		if fs.indexKind != stringIndex {
+			info.Member = id
+		}
+		keys = append(keys, info)
+	}
+	keys = append(keys, KeyInfo{Key: ms.deleteScheduleKey(), Type: "zset", Role: "schedule", Shared: true, Member: id})
+	if ms.hotKeys != nil {
+		keys = append(keys, KeyInfo{Key: ms.hotKeysKey(), Type: "zset", Role: "hotkeys", Shared: true, Member: id})
+	}
+	if ms.coalescer != nil {
+		keys = append(keys,
+			KeyInfo{Key: ms.coalesceWindowKey(), Type: "zset", Role: "coalesce", Shared: true, Member: id},
+			KeyInfo{Key: ms.coalescedEventsKey(), Type: "hash", Role: "coalesced", Shared: true, Member: id},
+		)
+	}
+	return keys
+}
+
+// fillStringIndexMembers sets the Member of each string index in keys, using
+// the values stored in the main hash for the model with the given id. The
+// Member is left empty for fields which do not have a value.
+func (ms *modelSpec) fillStringIndexMembers(conn redis.Conn, id string, keys []KeyInfo) error {
+	indexes := []int{}
+	args := redis.Args{ms.keyName() + ":" + id}
+	for i, info := range keys {
+		if info.Role != "index" || info.Member != "" {
+			continue
+		}
+		fs, found := ms.fieldsByName[info.Field]
+		if !found {
+			return fmt.Errorf("could not find field %s", info.Field)
+		}
+		indexes = append(indexes, i)
+		args = args.Add(fs.redisName)
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+	values, err := redis.Values(conn.Do("HMGET", args...))
+	if err != nil {
+		return err
+	}
+	for j, i := range indexes {
+		if values[j] == nil {
+			continue
+		}
+		value, err := redis.String(values[j], nil)
+		if err != nil {
+			return err
+		}
+		keys[i].Member = value + nullString + id
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File keys_test.go tests the code for inspecting the keys used to store
+// a model.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+type keysTestModel struct {
+	Name  string   `zoom:"index"`
+	Age   int      `zoom:"index"`
+	Tags  []string `redisType:"set"`
+	Notes []string `redisType:"list"`
+	DefaultData
+}
+
+func TestKeyInfos(t *testing.T) {
+	pool, err := NewPool(&Configuration{KeyPrefix: "app:"})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	mt, err := pool.RegisterWithOptions(&keysTestModel{},
+		Audit(10),
+		ArchiveOnExpire(),
+		TrackHotKeys(0.5),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error in RegisterWithOptions: %s", err.Error())
+	}
+	got := mt.spec.keyInfos("foo")
+	expected := []KeyInfo{
+		{Key: "app:keysTestModel:foo", Type: "hash", Role: "hash"},
+		{Key: "app:keysTestModel:foo:Tags", Type: "set", Role: "field", Field: "Tags"},
+		{Key: "app:keysTestModel:foo:Notes", Type: "list", Role: "field", Field: "Notes"},
+		{Key: "app:keysTestModel:foo:audit", Type: "list", Role: "audit"},
+		{Key: mt.spec.expiresKey("foo"), Type: "string", Role: "expires"},
+		{Key: "app:keysTestModel:archive:foo", Type: "hash", Role: "archive"},
+		{Key: "app:keysTestModel:all", Type: "set", Role: "all", Shared: true, Member: "foo"},
+		{Key: "app:keysTestModel:Name", Type: "zset", Role: "index", Field: "Name", Shared: true},
+		{Key: "app:keysTestModel:Age", Type: "zset", Role: "index", Field: "Age", Shared: true, Member: "foo"},
+		{Key: "app:keysTestModel:_zoom:deleteAt", Type: "zset", Role: "schedule", Shared: true, Member: "foo"},
+		{Key: "app:keysTestModel:_zoom:hotkeys", Type: "zset", Role: "hotkeys", Shared: true, Member: "foo"},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Keys were incorrect.\nExpected: %+v\nGot:      %+v", expected, got)
+	}
+}
+
+func TestReservedIds(t *testing.T) {
+	pool, err := NewPool(&Configuration{})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	mt, err := pool.Register(&keysTestModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	for _, id := range []string{"_zoom", "_zoom:deleteAt"} {
+		if _, err := mt.ModelKey(id); err == nil {
+			t.Errorf("Expected error in ModelKey for reserved id %q but got none", id)
+		}
+	}
+	// Other ids are allowed, including the names of internal keys
+	for _, id := range []string{"deleteAt", "hotkeys", "_zoomed"} {
+		if _, err := mt.ModelKey(id); err != nil {
+			t.Errorf("Unexpected error in ModelKey for id %q: %s", id, err.Error())
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(1)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	model := models[0]
+	keys, err := indexedTestModels.Keys(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in Keys: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	for _, info := range keys {
+		if info.Role == "schedule" {
+			if info.Exists {
+				t.Errorf("Expected model to not be scheduled for deletion but got %+v", info)
+			}
+			continue
+		}
+		if !info.Exists {
+			t.Errorf("Expected key to exist but got %+v", info)
+		}
+		if info.Role == "index" && info.Field == "String" {
+			if expected := model.String + nullString + model.Id(); info.Member != expected {
+				t.Errorf("Expected string index member to be %q but got %q", expected, info.Member)
+			}
+		}
+	}
+	if _, err := indexedTestModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	keys, err = indexedTestModels.Keys(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in Keys: %s", err.Error())
+	}
+	for _, info := range keys {
+		if info.Exists {
+			t.Errorf("Expected key to not exist after Delete but got %+v", info)
+		}
+	}
+	if _, err := indexedTestModels.Keys(""); err == nil {
+		t.Error("Expected an error in Keys with an empty id but got none")
+	}
+}
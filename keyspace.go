@@ -0,0 +1,194 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File keyspace.go contains code related to receiving keyspace
+// notifications for the keys which zoom uses to store models.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"strings"
+	"sync"
+)
+
+// keyspaceNotificationFlags are the flags for notify-keyspace-events which are
+// needed for keyspace events about models: keyspace events (K) for generic
+// commands (g), hashes (h), lists (l), sets (s), expired keys (x), and evicted
+// keys (e).
+const keyspaceNotificationFlags = "Kghlsxe"
+
+// KeyspaceEvent describes a keyspace notification for one of the keys used to
+// store a model. See http://redis.io/topics/notifications.
+type KeyspaceEvent struct {
+	// ModelName is the name of the registered type.
+	ModelName string
+	// Id is the id of the model.
+	Id string
+	// Field is the name of the field if the key was for a field stored outside
+	// of the main hash (e.g. a list or set field). It is empty if the key was
+	// the main hash.
+	Field string
+	// Kind is the name of the event sent by the database, e.g. "hset", "del",
+	// "expired", or "evicted".
+	Kind string
+}
+
+// KeyspaceSubscription receives keyspace events for one or more registered
+// types. It is created with SubscribeKeyspace.
+type KeyspaceSubscription struct {
+	// Events receives each event as it is sent by the database. It is closed
+	// when the subscription is closed.
+	Events <-chan KeyspaceEvent
+	events chan KeyspaceEvent
+	// closeEvents ensures events is only closed once
+	closeEvents sync.Once
+	// channelPrefix is the prefix for the channels that keyspace events are
+	// sent to, which is followed by the key
+	channelPrefix string
+	specs         []*modelSpec
+	*subscriber
+}
+
+// SubscribeKeyspace subscribes to keyspace events for the given types in the
+// default pool. See Pool.SubscribeKeyspace.
+func SubscribeKeyspace(modelTypes ...*ModelType) (*KeyspaceSubscription, error) {
+	return defaultPool.SubscribeKeyspace(modelTypes...)
+}
+
+// SubscribeKeyspace returns a KeyspaceSubscription which receives a
+// KeyspaceEvent whenever the main hash or a field stored outside of the main
+// hash is modified for a model of the given types, which must be registered
+// with p. Unlike ModelType.Subscribe, this works for changes made by any
+// client, including clients which do not use zoom, and also reports models
+// which expire or are evicted. If no types are given, all the types currently
+// registered with p are used. Keys which zoom uses for other purposes (e.g.
+// indexes) are ignored.
+//
+// Keyspace notifications are enabled with CONFIG SET if needed. If CONFIG is not
+// available, notify-keyspace-events must already include the flags
+// "Kghlsxe" (or "KA"). If the connection is lost, the subscription reconnects
+// and subscribes again automatically, but any events sent in the meantime are
+// missed. Events should be read from the Events channel promptly, since the
+// subscription stops receiving new events while the channel is full. Call Close
+// when the subscription is no longer needed.
+func (p *Pool) SubscribeKeyspace(modelTypes ...*ModelType) (*KeyspaceSubscription, error) {
+	specs := []*modelSpec{}
+	if len(modelTypes) == 0 {
+		specs = p.specs()
+	}
+	for _, mt := range modelTypes {
+		if mt.spec.pool != p {
+			return nil, fmt.Errorf("zoom: Error in SubscribeKeyspace: %s is registered with a different pool", mt.Name())
+		}
+		specs = append(specs, mt.spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("zoom: Error in SubscribeKeyspace: no types are registered")
+	}
+	channelPrefix := fmt.Sprintf("__keyspace@%d__:", p.getState().config.Database)
+	patterns := make([]string, len(specs))
+	for i, spec := range specs {
+		patterns[i] = channelPrefix + escapePattern(spec.keyName()) + ":*"
+	}
+	events := make(chan KeyspaceEvent, subscriptionBufferSize)
+	s := &KeyspaceSubscription{
+		Events:        events,
+		events:        events,
+		channelPrefix: channelPrefix,
+		specs:         specs,
+	}
+	onConnect := func(conn redis.Conn) error {
+		return enableNotifications(conn, keyspaceNotificationFlags)
+	}
+	sub, err := p.newSubscriber("PSUBSCRIBE", patterns, onConnect, s.handle)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in SubscribeKeyspace: %s", err.Error())
+	}
+	s.subscriber = sub
+	sub.start()
+	return s, nil
+}
+
+// handle converts a keyspace notification to a KeyspaceEvent and sends it to
+// s.events if the key belongs to a model.
+func (s *KeyspaceSubscription) handle(channel string, data []byte) {
+	key := strings.TrimPrefix(channel, s.channelPrefix)
+	for _, spec := range s.specs {
+		id, field, ok := spec.parseModelKey(key)
+		if !ok {
+			continue
+		}
+		event := KeyspaceEvent{
+			ModelName: spec.name,
+			Id:        id,
+			Field:     field,
+			Kind:      string(data),
+		}
+		select {
+		case s.events <- event:
+		case <-s.closed:
+		}
+		return
+	}
+}
+
+// Err returns the first error encountered by the subscription, if any,
+// including errors from connections which were lost and then reestablished.
+func (s *KeyspaceSubscription) Err() error {
+	return s.subscriber.Err()
+}
+
+// Close stops the subscription and closes the Events channel. It returns the
+// same error as Err.
+func (s *KeyspaceSubscription) Close() error {
+	err := s.subscriber.Close()
+	s.closeEvents.Do(func() {
+		close(s.events)
+	})
+	return err
+}
+
+// parseModelKey returns the id of the model and the name of the field (if any)
+// that key is used to store. ok is false if key is not the main hash for a
+// model of the given type or a field stored outside of the main hash, e.g. if
+// it is a field index or the set of all ids.
+func (ms *modelSpec) parseModelKey(key string) (id string, field string, ok bool) {
+	prefix := ms.keyName() + ":"
+	if !strings.HasPrefix(key, prefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(key, prefix)
+	switch {
+	case rest == "", rest == "all", rest == internalKeySegment, strings.HasPrefix(rest, internalKeySegment+":"), strings.HasPrefix(rest, "archive:"):
+		return "", "", false
+	}
+	for _, fs := range ms.fields {
+		if fs.indexKind != noIndex && rest == fs.redisName {
+			// A field index
+			return "", "", false
+		}
+	}
+	if i := strings.LastIndex(rest, ":"); i != -1 {
+		suffix := rest[i+1:]
+		for _, fs := range ms.collectionFields(ms.fieldNames()) {
+			if suffix == fs.redisName {
+				return rest[:i], fs.name, true
+			}
+		}
+		switch suffix {
+		case protobufKeySuffix, expiresKeySuffix, auditKeySuffix:
+			return "", "", false
+		}
+	}
+	return rest, "", true
+}
+
+// escapePattern escapes any characters in s which have a special meaning in
+// patterns for PSUBSCRIBE.
+func escapePattern(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(s)
+}
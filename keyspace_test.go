@@ -0,0 +1,82 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File keyspace_test.go tests the code in keyspace.go.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseModelKey(t *testing.T) {
+	spec, err := compileModelSpec(reflect.TypeOf(&archivedModel{}))
+	if err != nil {
+		t.Fatalf("Unexpected error in compileModelSpec: %s", err.Error())
+	}
+	spec.name = "archivedModel"
+	testCases := []struct {
+		key   string
+		id    string
+		field string
+		ok    bool
+	}{
+		{"archivedModel:abc", "abc", "", true},
+		{"archivedModel:a:b", "a:b", "", true},
+		{"archivedModel:abc:Tags", "abc", "Tags", true},
+		{"archivedModel:all", "", "", false},
+		{"archivedModel:Name", "", "", false},
+		{"archivedModel:deleteAt", "deleteAt", "", true},
+		{"archivedModel:_zoom:deleteAt", "", "", false},
+		{"archivedModel:_zoom:coalesce", "", "", false},
+		{"archivedModel:_zoom:coalesced", "", "", false},
+		{"archivedModel:_zoom:hotkeys", "", "", false},
+		{"archivedModel:archive:abc", "", "", false},
+		{"archivedModel:abc:audit", "", "", false},
+		{"archivedModel:abc:expires", "", "", false},
+		{"otherModel:abc", "", "", false},
+	}
+	for _, tc := range testCases {
+		id, field, ok := spec.parseModelKey(tc.key)
+		if id != tc.id || field != tc.field || ok != tc.ok {
+			t.Errorf("parseModelKey(%q): expected (%q, %q, %v) but got (%q, %q, %v)", tc.key, tc.id, tc.field, tc.ok, id, field, ok)
+		}
+	}
+}
+
+func TestSubscribeKeyspace(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	s, err := SubscribeKeyspace(testModels)
+	if err != nil {
+		t.Fatalf("Unexpected error in SubscribeKeyspace: %s", err.Error())
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Unexpected error in KeyspaceSubscription.Close: %s", err.Error())
+		}
+	}()
+
+	model := createTestModels(1)[0]
+	if err := testModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if _, err := testModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	for _, kind := range []string{"hset", "del"} {
+		expected := KeyspaceEvent{ModelName: testModels.Name(), Id: model.Id(), Kind: kind}
+		select {
+		case got := <-s.Events:
+			if got != expected {
+				t.Errorf("Wrong KeyspaceEvent.\n\tExpected: %#v\n\tBut got:  %#v", expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %v", expected)
+		}
+	}
+}
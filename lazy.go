@@ -0,0 +1,191 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File lazy.go contains code related to fields which are only loaded
+// from the database on demand.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+)
+
+// lazyLoader is implemented by models which can remember which of their lazy
+// fields were not loaded. Any model which embeds DefaultData satisfies
+// lazyLoader.
+type lazyLoader interface {
+	getUnloadedFields() map[string]bool
+	setUnloaded(map[string]bool)
+}
+
+var lazyLoaderType = reflect.TypeOf((*lazyLoader)(nil)).Elem()
+
+// getUnloadedFields returns the names of the lazy fields which were not loaded
+// when the model was last found.
+func (d *DefaultData) getUnloadedFields() map[string]bool {
+	return d.unloaded
+}
+
+// setUnloaded sets the names of the lazy fields which were not loaded.
+func (d *DefaultData) setUnloaded(unloaded map[string]bool) {
+	d.unloaded = unloaded
+}
+
+// hasLazyFields returns true iff any field of ms has the "lazy" option.
+func (ms *modelSpec) hasLazyFields() bool {
+	for _, fs := range ms.fields {
+		if fs.lazy {
+			return true
+		}
+	}
+	return false
+}
+
+// eagerFieldNames returns the names of all the fields of ms which do not have
+// the "lazy" option. These are the fields which are retrieved by default.
+func (ms *modelSpec) eagerFieldNames() []string {
+	names := make([]string, 0, len(ms.fields))
+	for _, fs := range ms.fields {
+		if !fs.lazy {
+			names = append(names, fs.name)
+		}
+	}
+	return names
+}
+
+// setUnloadedFields records which of the lazy fields of mr.model are not in
+// fieldNames, i.e. were not loaded when the model was found.
+func (mr *modelRef) setUnloadedFields(fieldNames []string) {
+	if !mr.spec.hasLazyFields() {
+		// Forget any fields which were not loaded the last time the model was
+		// found, e.g. with FindAllFields
+		if loader, ok := mr.model.(lazyLoader); ok && len(loader.getUnloadedFields()) > 0 {
+			loader.setUnloaded(nil)
+		}
+		return
+	}
+	unloaded := map[string]bool{}
+	for _, fs := range mr.spec.fields {
+		if fs.lazy && !stringSliceContains(fieldNames, fs.name) {
+			unloaded[fs.name] = true
+		}
+	}
+	mr.model.(lazyLoader).setUnloaded(unloaded)
+}
+
+// setUnloadedFieldsExcept records every field of mr.model which is not in
+// fieldNames as not loaded, e.g. because the model was found with
+// FindAllFields. It has no effect if mr.model does not embed DefaultData.
+func (mr *modelRef) setUnloadedFieldsExcept(fieldNames []string) {
+	loader, ok := mr.model.(lazyLoader)
+	if !ok {
+		return
+	}
+	unloaded := map[string]bool{}
+	for _, fs := range mr.spec.fields {
+		if !stringSliceContains(fieldNames, fs.name) {
+			unloaded[fs.name] = true
+		}
+	}
+	loader.setUnloaded(unloaded)
+}
+
+// withoutUnloadedFields returns fields without any fields which were not
+// loaded (e.g. lazy fields) and still have their zero value, so that saving a
+// model which was found without loading them does not erase their values.
+func (mr *modelRef) withoutUnloadedFields(fields []*fieldSpec) []*fieldSpec {
+	loader, ok := mr.model.(lazyLoader)
+	if !ok {
+		return fields
+	}
+	unloaded := loader.getUnloadedFields()
+	if len(unloaded) == 0 {
+		return fields
+	}
+	results := make([]*fieldSpec, 0, len(fields))
+	for _, fs := range fields {
+		if unloaded[fs.name] && isZero(mr.specFieldValue(fs)) {
+			continue
+		}
+		results = append(results, fs)
+	}
+	return results
+}
+
+// LoadField finds the value of the field with the given name for model, which
+// must have been found or saved already, and sets the field to that value. It
+// is intended for fields with the "lazy" option in their zoom struct tag, which
+// hold large values (e.g. the body of a document) and are skipped by Find,
+// FindByIds, FindAll, and queries so that loading many models (e.g. for a list
+// view) stays fast. A lazy field can also be loaded by a query which names it
+// with Include.
+//
+// A lazy field which was not loaded is not written when the model is saved, so
+// its value in the database is kept, unless it was given a value other than the
+// zero value. To set a lazy field which was not loaded to its zero value, load
+// it first. LoadField can be used for fields without the "lazy" option as well,
+// e.g. to refresh a single field, but not for fields with the redisType struct
+// tag.
+func (mt *ModelType) LoadField(model Model, fieldName string) error {
+	return runOp(&Op{Kind: LoadFieldOp, ModelName: mt.Name(), Id: model.Id(), Model: model}, func() error {
+		t := mt.newReadTransaction()
+		t.LoadField(mt, model, fieldName)
+		return t.Exec()
+	})
+}
+
+// LoadField finds the value of the field with the given name for model and
+// sets the field to that value in an existing transaction. See
+// ModelType.LoadField. Any errors encountered will be added to the transaction
+// and returned as an error when the transaction is executed.
+func (t *Transaction) LoadField(mt *ModelType, model Model, fieldName string) {
+	if err := t.checkModelTypeAndPool(mt, model); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in LoadField or Transaction.LoadField: %s", err.Error()))
+		return
+	}
+	if model.Id() == "" {
+		t.setError(fmt.Errorf("zoom: Error in LoadField or Transaction.LoadField: model does not have an id"))
+		return
+	}
+	fs, found := mt.spec.fieldsByName[fieldName]
+	if !found {
+		t.setError(fmt.Errorf("zoom: Error in LoadField or Transaction.LoadField: %s has no field named %s", mt.Name(), fieldName))
+		return
+	}
+	if !fs.storedInHash() {
+		t.setError(fmt.Errorf("zoom: Error in LoadField or Transaction.LoadField: %s.%s has a redisType", mt.Name(), fieldName))
+		return
+	}
+	mr := &modelRef{
+		spec:  mt.spec,
+		model: model,
+	}
+	t.Command("HGET", redis.Args{mr.key(), fs.redisName}, newLoadFieldHandler(mr, fs))
+}
+
+// newLoadFieldHandler returns a ReplyHandler which scans the reply from HGET
+// into the field of mr.model identified by fs and marks the field as loaded.
+func newLoadFieldHandler(mr *modelRef, fs *fieldSpec) ReplyHandler {
+	return func(reply interface{}) error {
+		if err := mr.scanField(fs, reply); err != nil {
+			return err
+		}
+		if loader, ok := mr.model.(lazyLoader); ok {
+			delete(loader.getUnloadedFields(), fs.name)
+		}
+		if mr.spec.trackChanges {
+			// Update the snapshot so that the field is not considered changed
+			if snapshot := mr.model.(snapshotter).getSnapshot(); snapshot != nil && snapshot.id == mr.model.Id() {
+				value, err := mr.hashValue(fs)
+				if err != nil {
+					return err
+				}
+				snapshot.values[fs.name] = snapshotValue(value)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File lazy_test.go tests the code in lazy.go.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+type lazyModel struct {
+	Title string
+	Body  string `zoom:"lazy"`
+	DefaultData
+}
+
+func TestLazyField(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	lazyModels := registerTestType(t, &lazyModel{})
+	model := &lazyModel{Title: "War and Peace", Body: "Well, Prince, so Genoa and Lucca..."}
+	if err := lazyModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The lazy field should be skipped by Find and queries
+	modelCopy := &lazyModel{}
+	if err := lazyModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if modelCopy.Title != model.Title || modelCopy.Body != "" {
+		t.Errorf("Expected only Title to be loaded but got %+v", modelCopy)
+	}
+	found := []*lazyModel{}
+	if err := lazyModels.NewQuery().Run(&found); err != nil {
+		t.Fatalf("Unexpected error in Query.Run: %s", err.Error())
+	}
+	if len(found) != 1 || found[0].Body != "" {
+		t.Errorf("Expected the query to skip Body but got %+v", found)
+	}
+	found = []*lazyModel{}
+	if err := lazyModels.NewQuery().Include("Body").Run(&found); err != nil {
+		t.Fatalf("Unexpected error in Query.Run: %s", err.Error())
+	}
+	if len(found) != 1 || found[0].Body != model.Body {
+		t.Errorf("Expected the query to include Body but got %+v", found)
+	}
+
+	// Saving the model without loading the lazy field should not erase it
+	modelCopy.Title = "Anna Karenina"
+	if err := lazyModels.Save(modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if err := lazyModels.LoadField(modelCopy, "Body"); err != nil {
+		t.Fatalf("Unexpected error in LoadField: %s", err.Error())
+	}
+	if modelCopy.Body != model.Body {
+		t.Errorf("Expected Body to be %q but got %q", model.Body, modelCopy.Body)
+	}
+
+	// Once it has been loaded, the lazy field can be cleared
+	modelCopy.Body = ""
+	if err := lazyModels.Save(modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if err := lazyModels.LoadField(modelCopy, "Body"); err != nil {
+		t.Fatalf("Unexpected error in LoadField: %s", err.Error())
+	}
+	if modelCopy.Body != "" {
+		t.Errorf("Expected Body to be cleared but got %q", modelCopy.Body)
+	}
+
+	if err := lazyModels.LoadField(modelCopy, "Missing"); err == nil {
+		t.Error("Expected an error in LoadField for a field which does not exist")
+	}
+}
+
+func TestLazyFieldInvalid(t *testing.T) {
+	type indexedLazyModel struct {
+		Body string `zoom:"lazy,index"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&indexedLazyModel{})); err == nil {
+		t.Error("Expected an error for a lazy field with an index")
+	}
+	type listLazyModel struct {
+		Bodies []string `zoom:"lazy" redisType:"list"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&listLazyModel{})); err == nil {
+		t.Error("Expected an error for a lazy field with a redisType")
+	}
+	type noDefaultDataModel struct {
+		Body string `zoom:"lazy"`
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&noDefaultDataModel{})); err == nil {
+		t.Error("Expected an error for a lazy field in a type without DefaultData")
+	}
+}
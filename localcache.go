@@ -0,0 +1,89 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File localcache.go contains code related to bounding the size and
+// age of the local cache of models.
+
+package zoom
+
+import (
+	"container/list"
+	"fmt"
+	"time"
+)
+
+// UseLocalCache is a ModelOption which causes zoom to keep a local cache of the
+// models of the given type which are retrieved with ModelType.Find, holding at
+// most maxEntries models and evicting the least recently used model when it is
+// full. Models are also removed from the cache once they have been cached for
+// longer than ttl, which bounds how stale a cached model can be. A maxEntries or
+// ttl of 0 means there is no limit. It is meant for models which are read very
+// often but rarely change.
+//
+// Saves and deletes made through ModelType methods or transactions in this
+// process are reflected immediately. On its own, the option does not detect
+// changes made by other processes until the ttl has passed, so when there is
+// more than one process it should be combined with UseInvalidationBus (or
+// UseClientTracking), in which case the limits apply to the cache used by
+// those options. See UseClientTracking for other details.
+func UseLocalCache(maxEntries int, ttl time.Duration) ModelOption {
+	return func(spec *modelSpec) error {
+		if maxEntries < 0 {
+			return fmt.Errorf("zoom: UseLocalCache maxEntries cannot be negative but got %d", maxEntries)
+		}
+		if ttl < 0 {
+			return fmt.Errorf("zoom: UseLocalCache ttl cannot be negative but got %s", ttl)
+		}
+		spec.localCache = true
+		spec.cacheMaxEntries = maxEntries
+		spec.cacheTTL = ttl
+		return nil
+	}
+}
+
+// expired returns true iff the entry has been cached for longer than the ttl
+// for its type.
+func (entry *trackedEntry) expired() bool {
+	ttl := entry.spec.cacheTTL
+	return ttl > 0 && time.Since(entry.cachedAt) > ttl
+}
+
+// addToLRU adds the entry with the given key to the list for its type and then
+// evicts the least recently used entries if there are too many. It has no effect
+// if the type does not use the UseLocalCache option. tr.entriesMu must be held.
+func (tr *tracker) addToLRU(key string, entry *trackedEntry) {
+	ms := entry.spec
+	if !ms.localCache {
+		return
+	}
+	l, found := tr.lrus[ms]
+	if !found {
+		l = list.New()
+		tr.lrus[ms] = l
+	}
+	entry.cachedAt = time.Now()
+	entry.elem = l.PushFront(key)
+	for ms.cacheMaxEntries > 0 && l.Len() > ms.cacheMaxEntries {
+		oldest := l.Back().Value.(string)
+		tr.remove(oldest, tr.entries[oldest])
+	}
+}
+
+// touch marks entry as the most recently used entry for its type. tr.entriesMu
+// must be held.
+func (tr *tracker) touch(entry *trackedEntry) {
+	if entry.elem != nil {
+		tr.lrus[entry.spec].MoveToFront(entry.elem)
+	}
+}
+
+// remove removes the entry with the given key from the cache. tr.entriesMu must
+// be held.
+func (tr *tracker) remove(key string, entry *trackedEntry) {
+	delete(tr.entries, key)
+	if entry.elem != nil {
+		tr.lrus[entry.spec].Remove(entry.elem)
+		entry.elem = nil
+	}
+}
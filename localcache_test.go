@@ -0,0 +1,179 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File localcache_test.go tests the code in localcache.go.
+
+package zoom
+
+import (
+	"container/list"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// localCachedModel is a model type that is only used for testing
+// the UseLocalCache option
+type localCachedModel struct {
+	Int    int
+	String string
+	DefaultData
+}
+
+func TestLocalCache(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	localCachedModels := registerTestType(t, &localCachedModel{}, UseLocalCache(2, 0))
+	models := []*localCachedModel{}
+	for i := 0; i < 3; i++ {
+		model := &localCachedModel{Int: randomInt(), String: randomString()}
+		if err := localCachedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		models = append(models, model)
+	}
+	for _, model := range models {
+		modelCopy := &localCachedModel{}
+		if err := localCachedModels.Find(model.Id(), modelCopy); err != nil {
+			t.Fatalf("Unexpected error in Find: %s", err.Error())
+		}
+		if !reflect.DeepEqual(model, modelCopy) {
+			t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+		}
+	}
+	tr, err := defaultPool.getTracker(false)
+	if err != nil {
+		t.Fatalf("Unexpected error in getTracker: %s", err.Error())
+	}
+	defer defaultPool.stopTracker(tr)
+	isCached := func(model *localCachedModel) bool {
+		key, _ := localCachedModels.ModelKey(model.Id())
+		tr.entriesMu.Lock()
+		defer tr.entriesMu.Unlock()
+		_, cached := tr.entries[key]
+		return cached
+	}
+	// Only the two most recently used models should be cached
+	if isCached(models[0]) {
+		t.Error("Expected the least recently used model to be evicted")
+	}
+	if !isCached(models[1]) || !isCached(models[2]) {
+		t.Error("Expected the most recently used models to be cached")
+	}
+
+	// Saving the model with zoom should be reflected immediately
+	models[2].Int++
+	if err := localCachedModels.Save(models[2]); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	modelCopy := &localCachedModel{}
+	if err := localCachedModels.Find(models[2].Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(models[2], modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", models[2], modelCopy)
+	}
+}
+
+func TestLocalCacheRenameAndDeleteAll(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	localCachedModels := registerTestType(t, &localCachedModel{}, UseLocalCache(0, 0))
+	models := []*localCachedModel{}
+	for i := 0; i < 2; i++ {
+		model := &localCachedModel{Int: randomInt(), String: randomString()}
+		if err := localCachedModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		if err := localCachedModels.Find(model.Id(), &localCachedModel{}); err != nil {
+			t.Fatalf("Unexpected error in Find: %s", err.Error())
+		}
+		models = append(models, model)
+	}
+	tr, err := defaultPool.getTracker(false)
+	if err != nil {
+		t.Fatalf("Unexpected error in getTracker: %s", err.Error())
+	}
+	defer defaultPool.stopTracker(tr)
+
+	// Renaming the model with zoom should be reflected immediately
+	oldId := models[0].Id()
+	if _, err := localCachedModels.Rename(oldId, "renamed"+oldId); err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	if err := localCachedModels.Find(oldId, &localCachedModel{}); err == nil {
+		t.Error("Expected an error in Find for the old id after Rename but got none")
+	}
+	models[0].SetId("renamed" + oldId)
+	modelCopy := &localCachedModel{}
+	if err := localCachedModels.Find(models[0].Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(models[0], modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", models[0], modelCopy)
+	}
+
+	// So should deleting every model
+	if _, err := localCachedModels.DeleteAll(); err != nil {
+		t.Fatalf("Unexpected error in DeleteAll: %s", err.Error())
+	}
+	for _, model := range models {
+		if err := localCachedModels.Find(model.Id(), &localCachedModel{}); err == nil {
+			t.Errorf("Expected an error in Find for model %s after DeleteAll but got none", model.Id())
+		}
+	}
+}
+
+func TestLocalCacheLRU(t *testing.T) {
+	spec := &modelSpec{localCache: true, cacheMaxEntries: 2, cacheTTL: time.Hour}
+	tr := &tracker{
+		entries: map[string]*trackedEntry{},
+		lrus:    map[*modelSpec]*list.List{},
+	}
+	add := func(key string) {
+		entry := &trackedEntry{spec: spec, reply: []interface{}{}}
+		tr.entries[key] = entry
+		tr.addToLRU(key, entry)
+	}
+	add("a")
+	add("b")
+	// Using a should make b the least recently used entry
+	tr.touch(tr.entries["a"])
+	add("c")
+	if _, found := tr.entries["b"]; found {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, found := tr.entries[key]; !found {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	if got := tr.lrus[spec].Len(); got != 2 {
+		t.Errorf("Expected 2 entries in the list but got %d", got)
+	}
+	tr.remove("a", tr.entries["a"])
+	if got := tr.lrus[spec].Len(); got != 1 {
+		t.Errorf("Expected 1 entry in the list after remove but got %d", got)
+	}
+
+	// Entries should expire after the ttl
+	entry := tr.entries["c"]
+	if entry.expired() {
+		t.Error("Expected entry to not be expired")
+	}
+	entry.cachedAt = time.Now().Add(-2 * time.Hour)
+	if !entry.expired() {
+		t.Error("Expected entry to be expired")
+	}
+
+	// Validation
+	if err := UseLocalCache(-1, 0)(&modelSpec{}); err == nil {
+		t.Error("Expected error with negative maxEntries but got none")
+	}
+	if err := UseLocalCache(0, -time.Second)(&modelSpec{}); err == nil {
+		t.Error("Expected error with negative ttl but got none")
+	}
+}
@@ -11,6 +11,10 @@ package zoom
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/vmihailenco/msgpack"
+	"reflect"
 )
 
 // Interface MarshalerUnmarshaler defines a handler for marshaling
@@ -28,12 +32,90 @@ type MarshalerUnmarshaler interface {
 // uses the builtin gob encoding.
 type gobMarshalerUnmarshaler struct{}
 
-// defaultMarshalerUnmarshaler is used to marshal and unmarshal inconvertible
-// fields whenever a custom MarshalerUnmarshaler is not provided.
-var defaultMarshalerUnmarshaler MarshalerUnmarshaler = gobMarshalerUnmarshaler{}
+// jsonMarshalerUnmarshaler is an implementation of MarshalerUnmarshaler that
+// uses the builtin json encoding.
+type jsonMarshalerUnmarshaler struct{}
 
-// Marshal returns the gob encoding of v.
+// msgpackMarshalerUnmarshaler is an implementation of MarshalerUnmarshaler that
+// uses the msgpack encoding.
+type msgpackMarshalerUnmarshaler struct{}
+
+var (
+	// GobMarshalerUnmarshaler is a MarshalerUnmarshaler which uses the builtin
+	// gob package. It is the default and can also be selected for a field with
+	// `zoom:"marshaler=gob"`.
+	GobMarshalerUnmarshaler MarshalerUnmarshaler = gobMarshalerUnmarshaler{}
+	// JSONMarshalerUnmarshaler is a MarshalerUnmarshaler which uses the builtin
+	// json package. Values stored with it are human-readable and can be read by
+	// non-Go clients, but unexported fields of nested structs are not saved. It
+	// can be selected for a field with `zoom:"marshaler=json"`.
+	JSONMarshalerUnmarshaler MarshalerUnmarshaler = jsonMarshalerUnmarshaler{}
+	// MsgpackMarshalerUnmarshaler is a MarshalerUnmarshaler which uses msgpack
+	// (github.com/vmihailenco/msgpack). It is typically smaller and faster to
+	// decode than gob, especially for maps and slices. It can be selected for a
+	// field with `zoom:"marshaler=msgpack"`.
+	MsgpackMarshalerUnmarshaler MarshalerUnmarshaler = msgpackMarshalerUnmarshaler{}
+)
+
+// marshalerUnmarshalers holds all the named MarshalerUnmarshalers which can be
+// selected for a field with the "marshaler" option of the zoom struct tag.
+var marshalerUnmarshalers = map[string]MarshalerUnmarshaler{
+	"gob":     GobMarshalerUnmarshaler,
+	"json":    JSONMarshalerUnmarshaler,
+	"msgpack": MsgpackMarshalerUnmarshaler,
+}
+
+// RegisterMarshalerUnmarshaler registers mu under the given name, so that it can
+// be used for individual fields with a struct tag, e.g.
+// `zoom:"marshaler=name"`. It must be called before registering any model types
+// which refer to name. It returns an error if name is already taken.
+func RegisterMarshalerUnmarshaler(name string, mu MarshalerUnmarshaler) error {
+	if name == "" {
+		return fmt.Errorf("zoom: Error in RegisterMarshalerUnmarshaler: name cannot be empty")
+	}
+	if mu == nil {
+		return fmt.Errorf("zoom: Error in RegisterMarshalerUnmarshaler: MarshalerUnmarshaler cannot be nil")
+	}
+	if _, found := marshalerUnmarshalers[name]; found {
+		return fmt.Errorf("zoom: Error in RegisterMarshalerUnmarshaler: a MarshalerUnmarshaler named %s has already been registered", name)
+	}
+	marshalerUnmarshalers[name] = mu
+	return nil
+}
+
+// UseMarshalerUnmarshaler is a ModelOption which causes mu to be used for all the
+// inconvertible fields of a model type instead of the default MarshalerUnmarshaler.
+// Fields with the "marshaler" option in their zoom struct tag will still use the
+// MarshalerUnmarshaler named in the tag.
+func UseMarshalerUnmarshaler(mu MarshalerUnmarshaler) ModelOption {
+	return func(spec *modelSpec) error {
+		if mu == nil {
+			return fmt.Errorf("zoom: UseMarshalerUnmarshaler requires a non-nil MarshalerUnmarshaler")
+		}
+		spec.marshalerUnmarshaler = mu
+		return nil
+	}
+}
+
+// marshalerUnmarshalerFor returns the MarshalerUnmarshaler that should be used for
+// the field identified by fs. In order of precedence, that is the one specified in
+// the struct tag for the field, the one specified for the model type, or the default.
+func (spec *modelSpec) marshalerUnmarshalerFor(fs *fieldSpec) MarshalerUnmarshaler {
+	if fs.marshalerUnmarshaler != nil {
+		return fs.marshalerUnmarshaler
+	}
+	if spec.marshalerUnmarshaler != nil {
+		return spec.marshalerUnmarshaler
+	}
+	return getSettings().marshalerUnmarshaler
+}
+
+// Marshal returns the gob encoding of v. The concrete types of any interface
+// values in v are registered with gob first.
 func (gobMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	if err := registerGobTypesIn(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
 	var buff bytes.Buffer
 	enc := gob.NewEncoder(&buff)
 	if err := enc.Encode(v); err != nil {
@@ -51,3 +133,23 @@ func (gobMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
 	}
 	return nil
 }
+
+// Marshal returns the json encoding of v.
+func (jsonMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the json-encoded data and stores the result in the value pointed to by v.
+func (jsonMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Marshal returns the msgpack encoding of v.
+func (msgpackMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal parses the msgpack-encoded data and stores the result in the value pointed to by v.
+func (msgpackMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,238 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File marshal_test.go tests the code in marshal.go, i.e.
+// choosing a MarshalerUnmarshaler for inconvertible fields.
+
+package zoom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"testing"
+)
+
+// prefixMarshalerUnmarshaler is a MarshalerUnmarshaler used for testing. It
+// uses gob but adds a prefix so we can tell which one was used to write a field.
+type prefixMarshalerUnmarshaler struct {
+	prefix []byte
+}
+
+func (p prefixMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := gobMarshalerUnmarshaler{}.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, p.prefix...), data...), nil
+}
+
+func (p prefixMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	if !bytes.HasPrefix(data, p.prefix) {
+		return fmt.Errorf("data did not have prefix %q", p.prefix)
+	}
+	return gobMarshalerUnmarshaler{}.Unmarshal(data[len(p.prefix):], v)
+}
+
+// marshalerModel is a model type that is only used for testing custom
+// MarshalerUnmarshalers
+type marshalerModel struct {
+	TypeMap  map[string]int
+	FieldMap map[string]int `zoom:"marshaler=testField"`
+	DefaultData
+}
+
+func TestCustomMarshalerUnmarshaler(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	typePrefix, fieldPrefix := []byte("type:"), []byte("field:")
+	if err := RegisterMarshalerUnmarshaler("testField", prefixMarshalerUnmarshaler{prefix: fieldPrefix}); err != nil {
+		t.Fatalf("Unexpected error in RegisterMarshalerUnmarshaler: %s", err.Error())
+	}
+	defer delete(marshalerUnmarshalers, "testField")
+	if err := RegisterMarshalerUnmarshaler("testField", gobMarshalerUnmarshaler{}); err == nil {
+		t.Error("Expected error when registering the same name twice but got none")
+	}
+	marshalerModels := registerTestType(t, &marshalerModel{}, UseMarshalerUnmarshaler(prefixMarshalerUnmarshaler{prefix: typePrefix}))
+
+	// Save a model and make sure each field was written with the expected
+	// MarshalerUnmarshaler
+	model := &marshalerModel{
+		TypeMap:  map[string]int{"a": randomInt()},
+		FieldMap: map[string]int{"b": randomInt()},
+	}
+	if err := marshalerModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	key, _ := marshalerModels.ModelKey(model.Id())
+	expectedPrefixes := map[string][]byte{"TypeMap": typePrefix, "FieldMap": fieldPrefix}
+	for fieldName, prefix := range expectedPrefixes {
+		got, err := redis.Bytes(conn.Do("HGET", key, fieldName))
+		if err != nil {
+			t.Fatalf("Unexpected error in HGET: %s", err.Error())
+		}
+		if !bytes.HasPrefix(got, prefix) {
+			t.Errorf("Expected field %s to have prefix %q but got %q", fieldName, prefix, got)
+		}
+	}
+
+	// Make sure we get the same model back when we find it
+	modelCopy := &marshalerModel{}
+	if err := marshalerModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
+
+func TestUnknownMarshalerUnmarshalerThrowsError(t *testing.T) {
+	type unknownMarshalerModel struct {
+		Map map[string]int `zoom:"marshaler=doesNotExist"`
+		DefaultData
+	}
+	if _, err := Register(&unknownMarshalerModel{}); err == nil {
+		t.Error("Expected error when registering a model with an unknown marshaler but got none")
+	}
+}
+
+// jsonModel is a model type that is only used for testing the
+// JSONMarshalerUnmarshaler
+type jsonModel struct {
+	Map    map[string]int
+	Nested struct{ A, B string }
+	Tagged []string `zoom:"marshaler=json"`
+	DefaultData
+}
+
+func TestJSONMarshalerUnmarshaler(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	jsonModels := registerTestType(t, &jsonModel{}, UseMarshalerUnmarshaler(JSONMarshalerUnmarshaler))
+
+	model := &jsonModel{
+		Map:    map[string]int{"a": randomInt()},
+		Tagged: []string{randomString(), randomString()},
+	}
+	model.Nested.A, model.Nested.B = randomString(), randomString()
+	if err := jsonModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// Each field should be stored as plain json
+	conn := NewConn()
+	defer conn.Close()
+	key, _ := jsonModels.ModelKey(model.Id())
+	expected := map[string]interface{}{
+		"Map":    model.Map,
+		"Nested": model.Nested,
+		"Tagged": model.Tagged,
+	}
+	for fieldName, val := range expected {
+		expectedJSON, err := json.Marshal(val)
+		if err != nil {
+			t.Fatalf("Unexpected error in json.Marshal: %s", err.Error())
+		}
+		got, err := redis.Bytes(conn.Do("HGET", key, fieldName))
+		if err != nil {
+			t.Fatalf("Unexpected error in HGET: %s", err.Error())
+		}
+		if string(got) != string(expectedJSON) {
+			t.Errorf("Field %s was incorrect.\nExpected: %s\nGot:      %s", fieldName, expectedJSON, got)
+		}
+	}
+
+	modelCopy := &jsonModel{}
+	if err := jsonModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
+
+// msgpackModel is a model type that is only used for testing the
+// MsgpackMarshalerUnmarshaler
+type msgpackModel struct {
+	Map    map[string]int
+	Slice  []string
+	Tagged map[string]string `zoom:"marshaler=msgpack"`
+	DefaultData
+}
+
+func TestMsgpackMarshalerUnmarshaler(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	msgpackModels := registerTestType(t, &msgpackModel{}, UseMarshalerUnmarshaler(MsgpackMarshalerUnmarshaler))
+
+	model := &msgpackModel{
+		Map:    map[string]int{"a": randomInt()},
+		Slice:  []string{randomString(), randomString()},
+		Tagged: map[string]string{"b": randomString()},
+	}
+	if err := msgpackModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	modelCopy := &msgpackModel{}
+	if err := msgpackModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
+
+// gobShape and gobCircle are used for testing automatic gob registration
+type gobShape interface {
+	Area() float64
+}
+
+type gobCircle struct {
+	Radius float64
+}
+
+func (c gobCircle) Area() float64 {
+	return 3.14 * c.Radius * c.Radius
+}
+
+// gobInterfaceModel is a model type that is only used for testing
+// automatic gob registration
+type gobInterfaceModel struct {
+	Shapes []gobShape
+	Extra  map[string]interface{}
+	DefaultData
+}
+
+func TestGobInterfaceFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	gobInterfaceModels := registerTestType(t, &gobInterfaceModel{})
+	model := &gobInterfaceModel{
+		Shapes: []gobShape{gobCircle{Radius: 2}},
+		Extra:  map[string]interface{}{"circle": gobCircle{Radius: 3}, "int": 4},
+	}
+	if err := gobInterfaceModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	modelCopy := &gobInterfaceModel{}
+	if err := gobInterfaceModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+	// gobCircle has already been registered, so registering it again in either
+	// form should be a no-op rather than an error
+	if err := RegisterGobTypes(gobCircle{}, &gobCircle{}); err != nil {
+		t.Errorf("Unexpected error in RegisterGobTypes: %s", err.Error())
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File middleware.go contains code related to middleware, which
+// wraps the operations performed on models and queries.
+
+package zoom
+
+import (
+	"context"
+)
+
+// OpKind is the kind of an operation passed to middleware.
+type OpKind string
+
+const (
+	SaveOp               OpKind = "Save"
+	SaveAllOp            OpKind = "SaveAll"
+	FindOp               OpKind = "Find"
+	FindAllOp            OpKind = "FindAll"
+	FindByIdsOp          OpKind = "FindByIds"
+	CountOp              OpKind = "Count"
+	DeleteOp             OpKind = "Delete"
+	DeleteAllOp          OpKind = "DeleteAll"
+	DeleteByIdsOp        OpKind = "DeleteByIds"
+	LoadFieldOp          OpKind = "LoadField"
+	DeleteAtOp           OpKind = "DeleteAt"
+	RenameOp             OpKind = "Rename"
+	TouchOp              OpKind = "Touch"
+	TTLOp                OpKind = "TTL"
+	PushToFieldOp        OpKind = "PushToField"
+	AddToSetFieldOp      OpKind = "AddToSetField"
+	RemoveFromSetFieldOp OpKind = "RemoveFromSetField"
+	SetFieldContainsOp   OpKind = "SetFieldContains"
+	QueryRunOp           OpKind = "Query.Run"
+	QueryIdsOp           OpKind = "Query.Ids"
+	QueryCountOp         OpKind = "Query.Count"
+)
+
+// Op describes a single operation, e.g. saving a model or running a query.
+// Middleware may inspect an Op (e.g. for logging or metrics) and may modify the
+// models or query it refers to before calling the next OpFunc.
+type Op struct {
+	Kind OpKind
+	// ModelName is the name of the registered model type. It is empty for
+	// SaveAllOp when using the package-level SaveAll function, since the models
+	// may be of different types.
+	ModelName string
+	// Id is the id passed to Find, Delete, DeleteAt, Touch, TTL, Rename (the old
+	// id), or one of the methods for list and set fields (e.g. PushToField). It
+	// is empty for other kinds of operations.
+	Id string
+	// Ids is the ids passed to FindByIds or DeleteByIds. It is nil for other
+	// kinds of operations.
+	Ids []string
+	// Model is the model passed to Save or Find. It is nil for other kinds of
+	// operations.
+	Model Model
+	// Models is the argument passed to FindAll, FindByIds, or Query.Run, or the
+	// models passed to SaveAll. It is nil for other kinds of operations.
+	Models interface{}
+	// Query is the query being run for QueryRunOp, QueryIdsOp, and QueryCountOp.
+	Query *Query
+	// Context is the context passed to a method which accepts a context, or
+	// context.Background() for methods which do not.
+	Context context.Context
+}
+
+// OpFunc performs an operation.
+type OpFunc func(op *Op) error
+
+// Middleware wraps an OpFunc, typically calling next to perform the operation
+// and doing something before and/or after. A Middleware may also return an error
+// without calling next, in which case the operation is not performed.
+type Middleware func(next OpFunc) OpFunc
+
+// middlewares holds the Middleware added with Use
+var middlewares = []Middleware{}
+
+// Use adds middleware which wraps every operation performed with the methods of
+// ModelType (Save, Find, Delete, etc., including the variants which accept a
+// context) and the finishers of Query (Run, Ids, Count, etc.), so that cross-cutting
+// concerns like metrics, authorization, or injecting errors in tests can be
+// implemented in one place. Middleware runs in the order it was added, i.e. the
+// first Middleware is the outermost. Operations which are added to a Transaction
+// directly do not run middleware. It is not safe to call Use concurrently with
+// other zoom functions, so it should typically be called during application
+// startup.
+func Use(middleware ...Middleware) {
+	middlewares = append(middlewares, middleware...)
+}
+
+// runOp calls fn to perform op, wrapped in any Middleware added with Use.
+func runOp(op *Op, fn func() error) error {
+	if op.Context == nil {
+		op.Context = context.Background()
+	}
+	next := OpFunc(func(*Op) error {
+		return fn()
+	})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		next = middlewares[i](next)
+	}
+	return next(op)
+}
+
+// newOp returns an Op of the given kind for q. ctx may be nil.
+func (q *Query) newOp(kind OpKind, models interface{}, ctx context.Context) *Op {
+	return &Op{
+		Kind:      kind,
+		ModelName: q.modelSpec.name,
+		Models:    models,
+		Query:     q,
+		Context:   ctx,
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File middleware_test.go tests the code in middleware.go, i.e.
+// middleware which wraps operations on models and queries.
+
+package zoom
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// middlewareTestKey is a context key used for testing
+type middlewareTestKey struct{}
+
+type middlewareModel struct {
+	Int int `zoom:"index"`
+	DefaultData
+}
+
+func TestMiddleware(t *testing.T) {
+	middlewareModels := registerTestType(t, &middlewareModel{})
+	originalMiddlewares := middlewares
+	defer func() {
+		middlewares = originalMiddlewares
+	}()
+
+	// The first middleware records each op and the order in which the
+	// middleware runs. The second one injects an error, so none of the
+	// operations actually touch the database.
+	calls := []string{}
+	ops := []*Op{}
+	errInjected := errors.New("injected error")
+	Use(func(next OpFunc) OpFunc {
+		return func(op *Op) error {
+			calls = append(calls, "first")
+			ops = append(ops, op)
+			return next(op)
+		}
+	}, func(next OpFunc) OpFunc {
+		return func(op *Op) error {
+			calls = append(calls, "second")
+			return errInjected
+		}
+	})
+
+	model := &middlewareModel{}
+	if err := middlewareModels.Save(model); err != errInjected {
+		t.Errorf("Expected injected error from Save but got %v", err)
+	}
+	if err := middlewareModels.Find("foo", model); err != errInjected {
+		t.Errorf("Expected injected error from Find but got %v", err)
+	}
+	ctx := context.WithValue(context.Background(), middlewareTestKey{}, "value")
+	if _, err := middlewareModels.DeleteContext(ctx, "bar"); err != errInjected {
+		t.Errorf("Expected injected error from DeleteContext but got %v", err)
+	}
+	query := middlewareModels.NewQuery().Filter("Int >", 5)
+	if _, err := query.Ids(); err != errInjected {
+		t.Errorf("Expected injected error from Query.Ids but got %v", err)
+	}
+
+	expectedCalls := []string{"first", "second", "first", "second", "first", "second", "first", "second"}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("Middleware was called in the wrong order.\nExpected: %v\nGot:      %v", expectedCalls, calls)
+	}
+	if len(ops) != 4 {
+		t.Fatalf("Expected 4 ops but got %d", len(ops))
+	}
+	if ops[0].Kind != SaveOp || ops[0].Model != model || ops[0].ModelName != middlewareModels.Name() {
+		t.Errorf("Op for Save was incorrect: %+v", ops[0])
+	}
+	if ops[0].Context != context.Background() {
+		t.Errorf("Expected Context to be context.Background() but got %v", ops[0].Context)
+	}
+	if ops[1].Kind != FindOp || ops[1].Id != "foo" {
+		t.Errorf("Op for Find was incorrect: %+v", ops[1])
+	}
+	if ops[2].Kind != DeleteOp || ops[2].Id != "bar" || ops[2].Context != ctx {
+		t.Errorf("Op for DeleteContext was incorrect: %+v", ops[2])
+	}
+	if ops[3].Kind != QueryIdsOp || ops[3].Query != query {
+		t.Errorf("Op for Query.Ids was incorrect: %+v", ops[3])
+	}
+}
+
+func TestMiddlewareCollectionFields(t *testing.T) {
+	type middlewareCollectionModel struct {
+		Ints []int    `redisType:"list"`
+		Tags []string `redisType:"set"`
+		DefaultData
+	}
+	middlewareCollectionModels := registerTestType(t, &middlewareCollectionModel{})
+	originalMiddlewares := middlewares
+	defer func() {
+		middlewares = originalMiddlewares
+	}()
+
+	ops := []*Op{}
+	errInjected := errors.New("injected error")
+	Use(func(next OpFunc) OpFunc {
+		return func(op *Op) error {
+			ops = append(ops, op)
+			return errInjected
+		}
+	})
+
+	if err := middlewareCollectionModels.PushToField("foo", "Ints", 1); err != errInjected {
+		t.Errorf("Expected injected error from PushToField but got %v", err)
+	}
+	if err := middlewareCollectionModels.AddToSetField("foo", "Tags", "a"); err != errInjected {
+		t.Errorf("Expected injected error from AddToSetField but got %v", err)
+	}
+	if err := middlewareCollectionModels.RemoveFromSetField("foo", "Tags", "a"); err != errInjected {
+		t.Errorf("Expected injected error from RemoveFromSetField but got %v", err)
+	}
+	if _, err := middlewareCollectionModels.SetFieldContains("foo", "Tags", "a"); err != errInjected {
+		t.Errorf("Expected injected error from SetFieldContains but got %v", err)
+	}
+
+	expectedKinds := []OpKind{PushToFieldOp, AddToSetFieldOp, RemoveFromSetFieldOp, SetFieldContainsOp}
+	if len(ops) != len(expectedKinds) {
+		t.Fatalf("Expected %d ops but got %d", len(expectedKinds), len(ops))
+	}
+	for i, op := range ops {
+		if op.Kind != expectedKinds[i] || op.Id != "foo" || op.ModelName != middlewareCollectionModels.Name() {
+			t.Errorf("Op for %s was incorrect: %+v", expectedKinds[i], op)
+		}
+	}
+}
@@ -12,12 +12,17 @@ import (
 	"github.com/garyburd/redigo/redis"
 	"reflect"
 	"strings"
+	"time"
 )
 
 // DefaultData should be embedded in any struct you wish to save.
 // It includes important fields and required methods to implement Model.
 type DefaultData struct {
-	id string
+	id       string
+	snapshot *modelSnapshot
+	// unloaded holds the names of the lazy fields which were not loaded when
+	// the model was last found
+	unloaded map[string]bool
 }
 
 // Model is an interface encapsulating anything that can be saved.
@@ -45,6 +50,48 @@ type modelSpec struct {
 	name         string
 	fieldsByName map[string]*fieldSpec
 	fields       []*fieldSpec
+	trackChanges bool
+	// storeProtobuf is true iff the StoreProtobuf option was used
+	storeProtobuf bool
+	// nullStrategy is set if the UseNullStrategy option was used
+	nullStrategy NullStrategy
+	// version and migrations are set if the SchemaVersion option was used
+	version    int
+	migrations map[int]MigrationFunc
+	// marshalerUnmarshaler is used for inconvertible fields of this type. If
+	// nil, the MarshalerUnmarshaler from the Configuration is used.
+	marshalerUnmarshaler MarshalerUnmarshaler
+	// pool is the Pool this type was registered with
+	pool *Pool
+	// clientTracking is true iff the UseClientTracking option was used
+	clientTracking bool
+	// invalidationBus is true iff the UseInvalidationBus option was used
+	invalidationBus bool
+	// localCache, cacheMaxEntries, and cacheTTL are set by the UseLocalCache
+	// option
+	localCache      bool
+	cacheMaxEntries int
+	cacheTTL        time.Duration
+	// computeFuncs are set by the ComputeFields option
+	computeFuncs []ComputeFunc
+	// auditMaxLen is set if the Audit option was used
+	auditMaxLen int
+	// ttl is set if the TTL option was used
+	ttl time.Duration
+	// archiveOnExpire is true iff the ArchiveOnExpire option was used
+	archiveOnExpire bool
+	// publishChanges is true iff the PublishChanges option was used
+	publishChanges bool
+	// changelog is set if the StreamChanges option was used
+	changelog *StreamOptions
+	// diffChanges is true iff the DiffChanges option was used
+	diffChanges bool
+	// coalescer is set if the CoalesceChanges option was used
+	coalescer *coalescer
+	// scanBatchSize is set if the ScanFindAll option was used
+	scanBatchSize int
+	// hotKeys is set if the TrackHotKeys option was used
+	hotKeys *hotKeyCounter
 }
 
 // fieldSpec contains parsed information about a particular field
@@ -54,16 +101,48 @@ type fieldSpec struct {
 	redisName string
 	typ       reflect.Type
 	indexKind indexKind
+	// marshalerUnmarshaler is set if the field has the "marshaler" option in
+	// its zoom struct tag.
+	marshalerUnmarshaler MarshalerUnmarshaler
+	// encrypted is true iff the field has the "encrypted" option in its zoom
+	// struct tag.
+	encrypted bool
+	// compressed is true iff the field has the "compress" option in its zoom
+	// struct tag.
+	compressed bool
+	// unique is true iff the field has the "unique" option in its zoom struct
+	// tag. Unique fields are always indexed.
+	unique bool
+	// defaultValue is set if the field has the "default=<value>" option in its
+	// zoom struct tag. It has the same type as the field.
+	defaultValue reflect.Value
+	// transitions is set by the UseTransitions option. It maps each state to
+	// the set of states which may follow it.
+	transitions map[string]map[string]bool
+	// index is the index sequence of the field within the model type. It has more
+	// than one element for the fields of nested structs with the "flatten" option.
+	index []int
+	// redisTags holds the value of the redis struct tag for the field and for each
+	// struct it is nested in. It is used to compute redisName.
+	redisTags []string
+	// lazy is true iff the field has the "lazy" option in its zoom struct tag.
+	lazy bool
+	// byteArray is true iff the field is an array of bytes or a pointer to one.
+	// It is computed when the type is registered so that it does not need to be
+	// checked every time a model is saved.
+	byteArray bool
 }
 
 // fieldKind is the kind of a particular field, and is either a primative,
-// a pointer, or an inconvertible.
+// a pointer, an inconvertible, a list, or a set.
 type fieldKind int
 
 const (
 	primativeField     fieldKind = iota // any primative type
 	pointerField                        // pointer to any primative type
 	inconvertibleField                  // all other types
+	listField                           // a slice stored as a separate redis list
+	setField                            // a slice stored as a separate redis set
 )
 
 // indexKind is the kind of an index, and is either noIndex, numericIndex,
@@ -81,14 +160,57 @@ const (
 // and returns a modelSpec.
 func compileModelSpec(typ reflect.Type) (*modelSpec, error) {
 	ms := &modelSpec{fieldsByName: map[string]*fieldSpec{}, typ: typ}
+	if err := ms.compileFields(typ.Elem(), nil, "", nil); err != nil {
+		return nil, err
+	}
+	if err := ms.setRedisNames(getNamingStrategy()); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// compileModelTag parses the options in the "zoom" struct tag for the embedded
+// DefaultData field or a blank field of a model type, which apply to the model
+// type as a whole (currently only "ttl=<duration>" is supported).
+func (ms *modelSpec) compileModelTag(zoomTag string) error {
+	if zoomTag == "" {
+		return nil
+	}
+	for _, op := range strings.Split(zoomTag, ",") {
+		switch {
+		case strings.HasPrefix(op, "ttl="):
+			ttl, err := time.ParseDuration(strings.TrimPrefix(op, "ttl="))
+			if err != nil {
+				return fmt.Errorf("could not parse ttl: %s", err.Error())
+			}
+			if err := TTL(ttl)(ms); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unrecognized option for model type: %s", op)
+		}
+	}
+	return nil
+}
 
+// compileFields parses the fields of elem, which must be a struct type, and adds
+// them to ms. index is the index sequence of elem within the model type, namePrefix
+// is prepended to the names of its fields, and redisTags holds the redis struct tags
+// for each struct it is nested in. They are used for nested structs with the
+// "flatten" option and should be empty for the model type itself.
+func (ms *modelSpec) compileFields(elem reflect.Type, index []int, namePrefix string, redisTags []string) error {
 	// Iterate through fields
-	elem := typ.Elem()
 	numFields := elem.NumField()
 	for i := 0; i < numFields; i++ {
 		field := elem.Field(i)
-		// Skip the DefaultData field
-		if field.Type == reflect.TypeOf(DefaultData{}) {
+		// Skip the DefaultData field and any blank fields. At the top level,
+		// their "zoom" tags hold options for the model type itself.
+		if field.Type == reflect.TypeOf(DefaultData{}) || field.Name == "_" {
+			if index == nil {
+				if err := ms.compileModelTag(field.Tag.Get("zoom")); err != nil {
+					return fmt.Errorf("zoom: %s (specified in struct tag for %s.%s)", err.Error(), elem.Name(), field.Name)
+				}
+			}
 			continue
 		}
 
@@ -98,53 +220,198 @@ func compileModelSpec(typ reflect.Type) (*modelSpec, error) {
 		if redisTag == "-" {
 			continue // skip field
 		}
-		fs := &fieldSpec{name: field.Name, typ: field.Type}
-		ms.fieldsByName[fs.name] = fs
-		ms.fields = append(ms.fields, fs)
-		if redisTag != "" {
-			fs.redisName = redisTag
-		} else {
-			fs.redisName = fs.name
+		fieldIndex := append(append([]int{}, index...), i)
+		fs := &fieldSpec{
+			name:      namePrefix + field.Name,
+			typ:       field.Type,
+			index:     fieldIndex,
+			redisTags: append(append([]string{}, redisTags...), redisTag),
 		}
 
-		// Parse the "zoom" tag (currently only "index" is supported)
+		// Parse the "zoom" tag (currently "index", "unique", "encrypted",
+		// "compress", "flatten", "lazy", "marshaler=<name>", "time=<format>",
+		// and "default=<value>" are supported)
 		zoomTag := tag.Get("zoom")
 		shouldIndex := false
+		shouldFlatten := false
+		timeFormat := ""
+		defaultString := ""
+		hasDefault := false
 		if zoomTag != "" {
 			options := strings.Split(zoomTag, ",")
 			for _, op := range options {
-				switch op {
-				case "index":
+				switch {
+				case op == "index":
+					shouldIndex = true
+				case op == "unique":
 					shouldIndex = true
+					fs.unique = true
+				case op == "encrypted":
+					fs.encrypted = true
+				case op == "compress":
+					fs.compressed = true
+				case op == "flatten":
+					shouldFlatten = true
+				case op == "lazy":
+					fs.lazy = true
+				case strings.HasPrefix(op, "marshaler="):
+					muName := strings.TrimPrefix(op, "marshaler=")
+					mu, found := marshalerUnmarshalers[muName]
+					if !found {
+						return fmt.Errorf("zoom: no MarshalerUnmarshaler named %s has been registered (specified in struct tag for %s.%s)", muName, elem.Name(), field.Name)
+					}
+					if mu == ProtobufMarshalerUnmarshaler && !typeIsProtoMessage(field.Type) {
+						return fmt.Errorf("zoom: the protobuf marshaler is only supported for fields which implement proto.Message. %s.%s has type %s", elem.Name(), field.Name, field.Type.String())
+					}
+					fs.marshalerUnmarshaler = mu
+				case strings.HasPrefix(op, "time="):
+					if !typeIsTime(field.Type) {
+						return fmt.Errorf("zoom: the time option in struct tag is only supported for time.Time fields. %s.%s has type %s", elem.Name(), field.Name, field.Type.String())
+					}
+					timeFormat = strings.TrimPrefix(op, "time=")
+				case strings.HasPrefix(op, "default="):
+					defaultString = strings.TrimPrefix(op, "default=")
+					hasDefault = true
 				default:
-					return nil, fmt.Errorf("zoom: unrecognized option specified in struct tag: %s", op)
+					return fmt.Errorf("zoom: unrecognized option specified in struct tag: %s", op)
 				}
 			}
 		}
 
+		if shouldFlatten {
+			// Store each field of the nested struct as a separate field in the main
+			// hash, e.g. "Address.City", instead of storing the struct itself
+			if field.Type.Kind() != reflect.Struct {
+				return fmt.Errorf("zoom: the flatten option in struct tag is only supported for struct fields. %s.%s has type %s", elem.Name(), field.Name, field.Type.String())
+			}
+			if shouldIndex || fs.encrypted || fs.compressed || fs.lazy || fs.marshalerUnmarshaler != nil || hasDefault {
+				return fmt.Errorf("zoom: the flatten option for %s.%s cannot be combined with other options. Add them to the fields of %s instead", elem.Name(), field.Name, field.Type.String())
+			}
+			if err := ms.compileFields(field.Type, fieldIndex, fs.name+".", fs.redisTags); err != nil {
+				return err
+			}
+			continue
+		}
+		ms.fieldsByName[fs.name] = fs
+		ms.fields = append(ms.fields, fs)
+
+		if fs.encrypted && shouldIndex {
+			return fmt.Errorf("zoom: cannot index %s.%s because encrypted fields cannot be indexed", elem.Name(), field.Name)
+		}
+		if fs.compressed && shouldIndex {
+			return fmt.Errorf("zoom: cannot index %s.%s because compressed fields cannot be indexed", elem.Name(), field.Name)
+		}
+
 		// Detect the kind of the field and (if applicable) the kind of the index
-		if typeIsPrimative(field.Type) {
+		if typeIsTime(field.Type) {
+			// time.Time or *time.Time. These are treated like inconvertibles but are
+			// stored in a readable format and can be indexed.
+			fs.kind = inconvertibleField
+			if shouldIndex {
+				fs.indexKind = numericIndex
+			}
+			if fs.marshalerUnmarshaler == nil {
+				mu, err := newTimeMarshalerUnmarshaler(timeFormat)
+				if err != nil {
+					return err
+				}
+				fs.marshalerUnmarshaler = mu
+			}
+		} else if typeIsValuerScanner(field.Type) {
+			// Custom type which implements Valuer and Scanner. These are treated
+			// like inconvertibles but use RedisValue and RedisScan by default.
+			fs.kind = inconvertibleField
+			if shouldIndex {
+				return fmt.Errorf("zoom: cannot index %s.%s because fields which implement Valuer cannot be indexed", elem.Name(), field.Name)
+			}
+			if fs.marshalerUnmarshaler == nil {
+				fs.marshalerUnmarshaler = valuerScannerMarshalerUnmarshaler{}
+			}
+		} else if typeIsPrimative(field.Type) {
 			// Primative
 			fs.kind = primativeField
+			fs.byteArray = typeIsByteArray(field.Type)
 			if shouldIndex {
 				if err := setIndexKind(fs, field.Type); err != nil {
-					return nil, err
+					return err
 				}
 			}
 		} else if field.Type.Kind() == reflect.Ptr && typeIsPrimative(field.Type.Elem()) {
 			// Pointer to a primative
 			fs.kind = pointerField
+			fs.byteArray = typeIsByteArray(field.Type.Elem())
 			if shouldIndex {
 				if err := setIndexKind(fs, field.Type.Elem()); err != nil {
-					return nil, err
+					return err
 				}
 			}
 		} else {
 			// All other types are considered inconvertible
 			fs.kind = inconvertibleField
+			if typeIsText(field.Type) {
+				// Store types like big.Int as text unless the struct tag said otherwise
+				if fs.marshalerUnmarshaler == nil {
+					fs.marshalerUnmarshaler = textMarshalerUnmarshaler{}
+				}
+				if shouldIndex {
+					if !typeIsNumericText(field.Type) {
+						return fmt.Errorf("zoom: Requested index on unsupported type %s", field.Type.String())
+					}
+					if _, ok := fs.marshalerUnmarshaler.(textMarshalerUnmarshaler); !ok {
+						return fmt.Errorf("zoom: cannot index %s.%s because it uses a custom marshaler", elem.Name(), field.Name)
+					}
+					fs.indexKind = numericIndex
+				}
+			}
+		}
+
+		// Parse the "redisType" tag, which allows certain fields to be stored
+		// in a separate redis data structure instead of the main hash
+		switch redisType := tag.Get("redisType"); redisType {
+		case "":
+		case "list", "set":
+			if field.Type.Kind() != reflect.Slice || !typeIsSliceOrArray(field.Type) {
+				return fmt.Errorf("zoom: redisType %q is only supported for slices (not including []byte). %s.%s has type %s", redisType, elem.Name(), field.Name, field.Type.String())
+			}
+			if shouldIndex {
+				return fmt.Errorf("zoom: cannot index %s.%s because fields with redisType %q cannot be indexed", elem.Name(), field.Name, redisType)
+			}
+			if fs.encrypted || fs.compressed {
+				return fmt.Errorf("zoom: cannot encrypt or compress %s.%s because fields with redisType %q are stored outside of the main hash", elem.Name(), field.Name, redisType)
+			}
+			if redisType == "list" {
+				fs.kind = listField
+			} else {
+				fs.kind = setField
+			}
+		default:
+			return fmt.Errorf("zoom: unrecognized redisType specified in struct tag: %s", redisType)
+		}
+
+		if fs.lazy {
+			if shouldIndex {
+				return fmt.Errorf("zoom: cannot index %s.%s because lazy fields cannot be indexed", elem.Name(), field.Name)
+			}
+			if !fs.storedInHash() {
+				return fmt.Errorf("zoom: the lazy option for %s.%s cannot be combined with redisType", elem.Name(), field.Name)
+			}
+			if !ms.typ.Implements(lazyLoaderType) {
+				return fmt.Errorf("zoom: the lazy option for %s.%s requires a model type which embeds DefaultData", elem.Name(), field.Name)
+			}
+		}
+
+		if hasDefault {
+			if fs.kind != primativeField && fs.kind != pointerField {
+				return fmt.Errorf("zoom: the default option in struct tag is only supported for primative fields and pointers to primatives. %s.%s has type %s", elem.Name(), field.Name, field.Type.String())
+			}
+			defaultValue := reflect.New(field.Type).Elem()
+			if err := scanDefaultVal(defaultString, defaultValue); err != nil {
+				return fmt.Errorf("zoom: invalid default value %q in struct tag for %s.%s: %s", defaultString, elem.Name(), field.Name, err.Error())
+			}
+			fs.defaultValue = defaultValue
 		}
 	}
-	return ms, nil
+	return nil
 }
 
 // setIndexKind sets the indexKind field of fs based on fieldType
@@ -165,37 +432,138 @@ func setIndexKind(fs *fieldSpec, fieldType reflect.Type) error {
 // allIndexKey returns a key which is used in redis to store all the ids of every model of a
 // given type
 func (ms *modelSpec) allIndexKey() string {
-	return ms.name + ":all"
+	return ms.keyName() + ":all"
+}
+
+// keyPrefix returns the KeyPrefix for the pool that ms was registered with.
+func (ms *modelSpec) keyPrefix() string {
+	if ms.pool == nil {
+		return ""
+	}
+	return ms.pool.getState().keyPrefix
+}
+
+// keyName returns the name of ms with the KeyPrefix for its pool prepended.
+// It is used as the prefix for all keys related to the model type.
+func (ms *modelSpec) keyName() string {
+	return ms.keyPrefix() + ms.name
+}
+
+// internalKeySegment is the segment which follows the name of a model type in
+// keys that zoom uses internally for the type as a whole, e.g. the schedule of
+// deletions. No model may have it as its id, so those keys can never collide
+// with the keys for a model.
+const internalKeySegment = "_zoom"
+
+// internalKey returns the key with the given name that zoom uses internally
+// for the model type as a whole.
+func (ms *modelSpec) internalKey(name string) string {
+	return ms.keyName() + ":" + internalKeySegment + ":" + name
 }
 
 // modelKey returns the key that identifies a hash in the database
 // which contains all the fields of the model corresponding to the given
-// id. It returns an error iff id is empty.
+// id. It returns an error iff id is empty or is reserved for internal keys.
 func (ms *modelSpec) modelKey(id string) (string, error) {
 	if id == "" {
 		return "", fmt.Errorf("zoom: Error in modelKey: id was empty")
 	}
-	return ms.name + ":" + id, nil
+	if id == internalKeySegment || strings.HasPrefix(id, internalKeySegment+":") {
+		return "", fmt.Errorf("zoom: Error in modelKey: id %q is reserved", id)
+	}
+	return ms.keyName() + ":" + id, nil
 }
 
-// fieldNames returns all the field names for the given modelSpec
-func (ms modelSpec) fieldNames() []string {
-	names := make([]string, len(ms.fields))
-	count := 0
-	for _, field := range ms.fields {
-		names[count] = field.name
-		count++
+// fieldKey returns the key that identifies a list or other data structure in the
+// database which is used to store the field identified by fs for the model with
+// the given id. Only fields which are not stored in the main hash have a field key.
+func (ms *modelSpec) fieldKey(id string, fs *fieldSpec) string {
+	return ms.keyName() + ":" + id + ":" + fs.redisName
+}
+
+// storedInHash returns true iff the field is stored in the main hash for the
+// model, as opposed to a separate data structure such as a list or set.
+func (fs *fieldSpec) storedInHash() bool {
+	return fs.kind != listField && fs.kind != setField
+}
+
+// checkFieldKeys returns an error if the key for any list or set field would be
+// the same as another key which belongs to each model, e.g. the key for the
+// protobuf blob if the StoreProtobuf option was used. It must be called after
+// all the options for ms have been applied.
+func (ms *modelSpec) checkFieldKeys() error {
+	reserved := map[string]string{}
+	if ms.storeProtobuf {
+		reserved[protobufKeySuffix] = "StoreProtobuf"
+	}
+	if ms.auditMaxLen > 0 {
+		reserved[auditKeySuffix] = "Audit"
+	}
+	if ms.archiveOnExpire {
+		reserved[expiresKeySuffix] = "ArchiveOnExpire"
+	}
+	for _, fs := range ms.fields {
+		if fs.storedInHash() {
+			continue
+		}
+		if option, found := reserved[fs.redisName]; found {
+			return fmt.Errorf("zoom: the redis name for %s.%s cannot be %q because the key for that name is used by the %s option", ms.typ.Elem().Name(), fs.name, fs.redisName, option)
+		}
+	}
+	return nil
+}
+
+// hashFieldNames returns only the names in fieldNames which correspond to fields
+// that are stored in the main hash for the model. Any names which do not correspond
+// to a field in the spec (e.g. the special name "-" which stands for the id) are
+// also included.
+func (ms *modelSpec) hashFieldNames(fieldNames []string) []string {
+	results := []string{}
+	for _, name := range fieldNames {
+		if fs, found := ms.fieldsByName[name]; !found || fs.storedInHash() {
+			results = append(results, name)
+		}
+	}
+	return results
+}
+
+// collectionFields returns the field specs for all the names in fieldNames which
+// correspond to fields that are not stored in the main hash for the model.
+func (ms *modelSpec) collectionFields(fieldNames []string) []*fieldSpec {
+	results := []*fieldSpec{}
+	for _, name := range fieldNames {
+		if fs, found := ms.fieldsByName[name]; found && !fs.storedInHash() {
+			results = append(results, fs)
+		}
+	}
+	return results
+}
+
+// redisNames returns the redis names for each field name in fieldNames.
+func (ms *modelSpec) redisNames(fieldNames []string) []string {
+	names := make([]string, len(fieldNames))
+	for i, name := range fieldNames {
+		names[i] = ms.redisName(name)
 	}
 	return names
 }
 
-// fieldRedisNames returns all the redis names (which might be custom names specified via
-// the `redis:"custonName"` struct tag) for each field in the given modelSpec
-func (ms modelSpec) fieldRedisNames() []string {
+// redisName returns the redis name for the field with the given name. Any names
+// which do not correspond to a field in the spec (e.g. the special name for the
+// schema version) are returned as is.
+func (ms *modelSpec) redisName(fieldName string) string {
+	if fs, found := ms.fieldsByName[fieldName]; found {
+		return fs.redisName
+	}
+	return fieldName
+}
+
+// fieldNames returns all the field names for the given modelSpec
+func (ms modelSpec) fieldNames() []string {
 	names := make([]string, len(ms.fields))
 	count := 0
 	for _, field := range ms.fields {
-		names[count] = field.redisName
+		names[count] = field.name
 		count++
 	}
 	return names
@@ -211,7 +579,7 @@ func (ms *modelSpec) fieldIndexKey(fieldName string) (string, error) {
 	} else if fs.indexKind == noIndex {
 		return "", fmt.Errorf("%s.%s is not an indexed field", ms.typ.Name(), fieldName)
 	}
-	return ms.name + ":" + fs.redisName, nil
+	return ms.keyName() + ":" + fs.redisName, nil
 }
 
 // sortArgs returns arguments that can be used to get all the fields in includeFields
@@ -225,7 +593,7 @@ func (ms *modelSpec) fieldIndexKey(fieldName string) (string, error) {
 func (ms *modelSpec) sortArgs(setKey string, includeFields []string, limit int, offset uint, orderKind orderKind) redis.Args {
 	args := redis.Args{setKey, "BY", "nosort"}
 	for _, fieldName := range includeFields {
-		args = append(args, "GET", ms.name+":*->"+fieldName)
+		args = append(args, "GET", ms.keyName()+":*->"+fieldName)
 	}
 	// We always want to get the id
 	args = append(args, "GET", "#")
@@ -241,6 +609,26 @@ func (ms *modelSpec) sortArgs(setKey string, includeFields []string, limit int,
 	return args
 }
 
+// checkCollectionField returns the fieldSpec identified by fieldName. It returns an
+// error if there is no such field, if the field is not of the given kind, or if any
+// of the given values do not have the same type as the elements of the field.
+func (spec *modelSpec) checkCollectionField(fieldName string, kind fieldKind, values []interface{}) (*fieldSpec, error) {
+	fs, found := spec.fieldsByName[fieldName]
+	if !found {
+		return nil, fmt.Errorf("Type %s has no field named %s", spec.typ.String(), fieldName)
+	}
+	if fs.kind != kind {
+		return nil, fmt.Errorf("%s.%s does not have the correct redisType", spec.typ.String(), fieldName)
+	}
+	elemType := fs.typ.Elem()
+	for _, value := range values {
+		if reflect.TypeOf(value) != elemType {
+			return nil, fmt.Errorf("Type of value (%T) does not match the type of the elements of %s.%s (%s)", value, spec.typ.String(), fieldName, elemType.String())
+		}
+	}
+	return fs, nil
+}
+
 // checkModelType returns an error iff model is not of the registered type that
 // corresponds to modelSpec.
 func (spec *modelSpec) checkModelType(model Model) error {
@@ -288,53 +676,109 @@ func (mr *modelRef) value() reflect.Value {
 // underlying struct. If the model is a nil pointer,
 // it will panic if the model is a nil pointer
 func (mr *modelRef) elemValue() reflect.Value {
-	if mr.value().IsNil() {
+	val := mr.value()
+	if val.IsNil() {
 		msg := fmt.Sprintf("zoom: panic in elemValue(). Model of type %T was nil", mr.model)
 		panic(msg)
 	}
-	return mr.value().Elem()
+	return val.Elem()
 }
 
-// fieldValue is an alias for mr.elemValue().FieldByName(name). It panics if
+// fieldValue returns the value of the field with the given name, which may refer
+// to a field of a flattened nested struct (e.g. "Address.City"). It panics if
 // the model behind mr does not have a field with the given name or if
 // the model is nil.
 func (mr *modelRef) fieldValue(name string) reflect.Value {
+	if fs, found := mr.spec.fieldsByName[name]; found {
+		return mr.specFieldValue(fs)
+	}
 	return mr.elemValue().FieldByName(name)
 }
 
+// specFieldValue is like fieldValue but uses the index sequence which was
+// computed when the type was registered, so it does not need to look up the
+// field by name. It should be used in the hot paths for saving and finding
+// models, where the fieldSpec is already known.
+func (mr *modelRef) specFieldValue(fs *fieldSpec) reflect.Value {
+	if len(fs.index) == 1 {
+		// Most fields are not nested, and Field is faster than FieldByIndex
+		return mr.elemValue().Field(fs.index[0])
+	}
+	return mr.elemValue().FieldByIndex(fs.index)
+}
+
 // key returns a key which is used in redis to store the model
 func (mr *modelRef) key() string {
-	return mr.spec.name + ":" + mr.model.Id()
+	return mr.spec.keyName() + ":" + mr.model.Id()
 }
 
 // mainHashArgs returns the args for the main hash for this model. Typically
 // these args should part of an HMSET command.
 func (mr *modelRef) mainHashArgs() (redis.Args, error) {
+	return mr.hashArgs(mr.spec.fields)
+}
+
+// hashArgs is like mainHashArgs but only includes the given fields. Any fields
+// which are not stored in the main hash are skipped.
+func (mr *modelRef) hashArgs(fields []*fieldSpec) (redis.Args, error) {
 	args := redis.Args{mr.key()}
-	ms := mr.spec
-	for _, fs := range ms.fields {
-		fieldVal := mr.fieldValue(fs.name)
-		switch fs.kind {
-		case primativeField:
-			args = args.Add(fs.redisName, fieldVal.Interface())
-		case pointerField:
-			if !fieldVal.IsNil() {
-				args = args.Add(fs.redisName, fieldVal.Elem().Interface())
-			} else {
-				args = args.Add(fs.redisName, "NULL")
+	for _, fs := range fields {
+		if !fs.storedInHash() {
+			// Lists and sets are stored separately, not in the main hash
+			continue
+		}
+		if mr.spec.getNullStrategy() == NullAbsent && mr.fieldIsNil(fs) {
+			// Nil pointers are removed from the hash instead
+			continue
+		}
+		value, err := mr.hashValue(fs)
+		if err != nil {
+			return nil, err
+		}
+		if fs.compressed {
+			value, err = compressValue([]byte(snapshotValue(value)))
+			if err != nil {
+				return nil, err
 			}
-		case inconvertibleField:
-			if fieldVal.Type().Kind() == reflect.Ptr && fieldVal.IsNil() {
-				args = args.Add(fs.redisName, "NULL")
-			} else {
-				// For inconvertibles, we convert the value to bytes using the gob package.
-				valBytes, err := defaultMarshalerUnmarshaler.Marshal(fieldVal.Interface())
-				if err != nil {
-					return nil, err
-				}
-				args = args.Add(fs.redisName, valBytes)
+		}
+		if fs.encrypted {
+			// Encryption happens here instead of in hashValue, since encrypting
+			// the same value twice gives different results
+			value, err = encryptValue([]byte(snapshotValue(value)), encryptionAAD(mr.key(), fs))
+			if err != nil {
+				return nil, err
 			}
 		}
+		args = args.Add(fs.redisName, value)
 	}
 	return args, nil
 }
+
+// hashValue returns the value of the field identified by fs converted to a
+// format suitable for storing in the main hash.
+func (mr *modelRef) hashValue(fs *fieldSpec) (interface{}, error) {
+	fieldVal := mr.specFieldValue(fs)
+	switch fs.kind {
+	case primativeField:
+		if fs.byteArray {
+			// Store byte arrays as raw bytes, just like byte slices
+			return byteSliceValue(fieldVal), nil
+		}
+		return fieldVal.Interface(), nil
+	case pointerField:
+		if !fieldVal.IsNil() {
+			if fs.byteArray {
+				return byteSliceValue(fieldVal.Elem()), nil
+			}
+			return fieldVal.Elem().Interface(), nil
+		}
+		return getSettings().nullSentinel, nil
+	default:
+		if fieldVal.Type().Kind() == reflect.Ptr && fieldVal.IsNil() {
+			return getSettings().nullSentinel, nil
+		}
+		// For inconvertibles, we convert the value to bytes using the appropriate
+		// MarshalerUnmarshaler (gob by default).
+		return mr.spec.marshalerUnmarshalerFor(fs).Marshal(fieldVal.Interface())
+	}
+}
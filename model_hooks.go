@@ -0,0 +1,57 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File model_hooks.go contains code related to hooks which are
+// implemented by models and called before they are saved.
+
+package zoom
+
+import (
+	"fmt"
+)
+
+// BeforeSaver is implemented by models which need to run code, e.g. validation,
+// before they are saved. BeforeSave is called by Save (and Transaction.Save)
+// after any default values and computed fields have been set. If BeforeSave
+// returns an error, the model is not saved and the error is returned as a
+// HookError. When more than one model is saved in the same transaction (e.g.
+// with SaveAll), none of them are saved and nothing else in the transaction is
+// executed.
+type BeforeSaver interface {
+	BeforeSave() error
+}
+
+// HookError is returned when a hook for a model (e.g. BeforeSave or a
+// ComputeFunc) returns an error. It identifies the model and the hook which
+// failed, which is useful when saving more than one model in a transaction.
+type HookError struct {
+	ModelName string
+	Id        string
+	// Hook is the name of the hook which failed, e.g. "BeforeSave"
+	Hook string
+	// Err is the error returned by the hook
+	Err error
+}
+
+func (e HookError) Error() string {
+	return fmt.Sprintf("zoom: Error in %s for %s with id = %s: %s", e.Hook, e.ModelName, e.Id, e.Err.Error())
+}
+
+// runBeforeSave calls the BeforeSave method of mr.model if it implements
+// BeforeSaver.
+func (mr *modelRef) runBeforeSave() error {
+	saver, ok := mr.model.(BeforeSaver)
+	if !ok {
+		return nil
+	}
+	if err := saver.BeforeSave(); err != nil {
+		return HookError{
+			ModelName: mr.spec.name,
+			Id:        mr.model.Id(),
+			Hook:      "BeforeSave",
+			Err:       err,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File model_hooks_test.go tests the code in model_hooks.go, i.e.
+// hooks which are implemented by models.
+
+package zoom
+
+import (
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"testing"
+)
+
+type validatedModel struct {
+	Name string
+	DefaultData
+}
+
+func (m *validatedModel) BeforeSave() error {
+	if m.Name == "" {
+		return errors.New("Name is required")
+	}
+	return nil
+}
+
+func TestBeforeSaveRollback(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	validatedModels := registerTestType(t, &validatedModel{})
+
+	// If BeforeSave fails for one of the models, nothing in the transaction
+	// should be executed, including commands which were added before it.
+	valid := &validatedModel{Name: "Alice"}
+	invalid := &validatedModel{}
+	tx := NewTransaction()
+	tx.Command("SET", redis.Args{"beforeSaveRollback", "value"}, nil)
+	tx.Save(validatedModels, valid)
+	tx.Save(validatedModels, invalid)
+	err := tx.Exec()
+	if err == nil {
+		t.Fatal("Expected an error from BeforeSave but got none")
+	}
+	hookErr, ok := err.(HookError)
+	if !ok {
+		t.Fatalf("Expected a HookError but got %T: %s", err, err.Error())
+	}
+	if hookErr.Hook != "BeforeSave" || hookErr.ModelName != validatedModels.Name() || hookErr.Id != invalid.Id() {
+		t.Errorf("HookError did not identify the model and hook which failed: %+v", hookErr)
+	}
+	count, err := validatedModels.Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("Expected no models to be saved but got %d", count)
+	}
+	conn := NewConn()
+	defer conn.Close()
+	exists, err := redis.Bool(conn.Do("EXISTS", "beforeSaveRollback"))
+	if err != nil {
+		t.Fatalf("Unexpected error in EXISTS: %s", err.Error())
+	}
+	if exists {
+		t.Error("Expected the command added before the failed Save to not be executed")
+	}
+
+	// SaveAll should behave the same way
+	if err := SaveAll(valid, invalid); err == nil {
+		t.Error("Expected an error from BeforeSave in SaveAll but got none")
+	}
+	count, err = validatedModels.Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("Expected no models to be saved but got %d", count)
+	}
+}
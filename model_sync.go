@@ -0,0 +1,121 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File model_sync.go contains code related to keeping a model in
+// memory up to date with changes made by other processes.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ModelSync keeps a model in memory up to date with the version stored in the
+// database. It is created with ModelType.Sync.
+type ModelSync struct {
+	model    Model
+	onChange func(Model)
+	watcher  *ModelWatcher
+	// mu protects model and deleted
+	mu      sync.RWMutex
+	deleted bool
+	// done is closed when the goroutine which updates model has stopped
+	done chan struct{}
+}
+
+// Sync finds the model with the given id and scans its values into model, just
+// like Find, and then keeps model up to date automatically whenever it is
+// changed by any process, so that long-lived processes always see the latest
+// version without polling. Changes are detected with ModelType.Watch, so the
+// same caveats apply (e.g. changes made while the connection is lost may be
+// missed until the next change).
+//
+// Since model is updated in place by a background goroutine, it must not be
+// read or modified without holding the read lock (see RLock). If onChange is
+// not nil, it is called after each update (without holding the lock) with
+// model, or with nil if the model was deleted or expired. If the model is
+// deleted, model keeps its last known values. Call Close to stop syncing.
+func (mt *ModelType) Sync(id string, model Model, onChange func(Model)) (*ModelSync, error) {
+	if err := mt.spec.checkModelType(model); err != nil {
+		return nil, fmt.Errorf("zoom: Error in Sync: %s", err.Error())
+	}
+	// Start watching first, so that any changes made after the model is found
+	// are not missed
+	w, err := mt.Watch(id)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in Sync: %s", err.Error())
+	}
+	if err := mt.FromMaster().Find(id, model); err != nil {
+		w.Close()
+		return nil, err
+	}
+	s := &ModelSync{
+		model:    model,
+		onChange: onChange,
+		watcher:  w,
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// run copies each version of the model received by s.watcher into s.model
+// until the watcher is closed.
+func (s *ModelSync) run() {
+	defer close(s.done)
+	dest := reflect.ValueOf(s.model).Elem()
+	for latest := range s.watcher.Changes {
+		s.mu.Lock()
+		if latest == nil {
+			s.deleted = true
+		} else {
+			dest.Set(reflect.ValueOf(latest).Elem())
+			s.deleted = false
+		}
+		s.mu.Unlock()
+		if s.onChange != nil {
+			if latest == nil {
+				s.onChange(nil)
+			} else {
+				s.onChange(s.model)
+			}
+		}
+	}
+}
+
+// RLock locks the model for reading. It must be held while reading any fields
+// of the model, since they may be updated at any time otherwise.
+func (s *ModelSync) RLock() {
+	s.mu.RLock()
+}
+
+// RUnlock undoes a single RLock call.
+func (s *ModelSync) RUnlock() {
+	s.mu.RUnlock()
+}
+
+// Deleted returns true iff the model was deleted (or expired) after it was last
+// updated. If it is saved again later, it is updated and Deleted returns false.
+func (s *ModelSync) Deleted() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.deleted
+}
+
+// Err returns the first error encountered while syncing, if any, including
+// errors from finding the model and from connections which were lost and then
+// reestablished.
+func (s *ModelSync) Err() error {
+	return s.watcher.Err()
+}
+
+// Close stops syncing and waits for the current update (if any) to finish. The
+// model keeps the values it had at that point. It returns the same error as Err.
+func (s *ModelSync) Close() error {
+	err := s.watcher.Close()
+	<-s.done
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File model_sync_test.go tests the code in model_sync.go.
+
+package zoom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModelTypeSync(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveTestModels(1)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	original := models[0]
+	changes := make(chan Model, 10)
+	synced := &testModel{}
+	s, err := testModels.Sync(original.Id(), synced, func(model Model) {
+		changes <- model
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in Sync: %s", err.Error())
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("Unexpected error in ModelSync.Close: %s", err.Error())
+		}
+	}()
+	s.RLock()
+	if synced.String != original.String {
+		t.Errorf("Expected String to be %s after Sync but got %s", original.String, synced.String)
+	}
+	s.RUnlock()
+
+	// Simulate another process saving a new version of the model
+	updated := &testModel{Int: original.Int, String: "updated", Bool: original.Bool}
+	updated.SetId(original.Id())
+	if err := testModels.Save(updated); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	select {
+	case got := <-changes:
+		if got != synced {
+			t.Errorf("Expected onChange to be called with the synced model but got %#v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for onChange")
+	}
+	s.RLock()
+	if synced.String != "updated" {
+		t.Errorf("Expected String to be updated but got %s", synced.String)
+	}
+	s.RUnlock()
+
+	if _, err := testModels.Delete(original.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	select {
+	case got := <-changes:
+		if got != nil {
+			t.Errorf("Expected onChange to be called with nil but got %#v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for onChange")
+	}
+	if !s.Deleted() {
+		t.Error("Expected Deleted to return true after the model was deleted")
+	}
+
+	if _, err := testModels.Sync("doesNotExist", &testModel{}, nil); err == nil {
+		t.Error("Expected an error in Sync for a model which does not exist")
+	}
+}
@@ -12,13 +12,14 @@ import (
 	"fmt"
 	"github.com/garyburd/redigo/redis"
 	"reflect"
+	"sort"
 	"strings"
 )
 
 var (
-	// modelTypeToSpec maps a registered model type to a modelSpec
+	// modelTypeToSpec maps a model type registered with the default pool to a modelSpec
 	modelTypeToSpec map[reflect.Type]*modelSpec = map[reflect.Type]*modelSpec{}
-	// modelNameToSpec maps a registered model name to a modelSpec
+	// modelNameToSpec maps a model name registered with the default pool to a modelSpec
 	modelNameToSpec map[string]*modelSpec = map[string]*modelSpec{}
 )
 
@@ -27,6 +28,8 @@ var (
 // Register and RegisterName functions to register new types.
 type ModelType struct {
 	spec *modelSpec
+	// fromMaster is true if reads should not be sent to replicas
+	fromMaster bool
 }
 
 // Name returns the name for the given ModelType. The name is a unique
@@ -44,9 +47,33 @@ func (mt *ModelType) Name() string {
 // default the name is just its type without the package prefix or dereference
 // operators. So for example, the default name corresponding to *models.User
 // would be "User". See RegisterName if you need to specify a custom name.
+// Model types registered with Register use the default pool.
 func Register(model Model) (*ModelType, error) {
+	return defaultPool.Register(model)
+}
+
+// Register is like the package-level Register function but registers the type
+// of model with p instead of the default pool.
+func (p *Pool) Register(model Model) (*ModelType, error) {
 	defaultName := getDefaultName(reflect.TypeOf(model))
-	return RegisterName(defaultName, model)
+	return p.registerName(defaultName, model)
+}
+
+// ModelOption is an option which changes the way models of a particular type
+// are stored or retrieved. ModelOptions may be passed to RegisterWithOptions.
+type ModelOption func(spec *modelSpec) error
+
+// RegisterWithOptions is like Register but also accepts one or more options
+// which change the way models of the given type are stored or retrieved.
+func RegisterWithOptions(model Model, options ...ModelOption) (*ModelType, error) {
+	return defaultPool.RegisterWithOptions(model, options...)
+}
+
+// RegisterWithOptions is like the package-level RegisterWithOptions function
+// but registers the type of model with p instead of the default pool.
+func (p *Pool) RegisterWithOptions(model Model, options ...ModelOption) (*ModelType, error) {
+	defaultName := getDefaultName(reflect.TypeOf(model))
+	return p.registerName(defaultName, model, options...)
 }
 
 // getDefaultName returns the default name for the given type, which is
@@ -68,14 +95,45 @@ func getDefaultName(typ reflect.Type) string {
 // database. Both the name and the model must be unique, i.e., not
 // already registered. The type of model must be a pointer to a struct.
 func RegisterName(name string, model Model) (*ModelType, error) {
-	// Make sure the name and type have not been previously registered
+	return defaultPool.RegisterName(name, model)
+}
+
+// RegisterName is like the package-level RegisterName function but registers
+// the type of model with p instead of the default pool.
+func (p *Pool) RegisterName(name string, model Model) (*ModelType, error) {
+	return p.registerName(name, model)
+}
+
+// Unregister removes the registration for the type of model from the default
+// pool, so that the type and its name can be registered again, e.g. with
+// different options. It is mostly useful in tests. Models of the type which are
+// already saved are not affected, and any ModelType for the type should not be
+// used after it is unregistered. Unregister returns an error if the type of
+// model is not registered.
+func Unregister(model Model) error {
+	return defaultPool.Unregister(model)
+}
+
+// Unregister is like the package-level Unregister function but removes the
+// registration from p instead of the default pool.
+func (p *Pool) Unregister(model Model) error {
 	typ := reflect.TypeOf(model)
-	switch {
-	case typeIsRegistered(typ):
-		return nil, fmt.Errorf("zoom: Error in Register or RegisterName: The type %T has already been registered.", model)
-	case nameIsRegistered(name):
-		return nil, fmt.Errorf("zoom: Error in Register or RegisterName: The name %s has already been registered.", name)
-	case !typeIsPointerToStruct(typ):
+	p.registryMu.Lock()
+	defer p.registryMu.Unlock()
+	spec, found := p.modelTypeToSpec[typ]
+	if !found {
+		return fmt.Errorf("zoom: Error in Unregister: The type %T has not been registered.", model)
+	}
+	delete(p.modelTypeToSpec, typ)
+	delete(p.modelNameToSpec, spec.name)
+	return nil
+}
+
+// registerName registers the type of model with the given name and applies
+// each option to the compiled spec.
+func (p *Pool) registerName(name string, model Model, options ...ModelOption) (*ModelType, error) {
+	typ := reflect.TypeOf(model)
+	if !typeIsPointerToStruct(typ) {
 		return nil, fmt.Errorf("zoom: Register and RegisterName require a pointer to a struct as an argument. Got type %T", model)
 	}
 
@@ -85,23 +143,115 @@ func RegisterName(name string, model Model) (*ModelType, error) {
 		return nil, err
 	}
 	spec.name = name
-	modelTypeToSpec[typ] = spec
-	modelNameToSpec[name] = spec
+	spec.pool = p
+	for _, option := range options {
+		if err := option(spec); err != nil {
+			return nil, err
+		}
+	}
+	if err := spec.checkFieldKeys(); err != nil {
+		return nil, err
+	}
+
+	// Make sure the name and type have not been previously registered. This
+	// is checked while holding the lock so that two goroutines cannot register
+	// the same type or name at once.
+	p.registryMu.Lock()
+	defer p.registryMu.Unlock()
+	if _, found := p.modelTypeToSpec[typ]; found {
+		return nil, fmt.Errorf("zoom: Error in Register or RegisterName: The type %T has already been registered.", model)
+	}
+	if _, found := p.modelNameToSpec[name]; found {
+		return nil, fmt.Errorf("zoom: Error in Register or RegisterName: The name %s has already been registered.", name)
+	}
+	p.modelTypeToSpec[typ] = spec
+	p.modelNameToSpec[name] = spec
 
 	// Return the ModelType
-	return &ModelType{spec}, nil
+	return &ModelType{spec: spec}, nil
 }
 
-func typeIsRegistered(typ reflect.Type) bool {
-	_, found := modelTypeToSpec[typ]
+// modelTypeOf returns the ModelType corresponding to the type of model
+// registered with p. It returns an error if the type of model has not been
+// registered with p.
+func (p *Pool) modelTypeOf(model Model) (*ModelType, error) {
+	spec, found := p.specForType(reflect.TypeOf(model))
+	if !found {
+		return nil, fmt.Errorf("Type %T has not been registered", model)
+	}
+	return &ModelType{spec: spec}, nil
+}
+
+func (p *Pool) typeIsRegistered(typ reflect.Type) bool {
+	_, found := p.specForType(typ)
 	return found
 }
 
-func nameIsRegistered(name string) bool {
-	_, found := modelNameToSpec[name]
+func (p *Pool) nameIsRegistered(name string) bool {
+	_, found := p.specForName(name)
 	return found
 }
 
+// specForType returns the spec for the given type if it is registered with p.
+func (p *Pool) specForType(typ reflect.Type) (*modelSpec, bool) {
+	p.registryMu.RLock()
+	defer p.registryMu.RUnlock()
+	spec, found := p.modelTypeToSpec[typ]
+	return spec, found
+}
+
+// specForName returns the spec for the type registered with p under the given
+// name, if any.
+func (p *Pool) specForName(name string) (*modelSpec, bool) {
+	p.registryMu.RLock()
+	defer p.registryMu.RUnlock()
+	spec, found := p.modelNameToSpec[name]
+	return spec, found
+}
+
+// specs returns the specs for every type registered with p, sorted by name.
+// It returns a copy, so it is safe to iterate over while other goroutines
+// register types, e.g. in background workers.
+func (p *Pool) specs() []*modelSpec {
+	p.registryMu.RLock()
+	defer p.registryMu.RUnlock()
+	specs := make([]*modelSpec, 0, len(p.modelNameToSpec))
+	for _, spec := range p.modelNameToSpec {
+		specs = append(specs, spec)
+	}
+	sort.Sort(specsByName(specs))
+	return specs
+}
+
+// specsByName sorts specs by name.
+type specsByName []*modelSpec
+
+func (s specsByName) Len() int           { return len(s) }
+func (s specsByName) Less(i, j int) bool { return s[i].name < s[j].name }
+func (s specsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// typeIsRegistered returns true iff typ has been registered with the default
+// pool or any pool created with NewPool.
+func typeIsRegistered(typ reflect.Type) bool {
+	if defaultPool.typeIsRegistered(typ) {
+		return true
+	}
+	otherPoolsMu.RLock()
+	defer otherPoolsMu.RUnlock()
+	for _, p := range otherPools {
+		if p.typeIsRegistered(typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// nameIsRegistered returns true iff name has been registered with the default
+// pool.
+func nameIsRegistered(name string) bool {
+	return defaultPool.nameIsRegistered(name)
+}
+
 // ModelKey returns the key that identifies a hash in the database
 // which contains all the fields of the model corresponding to the given
 // id. It returns an error iff id is empty.
@@ -126,16 +276,101 @@ func (mt *ModelType) FieldIndexKey(fieldName string) (string, error) {
 // database. Save throws an error if the type of model does not match the registered
 // ModelType. If the Id field of the struct is empty, Save will mutate the struct by
 // setting the Id. To make a struct satisfy the Model interface, you can embed
-// zoom.DefaultData.
+// zoom.DefaultData. If any fields with the "unique" option have the same value as
+// another model of the same type, nothing is saved and Save returns a
+// UniqueViolationError which lists every violation. If another client changes the
+// value of a unique field concurrently, Save returns a WatchError and can be retried.
 func (mt *ModelType) Save(model Model) error {
-	t := NewTransaction()
+	return runOp(&Op{Kind: SaveOp, ModelName: mt.Name(), Model: model}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.Save(mt, model)
+		if err := t.Exec(); err != nil {
+			return err
+		}
+		// The id is not known until the model is saved
+		mt.recordAccess(model.Id())
+		return nil
+	})
+}
+
+// SaveIfNotExists is like Save but only saves the model if a model with the
+// same type and id does not already exist in the database. If it does exist,
+// nothing is written and SaveIfNotExists returns an AlreadyExistsError. The
+// check is atomic: the main hash for the model is watched before checking for
+// its existence, so if another client creates the model concurrently, the
+// save will be aborted and an AlreadyExistsError will be returned. This makes
+// SaveIfNotExists suitable for idempotent creation flows.
+func (mt *ModelType) SaveIfNotExists(model Model) error {
+	return runOp(&Op{Kind: SaveOp, ModelName: mt.Name(), Model: model}, func() error {
+		return mt.saveIfNotExists(model)
+	})
+}
+
+// saveIfNotExists is like SaveIfNotExists but does not run middleware.
+func (mt *ModelType) saveIfNotExists(model Model) error {
+	if err := mt.checkModelType(model); err != nil {
+		return fmt.Errorf("zoom: Error in SaveIfNotExists: %s", err.Error())
+	}
+	if model.Id() == "" {
+		model.SetId(generateRandomId())
+	}
+	key, err := mt.ModelKey(model.Id())
+	if err != nil {
+		return err
+	}
+	t := mt.spec.pool.NewTransaction()
+	if err := t.WatchKey(key); err != nil {
+		t.conn.Close()
+		return err
+	}
+	exists, err := redis.Bool(t.conn.Do("EXISTS", key))
+	if err != nil {
+		t.conn.Close()
+		return err
+	}
+	alreadyExistsErr := AlreadyExistsError{Msg: fmt.Sprintf("%s with id = %s already exists", mt.Name(), model.Id())}
+	if exists {
+		t.conn.Close()
+		return alreadyExistsErr
+	}
 	t.Save(mt, model)
 	if err := t.Exec(); err != nil {
+		if _, ok := err.(WatchError); ok {
+			// The model was created by someone else after we checked
+			return alreadyExistsErr
+		}
 		return err
 	}
 	return nil
 }
 
+// SaveAll writes models to the redis database in a single transaction. Unlike
+// the other methods for saving, the models may be of different registered
+// types. All of the models, including any field indexes, are saved atomically
+// using MULTI/EXEC, so either all of them are saved or none of them are. SaveAll
+// returns an error if any of the models are of a type which has not been
+// registered, or if there was a problem connecting to the database.
+func SaveAll(models ...Model) error {
+	return defaultPool.SaveAll(models...)
+}
+
+// SaveAll is like the package-level SaveAll function but uses p instead of the
+// default pool. All of the models must be of types registered with p.
+func (p *Pool) SaveAll(models ...Model) error {
+	return runOp(&Op{Kind: SaveAllOp, Models: models}, func() error {
+		t := p.NewTransaction()
+		for _, model := range models {
+			mt, err := p.modelTypeOf(model)
+			if err != nil {
+				t.setError(fmt.Errorf("zoom: Error in SaveAll: %s", err.Error()))
+				break
+			}
+			t.Save(mt, model)
+		}
+		return t.Exec()
+	})
+}
+
 // Save writes a model (a struct which satisfies the Model interface) to the redis
 // database inside an existing transaction. save will set the err property of the
 // transaction if the type of model does not matched the registered ModelType, which
@@ -145,43 +380,128 @@ func (mt *ModelType) Save(model Model) error {
 // will be added to the transaction and returned as an error when the transaction is
 // executed.
 func (t *Transaction) Save(mt *ModelType, model Model) {
-	if err := mt.checkModelType(model); err != nil {
+	t.save(mt, model, expiration{ttl: mt.spec.ttl})
+}
+
+// save is like Save but sets the expiration for the model to exp. The model
+// does not expire if exp is the zero value.
+func (t *Transaction) save(mt *ModelType, model Model, exp expiration) {
+	if err := t.checkModelTypeAndPool(mt, model); err != nil {
 		t.setError(fmt.Errorf("zoom: Error in Save or Transaction.Save: %s", err.Error()))
 		return
 	}
 	// Generate id if needed
 	if model.Id() == "" {
 		model.SetId(generateRandomId())
+	} else if _, err := mt.spec.modelKey(model.Id()); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in Save or Transaction.Save: %s", err.Error()))
+		return
 	}
 	// Create a modelRef and start a transaction
 	mr := &modelRef{
 		spec:  mt.spec,
 		model: model,
 	}
+	// Fill in default values for any zero-valued fields, then compute any
+	// derived fields and run the BeforeSave hook (if any). If any of these fail,
+	// the error is set on the transaction, so nothing in it will be executed.
+	mr.setDefaults()
+	if err := mr.computeFields(); err != nil {
+		t.setError(err)
+		return
+	}
+	if err := mr.runBeforeSave(); err != nil {
+		t.setError(err)
+		return
+	}
+	// If changes are being tracked, only save the fields which have changed
+	// since the model was last found or saved
+	fields, err := mr.changedFields()
+	if err != nil {
+		t.setError(err)
+		return
+	}
+	fields = mr.withoutUnloadedFields(fields)
+	// Make sure any fields with transitions have legal values and the values
+	// of any unique fields are not already used
+	if err := t.checkTransitions(mr, fields); err != nil {
+		t.setError(err)
+		return
+	}
+	if err := t.checkUniqueFields(mr, fields); err != nil {
+		t.setError(err)
+		return
+	}
+	// Determine which fields to include in the change event (if any). This
+	// must happen before the main hash is updated, because it relies on reading
+	// the old field values.
+	eventFields, err := t.diffFields(mr, fields)
+	if err != nil {
+		t.setError(err)
+		return
+	}
 	// Save indexes
 	// This must happen first, because it relies on reading the old field values
 	// from the hash for string indexes (if any)
-	t.saveFieldIndexes(mr)
+	t.saveFieldIndexes(mr, fields)
+	// Add a record to the audit trail (if any). This must happen before the
+	// main hash is updated, because it relies on reading the old field values.
+	t.auditSave(mr, fields)
 	// Save the model fields in a hash in the database
-	hashArgs, err := mr.mainHashArgs()
+	hashArgs, err := mr.hashArgs(fields)
 	if err != nil {
 		t.setError(err)
+		return
+	}
+	if mr.spec.version != 0 {
+		hashArgs = hashArgs.Add(versionFieldName, mr.spec.version)
 	}
 	if len(hashArgs) > 1 {
 		// Only save the main hash if there are any fields
 		// The first element in hashArgs is the model key,
 		// so there are fields if the length is greater than
 		// 1.
-		t.Command("HMSET", hashArgs, nil)
+		t.Command("HMSET", hashArgs, mr.spec.newForgetTrackedHandler(mr.key(), nil))
+	}
+	if mr.spec.getNullStrategy() == NullAbsent {
+		// Remove any nil pointer fields from the main hash
+		if nilFieldNames := mr.nilFieldNames(fields); len(nilFieldNames) > 0 {
+			t.Command("HDEL", redis.Args{mr.key()}.Add(Interfaces(nilFieldNames)...), nil)
+		}
+	}
+	t.publishInvalidation(mr.spec, mr.key())
+	// Save any fields which are stored outside of the main hash
+	for _, fs := range fields {
+		if !fs.storedInHash() {
+			t.saveCollectionField(mr, fs)
+		}
+	}
+	if mr.spec.storeProtobuf {
+		t.saveProtobuf(mr)
 	}
 	// Add the model id to the set of all models of this type
-	t.Command("SADD", redis.Args{mt.AllIndexKey(), model.Id()}, nil)
+	var handler ReplyHandler
+	if mr.spec.trackChanges {
+		// Once the transaction succeeds, the model matches what is stored in
+		// the database
+		handler = newTakeSnapshotHandler(mr, mr.spec.fieldNames())
+	}
+	t.Command("SADD", redis.Args{mt.AllIndexKey(), model.Id()}, handler)
+	if !exp.isZero() {
+		t.expireModel(mr.spec, model.Id(), exp, nil)
+	}
+	t.recordChange(mr.spec, &ChangeEvent{
+		ModelName: mr.spec.name,
+		Id:        model.Id(),
+		Kind:      SaveOp,
+		Fields:    fieldSpecNames(eventFields),
+	}, model)
 }
 
 // saveFieldIndexes adds commands to the transaction for saving the indexes
-// for all indexed fields.
-func (t *Transaction) saveFieldIndexes(mr *modelRef) {
-	for _, fs := range mr.spec.fields {
+// for all indexed fields in fields.
+func (t *Transaction) saveFieldIndexes(mr *modelRef, fields []*fieldSpec) {
+	for _, fs := range fields {
 		switch fs.indexKind {
 		case noIndex:
 			continue
@@ -198,11 +518,15 @@ func (t *Transaction) saveFieldIndexes(mr *modelRef) {
 // saveNumericIndex adds commands to the transaction for saving a numeric
 // index on the given field.
 func (t *Transaction) saveNumericIndex(mr *modelRef, fs *fieldSpec) {
-	fieldValue := mr.fieldValue(fs.name)
+	fieldValue := mr.specFieldValue(fs)
 	if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
 		return
 	}
-	score := numericScore(fieldValue)
+	score, err := numericScore(fieldValue)
+	if err != nil {
+		t.setError(err)
+		return
+	}
 	indexKey, err := mr.spec.fieldIndexKey(fs.name)
 	if err != nil {
 		t.setError(err)
@@ -213,7 +537,7 @@ func (t *Transaction) saveNumericIndex(mr *modelRef, fs *fieldSpec) {
 // saveBooleanIndex adds commands to the transaction for saving a boolean
 // index on the given field.
 func (t *Transaction) saveBooleanIndex(mr *modelRef, fs *fieldSpec) {
-	fieldValue := mr.fieldValue(fs.name)
+	fieldValue := mr.specFieldValue(fs)
 	if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
 		return
 	}
@@ -229,15 +553,15 @@ func (t *Transaction) saveBooleanIndex(mr *modelRef, fs *fieldSpec) {
 // index on the given field. This includes removing the old index (if any).
 func (t *Transaction) saveStringIndex(mr *modelRef, fs *fieldSpec) {
 	// Remove the old index (if any)
-	t.deleteStringIndex(mr.spec.name, mr.model.Id(), fs.redisName)
-	fieldValue := mr.fieldValue(fs.name)
+	t.deleteStringIndex(mr.spec.keyName(), mr.model.Id(), fs.redisName)
+	fieldValue := mr.specFieldValue(fs)
 	for fieldValue.Kind() == reflect.Ptr {
 		if fieldValue.IsNil() {
 			return
 		}
 		fieldValue = fieldValue.Elem()
 	}
-	member := fieldValue.String() + nullString + mr.model.Id()
+	member := stringValue(fieldValue) + nullString + mr.model.Id()
 	indexKey, err := mr.spec.fieldIndexKey(fs.name)
 	if err != nil {
 		t.setError(err)
@@ -252,12 +576,15 @@ func (t *Transaction) saveStringIndex(mr *modelRef, fs *fieldSpec) {
 // with the given id does not exist, if the given model was the wrong type, or
 // if there was a problem connecting to the database.
 func (mt *ModelType) Find(id string, model Model) error {
-	t := NewTransaction()
-	t.Find(mt, id, model)
-	if err := t.Exec(); err != nil {
-		return err
-	}
-	return nil
+	return runOp(&Op{Kind: FindOp, ModelName: mt.Name(), Id: id, Model: model}, func() error {
+		mt.recordAccess(id)
+		if mt.spec.usesLocalCache() {
+			return mt.findTracked(id, model)
+		}
+		t := mt.newReadTransaction()
+		t.Find(mt, id, model)
+		return t.Exec()
+	})
 }
 
 // Find retrieves a model with the given id from redis and scans its values
@@ -267,7 +594,7 @@ func (mt *ModelType) Find(id string, model Model) error {
 // will be added to the transaction and returned as an error when the transaction is
 // executed.
 func (t *Transaction) Find(mt *ModelType, id string, model Model) {
-	if err := mt.checkModelType(model); err != nil {
+	if err := t.checkModelTypeAndPool(mt, model); err != nil {
 		t.setError(fmt.Errorf("zoom: Error in Find or Transaction.Find: %s", err.Error()))
 		return
 	}
@@ -277,11 +604,23 @@ func (t *Transaction) Find(mt *ModelType, id string, model Model) {
 		model: model,
 	}
 	// Get the fields from the main hash for this model
+	fieldNames, args := mr.findArgs()
+	t.Command("HMGET", args, newScanModelHandler(fieldNames, mr))
+	// Get any fields which are stored outside of the main hash
+	for _, fs := range mr.spec.collectionFields(mr.spec.fieldNames()) {
+		t.findCollectionField(mr, fs)
+	}
+}
+
+// findArgs returns the names of the fields to get from the main hash for mr
+// and the arguments for the HMGET command.
+func (mr *modelRef) findArgs() ([]string, redis.Args) {
+	fieldNames := mr.spec.hashFieldNames(mr.spec.withVersion(mr.spec.eagerFieldNames()))
 	args := redis.Args{mr.key()}
-	for _, fieldName := range mr.spec.fieldRedisNames() {
+	for _, fieldName := range mr.spec.redisNames(fieldNames) {
 		args = append(args, fieldName)
 	}
-	t.Command("HMGET", args, newScanModelHandler(mr.spec.fieldNames(), mr))
+	return fieldNames, args
 }
 
 // FindAll finds all the models of the given type. It executes the commands needed
@@ -290,16 +629,18 @@ func (t *Transaction) Find(mt *ModelType, id string, model Model) {
 // FindAll will grow or shrink the models slice as needed and if any of the models in the
 // models slice are nil, FindAll will use reflection to allocate memory for them.
 // FindAll returns an error if models is the wrong type or if there was a problem connecting
-// to the database.
+// to the database. For types with a very large number of models, see the ScanFindAll option.
 func (mt *ModelType) FindAll(models interface{}) error {
 	// Since this is somewhat type-unsafe, we need to verify that
 	// models is the correct type
-	t := NewTransaction()
-	t.FindAll(mt, models)
-	if err := t.Exec(); err != nil {
-		return err
-	}
-	return nil
+	return runOp(&Op{Kind: FindAllOp, ModelName: mt.Name(), Models: models}, func() error {
+		if mt.spec.scanBatchSize > 0 {
+			return mt.scanAll(models)
+		}
+		t := mt.newReadTransaction()
+		t.FindAll(mt, models)
+		return t.Exec()
+	})
 }
 
 // FindAll finds all the models of the given type and scans the values of the models into
@@ -316,21 +657,27 @@ func (t *Transaction) FindAll(mt *ModelType, models interface{}) {
 		t.setError(fmt.Errorf("zoom: Error in FindAll or Transaction.FindAll: %s", err.Error()))
 		return
 	}
-	sortArgs := mt.spec.sortArgs(mt.spec.allIndexKey(), mt.spec.fieldRedisNames(), 0, 0, ascendingOrder)
-	fieldNames := append(mt.spec.fieldNames(), "-")
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in FindAll or Transaction.FindAll: %s", err.Error()))
+		return
+	}
+	fieldNames := mt.spec.withVersion(mt.spec.eagerFieldNames())
+	hashFieldNames := mt.spec.hashFieldNames(fieldNames)
+	sortArgs := mt.spec.sortArgs(mt.spec.allIndexKey(), mt.spec.redisNames(hashFieldNames), 0, 0, ascendingOrder)
+	fieldNames = append(fieldNames, "-")
 	t.Command("SORT", sortArgs, newScanModelsHandler(mt.spec, fieldNames, models))
 }
 
 // Count returns the number of models of the given type that exist in the database.
 // It returns an error if there was a problem connecting to the database.
 func (mt *ModelType) Count() (int, error) {
-	t := NewTransaction()
 	count := 0
-	t.Count(mt, &count)
-	if err := t.Exec(); err != nil {
-		return count, err
-	}
-	return count, nil
+	err := runOp(&Op{Kind: CountOp, ModelName: mt.Name()}, func() error {
+		t := mt.newReadTransaction()
+		t.Count(mt, &count)
+		return t.Exec()
+	})
+	return count, err
 }
 
 // Count counts the number of models of the given type in the database in an existing
@@ -338,6 +685,10 @@ func (mt *ModelType) Count() (int, error) {
 // encountered will be added to the transaction and returned as an error when the
 // transaction is executed.
 func (t *Transaction) Count(mt *ModelType, count *int) {
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in Count or Transaction.Count: %s", err.Error()))
+		return
+	}
 	t.Command("SCARD", redis.Args{mt.AllIndexKey()}, newScanIntHandler(count))
 }
 
@@ -347,13 +698,13 @@ func (t *Transaction) Count(mt *ModelType, count *int) {
 // or not the model was found and deleted, and will only return an error
 // if there was a problem connecting to the database.
 func (mt *ModelType) Delete(id string) (bool, error) {
-	t := NewTransaction()
 	deleted := false
-	t.Delete(mt, id, &deleted)
-	if err := t.Exec(); err != nil {
-		return deleted, err
-	}
-	return deleted, nil
+	err := runOp(&Op{Kind: DeleteOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.Delete(mt, id, &deleted)
+		return t.Exec()
+	})
+	return deleted, err
 }
 
 // Delete removes a model with the given type and id in an existing transaction.
@@ -363,14 +714,39 @@ func (mt *ModelType) Delete(id string) (bool, error) {
 // added to the transaction and returned as an error when the transaction is
 // executed.
 func (t *Transaction) Delete(mt *ModelType, id string, deleted *bool) {
-	// Delete any field indexes
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in Delete or Transaction.Delete: %s", err.Error()))
+		return
+	}
+	// Add a record to the audit trail (if any) and delete any field indexes
 	// This must happen first, because it relies on reading the old field values
-	// from the hash for string indexes (if any)
+	// from the hash
+	t.auditDelete(mt, id)
 	t.deleteFieldIndexes(mt, id)
+	// Delete any fields which are stored outside of the main hash
+	for _, fs := range mt.spec.collectionFields(mt.spec.fieldNames()) {
+		t.Command("DEL", redis.Args{mt.spec.fieldKey(id, fs)}, nil)
+	}
+	if mt.spec.storeProtobuf {
+		t.Command("DEL", redis.Args{mt.spec.protobufKey(id)}, nil)
+	}
+	if mt.spec.archiveOnExpire {
+		t.Command("DEL", redis.Args{mt.spec.expiresKey(id)}, nil)
+	}
 	// Delete the main hash
-	t.Command("DEL", redis.Args{mt.Name() + ":" + id}, newScanBoolHandler(deleted))
+	key := mt.spec.keyName() + ":" + id
+	t.Command("DEL", redis.Args{key}, mt.spec.newForgetTrackedHandler(key, newScanBoolHandler(deleted)))
+	t.publishInvalidation(mt.spec, key)
 	// Remvoe the id from the index of all models for the given type
 	t.Command("SREM", redis.Args{mt.AllIndexKey(), id}, nil)
+	// Cancel any scheduled deletion
+	t.Command("ZREM", redis.Args{mt.spec.deleteScheduleKey(), id}, nil)
+	// Remove the access count (if any)
+	if mt.spec.hotKeys != nil {
+		mt.spec.hotKeys.forget(id)
+		t.Command("ZREM", redis.Args{mt.spec.hotKeysKey(), id}, nil)
+	}
+	t.recordChange(mt.spec, &ChangeEvent{ModelName: mt.spec.name, Id: id, Kind: DeleteOp}, nil)
 }
 
 // deleteFieldIndexes adds commands to the transaction for deleting the field
@@ -384,7 +760,7 @@ func (t *Transaction) deleteFieldIndexes(mt *ModelType, id string) {
 			t.deleteNumericOrBooleanIndex(fs, mt.spec, id)
 		case stringIndex:
 			// NOTE: this invokes a lua script which is defined in scripts/delete_string_index.lua
-			t.deleteStringIndex(mt.Name(), id, fs.redisName)
+			t.deleteStringIndex(mt.spec.keyName(), id, fs.redisName)
 		}
 	}
 }
@@ -399,17 +775,75 @@ func (t *Transaction) deleteNumericOrBooleanIndex(fs *fieldSpec, ms *modelSpec,
 	t.Command("ZREM", redis.Args{indexKey, modelId}, nil)
 }
 
+// Rename atomically changes the id of the model with the given type and oldId to
+// newId. The main hash, any list or set fields, the set of all ids, all field
+// indexes, the audit trail, any scheduled deletion (see DeleteAt), the access
+// count (see TrackHotKeys), and any pending coalesced change event (see
+// CoalesceChanges) are updated in a single lua script, so no other client will ever see the
+// model in an inconsistent state. Rename returns true iff a model with oldId existed
+// and was renamed. It returns an error if a model with newId already exists, if
+// either id is empty, or if there was a problem connecting to the database. Note
+// that Rename does not change the id of any model structs in memory; you will need
+// to call SetId yourself.
+func (mt *ModelType) Rename(oldId string, newId string) (bool, error) {
+	renamed := false
+	err := runOp(&Op{Kind: RenameOp, ModelName: mt.Name(), Id: oldId}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.Rename(mt, oldId, newId, &renamed)
+		return t.Exec()
+	})
+	return renamed, err
+}
+
+// Rename changes the id of the model with the given type and oldId to newId in an
+// existing transaction. renamed will be set to true iff a model with oldId existed
+// and was renamed when the transaction is executed. See ModelType.Rename for more
+// information. Any errors encountered will be added to the transaction and returned
+// as an error when the transaction is executed.
+func (t *Transaction) Rename(mt *ModelType, oldId string, newId string, renamed *bool) {
+	if oldId == "" || newId == "" {
+		t.setError(fmt.Errorf("zoom: Error in Rename: ids cannot be empty"))
+		return
+	}
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in Rename: %s", err.Error()))
+		return
+	}
+	if _, err := mt.spec.modelKey(newId); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in Rename: %s", err.Error()))
+		return
+	}
+	// Encrypted values are bound to the key of the model, so they need to be
+	// encrypted again for the new key after the model is renamed
+	encryptedArgs, err := t.reencryptForRename(mt.spec, oldId, newId)
+	if err != nil {
+		t.setError(fmt.Errorf("zoom: Error in Rename: %s", err.Error()))
+		return
+	}
+	if mt.spec.hotKeys != nil {
+		// The count which has already been sent is moved by the script
+		mt.spec.hotKeys.forget(oldId)
+	}
+	oldKey, newKey := mt.spec.keyName()+":"+oldId, mt.spec.keyName()+":"+newId
+	t.renameModel(mt.spec, oldId, newId, mt.spec.newForgetTrackedHandler(oldKey, mt.spec.newForgetTrackedHandler(newKey, newScanBoolHandler(renamed))))
+	if encryptedArgs != nil {
+		t.Command("HMSET", encryptedArgs, nil)
+	}
+	t.publishInvalidation(mt.spec, oldKey)
+	t.publishInvalidation(mt.spec, newKey)
+}
+
 // DeleteAll deletes all the models of the given type in a single transaction. See
 // http://redis.io/topics/transactions. It returns the number of models deleted
 // and an error if there was a problem connecting to the database.
 func (mt *ModelType) DeleteAll() (int, error) {
-	t := NewTransaction()
 	count := 0
-	t.DeleteAll(mt, &count)
-	if err := t.Exec(); err != nil {
-		return count, err
-	}
-	return count, nil
+	err := runOp(&Op{Kind: DeleteAllOp, ModelName: mt.Name()}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.DeleteAll(mt, &count)
+		return t.Exec()
+	})
+	return count, err
 }
 
 // DeleteAll delets all models for the given model type in an existing transaction.
@@ -417,7 +851,31 @@ func (mt *ModelType) DeleteAll() (int, error) {
 // when the transaction is executed. Any errors encountered will be added to the transaction
 // and returned as an error when the transaction is executed.
 func (t *Transaction) DeleteAll(mt *ModelType, count *int) {
-	t.deleteModelsBySetIds(mt.AllIndexKey(), mt.Name(), newScanIntHandler(count))
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in DeleteAll or Transaction.DeleteAll: %s", err.Error()))
+		return
+	}
+	collectionFieldNames := []string{}
+	for _, fs := range mt.spec.collectionFields(mt.spec.fieldNames()) {
+		collectionFieldNames = append(collectionFieldNames, fs.redisName)
+	}
+	if mt.spec.storeProtobuf {
+		// The protobuf key uses the same format as a collection field key
+		collectionFieldNames = append(collectionFieldNames, protobufKeySuffix)
+	}
+	if mt.spec.archiveOnExpire {
+		collectionFieldNames = append(collectionFieldNames, expiresKeySuffix)
+	}
+	t.deleteModelsBySetIds(mt.AllIndexKey(), mt.spec.keyName(), mt.spec.newForgetAllTrackedHandler(newScanIntHandler(count)), collectionFieldNames...)
+	t.Command("DEL", redis.Args{mt.spec.deleteScheduleKey()}, nil)
+	if mt.spec.coalescer != nil {
+		t.Command("DEL", redis.Args{mt.spec.coalesceWindowKey(), mt.spec.coalescedEventsKey()}, nil)
+	}
+	if mt.spec.hotKeys != nil {
+		t.Command("DEL", redis.Args{mt.spec.hotKeysKey()}, nil)
+	}
+	t.publishInvalidation(mt.spec, "*")
+	t.recordChange(mt.spec, &ChangeEvent{ModelName: mt.spec.name, Kind: DeleteAllOp}, nil)
 }
 
 // checkModelType returns an error iff model is not of the registered type that
@@ -8,6 +8,7 @@
 package zoom
 
 import (
+	"github.com/garyburd/redigo/redis"
 	"reflect"
 	"testing"
 )
@@ -49,6 +50,56 @@ func TestRegisterName(t *testing.T) {
 	delete(modelTypeToSpec, regTestModels.spec.typ)
 }
 
+func TestUnregister(t *testing.T) {
+	regTestModels, err := Register(&regTestModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	if err := Unregister(&regTestModel{}); err != nil {
+		t.Fatalf("Unexpected error in Unregister: %s", err.Error())
+	}
+	if nameIsRegistered(regTestModels.Name()) || typeIsRegistered(regTestModels.spec.typ) {
+		t.Error("Expected type to not be registered after Unregister")
+	}
+	if err := Unregister(&regTestModel{}); err == nil {
+		t.Error("Expected error unregistering a type which is not registered but got none")
+	}
+	// The type should be able to be registered again
+	if _, err := Register(&regTestModel{}); err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	if err := Unregister(&regTestModel{}); err != nil {
+		t.Fatalf("Unexpected error in Unregister: %s", err.Error())
+	}
+}
+
+func TestRegisterConcurrently(t *testing.T) {
+	pool, err := NewPool(&Configuration{})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	// Read the registry from another goroutine the same way background workers
+	// (e.g. an ExpirationListener) do while types are registered. Run with
+	// -race to detect unsynchronized access.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			pool.specs()
+			pool.RegisteredTypes()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := pool.Register(&regTestModel{}); err != nil {
+			t.Fatalf("Unexpected error in Register: %s", err.Error())
+		}
+		if err := pool.Unregister(&regTestModel{}); err != nil {
+			t.Fatalf("Unexpected error in Unregister: %s", err.Error())
+		}
+	}
+	<-done
+}
+
 func testRegisteredModelType(t *testing.T, modelType *ModelType, expectedName string, expectedType reflect.Type) {
 	// Check that the name and type are correct
 	if modelType.Name() != expectedName {
@@ -79,6 +130,8 @@ func testRegisteredModelType(t *testing.T, modelType *ModelType, expectedName st
 			kind:      primativeField,
 			name:      "Int",
 			redisName: "Int",
+			index:     []int{1},
+			redisTags: []string{""},
 			typ:       reflect.TypeOf(1),
 			indexKind: noIndex,
 		},
@@ -86,6 +139,8 @@ func testRegisteredModelType(t *testing.T, modelType *ModelType, expectedName st
 			kind:      primativeField,
 			name:      "Bool",
 			redisName: "Bool",
+			index:     []int{2},
+			redisTags: []string{""},
 			typ:       reflect.TypeOf(true),
 			indexKind: noIndex,
 		},
@@ -93,6 +148,8 @@ func testRegisteredModelType(t *testing.T, modelType *ModelType, expectedName st
 			kind:      primativeField,
 			name:      "String",
 			redisName: "String",
+			index:     []int{3},
+			redisTags: []string{""},
 			typ:       reflect.TypeOf(""),
 			indexKind: noIndex,
 		},
@@ -126,6 +183,58 @@ func TestSave(t *testing.T) {
 	expectFieldEquals(t, key, "Bool", model.Bool)
 }
 
+func TestSaveIfNotExists(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// The first time, the model should be saved
+	model := createTestModels(1)[0]
+	if err := testModels.SaveIfNotExists(model); err != nil {
+		t.Errorf("Unexpected error in testModels.SaveIfNotExists: %s", err.Error())
+	}
+	expectModelExists(t, testModels, model)
+
+	// The second time, we expect an AlreadyExistsError and the stored
+	// fields should not change
+	modelCopy := &testModel{Int: model.Int + 1, String: model.String, Bool: model.Bool}
+	modelCopy.SetId(model.Id())
+	err := testModels.SaveIfNotExists(modelCopy)
+	if err == nil {
+		t.Fatal("Expected an AlreadyExistsError but got nil")
+	}
+	if _, ok := err.(AlreadyExistsError); !ok {
+		t.Errorf("Expected an AlreadyExistsError but got: %T: %s", err, err.Error())
+	}
+	key, _ := testModels.ModelKey(model.Id())
+	expectFieldEquals(t, key, "Int", model.Int)
+}
+
+func TestSaveAll(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Create and save models of two different types
+	model := createTestModels(1)[0]
+	indexedModel := createIndexedTestModels(1)[0]
+	if err := SaveAll(model, indexedModel); err != nil {
+		t.Errorf("Unexpected error in SaveAll: %s", err.Error())
+	}
+
+	// Make sure both models were saved correctly
+	expectModelExists(t, testModels, model)
+	expectModelExists(t, indexedTestModels, indexedModel)
+	expectIndexExists(t, indexedTestModels, indexedModel, "Int")
+
+	// If any model is of an unregistered type, nothing should be saved
+	otherModel := createTestModels(1)[0]
+	if err := SaveAll(otherModel, &regTestModel{}); err == nil {
+		t.Error("Expected an error when saving an unregistered type but got none")
+	}
+	if otherModel.Id() != "" {
+		expectModelDoesNotExist(t, testModels, otherModel)
+	}
+}
+
 func TestFind(t *testing.T) {
 	testingSetUp()
 	defer testingTearDown()
@@ -288,3 +397,77 @@ func TestDeleteAll(t *testing.T) {
 	// Make sure the models were deleted
 	expectModelsDoNotExist(t, testModels, Models(models))
 }
+
+func TestRename(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Create and save some indexed test models
+	models, err := createAndSaveIndexedTestModels(2)
+	if err != nil {
+		t.Fatalf("Unexpected error saving test models: %s", err.Error())
+	}
+	model := models[0]
+	oldId := model.Id()
+	newId := "renamed" + oldId
+
+	// Rename the first model
+	renamed, err := indexedTestModels.Rename(oldId, newId)
+	if err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	if !renamed {
+		t.Error("Expected renamed to be true but got false")
+	}
+
+	// The model and all of its indexes should have moved to the new id
+	expectKeyDoesNotExist(t, indexedTestModels.spec.name+":"+oldId)
+	expectSetDoesNotContain(t, indexedTestModels.AllIndexKey(), oldId)
+	model.SetId(newId)
+	expectModelExists(t, indexedTestModels, model)
+	for _, fieldName := range []string{"Int", "String", "Bool"} {
+		expectIndexExists(t, indexedTestModels, model, fieldName)
+	}
+
+	// Renaming to an id that already exists should cause an error
+	if _, err := indexedTestModels.Rename(newId, models[1].Id()); err == nil {
+		t.Error("Expected an error when renaming to an existing id but got none")
+	}
+
+	// Renaming a model that does not exist should return false
+	renamed, err = indexedTestModels.Rename(oldId, "foo")
+	if err != nil {
+		t.Errorf("Unexpected error in Rename: %s", err.Error())
+	}
+	if renamed {
+		t.Error("Expected renamed to be false but got true")
+	}
+}
+
+func TestRenameNilIndexedFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Nil pointers are stored as the null sentinel but are not indexed, so they
+	// should still not be indexed after the model is renamed
+	model := &indexedPointersModel{}
+	if err := indexedPointersModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if _, err := indexedPointersModels.Rename(model.Id(), "renamed"+model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	indexKey, err := indexedPointersModels.FieldIndexKey("String")
+	if err != nil {
+		t.Fatalf("Unexpected error in FieldIndexKey: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	count, err := redis.Int(conn.Do("ZCARD", indexKey))
+	if err != nil {
+		t.Fatalf("Unexpected error in ZCARD: %s", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("Expected the string index to be empty after Rename but it had %d members", count)
+	}
+}
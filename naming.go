@@ -0,0 +1,119 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File naming.go contains code related to deriving the names of
+// fields in redis from the names of struct fields.
+
+package zoom
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NamingStrategy converts the name of a struct field into the name of the
+// corresponding field in redis. It is only used for fields without a redis
+// struct tag. For the fields of nested structs with the flatten option, it
+// is applied to the name of each struct field separately.
+type NamingStrategy func(fieldName string) string
+
+var (
+	// namingStrategy is the NamingStrategy for model types which did not specify
+	// one. If nil, struct field names are used as is. It must only be accessed
+	// via getNamingStrategy and SetNamingStrategy.
+	namingStrategy   NamingStrategy
+	namingStrategyMu sync.RWMutex
+)
+
+// reservedRedisNames maps the redis names which cannot be used for fields to
+// a description of what they are used for instead.
+var reservedRedisNames = map[string]string{
+	"-":              "the id of the model",
+	versionFieldName: "the schema version of the model",
+}
+
+// SetNamingStrategy sets the NamingStrategy for all model types which do not
+// specify their own with UseNamingStrategy. It only affects model types which
+// are registered after it is called. If strategy is nil, struct field names are
+// used as is, which is the default.
+func SetNamingStrategy(strategy NamingStrategy) {
+	namingStrategyMu.Lock()
+	namingStrategy = strategy
+	namingStrategyMu.Unlock()
+}
+
+// getNamingStrategy returns the NamingStrategy set with SetNamingStrategy.
+func getNamingStrategy() NamingStrategy {
+	namingStrategyMu.RLock()
+	defer namingStrategyMu.RUnlock()
+	return namingStrategy
+}
+
+// UseNamingStrategy is a ModelOption which sets the NamingStrategy for a model
+// type, overriding the one set with SetNamingStrategy.
+func UseNamingStrategy(strategy NamingStrategy) ModelOption {
+	return func(spec *modelSpec) error {
+		return spec.setRedisNames(strategy)
+	}
+}
+
+// LowerCase is a NamingStrategy which converts field names to lower case, e.g.
+// "UserID" becomes "userid".
+func LowerCase(fieldName string) string {
+	return strings.ToLower(fieldName)
+}
+
+// SnakeCase is a NamingStrategy which converts field names to snake case, e.g.
+// "UserID" becomes "user_id" and "HTTPServer" becomes "http_server".
+func SnakeCase(fieldName string) string {
+	runes := []rune(fieldName)
+	result := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word if the previous rune was lower case or a digit, or if
+			// this is the last upper case rune in an acronym followed by a lower case
+			// rune (e.g. the "S" in "HTTPServer")
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) && runes[i-1] != '_' ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+				result = append(result, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		result = append(result, r)
+	}
+	return string(result)
+}
+
+// setRedisNames sets the redis name of every field in ms using the given
+// strategy. Redis struct tags take precedence over strategy. It returns an
+// error if two fields would have the same redis name or if the redis name for
+// a field is reserved by zoom.
+func (ms *modelSpec) setRedisNames(strategy NamingStrategy) error {
+	fieldsByRedisName := map[string]*fieldSpec{}
+	for _, fs := range ms.fields {
+		goNames := strings.Split(fs.name, ".")
+		parts := make([]string, len(goNames))
+		for i, goName := range goNames {
+			switch {
+			case fs.redisTags[i] != "":
+				parts[i] = fs.redisTags[i]
+			case strategy != nil:
+				parts[i] = strategy(goName)
+			default:
+				parts[i] = goName
+			}
+		}
+		fs.redisName = strings.Join(parts, ".")
+		if use, found := reservedRedisNames[fs.redisName]; found {
+			return fmt.Errorf("zoom: the redis name for %s.%s cannot be %q because that name is used for %s", ms.typ.Elem().Name(), fs.name, fs.redisName, use)
+		}
+		if other, found := fieldsByRedisName[fs.redisName]; found {
+			return fmt.Errorf("zoom: %s.%s and %s.%s cannot both have the redis name %q", ms.typ.Elem().Name(), other.name, ms.typ.Elem().Name(), fs.name, fs.redisName)
+		}
+		fieldsByRedisName[fs.redisName] = fs
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File naming_test.go tests the code in naming.go, i.e. deriving
+// the names of fields in redis.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	testCases := map[string]string{
+		"Name":       "name",
+		"FirstName":  "first_name",
+		"UserID":     "user_id",
+		"HTTPServer": "http_server",
+		"Address2":   "address2",
+		"Field2Name": "field2_name",
+		"Already_ok": "already_ok",
+	}
+	for input, expected := range testCases {
+		if got := SnakeCase(input); got != expected {
+			t.Errorf("SnakeCase(%q) was incorrect. Expected %q but got %q", input, expected, got)
+		}
+	}
+}
+
+func TestUseNamingStrategy(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	type location struct {
+		ZipCode string
+	}
+	type namingModel struct {
+		FirstName string `zoom:"index"`
+		UserID    int
+		Custom    string   `redis:"CUSTOM"`
+		HomeAddr  location `zoom:"flatten"`
+		DefaultData
+	}
+	namingModels, err := RegisterWithOptions(&namingModel{}, UseNamingStrategy(SnakeCase))
+	if err != nil {
+		t.Fatalf("Unexpected error in RegisterWithOptions: %s", err.Error())
+	}
+	model := &namingModel{
+		FirstName: randomString(),
+		UserID:    randomInt(),
+		Custom:    randomString(),
+		HomeAddr:  location{ZipCode: randomString()},
+	}
+	if err := namingModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	key, _ := namingModels.ModelKey(model.Id())
+	expectFieldEquals(t, key, "first_name", model.FirstName)
+	expectFieldEquals(t, key, "user_id", model.UserID)
+	expectFieldEquals(t, key, "CUSTOM", model.Custom)
+	expectFieldEquals(t, key, "home_addr.zip_code", model.HomeAddr.ZipCode)
+	expectIndexExists(t, namingModels, model, "FirstName")
+}
+
+func TestRedisNameConflicts(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	type duplicateTagModel struct {
+		First  string `redis:"name"`
+		Second string `redis:"name"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&duplicateTagModel{})); err == nil {
+		t.Error("Expected an error for fields with the same redis name but got none")
+	}
+	type reservedTagModel struct {
+		Version int `redis:"-version"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&reservedTagModel{})); err == nil {
+		t.Error("Expected an error for a field with a reserved redis name but got none")
+	}
+	// A NamingStrategy can also cause a conflict
+	type duplicateStrategyModel struct {
+		UserID string
+		Userid string
+		DefaultData
+	}
+	if _, err := RegisterWithOptions(&duplicateStrategyModel{}, UseNamingStrategy(LowerCase)); err == nil {
+		t.Error("Expected an error for fields with the same redis name after applying the NamingStrategy but got none")
+	}
+}
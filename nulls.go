@@ -0,0 +1,68 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File nulls.go contains code related to storing nil pointer fields.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// NullStrategy determines how nil pointer fields are stored in the main hash.
+// In all cases, a pointer field which points to a zero value (e.g. an empty
+// string) is stored as that zero value, so it can be distinguished from nil.
+type NullStrategy int
+
+const (
+	// NullSentinel stores nil pointers as a sentinel string, which is "NULL" by
+	// default and can be changed with the NullSentinel config option. A pointer
+	// to a value equal to the sentinel will be found as nil, so you should choose
+	// a sentinel which will not collide with legitimate data.
+	NullSentinel NullStrategy = iota + 1
+	// NullAbsent removes nil pointers from the main hash (using HDEL), so there
+	// is no chance of a collision. Note that a model which only has nil fields
+	// will have no main hash at all and cannot be found.
+	NullAbsent
+)
+
+// UseNullStrategy is a ModelOption which sets the NullStrategy for a model type,
+// overriding the NullStrategy config option.
+func UseNullStrategy(strategy NullStrategy) ModelOption {
+	return func(spec *modelSpec) error {
+		if strategy != NullSentinel && strategy != NullAbsent {
+			return fmt.Errorf("zoom: UseNullStrategy called with invalid NullStrategy: %d", strategy)
+		}
+		spec.nullStrategy = strategy
+		return nil
+	}
+}
+
+// getNullStrategy returns the NullStrategy for the model type, falling back to
+// the global one if none was specified.
+func (ms *modelSpec) getNullStrategy() NullStrategy {
+	if ms.nullStrategy != 0 {
+		return ms.nullStrategy
+	}
+	return getSettings().nullStrategy
+}
+
+// fieldIsNil returns true iff the field identified by fs is a nil pointer.
+func (mr *modelRef) fieldIsNil(fs *fieldSpec) bool {
+	fieldVal := mr.specFieldValue(fs)
+	return fieldVal.Kind() == reflect.Ptr && fieldVal.IsNil()
+}
+
+// nilFieldNames returns the redis names of all the fields in fields which are
+// stored in the main hash and are nil pointers.
+func (mr *modelRef) nilFieldNames(fields []*fieldSpec) []string {
+	names := []string{}
+	for _, fs := range fields {
+		if fs.storedInHash() && mr.fieldIsNil(fs) {
+			names = append(names, fs.redisName)
+		}
+	}
+	return names
+}
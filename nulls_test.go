@@ -0,0 +1,81 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File nulls_test.go tests the code in nulls.go, i.e. storing nil
+// pointer fields.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"testing"
+)
+
+// nullsModel is a model type that is only used for testing NullStrategy
+type nullsModel struct {
+	Nil   *string
+	Empty *string
+	Null  *string
+	Int   *int
+	Map   *map[string]int
+	DefaultData
+}
+
+func TestNullStrategies(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	for _, strategy := range []NullStrategy{NullSentinel, NullAbsent} {
+		strategy := strategy
+		t.Run(fmt.Sprintf("strategy %d", strategy), func(t *testing.T) {
+			nullsModels := registerTestType(t, &nullsModel{}, UseNullStrategy(strategy))
+			empty, null, zero := "", "NULL", 0
+			model := &nullsModel{
+				Empty: &empty,
+				Null:  &null,
+				Int:   &zero,
+			}
+			if err := nullsModels.Save(model); err != nil {
+				t.Fatalf("Unexpected error in Save: %s", err.Error())
+			}
+
+			key, _ := nullsModels.ModelKey(model.Id())
+			conn := NewConn()
+			exists, err := redis.Bool(conn.Do("HEXISTS", key, "Nil"))
+			conn.Close()
+			if err != nil {
+				t.Fatalf("Unexpected error in HEXISTS: %s", err.Error())
+			}
+			if expected := strategy == NullSentinel; exists != expected {
+				t.Errorf("Expected HEXISTS for nil field to be %v with strategy %d but got %v", expected, strategy, exists)
+			}
+
+			// Nil and zero values should be distinguishable. With NullAbsent, a pointer
+			// to the string "NULL" should also be distinguishable from nil.
+			modelCopy := &nullsModel{}
+			if err := nullsModels.Find(model.Id(), modelCopy); err != nil {
+				t.Fatalf("Unexpected error in Find: %s", err.Error())
+			}
+			if strategy == NullSentinel {
+				model.Null = nil
+			}
+			if !reflect.DeepEqual(model, modelCopy) {
+				t.Errorf("Found model was incorrect with strategy %d.\nExpected: %+v\nGot:      %+v", strategy, model, modelCopy)
+			}
+		})
+	}
+}
+
+func TestFindNonexistentModel(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	if err := testModels.Find("doesNotExist", &testModel{}); err == nil {
+		t.Error("Expected error when finding a model that does not exist but got none")
+	} else if _, ok := err.(ModelNotFoundError); !ok {
+		t.Errorf("Expected a ModelNotFoundError but got %T: %s", err, err.Error())
+	}
+}
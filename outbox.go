@@ -0,0 +1,231 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File outbox.go contains code related to the transactional outbox,
+// which records messages in the same transaction as a change and
+// relays them to pub/sub channels or streams later.
+
+package zoom
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// outboxKeySuffix is appended to the KeyPrefix for a pool to get the key for
+// the list which holds its outbox.
+const outboxKeySuffix = "zoom:outbox"
+
+// outboxBatchSize is the maximum number of messages sent by a single call to
+// the dispatch_outbox script.
+const outboxBatchSize = 100
+
+// OutboxTarget is the kind of destination for an OutboxMessage.
+type OutboxTarget string
+
+const (
+	// PubSubTarget means the payload is published to a pub/sub channel.
+	PubSubTarget OutboxTarget = "pubsub"
+	// StreamTarget means the payload is added to a stream under the field
+	// "payload". Requires redis version 5.0 or higher.
+	StreamTarget OutboxTarget = "stream"
+)
+
+// OutboxMessage is a message which is recorded in the outbox in the same
+// transaction as a change to the database, and later sent to its destination
+// by an OutboxDispatcher. See ModelType.SaveWithOutbox.
+type OutboxMessage struct {
+	// Target is the kind of destination. Default: PubSubTarget
+	Target OutboxTarget `json:"target"`
+	// Destination is the name of the channel or the key of the stream (without
+	// the KeyPrefix) to send the payload to.
+	Destination string `json:"destination"`
+	// Payload is the content of the message.
+	Payload string `json:"payload"`
+}
+
+// OutboxKey returns the key for the list which holds the messages in the outbox
+// for the default pool that have not been dispatched yet.
+func OutboxKey() string {
+	return defaultPool.OutboxKey()
+}
+
+// OutboxKey returns the key for the list which holds the messages in the outbox
+// for p that have not been dispatched yet, i.e. zoom:outbox with the KeyPrefix
+// (if any) prepended.
+func (p *Pool) OutboxKey() string {
+	return p.getState().keyPrefix + outboxKeySuffix
+}
+
+// SaveWithOutbox is like Save but also appends the given messages to the outbox
+// in the same transaction. Either the model is saved and the messages are
+// recorded, or neither happens, so a message can never be lost if the save
+// succeeded (or sent if it failed), even if the process crashes right after.
+// The messages are sent by an OutboxDispatcher (see StartOutboxDispatcher).
+func (mt *ModelType) SaveWithOutbox(model Model, messages ...OutboxMessage) error {
+	return runOp(&Op{Kind: SaveOp, ModelName: mt.Name(), Model: model}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.Save(mt, model)
+		t.AppendOutbox(messages...)
+		return t.Exec()
+	})
+}
+
+// AppendOutbox appends the given messages to the outbox when the transaction is
+// executed. It can be combined with any other commands in the transaction, and
+// the messages are only recorded if the transaction succeeds. See
+// ModelType.SaveWithOutbox.
+func (t *Transaction) AppendOutbox(messages ...OutboxMessage) {
+	if len(messages) == 0 {
+		return
+	}
+	args := []interface{}{t.pool.OutboxKey()}
+	for _, message := range messages {
+		if message.Target == "" {
+			message.Target = PubSubTarget
+		}
+		if message.Target != PubSubTarget && message.Target != StreamTarget {
+			t.setError(fmt.Errorf("zoom: Error in AppendOutbox: invalid target %q", message.Target))
+			return
+		}
+		if message.Destination == "" {
+			t.setError(fmt.Errorf("zoom: Error in AppendOutbox: destination cannot be empty"))
+			return
+		}
+		message.Destination = t.pool.getState().keyPrefix + message.Destination
+		encoded, err := json.Marshal(message)
+		if err != nil {
+			t.setError(fmt.Errorf("zoom: Error in AppendOutbox: %s", err.Error()))
+			return
+		}
+		args = append(args, encoded)
+	}
+	t.Command("RPUSH", args, nil)
+}
+
+// FailedOutboxKey returns the key for the list which holds the messages in the
+// outbox for the default pool that could not be sent. See
+// Pool.FailedOutboxKey.
+func FailedOutboxKey() string {
+	return defaultPool.FailedOutboxKey()
+}
+
+// FailedOutboxKey returns the key for the list which holds the messages in the
+// outbox for p that could not be sent, e.g. because the destination for a
+// StreamTarget message holds some other type of value. Each message is encoded
+// as JSON. Failed messages are not retried.
+func (p *Pool) FailedOutboxKey() string {
+	return p.OutboxKey() + ":failed"
+}
+
+// OutboxDispatcher periodically sends the messages in the outbox to their
+// destinations. It is created with StartOutboxDispatcher.
+type OutboxDispatcher struct {
+	pool     *Pool
+	interval time.Duration
+	// err is the first error encountered by the dispatcher
+	err   error
+	errMu sync.Mutex
+	// stop is closed to stop the dispatcher and done is closed when it has
+	// stopped
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// StartOutboxDispatcher starts an OutboxDispatcher for the default pool. See
+// Pool.StartOutboxDispatcher.
+func StartOutboxDispatcher(interval time.Duration) (*OutboxDispatcher, error) {
+	return defaultPool.StartOutboxDispatcher(interval)
+}
+
+// StartOutboxDispatcher starts a background goroutine which sends the messages
+// in the outbox for p to their destinations every interval, in the order they
+// were recorded. Each message is removed from the outbox and sent in a single
+// lua script, so it is sent exactly once even if more than one dispatcher is
+// running. Note that a message which is published to a pub/sub channel is only
+// received by clients which are subscribed when it is dispatched. Messages
+// which cannot be sent are moved to the list returned by FailedOutboxKey. The
+// dispatcher runs until Close is called.
+func (p *Pool) StartOutboxDispatcher(interval time.Duration) (*OutboxDispatcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("zoom: Error in StartOutboxDispatcher: interval must be positive but got %s", interval)
+	}
+	d := &OutboxDispatcher{
+		pool:     p,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d, nil
+}
+
+// run dispatches the messages in the outbox every interval until d is closed.
+func (d *OutboxDispatcher) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			if err := d.pool.dispatchOutbox(d.stop); err != nil {
+				d.setError(err)
+			}
+		}
+	}
+}
+
+// dispatchOutbox sends the messages in the outbox for p in batches until the
+// outbox is empty or stop is closed.
+func (p *Pool) dispatchOutbox(stop <-chan struct{}) error {
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		count := 0
+		t := p.NewTransaction()
+		t.dispatchOutbox(p.OutboxKey(), p.FailedOutboxKey(), outboxBatchSize, newScanIntHandler(&count))
+		if err := t.Exec(); err != nil {
+			return fmt.Errorf("zoom: Error in OutboxDispatcher: %s", err.Error())
+		}
+		if count < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+// setError sets the error for d if it does not already have one.
+func (d *OutboxDispatcher) setError(err error) {
+	d.errMu.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.errMu.Unlock()
+}
+
+// Err returns the first error encountered by the dispatcher, if any. Errors do
+// not stop the dispatcher, and if the outbox could not be read, the messages
+// in it are tried again after the next interval.
+func (d *OutboxDispatcher) Err() error {
+	d.errMu.Lock()
+	defer d.errMu.Unlock()
+	return d.err
+}
+
+// Close stops the dispatcher and waits for it to finish sending the current
+// batch of messages (if any). It returns the same error as Err.
+func (d *OutboxDispatcher) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+	})
+	<-d.done
+	return d.Err()
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File outbox_test.go tests the code in outbox.go.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"testing"
+	"time"
+)
+
+func TestSaveWithOutbox(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Subscribe to the channel before the message is dispatched
+	psc := redis.PubSubConn{Conn: NewConn()}
+	defer psc.Close()
+	if err := psc.Subscribe("outboxChannel"); err != nil {
+		t.Fatalf("Unexpected error in Subscribe: %s", err.Error())
+	}
+	if _, ok := psc.Receive().(redis.Subscription); !ok {
+		t.Fatal("Expected a subscription confirmation")
+	}
+
+	model := createTestModels(1)[0]
+	messages := []OutboxMessage{
+		{Destination: "outboxChannel", Payload: "created " + model.Id()},
+		{Target: StreamTarget, Destination: "outboxStream", Payload: "created " + model.Id()},
+	}
+	if err := testModels.SaveWithOutbox(model, messages...); err != nil {
+		t.Fatalf("Unexpected error in SaveWithOutbox: %s", err.Error())
+	}
+	expectModelExists(t, testModels, model)
+	conn := NewConn()
+	defer conn.Close()
+	if length, err := redis.Int(conn.Do("LLEN", OutboxKey())); err != nil {
+		t.Fatalf("Unexpected error in LLEN: %s", err.Error())
+	} else if length != len(messages) {
+		t.Errorf("Expected %d messages in the outbox but got %d", len(messages), length)
+	}
+
+	d, err := StartOutboxDispatcher(time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error in StartOutboxDispatcher: %s", err.Error())
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			t.Errorf("Unexpected error in OutboxDispatcher.Close: %s", err.Error())
+		}
+	}()
+	switch reply := psc.Receive().(type) {
+	case redis.Message:
+		if string(reply.Data) != messages[0].Payload {
+			t.Errorf("Expected payload %q but got %q", messages[0].Payload, string(reply.Data))
+		}
+	case error:
+		t.Fatalf("Unexpected error in Receive: %s", reply.Error())
+	default:
+		t.Fatalf("Unexpected reply from Receive: %#v", reply)
+	}
+	entries, err := redis.Values(conn.Do("XRANGE", "outboxStream", "-", "+"))
+	if err != nil {
+		t.Fatalf("Unexpected error in XRANGE: %s", err.Error())
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry in the stream but got %d", len(entries))
+	}
+	if length, err := redis.Int(conn.Do("LLEN", OutboxKey())); err != nil {
+		t.Fatalf("Unexpected error in LLEN: %s", err.Error())
+	} else if length != 0 {
+		t.Errorf("Expected the outbox to be empty but got %d messages", length)
+	}
+}
+
+func TestSaveWithOutboxInvalidMessage(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	model := createTestModels(1)[0]
+	err := testModels.SaveWithOutbox(model, OutboxMessage{Target: "email", Destination: "someone"})
+	if err == nil {
+		t.Fatal("Expected an error for an invalid target")
+	}
+	// Neither the model nor the message should have been saved
+	expectModelDoesNotExist(t, testModels, model)
+	conn := NewConn()
+	defer conn.Close()
+	if length, err := redis.Int(conn.Do("LLEN", OutboxKey())); err != nil {
+		t.Fatalf("Unexpected error in LLEN: %s", err.Error())
+	} else if length != 0 {
+		t.Errorf("Expected the outbox to be empty but got %d messages", length)
+	}
+}
+
+func TestDispatchOutboxFailed(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	conn := NewConn()
+	defer conn.Close()
+	// A stream message cannot be sent to a key which holds a string
+	if _, err := conn.Do("SET", "notAStream", "foo"); err != nil {
+		t.Fatalf("Unexpected error in SET: %s", err.Error())
+	}
+	t1 := NewTransaction()
+	t1.AppendOutbox(
+		OutboxMessage{Target: StreamTarget, Destination: "notAStream", Payload: "lost"},
+		OutboxMessage{Target: StreamTarget, Destination: "outboxStream", Payload: "sent"},
+	)
+	if err := t1.Exec(); err != nil {
+		t.Fatalf("Unexpected error in Exec: %s", err.Error())
+	}
+	if err := defaultPool.dispatchOutbox(nil); err != nil {
+		t.Fatalf("Unexpected error in dispatchOutbox: %s", err.Error())
+	}
+	if length, err := redis.Int(conn.Do("LLEN", FailedOutboxKey())); err != nil {
+		t.Fatalf("Unexpected error in LLEN: %s", err.Error())
+	} else if length != 1 {
+		t.Errorf("Expected 1 failed message but got %d", length)
+	}
+	if length, err := redis.Int(conn.Do("XLEN", "outboxStream")); err != nil {
+		t.Fatalf("Unexpected error in XLEN: %s", err.Error())
+	} else if length != 1 {
+		t.Errorf("Expected 1 entry in the stream but got %d", length)
+	}
+}
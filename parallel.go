@@ -0,0 +1,113 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File parallel.go contains code related to finding the models which
+// match a query with more than one concurrent worker.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Parallel causes the models which match the query to be found by up to workers
+// concurrent goroutines when the query is run, each of which finds batchSize
+// models at a time in its own transaction. By default, all of the models are
+// found with a single SORT command, which is processed serially on one
+// connection and blocks the database while it runs. For queries which match
+// thousands of models, using more than one worker can greatly improve
+// throughput on multi-core clients. The ids are found first, and then the models are found in
+// separate transactions, so unlike the default, the results are not read
+// atomically. A model which is deleted after its id was found is skipped.
+// Parallel has no effect on Count or Ids. Parallel will set an error on the
+// query if workers or batchSize is 0.
+func (q *Query) Parallel(workers uint, batchSize uint) *Query {
+	if workers == 0 || batchSize == 0 {
+		q.setError(fmt.Errorf("zoom: error in Query.Parallel: workers and batchSize must be positive but got %d and %d", workers, batchSize))
+		return q
+	}
+	q.workers = workers
+	q.batchSize = batchSize
+	return q
+}
+
+// hasParallel returns true iff the Parallel modifier was used.
+func (q *Query) hasParallel() bool {
+	return q.workers > 0
+}
+
+// runParallel is like run but finds the ids first and then finds the models in
+// batches with q.workers concurrent workers. See Parallel.
+func (q *Query) runParallel(newTransaction func() *Transaction, models interface{}) error {
+	ids, err := q.ids(newTransaction)
+	if err != nil {
+		return err
+	}
+	modelsVal := reflect.ValueOf(models).Elem()
+	if modelsVal.Kind() != reflect.Slice {
+		return fmt.Errorf("zoom: Error in Query.Run: models should be a pointer to a slice when using Parallel")
+	}
+	// Each worker writes to a separate range of results, so no lock is needed.
+	// Models which no longer exist are left as nil.
+	results := reflect.MakeSlice(modelsVal.Type(), len(ids), len(ids))
+	batchSize := int(q.batchSize)
+	batches := make(chan int)
+	errs := make(chan error, q.workers)
+	var wg sync.WaitGroup
+	for i := uint(0); i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				stop := start + batchSize
+				if stop > len(ids) {
+					stop = len(ids)
+				}
+				t := newTransaction()
+				q.findBatch(t, ids[start:stop], results.Slice(start, stop))
+				if err := t.Exec(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	// Stop handing out batches after the first error, since the results will
+	// not be used
+	var runErr error
+	for start := 0; start < len(ids) && runErr == nil; start += batchSize {
+		select {
+		case batches <- start:
+		case runErr = <-errs:
+		}
+	}
+	close(batches)
+	wg.Wait()
+	if runErr == nil {
+		select {
+		case runErr = <-errs:
+		default:
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	found := reflect.MakeSlice(modelsVal.Type(), 0, len(ids))
+	for i := 0; i < results.Len(); i++ {
+		if model := results.Index(i); !model.IsNil() {
+			found = reflect.Append(found, model)
+		}
+	}
+	modelsVal.Set(found)
+	return nil
+}
+
+// findBatch adds commands to t which find the models with the given ids and
+// scan the fields included in the query into the corresponding elements of
+// dest. See modelSpec.findBatch.
+func (q *Query) findBatch(t *Transaction, ids []string, dest reflect.Value) {
+	q.modelSpec.findBatch(t, q.fieldNames(), ids, dest)
+}
@@ -0,0 +1,218 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File pipeline.go contains code related to pipelines, which send
+// several independent operations to the database in a single round
+// trip.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sync"
+)
+
+// Pipeline queues operations (e.g. Find and Save) and sends them to the
+// database all at once when Flush is called, which requires only a single
+// round trip. Unlike a Transaction, the operations in a Pipeline are not atomic
+// and each one succeeds or fails independently. Each method returns a Future
+// which can be used to check whether that operation succeeded after Flush is
+// called. Values are scanned into the arguments (e.g. the model passed to Find)
+// when Flush is called. A Pipeline may be reused after it is flushed, but it is
+// not safe for concurrent use.
+type Pipeline struct {
+	pool    *Pool
+	actions []*Action
+	futures []*Future
+}
+
+// Future is the result of a single operation in a Pipeline. It is not ready
+// until Flush has been called on the Pipeline. It is safe to check a Future
+// from a different goroutine than the one which flushes the Pipeline.
+type Future struct {
+	// done is closed when the operation has finished. err must not be changed
+	// after that.
+	done     chan struct{}
+	doneOnce sync.Once
+	err      error
+}
+
+// newFuture returns a Future which is not done.
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// Done returns true iff the operation has finished, i.e. if Flush has been
+// called or if there was an error while adding the operation to the Pipeline.
+func (f *Future) Done() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Err returns the first error that occurred during the operation, if any. It
+// returns an error if the operation has not finished yet.
+func (f *Future) Err() error {
+	if !f.Done() {
+		return fmt.Errorf("zoom: Error in Future.Err: Flush has not been called on the Pipeline")
+	}
+	return f.err
+}
+
+// Wait waits for the operation to finish and then returns the first error that
+// occurred during the operation, if any. For a Pipeline, it waits forever if
+// Flush is never called, so it is mostly useful for an AutoPipeline, which is
+// flushed in the background.
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// setError sets f.err iff it was not already set. It must not be called after
+// finish.
+func (f *Future) setError(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// finish marks the operation as finished. It is safe to call more than once.
+func (f *Future) finish() {
+	f.doneOnce.Do(func() {
+		close(f.done)
+	})
+}
+
+// NewPipeline instantiates and returns a new pipeline which uses the default
+// pool.
+func NewPipeline() *Pipeline {
+	return defaultPool.NewPipeline()
+}
+
+// NewPipeline instantiates and returns a new pipeline which uses p. Any
+// ModelTypes passed to the methods of the pipeline should be registered with p.
+func (p *Pool) NewPipeline() *Pipeline {
+	return &Pipeline{pool: p}
+}
+
+// queue calls fn with a transaction which is only used to collect actions and
+// then adds the actions to the pipeline. It returns a Future for the actions.
+func (pl *Pipeline) queue(fn func(t *Transaction)) *Future {
+	t := &Transaction{pool: pl.pool}
+	fn(t)
+	f := newFuture()
+	if t.err != nil {
+		f.err = t.err
+		f.finish()
+		return f
+	}
+	if len(t.actions) == 0 {
+		f.finish()
+		return f
+	}
+	for _, a := range t.actions {
+		pl.actions = append(pl.actions, a)
+		pl.futures = append(pl.futures, f)
+	}
+	return f
+}
+
+// Save queues an operation which saves model. See ModelType.Save.
+func (pl *Pipeline) Save(mt *ModelType, model Model) *Future {
+	return pl.queue(func(t *Transaction) { t.Save(mt, model) })
+}
+
+// Find queues an operation which finds the model with the given id and scans
+// its values into model. See ModelType.Find.
+func (pl *Pipeline) Find(mt *ModelType, id string, model Model) *Future {
+	return pl.queue(func(t *Transaction) { t.Find(mt, id, model) })
+}
+
+// FindAll queues an operation which finds all models of the given type and
+// scans their values into models. See ModelType.FindAll.
+func (pl *Pipeline) FindAll(mt *ModelType, models interface{}) *Future {
+	return pl.queue(func(t *Transaction) { t.FindAll(mt, models) })
+}
+
+// Count queues an operation which counts the number of models of the given
+// type and sets the value of count. See ModelType.Count.
+func (pl *Pipeline) Count(mt *ModelType, count *int) *Future {
+	return pl.queue(func(t *Transaction) { t.Count(mt, count) })
+}
+
+// Delete queues an operation which deletes the model with the given id and
+// sets the value of deleted to true iff the model existed. See
+// ModelType.Delete.
+func (pl *Pipeline) Delete(mt *ModelType, id string, deleted *bool) *Future {
+	return pl.queue(func(t *Transaction) { t.Delete(mt, id, deleted) })
+}
+
+// Command queues an arbitrary redis command. handler will be called with the
+// reply when Flush is called. It may be nil.
+func (pl *Pipeline) Command(name string, args redis.Args, handler ReplyHandler) *Future {
+	return pl.queue(func(t *Transaction) { t.Command(name, args, handler) })
+}
+
+// Flush sends all of the queued operations to the database in a single round
+// trip and then calls the handlers for each reply, scanning the results into
+// the arguments given for each operation. Each Future returned for the queued
+// operations is ready after Flush returns. Flush returns the first error that
+// occurred in any of the operations (if any), but an error in one operation
+// does not prevent the others from running. After Flush returns, the pipeline
+// is empty and can be reused.
+func (pl *Pipeline) Flush() error {
+	actions, futures := pl.actions, pl.futures
+	pl.actions, pl.futures = nil, nil
+	if len(actions) == 0 {
+		return nil
+	}
+	defer func() {
+		for _, f := range futures {
+			f.finish()
+		}
+	}()
+	conn := pl.pool.NewConn()
+	defer conn.Close()
+	t := &Transaction{conn: conn}
+	for _, a := range actions {
+		if err := t.sendAction(a); err != nil {
+			return failFutures(futures, err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return failFutures(futures, err)
+	}
+	var firstErr error
+	for i, a := range actions {
+		reply, err := conn.Receive()
+		if err == nil && a.handler != nil {
+			err = a.handler(reply)
+		}
+		if err != nil {
+			futures[i].setError(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			if conn.Err() != nil {
+				// The connection is broken, so none of the remaining replies
+				// can be received
+				failFutures(futures[i:], err)
+				return firstErr
+			}
+		}
+	}
+	return firstErr
+}
+
+// failFutures sets the error for each future and returns err.
+func failFutures(futures []*Future, err error) error {
+	for _, f := range futures {
+		f.setError(err)
+	}
+	return err
+}
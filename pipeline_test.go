@@ -0,0 +1,70 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File pipeline_test.go tests the code in pipeline.go, i.e.
+// sending several operations in a single round trip.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models := createTestModels(2)
+	pl := NewPipeline()
+	saves := []*Future{}
+	for _, model := range models {
+		saves = append(saves, pl.Save(testModels, model))
+	}
+	if saves[0].Done() {
+		t.Error("Expected Future to not be done before Flush")
+	}
+	if err := saves[0].Err(); err == nil {
+		t.Error("Expected error from Future.Err before Flush but got none")
+	}
+	if err := pl.Flush(); err != nil {
+		t.Fatalf("Unexpected error in Flush: %s", err.Error())
+	}
+	for i, f := range saves {
+		if err := f.Err(); err != nil {
+			t.Errorf("Unexpected error in Save for model %d: %s", i, err.Error())
+		}
+	}
+
+	// Find the models along with one that does not exist. The missing model
+	// should not prevent the others from being found.
+	modelCopies := []*testModel{{}, {}}
+	finds := []*Future{}
+	for i, model := range models {
+		finds = append(finds, pl.Find(testModels, model.Id(), modelCopies[i]))
+	}
+	missing := pl.Find(testModels, "doesNotExist", &testModel{})
+	count := 0
+	counted := pl.Count(testModels, &count)
+	if err := pl.Flush(); err == nil {
+		t.Error("Expected error from Flush but got none")
+	}
+	if _, ok := missing.Err().(ModelNotFoundError); !ok {
+		t.Errorf("Expected ModelNotFoundError but got: %T: %v", missing.Err(), missing.Err())
+	}
+	for i, f := range finds {
+		if err := f.Err(); err != nil {
+			t.Errorf("Unexpected error in Find for model %d: %s", i, err.Error())
+		}
+	}
+	if !reflect.DeepEqual(models, modelCopies) {
+		t.Errorf("Found models were incorrect.\nExpected: %+v\nGot:      %+v", models, modelCopies)
+	}
+	if err := counted.Err(); err != nil {
+		t.Errorf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != len(models) {
+		t.Errorf("Expected count to be %d but got %d", len(models), count)
+	}
+}
@@ -9,28 +9,272 @@
 package zoom
 
 import (
+	"fmt"
 	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// pool is a pool of redis connections
-var pool *redis.Pool
+// Pool is a pool of connections to a single redis database along with the
+// model types which have been registered with it. Most applications only need
+// the default pool, which is initialized by Init and used by the package-level
+// functions (Register, NewConn, NewTransaction, etc.). If you need to talk to
+// more than one redis server or database from the same process, use NewPool to
+// create additional pools and register model types with them directly. Each
+// ModelType is bound to the Pool it was registered with, so the same struct
+// type may be registered with more than one Pool.
+type Pool struct {
+	// waitCount and waitDuration are accessed atomically and must be first
+	// to guarantee 64-bit alignment
+	waitCount    int64
+	waitDuration int64
+	nextReplica  uint32
+	// closed is set to 1 when p is closed and back to 0 when it is initialized
+	// again. It is accessed atomically.
+	closed int32
+	// state holds the drivers and options for p. It is replaced as a whole
+	// whenever p is initialized, so it must only be accessed via getState.
+	state   *poolState
+	stateMu sync.RWMutex
+	// tracker holds the local cache for types which use client tracking. It
+	// is started the first time it is needed.
+	tracker   *tracker
+	trackerMu sync.Mutex
+	// connectionHooks are called when there is a problem with a connection
+	connectionHooks []ConnectionHooks
+	// changeEventHooks are called before a change event is recorded
+	changeEventHooks []ChangeEventHook
+	// modelTypeToSpec maps a registered model type to a modelSpec
+	modelTypeToSpec map[reflect.Type]*modelSpec
+	// modelNameToSpec maps a registered model name to a modelSpec
+	modelNameToSpec map[string]*modelSpec
+	// registryMu protects modelTypeToSpec and modelNameToSpec, which may be
+	// read by background workers (e.g. an ExpirationListener) while types are
+	// being registered. The maps must only be accessed while holding it.
+	registryMu sync.RWMutex
+}
+
+// poolState holds the drivers and options for a Pool which are set when the
+// Pool is initialized. A poolState is never modified after it is created.
+type poolState struct {
+	// driver is used to get connections to the master
+	driver Driver
+	// replicas are used for reads if ReplicaAddresses was not empty
+	replicas []Driver
+	// networkRetries is the number of times transactions are retried if
+	// there is a network error
+	networkRetries int
+	// config is the configuration used to initialize the pool
+	config *Configuration
+	// keyPrefix is prepended to every key
+	keyPrefix string
+	// maxActive and wait are used to collect statistics. See Stats.
+	maxActive int
+	wait      bool
+}
+
+// defaultPool is the pool used by the package-level functions. It shares its
+// registry with the global modelTypeToSpec and modelNameToSpec maps.
+var defaultPool = &Pool{
+	modelTypeToSpec: modelTypeToSpec,
+	modelNameToSpec: modelNameToSpec,
+}
+
+// otherPools holds every pool created with NewPool so that functions which do
+// not have access to a specific pool (e.g. Models) can check whether a type
+// has been registered with any of them.
+var otherPools = []*Pool{}
+
+// otherPoolsMu protects otherPools, which may be read by functions which check
+// the registry while another goroutine creates a pool.
+var otherPoolsMu sync.RWMutex
+
+// NewPool creates and returns a new Pool which is independent of the default
+// pool and any other pools. It accepts a Configuration struct as an argument.
+// Any zero values in the configuration will fallback to their default values.
+// Note that only the options related to connecting to the database apply to
+// the new pool. The other options (e.g. MarshalerUnmarshaler and
+// EncryptionKey) are package-wide and are only set by Init.
+func NewPool(config *Configuration) (*Pool, error) {
+	config = parseConfig(config)
+	if err := applyURL(config); err != nil {
+		return nil, err
+	}
+	p := &Pool{
+		modelTypeToSpec: map[reflect.Type]*modelSpec{},
+		modelNameToSpec: map[string]*modelSpec{},
+	}
+	if err := p.init(config); err != nil {
+		return nil, err
+	}
+	otherPoolsMu.Lock()
+	otherPools = append(otherPools, p)
+	otherPoolsMu.Unlock()
+	return p, nil
+}
+
+// init creates the drivers used by p with the given configuration. If p was
+// already initialized, the new drivers replace the old ones, which are closed.
+// Connections which were already taken from the old drivers remain usable until
+// they are closed.
+func (p *Pool) init(config *Configuration) error {
+	state, err := p.newState(config)
+	if err != nil {
+		return err
+	}
+	return p.setState(state)
+}
+
+// newState creates the drivers for p with the given configuration and returns
+// them in a new poolState without changing p.
+func (p *Pool) newState(config *Configuration) (*poolState, error) {
+	driver := config.Driver
+	if driver == nil {
+		redisPool, err := p.newRedisPool(config)
+		if err != nil {
+			return nil, err
+		}
+		driver = redisPool
+	}
+	replicas, err := p.newReplicaPools(config)
+	if err != nil {
+		return nil, err
+	}
+	state := &poolState{
+		driver:         driver,
+		replicas:       replicas,
+		config:         config,
+		keyPrefix:      config.KeyPrefix,
+		maxActive:      config.MaxActive,
+		wait:           config.Wait,
+		networkRetries: config.NetworkRetries,
+	}
+	if state.networkRetries < 0 {
+		state.networkRetries = 0
+	}
+	return state, nil
+}
+
+// setState replaces the state of p with the given state and closes the drivers
+// in the old state, if any. If WaitForConnection is true in the configuration
+// for the new state, it then waits for the database to be reachable.
+func (p *Pool) setState(state *poolState) error {
+	p.stateMu.Lock()
+	oldState := p.state
+	p.state = state
+	p.stateMu.Unlock()
+	atomic.StoreInt32(&p.closed, 0)
+	if oldState != nil {
+		p.closeState(oldState, state)
+	}
+	if state.config.WaitForConnection {
+		return p.Ping()
+	}
+	return nil
+}
+
+// getState returns the current state of p. If p is the default pool and Init
+// has not been called yet, it initializes the default pool with the default
+// configuration.
+func (p *Pool) getState() *poolState {
+	p.stateMu.RLock()
+	state := p.state
+	p.stateMu.RUnlock()
+	if state == nil && p == defaultPool {
+		return initDefaultPool()
+	}
+	return state
+}
+
+// isClosed returns true iff p has been closed and not initialized again.
+func (p *Pool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
 
-// initPool initializes the pool with the given parameters
-func initPool(network string, address string, database int, password string) {
-	pool = &redis.Pool{
-		MaxIdle:     10,
-		MaxActive:   0,
-		IdleTimeout: 240 * time.Second,
+// closeState closes the drivers in oldState which are not also used by
+// newState. It also stops the tracker for p, since it holds connections from
+// the old driver.
+func (p *Pool) closeState(oldState *poolState, newState *poolState) {
+	p.trackerMu.Lock()
+	tr := p.tracker
+	p.tracker = nil
+	p.trackerMu.Unlock()
+	if tr != nil {
+		p.stopTracker(tr)
+	}
+	if oldState.driver != newState.driver {
+		oldState.driver.Close()
+	}
+	for _, replica := range oldState.replicas {
+		replica.Close()
+	}
+}
+
+// dialWithRetries calls dial until it succeeds or policy.MaxAttempts attempts
+// have been made, waiting between attempts according to policy. It returns the
+// error from the last attempt if none succeeded.
+func dialWithRetries(policy RetryPolicy, dial func() (redis.Conn, error)) (redis.Conn, error) {
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(policy.backoff(attempt))
+		}
+		var c redis.Conn
+		if c, err = dial(); err == nil {
+			return c, nil
+		}
+	}
+	return nil, err
+}
+
+// Ping checks that the database for p is reachable using the PING command.
+func (p *Pool) Ping() error {
+	conn := p.NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		return fmt.Errorf("zoom: Error connecting to database: %s", err.Error())
+	}
+	return nil
+}
+
+// newRedisPool creates a redis pool with the given configuration. It returns an
+// error if any of the options for the pool are negative.
+func (p *Pool) newRedisPool(config *Configuration) (*redis.Pool, error) {
+	if config.MaxIdle < 0 || config.MaxActive < 0 {
+		return nil, fmt.Errorf("zoom: MaxIdle and MaxActive cannot be negative but got %d and %d", config.MaxIdle, config.MaxActive)
+	}
+	if config.IdleTimeout < 0 {
+		return nil, fmt.Errorf("zoom: IdleTimeout cannot be negative but got %s", config.IdleTimeout)
+	}
+	network, address := config.Network, config.Address
+	database, username, password := config.Database, config.Username, config.Password
+	dialOptions, err := newDialOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	return &redis.Pool{
+		MaxIdle:      config.MaxIdle,
+		MaxActive:    config.MaxActive,
+		IdleTimeout:  config.IdleTimeout,
+		Wait:         config.Wait,
+		TestOnBorrow: p.newHealthCheck(config.HealthCheckInterval),
 		Dial: func() (redis.Conn, error) {
 			// Connect to config.Address using config.Network
-			c, err := redis.Dial(network, address)
+			c, err := dialWithRetries(config.DialRetryPolicy, func() (redis.Conn, error) {
+				return redis.Dial(network, address, dialOptions...)
+			})
 			if err != nil {
 				return nil, err
 			}
 			// If a password was provided, use the AUTH command to authenticate
 			if password != "" {
-				_, err = c.Do("AUTH", password)
+				if username != "" {
+					_, err = c.Do("AUTH", username, password)
+				} else {
+					_, err = c.Do("AUTH", password)
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -42,13 +286,70 @@ func initPool(network string, address string, database int, password string) {
 			}
 			return c, err
 		},
+	}, nil
+}
+
+// newDialOptions returns the options passed to redis.Dial for the given
+// configuration
+func newDialOptions(config *Configuration) ([]redis.DialOption, error) {
+	dialOptions := []redis.DialOption{}
+	if config.ConnectTimeout != 0 {
+		dialOptions = append(dialOptions, redis.DialConnectTimeout(config.ConnectTimeout))
+	}
+	if config.ReadTimeout != 0 {
+		dialOptions = append(dialOptions, redis.DialReadTimeout(config.ReadTimeout))
+	}
+	if config.WriteTimeout != 0 {
+		dialOptions = append(dialOptions, redis.DialWriteTimeout(config.WriteTimeout))
+	}
+	if config.KeepAlive != 0 {
+		dialOptions = append(dialOptions, redis.DialKeepAlive(config.KeepAlive))
+	}
+	if config.NetDial != nil {
+		dialOptions = append(dialOptions, redis.DialNetDial(config.NetDial))
+	}
+	if config.UseTLS {
+		tlsConfig, err := buildTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		dialOptions = append(dialOptions, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
+	}
+	return append(dialOptions, config.DialOptions...), nil
+}
+
+// NewConn gets a connection from the pool and returns it. It can be used
+// for directly interacting with the database. See
+// http://godoc.org/github.com/garyburd/redigo/redis for full documentation
+// on the redis.Conn type.
+func (p *Pool) NewConn() redis.Conn {
+	return p.checkConn(p.getConn())
+}
+
+// Close closes the pool, including any connections to replicas. Any model
+// types registered with p can no longer be used after it is closed.
+func (p *Pool) Close() error {
+	atomic.StoreInt32(&p.closed, 1)
+	p.trackerMu.Lock()
+	tr := p.tracker
+	p.trackerMu.Unlock()
+	if tr != nil {
+		p.stopTracker(tr)
+	}
+	state := p.getState()
+	err := state.driver.Close()
+	for _, replica := range state.replicas {
+		if replicaErr := replica.Close(); err == nil {
+			err = replicaErr
+		}
 	}
+	return err
 }
 
-// NewConn gets a connection from the connection pool and returns it.
+// NewConn gets a connection from the default connection pool and returns it.
 // It can be used for directly interacting with the database. See
 // http://godoc.org/github.com/garyburd/redigo/redis for full documentation
 // on the redis.Conn type.
 func NewConn() redis.Conn {
-	return pool.Get()
+	return defaultPool.NewConn()
 }
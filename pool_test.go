@@ -0,0 +1,371 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File pool_test.go tests the code in pool.go, i.e. using more
+// than one independent connection pool.
+
+package zoom
+
+import (
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPool(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Create a second pool which uses a different database
+	otherDatabase := *database + 1
+	otherPool, err := NewPool(&Configuration{
+		Address:  *address,
+		Network:  *network,
+		Database: otherDatabase,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	defer func() {
+		conn := otherPool.NewConn()
+		if _, err := conn.Do("FLUSHDB"); err != nil {
+			t.Errorf("Unexpected error in FLUSHDB: %s", err.Error())
+		}
+		conn.Close()
+		otherPool.Close()
+		removeLastPool()
+	}()
+	conn := otherPool.NewConn()
+	n, err := redis.Int(conn.Do("DBSIZE"))
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error in DBSIZE: %s", err.Error())
+	}
+	if n != 0 {
+		t.Skipf("Database #%d is not empty, skipping", otherDatabase)
+	}
+
+	// The same type which is registered with the default pool should be able
+	// to be registered with the new pool
+	otherTestModels, err := otherPool.Register(&testModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	model := createTestModels(1)[0]
+	if err := otherTestModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The model should only exist in the database used by the new pool
+	if count, err := testModels.Count(); err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	} else if count != 0 {
+		t.Errorf("Expected 0 models in the default pool but got %d", count)
+	}
+	modelCopy := &testModel{}
+	if err := otherTestModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	testingSetUp()
+
+	dials := 0
+	dialPool, err := NewPool(&Configuration{
+		Address:        *address,
+		Network:        *network,
+		Database:       *database,
+		ConnectTimeout: time.Second,
+		ReadTimeout:    time.Second,
+		WriteTimeout:   time.Second,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			dials++
+			return net.Dial(network, addr)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	defer func() {
+		dialPool.Close()
+		removeLastPool()
+	}()
+	conn := dialPool.NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Fatalf("Unexpected error in PING: %s", err.Error())
+	}
+	if dials != 1 {
+		t.Errorf("Expected NetDial to be called once but got %d", dials)
+	}
+}
+
+func TestPoolTuningOptions(t *testing.T) {
+	tunedPool, err := NewPool(&Configuration{
+		Address:     *address,
+		Network:     *network,
+		Database:    *database,
+		MaxIdle:     3,
+		MaxActive:   7,
+		IdleTimeout: 30 * time.Second,
+		Wait:        true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	defer func() {
+		tunedPool.Close()
+		removeLastPool()
+	}()
+	redisPool, ok := tunedPool.Driver().(*redis.Pool)
+	if !ok {
+		t.Fatalf("Expected Driver to return a *redis.Pool but got %T", tunedPool.Driver())
+	}
+	if redisPool.MaxIdle != 3 {
+		t.Errorf("Expected MaxIdle to be 3 but got %d", redisPool.MaxIdle)
+	}
+	if redisPool.MaxActive != 7 {
+		t.Errorf("Expected MaxActive to be 7 but got %d", redisPool.MaxActive)
+	}
+	if redisPool.IdleTimeout != 30*time.Second {
+		t.Errorf("Expected IdleTimeout to be 30s but got %s", redisPool.IdleTimeout)
+	}
+	if !redisPool.Wait {
+		t.Error("Expected Wait to be true but got false")
+	}
+
+	// Negative values are invalid
+	invalidConfigs := map[string]*Configuration{
+		"negative MaxIdle":     {MaxIdle: -1},
+		"negative MaxActive":   {MaxActive: -1},
+		"negative IdleTimeout": {IdleTimeout: -time.Second},
+	}
+	for desc, config := range invalidConfigs {
+		if _, err := NewPool(config); err == nil {
+			t.Errorf("Expected an error in NewPool with %s but got none", desc)
+		}
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	prefixPool, err := NewPool(&Configuration{
+		Address:   *address,
+		Network:   *network,
+		Database:  *database,
+		KeyPrefix: "myapp:",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	defer func() {
+		prefixPool.Close()
+		removeLastPool()
+	}()
+	prefixModels, err := prefixPool.Register(&indexedTestModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	model := createIndexedTestModels(1)[0]
+	if err := prefixModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// Every key should start with the prefix
+	conn := NewConn()
+	defer conn.Close()
+	keys, err := redis.Strings(conn.Do("KEYS", "*"))
+	if err != nil {
+		t.Fatalf("Unexpected error in KEYS: %s", err.Error())
+	}
+	if len(keys) == 0 {
+		t.Error("Expected some keys to be created but got none")
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "myapp:indexedTestModel:") {
+			t.Errorf("Expected key %q to start with the prefix", key)
+		}
+	}
+
+	// Queries and DeleteAll should also use the prefix
+	gotModels := []*indexedTestModel{}
+	if err := prefixModels.NewQuery().Filter("String =", model.String).Run(&gotModels); err != nil {
+		t.Fatalf("Unexpected error in Run: %s", err.Error())
+	}
+	if len(gotModels) != 1 {
+		t.Errorf("Expected 1 model from Run but got %d", len(gotModels))
+	}
+	if count, err := prefixModels.DeleteAll(); err != nil {
+		t.Fatalf("Unexpected error in DeleteAll: %s", err.Error())
+	} else if count != 1 {
+		t.Errorf("Expected DeleteAll to delete 1 model but got %d", count)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	testingSetUp()
+
+	statsPool, err := NewPool(&Configuration{
+		Address:   *address,
+		Network:   *network,
+		Database:  *database,
+		MaxActive: 1,
+		Wait:      true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	defer func() {
+		statsPool.Close()
+		removeLastPool()
+	}()
+	conn := statsPool.NewConn()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Fatalf("Unexpected error in PING: %s", err.Error())
+	}
+	if stats := statsPool.Stats(); stats.ActiveCount != 1 || stats.IdleCount != 0 {
+		t.Errorf("Expected 1 active and 0 idle connections but got %+v", stats)
+	}
+
+	// Getting another connection should wait until the first is closed
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		conn.Close()
+	}()
+	otherConn := statsPool.NewConn()
+	otherConn.Close()
+	stats := statsPool.Stats()
+	if stats.WaitCount != 1 {
+		t.Errorf("Expected WaitCount to be 1 but got %d", stats.WaitCount)
+	}
+	if stats.WaitDuration <= 0 {
+		t.Errorf("Expected WaitDuration to be positive but got %s", stats.WaitDuration)
+	}
+	if stats.IdleCount != 1 {
+		t.Errorf("Expected 1 idle connection but got %d", stats.IdleCount)
+	}
+}
+
+func TestDialWithRetries(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	newDial := func(failures int) func() (redis.Conn, error) {
+		return func() (redis.Conn, error) {
+			if failures > 0 {
+				failures--
+				return nil, errors.New("connection refused")
+			}
+			calls := 0
+			return brokenConn{calls: &calls}, nil
+		}
+	}
+	if _, err := dialWithRetries(policy, newDial(2)); err != nil {
+		t.Errorf("Unexpected error in dialWithRetries: %s", err.Error())
+	}
+	if _, err := dialWithRetries(policy, newDial(3)); err == nil {
+		t.Error("Expected error from dialWithRetries when every attempt fails but got none")
+	}
+}
+
+// closeRecordingDriver is a Driver used for testing. Its connections always
+// return err, and it records whether it was closed.
+type closeRecordingDriver struct {
+	errorDriver
+	closed bool
+}
+
+func (d *closeRecordingDriver) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestReinit(t *testing.T) {
+	// Restore the original configuration when we're done. Note that getState
+	// lazily initializes the default pool if needed.
+	originalConfig := *defaultPool.getState().config
+	defer func() {
+		if err := Init(&originalConfig); err != nil {
+			t.Fatalf("Unexpected error in Init: %s", err.Error())
+		}
+	}()
+
+	first := &closeRecordingDriver{errorDriver: errorDriver{err: errors.New("first")}}
+	if err := Init(&Configuration{Driver: first}); err != nil {
+		t.Fatalf("Unexpected error in Init: %s", err.Error())
+	}
+	firstConn := NewConn()
+	defer firstConn.Close()
+	if _, err := firstConn.Do("PING"); err == nil || err.Error() != "first" {
+		t.Errorf("Expected connection from the first driver but got error: %v", err)
+	}
+
+	// Calling Init again should replace and close the first driver, but
+	// connections which were already in use should continue to work.
+	second := &closeRecordingDriver{errorDriver: errorDriver{err: errors.New("second")}}
+	if err := Init(&Configuration{Driver: second}); err != nil {
+		t.Fatalf("Unexpected error in Init: %s", err.Error())
+	}
+	if !first.closed {
+		t.Error("Expected the first driver to be closed after calling Init again")
+	}
+	if second.closed {
+		t.Error("Expected the second driver to not be closed")
+	}
+	if driver := defaultPool.Driver(); driver != second {
+		t.Errorf("Expected Driver to return the second driver but got %v", driver)
+	}
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err == nil || err.Error() != "second" {
+		t.Errorf("Expected connection from the second driver but got error: %v", err)
+	}
+	if _, err := firstConn.Do("PING"); err == nil || err.Error() != "first" {
+		t.Errorf("Expected existing connection to still use the first driver but got error: %v", err)
+	}
+}
+
+func TestReinitInvalidConfig(t *testing.T) {
+	originalConfig := *defaultPool.getState().config
+	defer func() {
+		if err := Init(&originalConfig); err != nil {
+			t.Fatalf("Unexpected error in Init: %s", err.Error())
+		}
+	}()
+
+	first := &closeRecordingDriver{errorDriver: errorDriver{err: errors.New("first")}}
+	if err := Init(&Configuration{Driver: first}); err != nil {
+		t.Fatalf("Unexpected error in Init: %s", err.Error())
+	}
+	settings := getSettings()
+
+	// An invalid configuration should leave the previous driver and settings in
+	// place
+	second := &closeRecordingDriver{errorDriver: errorDriver{err: errors.New("second")}}
+	err := Init(&Configuration{
+		Driver:        second,
+		NullSentinel:  "nil",
+		EncryptionKey: []byte("too short"),
+	})
+	if err == nil {
+		t.Fatal("Expected error in Init with an invalid EncryptionKey but got none")
+	}
+	if first.closed {
+		t.Error("Expected the first driver to not be closed after Init failed")
+	}
+	if driver := defaultPool.Driver(); driver != first {
+		t.Errorf("Expected Driver to return the first driver but got %v", driver)
+	}
+	if got := getSettings(); got != settings {
+		t.Errorf("Expected settings to be unchanged after Init failed but got %+v", got)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File prepared.go contains code related to preparing queries which
+// are run many times, possibly with different filter values.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+)
+
+// Placeholder can be passed to Query.Filter instead of a value to create a
+// parameterized query. The actual value is given as an argument each time the
+// query is run, after preparing it with Query.Prepare.
+type Placeholder struct{}
+
+// PreparedQuery is a query whose plan has been computed ahead of time, so that
+// running it many times is cheaper than building and running an equivalent
+// Query each time. The keys for each index, the prefixes for temporary keys,
+// and the arguments for SORT are all computed once by Query.Prepare. Unlike a
+// Query, a PreparedQuery is safe for concurrent use.
+type PreparedQuery struct {
+	query *Query
+	// baseKey holds the ids which the filters are applied to. If orderIndexKey
+	// is not empty, the ids are first extracted from the string index at
+	// orderIndexKey into a temporary key which starts with orderKeyPrefix.
+	baseKey        string
+	orderIndexKey  string
+	orderKeyPrefix string
+	// filterKeyPrefix is the prefix for the temporary key which holds the ids
+	// which match all the filters
+	filterKeyPrefix string
+	filters         []preparedFilter
+	numParams       int
+	// runSortArgs and idsSortArgs are the arguments for SORT, not including the
+	// key, when running the query and when getting only the ids respectively
+	runSortArgs redis.Args
+	idsSortArgs redis.Args
+	// scanFieldNames are the field names for scanning the reply to SORT
+	scanFieldNames []string
+}
+
+// preparedFilter is a filter along with the keys it uses.
+type preparedFilter struct {
+	filter filter
+	// param is the index of the argument which holds the value for the filter,
+	// or -1 if the filter does not have a Placeholder value. paramType is the
+	// type which the argument must have.
+	param     int
+	paramType reflect.Type
+	// fieldIndexKey is the key for the index on the field, and keyPrefix is the
+	// prefix for the temporary key which holds the ids that match the filter
+	fieldIndexKey string
+	keyPrefix     string
+}
+
+// Prepare computes the plan for q and returns a PreparedQuery which can be run
+// many times without computing it again. Any filters with a Placeholder value
+// are parameters, and the values for them are given as arguments each time the
+// prepared query is run, in the same order as the filters were added. Changing
+// q after calling Prepare does not affect the PreparedQuery. Prepare returns
+// the first error that occurred during the lifetime of q (if any). The Parallel
+// modifier is not supported for prepared queries.
+func (q *Query) Prepare() (*PreparedQuery, error) {
+	if q.hasError() {
+		return nil, q.err
+	}
+	if q.hasParallel() {
+		return nil, fmt.Errorf("zoom: Error in Query.Prepare: prepared queries do not support the Parallel modifier")
+	}
+	query := *q
+	query.tx = nil
+	query.filters = append([]filter{}, q.filters...)
+	ms := query.modelSpec
+	p := &PreparedQuery{
+		query:   &query,
+		baseKey: ms.allIndexKey(),
+	}
+	if query.hasOrder() {
+		fieldIndexKey, err := ms.fieldIndexKey(query.order.fieldName)
+		if err != nil {
+			return nil, err
+		}
+		if ms.fieldsByName[query.order.fieldName].indexKind == stringIndex {
+			p.orderIndexKey = fieldIndexKey
+			p.orderKeyPrefix = ms.keyPrefix() + "order:" + query.order.fieldName + ":"
+		} else {
+			p.baseKey = fieldIndexKey
+		}
+	}
+	if query.hasFilters() {
+		p.filterKeyPrefix = ms.keyPrefix() + "filter:all:"
+	}
+	for _, filter := range query.filters {
+		fieldIndexKey, err := ms.fieldIndexKey(filter.fieldSpec.name)
+		if err != nil {
+			return nil, err
+		}
+		pf := preparedFilter{
+			filter:        filter,
+			param:         -1,
+			fieldIndexKey: fieldIndexKey,
+			keyPrefix:     ms.keyPrefix() + "filter:" + fieldIndexKey + ":",
+		}
+		if filter.placeholder {
+			pf.param = p.numParams
+			p.numParams++
+			pf.paramType = filter.fieldSpec.typ
+			for pf.paramType.Kind() == reflect.Ptr {
+				pf.paramType = pf.paramType.Elem()
+			}
+		}
+		p.filters = append(p.filters, pf)
+	}
+	limit := int(query.limit)
+	if limit == 0 {
+		// In our query syntax, a limit of 0 means unlimited
+		// But in redis, -1 means unlimited
+		limit = -1
+	}
+	// sortArgs expects a key, so use an empty one and then remove it
+	p.runSortArgs = ms.sortArgs("", query.redisFieldNames(), limit, query.offset, query.order.kind)[1:]
+	p.idsSortArgs = ms.sortArgs("", nil, limit, query.offset, query.order.kind)[1:]
+	p.scanFieldNames = append(ms.withVersion(query.fieldNames()), "-")
+	return p, nil
+}
+
+// String satisfies fmt.Stringer and prints out the query which was prepared.
+func (p *PreparedQuery) String() string {
+	return p.query.String()
+}
+
+// Run runs the prepared query with the given arguments, which are the values
+// for any filters with a Placeholder value, and scans the results into models.
+// See Query.Run. It returns an error if the number or types of the arguments do
+// not match the placeholders.
+func (p *PreparedQuery) Run(models interface{}, args ...interface{}) error {
+	return runOp(p.query.newOp(QueryRunOp, models, nil), func() error {
+		if err := p.query.modelSpec.checkModelsType(models); err != nil {
+			return err
+		}
+		filters, err := p.bind(args)
+		if err != nil {
+			return err
+		}
+		t := p.query.newReadTransaction()
+		idsKey, tmpKeys := p.generateIdsSet(t, filters)
+		t.Command("SORT", append(redis.Args{idsKey}, p.runSortArgs...), newScanModelsHandler(p.query.modelSpec, p.scanFieldNames, models))
+		if len(tmpKeys) > 0 {
+			t.Command("DEL", tmpKeys, nil)
+		}
+		return t.Exec()
+	})
+}
+
+// Ids runs the prepared query with the given arguments and returns only the
+// ids of the models. See Query.Ids and PreparedQuery.Run.
+func (p *PreparedQuery) Ids(args ...interface{}) ([]string, error) {
+	var ids []string
+	err := runOp(p.query.newOp(QueryIdsOp, nil, nil), func() error {
+		var err error
+		ids, err = p.ids(args)
+		return err
+	})
+	return ids, err
+}
+
+// ids is like Ids but does not run middleware.
+func (p *PreparedQuery) ids(args []interface{}) ([]string, error) {
+	filters, err := p.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	t := p.query.newReadTransaction()
+	idsKey, tmpKeys := p.generateIdsSet(t, filters)
+	ids := []string{}
+	t.Command("SORT", append(redis.Args{idsKey}, p.idsSortArgs...), newScanStringsHandler(&ids))
+	if len(tmpKeys) > 0 {
+		t.Command("DEL", tmpKeys, nil)
+	}
+	if err := t.Exec(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Count runs the prepared query with the given arguments and returns the number
+// of models that match it. See Query.Count and PreparedQuery.Run.
+func (p *PreparedQuery) Count(args ...interface{}) (uint, error) {
+	var count uint
+	err := runOp(p.query.newOp(QueryCountOp, nil, nil), func() error {
+		if !p.query.hasFilters() {
+			if _, err := p.bind(args); err != nil {
+				return err
+			}
+			var err error
+			count, err = p.query.count()
+			return err
+		}
+		ids, err := p.ids(args)
+		count = uint(len(ids))
+		return err
+	})
+	return count, err
+}
+
+// bind returns the filters for the query with the values of any placeholders
+// set to the corresponding arguments. It returns an error if the number or
+// types of the arguments do not match the placeholders.
+func (p *PreparedQuery) bind(args []interface{}) ([]filter, error) {
+	if len(args) != p.numParams {
+		return nil, fmt.Errorf("zoom: Error in PreparedQuery: expected %d arguments but got %d", p.numParams, len(args))
+	}
+	filters := make([]filter, len(p.filters))
+	for i, pf := range p.filters {
+		filters[i] = pf.filter
+		if pf.param == -1 {
+			continue
+		}
+		arg := args[pf.param]
+		argVal := reflect.ValueOf(arg)
+		for argVal.Kind() == reflect.Ptr {
+			argVal = argVal.Elem()
+		}
+		if !argVal.IsValid() {
+			return nil, fmt.Errorf("zoom: Error in PreparedQuery: argument %d for %s was nil", pf.param, pf.filter.fieldSpec.name)
+		}
+		if argVal.Type() != pf.paramType {
+			return nil, fmt.Errorf("zoom: Error in PreparedQuery: argument %d for %s should have type %s but got %T", pf.param, pf.filter.fieldSpec.name, pf.paramType.String(), arg)
+		}
+		if err := filters[i].setValue(arg); err != nil {
+			return nil, fmt.Errorf("zoom: Error in PreparedQuery: %s", err.Error())
+		}
+		filters[i].placeholder = false
+	}
+	return filters, nil
+}
+
+// generateIdsSet adds commands to t which store the ids that match the query in
+// the key idsKey, using the given filters, which should have been returned by
+// bind. It is like Query.generateIdsSet, but the keys have already been computed.
+// tmpKeys should be deleted after the ids have been read from idsKey.
+func (p *PreparedQuery) generateIdsSet(t *Transaction, filters []filter) (idsKey string, tmpKeys redis.Args) {
+	idsKey = p.baseKey
+	tmpKeys = redis.Args{}
+	if p.orderIndexKey != "" {
+		orderedIdsKey := p.orderKeyPrefix + generateRandomId()
+		tmpKeys = append(tmpKeys, orderedIdsKey)
+		t.extractIdsFromStringIndex(p.orderIndexKey, orderedIdsKey, "-", "+")
+		idsKey = orderedIdsKey
+	}
+	if len(filters) > 0 {
+		filteredIdsKey := p.filterKeyPrefix + generateRandomId()
+		tmpKeys = append(tmpKeys, filteredIdsKey)
+		for i, filter := range filters {
+			origKey := filteredIdsKey
+			if i == 0 {
+				// The first time, we should intersect with the ids key from above
+				origKey = idsKey
+			}
+			t.intersectFilter(filter, filterKeys{
+				fieldIndexKey: p.filters[i].fieldIndexKey,
+				filterKey:     p.filters[i].keyPrefix + generateRandomId(),
+				origKey:       origKey,
+				destKey:       filteredIdsKey,
+			})
+		}
+		idsKey = filteredIdsKey
+	}
+	return idsKey, tmpKeys
+}
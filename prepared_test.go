@@ -0,0 +1,80 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File prepared_test.go tests the code in prepared.go.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreparedQuery(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(10)
+	if err != nil {
+		t.Fatalf("Unexpected error saving indexed test models: %s", err.Error())
+	}
+	p, err := indexedTestModels.NewQuery().Filter("Int >", Placeholder{}).Filter("Bool =", true).Order("String").Prepare()
+	if err != nil {
+		t.Fatalf("Unexpected error in Prepare: %s", err.Error())
+	}
+	// Run the prepared query with a few different arguments and compare the
+	// results to the equivalent queries
+	for _, arg := range []int{-1, models[0].Int, models[5].Int} {
+		q := indexedTestModels.NewQuery().Filter("Int >", arg).Filter("Bool =", true).Order("String")
+		expected := expectedResultsForQuery(q, models)
+		got := []*indexedTestModel{}
+		if err := p.Run(&got, arg); err != nil {
+			t.Fatalf("Unexpected error in PreparedQuery.Run: %s", err.Error())
+		}
+		if err := expectModelsToBeEqual(expected, got, true); err != nil {
+			t.Errorf("Unexpected results for %s with argument %d: %s", p, arg, err.Error())
+		}
+		ids, err := p.Ids(arg)
+		if err != nil {
+			t.Fatalf("Unexpected error in PreparedQuery.Ids: %s", err.Error())
+		}
+		if len(ids) != len(expected) {
+			t.Errorf("Expected %d ids but got %d", len(expected), len(ids))
+		}
+		count, err := p.Count(arg)
+		if err != nil {
+			t.Fatalf("Unexpected error in PreparedQuery.Count: %s", err.Error())
+		}
+		if int(count) != len(expected) {
+			t.Errorf("Expected count to be %d but got %d", len(expected), count)
+		}
+	}
+
+	// The arguments should be validated
+	got := []*indexedTestModel{}
+	if err := p.Run(&got); err == nil {
+		t.Error("Expected error with too few arguments but got none")
+	}
+	if err := p.Run(&got, "not an int"); err == nil {
+		t.Error("Expected error with an argument of the wrong type but got none")
+	}
+
+	// A query with a placeholder can only be run after it is prepared
+	if err := indexedTestModels.NewQuery().Filter("Int >", Placeholder{}).Run(&got); err == nil {
+		t.Error("Expected error running a query with a Placeholder but got none")
+	}
+}
+
+func TestPreparedQueryString(t *testing.T) {
+	spec, err := compileModelSpec(reflect.TypeOf(&indexedTestModel{}))
+	if err != nil {
+		t.Fatalf("Unexpected error in compileModelSpec: %s", err.Error())
+	}
+	spec.name = "indexedTestModel"
+	q := (&ModelType{spec: spec}).NewQuery().Filter("Int >", Placeholder{})
+	expected := `indexedTestModel.NewQuery().Filter("Int >", Placeholder{})`
+	if got := q.String(); got != expected {
+		t.Errorf("Expected %s but got %s", expected, got)
+	}
+}
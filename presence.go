@@ -0,0 +1,174 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File presence.go contains code related to keeping track of which
+// members (e.g. workers or users) are currently online.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sync"
+	"time"
+)
+
+// Presence keeps track of which members of some group, e.g. workers or users,
+// are currently online. Each member is a model of a registered type which
+// expires unless it sends a heartbeat before its TTL runs out. It is created
+// with NewPresence.
+type Presence struct {
+	mt  *ModelType
+	ttl time.Duration
+}
+
+// NewPresence returns a Presence for the members which are models of the given
+// type. A member is considered alive for ttl after it was registered or last
+// sent a heartbeat. If ttl is 0, the TTL for the type (see the TTL option) is
+// used instead. Members should send a heartbeat well before ttl runs out, e.g.
+// every ttl/3, so that a slow heartbeat does not cause them to expire. Types
+// which use the ArchiveOnExpire option cannot be used.
+func NewPresence(mt *ModelType, ttl time.Duration) (*Presence, error) {
+	if ttl < 0 {
+		return nil, fmt.Errorf("zoom: Error in NewPresence: ttl cannot be negative but got %s", ttl)
+	}
+	if ttl == 0 {
+		ttl = mt.spec.ttl
+	}
+	if ttl == 0 {
+		return nil, fmt.Errorf("zoom: Error in NewPresence: ttl was 0 and %s was not registered with the TTL option", mt.Name())
+	}
+	if mt.spec.archiveOnExpire {
+		return nil, fmt.Errorf("zoom: Error in NewPresence: %s uses the ArchiveOnExpire option", mt.Name())
+	}
+	return &Presence{mt: mt, ttl: ttl}, nil
+}
+
+// Register saves model and marks it as alive until the TTL for the presence runs
+// out. It can also be used to update the fields of a member which is already
+// alive, since it also counts as a heartbeat.
+func (pr *Presence) Register(model Model) error {
+	return pr.mt.SaveWithTTL(model, pr.ttl)
+}
+
+// Heartbeat marks the member with the given id as alive until the TTL for the
+// presence runs out again. It returns false if the member is not alive, e.g.
+// because it expired before the heartbeat was sent, in which case it should be
+// registered again.
+func (pr *Presence) Heartbeat(id string) (bool, error) {
+	return pr.mt.Touch(id, pr.ttl)
+}
+
+// Unregister removes the member with the given id, e.g. when a worker shuts down
+// cleanly. It returns false if the member was not alive.
+func (pr *Presence) Unregister(id string) (bool, error) {
+	return pr.mt.Delete(id)
+}
+
+// ListAlive returns the ids of the members which are currently alive, in no
+// particular order. Members which have expired are not included, even if there
+// is no ExpirationListener running to remove them from the set of all models.
+func (pr *Presence) ListAlive() ([]string, error) {
+	conn := pr.mt.spec.pool.NewConn()
+	ids, err := redis.Strings(conn.Do("SMEMBERS", pr.mt.AllIndexKey()))
+	conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ListAlive: %s", err.Error())
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	t := pr.mt.spec.pool.NewTransaction()
+	exists := make([]bool, len(ids))
+	for i, id := range ids {
+		t.Command("EXISTS", redis.Args{pr.mt.spec.keyName() + ":" + id}, newScanBoolHandler(&exists[i]))
+	}
+	if err := t.Exec(); err != nil {
+		return nil, fmt.Errorf("zoom: Error in ListAlive: %s", err.Error())
+	}
+	alive := []string{}
+	for i, id := range ids {
+		if exists[i] {
+			alive = append(alive, id)
+		}
+	}
+	return alive, nil
+}
+
+// PresenceWatcher receives the ids of members which leave a Presence. It is
+// created with Presence.WatchDepartures.
+type PresenceWatcher struct {
+	// Departures receives the id of each member which expires, is evicted, or
+	// is unregistered. It is closed when the watcher is closed.
+	Departures <-chan string
+	departures chan string
+	sub        *KeyspaceSubscription
+	// stop is closed to stop the watcher and done is closed when it has
+	// stopped
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// WatchDepartures returns a PresenceWatcher which receives the id of each member
+// that leaves the presence, so that an application can react right away (e.g.
+// by reassigning the work of a worker which stopped sending heartbeats). It is
+// built on keyspace notifications (see SubscribeKeyspace), so departures which
+// happen while the connection is lost are missed. Call Close when the watcher is
+// no longer needed.
+func (pr *Presence) WatchDepartures() (*PresenceWatcher, error) {
+	sub, err := pr.mt.spec.pool.SubscribeKeyspace(pr.mt)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in WatchDepartures: %s", err.Error())
+	}
+	departures := make(chan string, subscriptionBufferSize)
+	w := &PresenceWatcher{
+		Departures: departures,
+		departures: departures,
+		sub:        sub,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// run sends the id to w.departures for each event which means the main hash for
+// a member was removed.
+func (w *PresenceWatcher) run() {
+	defer close(w.done)
+	defer close(w.departures)
+	for event := range w.sub.Events {
+		if event.Field != "" {
+			continue
+		}
+		switch event.Kind {
+		case "expired", "evicted", "del":
+		default:
+			continue
+		}
+		select {
+		case w.departures <- event.Id:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Err returns the first error encountered by the watcher, if any, including
+// errors from connections which were lost and then reestablished.
+func (w *PresenceWatcher) Err() error {
+	return w.sub.Err()
+}
+
+// Close stops the watcher and closes the Departures channel. It returns the same
+// error as Err.
+func (w *PresenceWatcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	err := w.sub.Close()
+	<-w.done
+	return err
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File presence_test.go tests the code in presence.go.
+
+package zoom
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// presenceModel is a model type that is only used for testing Presence
+type presenceModel struct {
+	Host string
+	DefaultData
+}
+
+func TestPresence(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	presenceModels := registerTestType(t, &presenceModel{})
+	if _, err := NewPresence(presenceModels, 0); err == nil {
+		t.Error("Expected an error in NewPresence for a type without a TTL")
+	}
+	presence, err := NewPresence(presenceModels, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPresence: %s", err.Error())
+	}
+	w, err := presence.WatchDepartures()
+	if err != nil {
+		t.Fatalf("Unexpected error in WatchDepartures: %s", err.Error())
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			t.Errorf("Unexpected error in PresenceWatcher.Close: %s", err.Error())
+		}
+	}()
+
+	workers := []*presenceModel{{Host: "a"}, {Host: "b"}, {Host: "c"}}
+	for _, worker := range workers {
+		if err := presence.Register(worker); err != nil {
+			t.Fatalf("Unexpected error in Register: %s", err.Error())
+		}
+	}
+	expected := []string{workers[0].Id(), workers[1].Id(), workers[2].Id()}
+	sort.Strings(expected)
+	alive, err := presence.ListAlive()
+	if err != nil {
+		t.Fatalf("Unexpected error in ListAlive: %s", err.Error())
+	}
+	sort.Strings(alive)
+	if !reflect.DeepEqual(expected, alive) {
+		t.Errorf("Expected %v to be alive but got %v", expected, alive)
+	}
+
+	// Unregister the first worker and keep the second one alive with
+	// heartbeats, so that only the third one expires.
+	if _, err := presence.Unregister(workers[0].Id()); err != nil {
+		t.Fatalf("Unexpected error in Unregister: %s", err.Error())
+	}
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if ok, err := presence.Heartbeat(workers[1].Id()); err != nil {
+			t.Fatalf("Unexpected error in Heartbeat: %s", err.Error())
+		} else if !ok {
+			t.Fatal("Expected Heartbeat to return true for a worker which is alive")
+		}
+	}
+	alive, err = presence.ListAlive()
+	if err != nil {
+		t.Fatalf("Unexpected error in ListAlive: %s", err.Error())
+	}
+	if !reflect.DeepEqual([]string{workers[1].Id()}, alive) {
+		t.Errorf("Expected only %s to be alive but got %v", workers[1].Id(), alive)
+	}
+	if ok, err := presence.Heartbeat(workers[2].Id()); err != nil {
+		t.Fatalf("Unexpected error in Heartbeat: %s", err.Error())
+	} else if ok {
+		t.Error("Expected Heartbeat to return false for a worker which expired")
+	}
+
+	// The watcher should report both departures
+	departed := []string{}
+	for len(departed) < 2 {
+		select {
+		case id := <-w.Departures:
+			departed = append(departed, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for departures. Got: %v", departed)
+		}
+	}
+	if departed[0] != workers[0].Id() || departed[1] != workers[2].Id() {
+		t.Errorf("Expected departures [%s %s] but got %v", workers[0].Id(), workers[2].Id(), departed)
+	}
+}
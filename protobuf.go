@@ -0,0 +1,122 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File protobuf.go contains code related to storing fields and
+// models using Protocol Buffers.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+)
+
+// protobufMarshalerUnmarshaler is an implementation of MarshalerUnmarshaler that
+// uses Protocol Buffers. It only supports values which implement proto.Message
+// (or pointers to such values).
+type protobufMarshalerUnmarshaler struct{}
+
+// ProtobufMarshalerUnmarshaler is a MarshalerUnmarshaler which uses Protocol
+// Buffers (github.com/golang/protobuf/proto). It can be selected for a field
+// which implements proto.Message with `zoom:"marshaler=protobuf"`. It is not
+// used automatically, since fields which were stored with gob cannot be read
+// reliably with protobuf.
+var ProtobufMarshalerUnmarshaler MarshalerUnmarshaler = protobufMarshalerUnmarshaler{}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+func init() {
+	marshalerUnmarshalers["protobuf"] = ProtobufMarshalerUnmarshaler
+}
+
+// typeIsProtoMessage returns true iff typ or a pointer to typ implements
+// proto.Message.
+func typeIsProtoMessage(typ reflect.Type) bool {
+	return typ.Implements(protoMessageType) || reflect.PtrTo(typ).Implements(protoMessageType)
+}
+
+// Marshal returns the protobuf encoding of v, which must implement proto.Message
+// or be a value whose pointer implements proto.Message.
+func (protobufMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return proto.Marshal(msg)
+	}
+	val := reflect.ValueOf(v)
+	if !val.IsValid() || !reflect.PtrTo(val.Type()).Implements(protoMessageType) {
+		return nil, fmt.Errorf("zoom: cannot marshal %T with protobuf because it does not implement proto.Message", v)
+	}
+	// Copy the value so we have something addressable
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	return proto.Marshal(ptr.Interface().(proto.Message))
+}
+
+// Unmarshal parses the protobuf-encoded data and stores the result in the value
+// pointed to by v. v must implement proto.Message or be a pointer to a nil or
+// non-nil value which implements proto.Message.
+func (protobufMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	if msg, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, msg)
+	}
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Ptr || !val.Elem().Type().Implements(protoMessageType) {
+		return fmt.Errorf("zoom: cannot unmarshal into %T with protobuf because it does not implement proto.Message", v)
+	}
+	if val.Elem().IsNil() {
+		val.Elem().Set(reflect.New(val.Elem().Type().Elem()))
+	}
+	return proto.Unmarshal(data, val.Elem().Interface().(proto.Message))
+}
+
+// StoreProtobuf is a ModelOption which causes the whole model to be written as a
+// single protobuf blob (in addition to the main hash) whenever it is saved, so
+// that other services can read it without understanding the format used by zoom.
+// The blob is stored as a string at the key returned by ModelType.ProtobufKey and
+// is deleted or renamed along with the model. The model type must implement
+// proto.Message.
+func StoreProtobuf() ModelOption {
+	return func(spec *modelSpec) error {
+		if !spec.typ.Implements(protoMessageType) {
+			return fmt.Errorf("zoom: StoreProtobuf requires a model type which implements proto.Message. %s does not", spec.typ.String())
+		}
+		spec.storeProtobuf = true
+		return nil
+	}
+}
+
+// protobufKeySuffix is appended to the key for a model to form the key where the
+// protobuf blob is stored.
+const protobufKeySuffix = "protobuf"
+
+// protobufKey returns the key where the protobuf blob for the model with the given
+// id is stored if the StoreProtobuf option was used.
+func (ms *modelSpec) protobufKey(id string) string {
+	return ms.keyName() + ":" + id + ":" + protobufKeySuffix
+}
+
+// ProtobufKey returns the key where the protobuf blob for the model with the given
+// id is stored if the type was registered with the StoreProtobuf option. It returns
+// an error if id is empty or the type was not registered with StoreProtobuf.
+func (mt *ModelType) ProtobufKey(id string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("zoom: Error in ProtobufKey: id was empty")
+	}
+	if !mt.spec.storeProtobuf {
+		return "", fmt.Errorf("zoom: Error in ProtobufKey: %s was not registered with the StoreProtobuf option", mt.Name())
+	}
+	return mt.spec.protobufKey(id), nil
+}
+
+// saveProtobuf adds a command to the transaction which writes the protobuf blob
+// for mr.model.
+func (t *Transaction) saveProtobuf(mr *modelRef) {
+	data, err := proto.Marshal(mr.model.(proto.Message))
+	if err != nil {
+		t.setError(err)
+		return
+	}
+	t.Command("SET", redis.Args{mr.spec.protobufKey(mr.model.Id()), data}, nil)
+}
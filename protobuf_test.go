@@ -0,0 +1,203 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File protobuf_test.go tests the code in protobuf.go, i.e.
+// storing fields and models using Protocol Buffers.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+// protoPoint is a hand-written proto.Message used for testing
+type protoPoint struct {
+	X int64 `protobuf:"varint,1,opt,name=x"`
+	Y int64 `protobuf:"varint,2,opt,name=y"`
+}
+
+func (p *protoPoint) Reset()         { *p = protoPoint{} }
+func (p *protoPoint) String() string { return proto.CompactTextString(p) }
+func (*protoPoint) ProtoMessage()    {}
+
+// protoFieldModel is a model type that is only used for testing
+// fields which implement proto.Message
+type protoFieldModel struct {
+	Point    protoPoint  `zoom:"marshaler=protobuf"`
+	PointPtr *protoPoint `zoom:"marshaler=protobuf"`
+	Gob      protoPoint
+	DefaultData
+}
+
+func TestProtobufFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	protoFieldModels := registerTestType(t, &protoFieldModel{})
+
+	model := &protoFieldModel{
+		Point:    protoPoint{X: int64(randomInt()), Y: int64(randomInt())},
+		PointPtr: &protoPoint{X: int64(randomInt()), Y: int64(randomInt())},
+		Gob:      protoPoint{X: int64(randomInt()), Y: int64(randomInt())},
+	}
+	if err := protoFieldModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The fields with the marshaler=protobuf option should have been stored
+	// with protobuf and the other one with gob
+	conn := NewConn()
+	defer conn.Close()
+	key, _ := protoFieldModels.ModelKey(model.Id())
+	expected := map[string]*protoPoint{
+		"Point":    &model.Point,
+		"PointPtr": model.PointPtr,
+	}
+	for fieldName, point := range expected {
+		expectedBytes, err := proto.Marshal(point)
+		if err != nil {
+			t.Fatalf("Unexpected error in proto.Marshal: %s", err.Error())
+		}
+		got, err := redis.Bytes(conn.Do("HGET", key, fieldName))
+		if err != nil {
+			t.Fatalf("Unexpected error in HGET: %s", err.Error())
+		}
+		if string(got) != string(expectedBytes) {
+			t.Errorf("Field %s was incorrect.\nExpected: %v\nGot:      %v", fieldName, expectedBytes, got)
+		}
+	}
+	expectedBytes, err := GobMarshalerUnmarshaler.Marshal(model.Gob)
+	if err != nil {
+		t.Fatalf("Unexpected error in Marshal: %s", err.Error())
+	}
+	if got, err := redis.Bytes(conn.Do("HGET", key, "Gob")); err != nil {
+		t.Fatalf("Unexpected error in HGET: %s", err.Error())
+	} else if string(got) != string(expectedBytes) {
+		t.Errorf("Field Gob was incorrect.\nExpected: %v\nGot:      %v", expectedBytes, got)
+	}
+
+	modelCopy := &protoFieldModel{}
+	if err := protoFieldModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
+
+func TestProtobufMarshalerRequiresProtoMessage(t *testing.T) {
+	type notProtoFieldModel struct {
+		Int int `zoom:"marshaler=protobuf"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&notProtoFieldModel{})); err == nil {
+		t.Error("Expected error when using the protobuf marshaler for a field which does not implement proto.Message but got none")
+	}
+}
+
+func TestStoreProtobufRequiresProtoMessage(t *testing.T) {
+	type notProtoModel struct {
+		Int int
+		DefaultData
+	}
+	if _, err := RegisterWithOptions(&notProtoModel{}, StoreProtobuf()); err == nil {
+		t.Error("Expected error when using StoreProtobuf with a type that does not implement proto.Message but got none")
+	}
+}
+
+// protoModel is a model type that is only used for testing the
+// StoreProtobuf option
+type protoModel struct {
+	Name  string   `protobuf:"bytes,1,opt,name=name"`
+	Count int64    `protobuf:"varint,2,opt,name=count"`
+	Tags  []string `protobuf:"bytes,3,rep,name=tags" redisType:"list"`
+	DefaultData
+}
+
+func (m *protoModel) Reset()         { *m = protoModel{} }
+func (m *protoModel) String() string { return proto.CompactTextString(m) }
+func (*protoModel) ProtoMessage()    {}
+
+func TestStoreProtobuf(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	protoModels := registerTestType(t, &protoModel{}, StoreProtobuf())
+
+	model := &protoModel{Name: randomString(), Count: int64(randomInt()), Tags: []string{"a", "b"}}
+	if err := protoModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The blob should hold the whole model
+	conn := NewConn()
+	defer conn.Close()
+	key, err := protoModels.ProtobufKey(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in ProtobufKey: %s", err.Error())
+	}
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err != nil {
+		t.Fatalf("Unexpected error in GET: %s", err.Error())
+	}
+	got := &protoModel{}
+	if err := proto.Unmarshal(data, got); err != nil {
+		t.Fatalf("Unexpected error in proto.Unmarshal: %s", err.Error())
+	}
+	got.SetId(model.Id())
+	if !reflect.DeepEqual(model, got) {
+		t.Errorf("Protobuf blob was incorrect.\nExpected: %+v\nGot:      %+v", model, got)
+	}
+
+	// The blob should be moved by Rename
+	if _, err := protoModels.Rename(model.Id(), "renamed"); err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	newKey, _ := protoModels.ProtobufKey("renamed")
+	expectKeyExists(t, newKey)
+	expectKeyDoesNotExist(t, key)
+
+	// The blob should be removed by Delete
+	if _, err := protoModels.Delete("renamed"); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	expectKeyDoesNotExist(t, newKey)
+
+	// The blobs should be removed by DeleteAll
+	keys := []string{}
+	for i := 0; i < 2; i++ {
+		model := &protoModel{Name: randomString()}
+		if err := protoModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		key, _ := protoModels.ProtobufKey(model.Id())
+		keys = append(keys, key)
+	}
+	if _, err := protoModels.DeleteAll(); err != nil {
+		t.Fatalf("Unexpected error in DeleteAll: %s", err.Error())
+	}
+	for _, key := range keys {
+		expectKeyDoesNotExist(t, key)
+	}
+}
+
+func TestStoreProtobufFieldKeyCollision(t *testing.T) {
+	type collidingProtoModel struct {
+		protoModel
+		Blob []string `redis:"protobuf" redisType:"list"`
+	}
+	pool, err := NewPool(&Configuration{})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	if _, err := pool.RegisterWithOptions(&collidingProtoModel{}, StoreProtobuf()); err == nil {
+		t.Error("Expected error when using StoreProtobuf with a list field named protobuf but got none")
+	}
+	if _, err := pool.Register(&collidingProtoModel{}); err != nil {
+		t.Errorf("Unexpected error in Register without StoreProtobuf: %s", err.Error())
+	}
+}
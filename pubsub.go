@@ -0,0 +1,248 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File pubsub.go contains code related to subscribing to pub/sub
+// channels, including keyspace notifications, and staying subscribed
+// if the connection to the database is lost.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resubscribePolicy determines how long subscribers wait before trying to
+// reconnect after their connection is lost. MaxAttempts is ignored, since
+// subscribers keep trying until they are closed.
+var resubscribePolicy = RetryPolicy{
+	MinBackoff: 100 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+}
+
+// subscriber keeps a connection subscribed to some channels (or patterns) and
+// calls handle for each message it receives. If the connection is lost, the
+// subscriber reconnects and subscribes again until it is closed. Messages which
+// are published while the subscriber is reconnecting are missed.
+type subscriber struct {
+	pool *Pool
+	// command is either SUBSCRIBE or PSUBSCRIBE
+	command  string
+	channels []string
+	// onConnect (if not nil) is called with a new connection before it is
+	// subscribed, e.g. to enable keyspace notifications
+	onConnect func(conn redis.Conn) error
+	// handle is called with the channel and data for each message. It must
+	// return promptly once closed is closed.
+	handle func(channel string, data []byte)
+	// conn is the current connection, if any
+	conn   redis.Conn
+	connMu sync.Mutex
+	// err is the first error encountered by the subscriber
+	err   error
+	errMu sync.Mutex
+	// closed is closed to stop the subscriber and done is closed when it has
+	// stopped
+	closed    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newSubscriber creates a subscriber and connects it. It returns an error if
+// the first attempt to connect or subscribe fails. Call start to begin
+// handling messages.
+func (p *Pool) newSubscriber(command string, channels []string, onConnect func(redis.Conn) error, handle func(string, []byte)) (*subscriber, error) {
+	s := &subscriber{
+		pool:      p,
+		command:   command,
+		channels:  channels,
+		onConnect: onConnect,
+		handle:    handle,
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// start handles messages in a new goroutine until s is closed.
+func (s *subscriber) start() {
+	go s.run()
+}
+
+// connect gets a new connection from the pool, subscribes it, and sets s.conn.
+func (s *subscriber) connect() error {
+	conn := s.pool.NewConn()
+	if s.onConnect != nil {
+		if err := s.onConnect(conn); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if _, err := conn.Do(s.command, redis.Args{}.AddFlat(s.channels)...); err != nil {
+		conn.Close()
+		return err
+	}
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	select {
+	case <-s.closed:
+		conn.Close()
+		return fmt.Errorf("zoom: subscriber was closed")
+	default:
+	}
+	s.conn = conn
+	return nil
+}
+
+// run receives messages until s is closed, reconnecting as needed.
+func (s *subscriber) run() {
+	defer close(s.done)
+	for attempt := 0; ; {
+		s.connMu.Lock()
+		conn := s.conn
+		s.connMu.Unlock()
+		if conn == nil {
+			attempt++
+			select {
+			case <-s.closed:
+				return
+			case <-time.After(resubscribePolicy.backoff(attempt)):
+			}
+			if err := s.connect(); err != nil {
+				if s.isClosed() {
+					return
+				}
+				s.setError(err)
+			}
+			continue
+		}
+		attempt = 0
+		err := s.receive(conn)
+		s.connMu.Lock()
+		s.conn = nil
+		s.connMu.Unlock()
+		conn.Close()
+		if s.isClosed() {
+			return
+		}
+		s.setError(err)
+		s.pool.runConnectionDroppedHooks(err)
+	}
+}
+
+// receive calls s.handle for each message received on conn until there is an
+// error.
+func (s *subscriber) receive(conn redis.Conn) error {
+	for {
+		reply, err := receiveWithoutTimeout(conn)
+		if err != nil {
+			return err
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) < 3 {
+			continue
+		}
+		kind, _ := redis.String(values[0], nil)
+		var channel, data []byte
+		switch {
+		case kind == "message" && len(values) == 3:
+			channel, _ = values[1].([]byte)
+			data, _ = values[2].([]byte)
+		case kind == "pmessage" && len(values) == 4:
+			channel, _ = values[2].([]byte)
+			data, _ = values[3].([]byte)
+		default:
+			continue
+		}
+		s.handle(string(channel), data)
+	}
+}
+
+// receiveWithoutTimeout is like conn.Receive but waits indefinitely instead of
+// using the ReadTimeout for the pool (if any), since a subscribed connection may
+// not receive a message for a long time. Connections which do not support
+// redis.ConnWithTimeout (e.g. from some custom Drivers) use their normal
+// timeout.
+func receiveWithoutTimeout(conn redis.Conn) (interface{}, error) {
+	if _, ok := conn.(redis.ConnWithTimeout); ok {
+		return redis.ReceiveWithTimeout(conn, 0)
+	}
+	return conn.Receive()
+}
+
+// isClosed returns true iff s has been closed.
+func (s *subscriber) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// setError sets the error for s if it does not already have one.
+func (s *subscriber) setError(err error) {
+	s.errMu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.errMu.Unlock()
+}
+
+// Err returns the first error encountered, if any.
+func (s *subscriber) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+// Close stops s and waits for it to finish handling the current message, if
+// any. It returns the same error as Err.
+func (s *subscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.connMu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.connMu.Unlock()
+	})
+	<-s.done
+	return s.Err()
+}
+
+// enableNotifications adds the given flags to the notify-keyspace-events config
+// option if they are not already there (see http://redis.io/topics/notifications).
+// It has no effect if the CONFIG command is not available.
+func enableNotifications(conn redis.Conn, flags string) error {
+	reply, err := redis.Strings(conn.Do("CONFIG", "GET", "notify-keyspace-events"))
+	if err != nil || len(reply) != 2 {
+		// Assume CONFIG has been disabled and notifications were configured some
+		// other way
+		return nil
+	}
+	current := reply[1]
+	missing := ""
+	for _, flag := range flags {
+		if strings.ContainsRune(current, flag) {
+			continue
+		}
+		if flag != 'K' && flag != 'E' && strings.ContainsRune(current, 'A') {
+			// A is an alias for all the classes of events
+			continue
+		}
+		missing += string(flag)
+	}
+	if missing == "" {
+		return nil
+	}
+	_, err = conn.Do("CONFIG", "SET", "notify-keyspace-events", current+missing)
+	return err
+}
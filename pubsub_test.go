@@ -0,0 +1,50 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File pubsub_test.go tests the code in pubsub.go, i.e. staying
+// subscribed to pub/sub channels.
+
+package zoom
+
+import (
+	"testing"
+	"time"
+)
+
+// timeoutConn is a redis.Conn which supports redis.ConnWithTimeout and records
+// the timeout used for the last call to ReceiveWithTimeout.
+type timeoutConn struct {
+	brokenConn
+	timeout *time.Duration
+}
+
+func (c timeoutConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return c.Do(commandName, args...)
+}
+
+func (c timeoutConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	*c.timeout = timeout
+	return "message", nil
+}
+
+func TestReceiveWithoutTimeout(t *testing.T) {
+	// Connections which support timeouts should wait indefinitely, even if the
+	// pool has a ReadTimeout
+	timeout := time.Second
+	reply, err := receiveWithoutTimeout(timeoutConn{timeout: &timeout})
+	if err != nil {
+		t.Fatalf("Unexpected error in receiveWithoutTimeout: %s", err.Error())
+	}
+	if reply != "message" {
+		t.Errorf("Expected reply from ReceiveWithTimeout but got %v", reply)
+	}
+	if timeout != 0 {
+		t.Errorf("Expected a timeout of 0 but got %s", timeout)
+	}
+
+	// Other connections should fall back to Receive
+	if _, err := receiveWithoutTimeout(brokenConn{}); err != nil {
+		t.Errorf("Unexpected error in receiveWithoutTimeout: %s", err.Error())
+	}
+}
@@ -28,6 +28,13 @@ type Query struct {
 	offset    uint
 	filters   []filter
 	err       error
+	// fromMaster is true if the query should not be sent to a replica
+	fromMaster bool
+	// workers and batchSize are set if the Parallel modifier was used
+	workers   uint
+	batchSize uint
+	// prefetch is set if the Prefetch modifier was used
+	prefetch uint
 }
 
 // String satisfies fmt.Stringer and prints out the query in a format that
@@ -51,6 +58,12 @@ func (q *Query) String() string {
 	} else if q.hasExcludes() {
 		result += fmt.Sprintf(`.Exclude("%s")`, strings.Join(q.excludes, `", "`))
 	}
+	if q.hasParallel() {
+		result += fmt.Sprintf(".Parallel(%d, %d)", q.workers, q.batchSize)
+	}
+	if q.prefetch > 0 {
+		result += fmt.Sprintf(".Prefetch(%d)", q.prefetch)
+	}
 	return result
 }
 
@@ -89,10 +102,15 @@ type filter struct {
 	fieldSpec *fieldSpec
 	op        filterOp
 	value     reflect.Value
+	// placeholder is true iff the value is a Placeholder, in which case value
+	// is not valid until an argument is given to a PreparedQuery
+	placeholder bool
 }
 
 func (f filter) String() string {
-	if f.value.Kind() == reflect.String {
+	if f.placeholder {
+		return fmt.Sprintf(`Filter("%s %s", Placeholder{})`, f.fieldSpec.name, f.op)
+	} else if f.value.Kind() == reflect.String {
 		return fmt.Sprintf(`Filter("%s %s", "%s")`, f.fieldSpec.name, f.op, f.value.String())
 	} else {
 		return fmt.Sprintf(`Filter("%s %s", %v)`, f.fieldSpec.name, f.op, f.value.Interface())
@@ -145,7 +163,8 @@ var filterOps = map[string]filterOp{
 // execute it.
 func (modelType *ModelType) NewQuery() *Query {
 	return &Query{
-		modelSpec: modelType.spec,
+		modelSpec:  modelType.spec,
+		fromMaster: modelType.fromMaster,
 	}
 }
 
@@ -220,7 +239,8 @@ func (q *Query) Offset(amount uint) *Query {
 // same as any other error that occurs during the lifetime of the query, is not
 // returned until the query is executed. When the query is executed the first
 // error that occured during the lifetime of the query object (if any) will be
-// returned.
+// returned. Fields with the "lazy" option are only read if they are specified
+// in Include.
 func (q *Query) Include(fields ...string) *Query {
 	if q.hasExcludes() {
 		q.setError(errors.New("zoom: cannot use both Include and Exclude modifiers on a query"))
@@ -255,13 +275,15 @@ func (q *Query) Exclude(fields ...string) *Query {
 // `zoom:"index"` struct tag. If multiple filters are applied to the same query,
 // the query will only return models which have matches for ALL of the filters.
 // I.e. applying multiple filters is logially equivalent to combining them with
-// a AND or INTERSECT operator. Filter will set an error on the query if the
-// arguments are improperly formated, if the field you are attempting to filter
-// is not indexed, or if the type of value does not match the type of the field.
-// The error, same as any other error that occurs during the lifetime of the
-// query, is not returned until the query is executed. When the query is
-// executed the first error that occured during the lifetime of the query object
-// (if any) will be returned.
+// a AND or INTERSECT operator. value may be Placeholder{} to create a
+// parameterized query, in which case the query must be run with Prepare (see
+// Query.Prepare). Filter will set an error on the query if the arguments are
+// improperly formated, if the field you are attempting to filter is not
+// indexed, or if the type of value does not match the type of the field. The
+// error, same as any other error that occurs during the lifetime of the query,
+// is not returned until the query is executed. When the query is executed the
+// first error that occured during the lifetime of the query object (if any)
+// will be returned.
 func (q *Query) Filter(filterString string, value interface{}) *Query {
 	fieldName, operator, err := splitFilterString(filterString)
 	if err != nil {
@@ -291,16 +313,42 @@ func (q *Query) Filter(filterString string, value interface{}) *Query {
 		fieldSpec: fieldSpec,
 		op:        filterOp,
 	}
+	if _, ok := value.(Placeholder); ok {
+		// The value will be given when the prepared query is run
+		filter.placeholder = true
+		q.filters = append(q.filters, filter)
+		return q
+	}
 	// Make sure the given value is the correct type
 	if err := filter.checkValType(value); err != nil {
 		q.setError(err)
 		return q
 	}
-	filter.value = reflect.ValueOf(value)
+	if err := filter.setValue(value); err != nil {
+		q.setError(err)
+		return q
+	}
 	q.filters = append(q.filters, filter)
 	return q
 }
 
+// setValue sets the value for the filter, which must already have been checked
+// with checkValType. It returns an error if the value is a numeric text type
+// which cannot be converted to a score.
+func (filter *filter) setValue(value interface{}) error {
+	filter.value = reflect.ValueOf(value)
+	if filter.fieldSpec.kind == inconvertibleField && filter.fieldSpec.indexKind == numericIndex {
+		// Times and numeric text types like big.Int are indexed by their score,
+		// so we need to filter by score
+		score, err := numericScore(filter.value)
+		if err != nil {
+			return err
+		}
+		filter.value = reflect.ValueOf(score)
+	}
+	return nil
+}
+
 func splitFilterString(filterString string) (fieldName string, operator string, err error) {
 	tokens := strings.Split(filterString, " ")
 	if len(tokens) != 2 {
@@ -340,10 +388,21 @@ func (filter filter) checkValType(value interface{}) error {
 // return the first error that occured during the lifetime of the query object
 // (if any). It will also return an error if models is the wrong type.
 func (q *Query) Run(models interface{}) error {
+	return runOp(q.newOp(QueryRunOp, models, nil), func() error {
+		return q.run(q.newReadTransaction, models)
+	})
+}
+
+// run is like Run but uses newTransaction to create the transaction which is
+// used to execute the query.
+func (q *Query) run(newTransaction func() *Transaction, models interface{}) error {
 	if err := q.modelSpec.checkModelsType(models); err != nil {
 		return err
 	}
-	q.tx = NewTransaction()
+	if q.hasParallel() {
+		return q.runParallel(newTransaction, models)
+	}
+	q.tx = newTransaction()
 	idsKey, tmpKeys, err := q.generateIdsSet()
 	if err != nil {
 		if len(tmpKeys) > 0 {
@@ -358,7 +417,7 @@ func (q *Query) Run(models interface{}) error {
 		limit = -1
 	}
 	sortArgs := q.modelSpec.sortArgs(idsKey, q.redisFieldNames(), limit, q.offset, q.order.kind)
-	q.tx.Command("SORT", sortArgs, newScanModelsHandler(q.modelSpec, append(q.fieldNames(), "-"), models))
+	q.tx.Command("SORT", sortArgs, newScanModelsHandler(q.modelSpec, append(q.modelSpec.withVersion(q.fieldNames()), "-"), models))
 	if len(tmpKeys) > 0 {
 		q.tx.Command("DEL", (redis.Args{}).Add(tmpKeys...), nil)
 	}
@@ -394,9 +453,20 @@ func (q *Query) RunOne(model Model) error {
 // error that occured during the lifetime of the query object (if any).
 // Otherwise, the second return value will be nil.
 func (q *Query) Count() (uint, error) {
+	var count uint
+	err := runOp(q.newOp(QueryCountOp, nil, nil), func() error {
+		var err error
+		count, err = q.count()
+		return err
+	})
+	return count, err
+}
+
+// count is like Count but does not run middleware.
+func (q *Query) count() (uint, error) {
 	if !q.hasFilters() {
 		// Just return the number of ids in the all index set
-		conn := NewConn()
+		conn := q.newReadConn()
 		defer conn.Close()
 		count64, err := redis.Uint64(conn.Do("SCARD", q.modelSpec.allIndexKey()))
 		if err != nil {
@@ -420,7 +490,7 @@ func (q *Query) Count() (uint, error) {
 		// If the query has filters, it is difficult to do any optimizations.
 		// Instead we'll just count the number of ids that match the query
 		// criteria.
-		ids, err := q.Ids()
+		ids, err := q.ids(q.newReadTransaction)
 		if err != nil {
 			return 0, err
 		}
@@ -432,7 +502,19 @@ func (q *Query) Count() (uint, error) {
 // models themselves. Ids will return the first error that occured
 // during the lifetime of the query object (if any).
 func (q *Query) Ids() ([]string, error) {
-	q.tx = NewTransaction()
+	var ids []string
+	err := runOp(q.newOp(QueryIdsOp, nil, nil), func() error {
+		var err error
+		ids, err = q.ids(q.newReadTransaction)
+		return err
+	})
+	return ids, err
+}
+
+// ids is like Ids but uses newTransaction to create the transaction which is
+// used to execute the query.
+func (q *Query) ids(newTransaction func() *Transaction) ([]string, error) {
+	q.tx = newTransaction()
 	idsKey, tmpKeys, err := q.generateIdsSet()
 	if err != nil {
 		if len(tmpKeys) > 0 {
@@ -474,7 +556,7 @@ func (q *Query) generateIdsSet() (idsKey string, tmpKeys []interface{}, err erro
 		if fieldSpec.indexKind == stringIndex {
 			// If the order is a string field, we need to extract the ids before
 			// we use ZRANGE. Create a temporary set to store the ordered ids
-			orderedIdsKey := generateRandomKey("order:" + q.order.fieldName)
+			orderedIdsKey := q.generateRandomKey("order:" + q.order.fieldName)
 			tmpKeys = append(tmpKeys, orderedIdsKey)
 			idsKey = orderedIdsKey
 			// TODO: if there is a filter on the same field, pass the start and stop
@@ -485,7 +567,7 @@ func (q *Query) generateIdsSet() (idsKey string, tmpKeys []interface{}, err erro
 		}
 	}
 	if q.hasFilters() {
-		filteredIdsKey := generateRandomKey("filter:all")
+		filteredIdsKey := q.generateRandomKey("filter:all")
 		tmpKeys = append(tmpKeys, filteredIdsKey)
 		for i, filter := range q.filters {
 			if i == 0 {
@@ -511,38 +593,65 @@ func (q *Query) generateIdsSet() (idsKey string, tmpKeys []interface{}, err erro
 // delete any temporary sets created since, in this case, they are gauranteed to not be needed
 // by any other transaction commands.
 func (q *Query) intersectFilter(filter filter, origKey string, destKey string) error {
+	if filter.placeholder {
+		return fmt.Errorf("zoom: Error in Query: the filter on %s has a Placeholder value, so the query must be run with Prepare", filter.fieldSpec.name)
+	}
+	fieldIndexKey, err := q.modelSpec.fieldIndexKey(filter.fieldSpec.name)
+	if err != nil {
+		return err
+	}
+	q.tx.intersectFilter(filter, filterKeys{
+		fieldIndexKey: fieldIndexKey,
+		filterKey:     q.generateRandomKey("filter:" + fieldIndexKey),
+		origKey:       origKey,
+		destKey:       destKey,
+	})
+	return nil
+}
+
+// filterKeys are the keys used by the commands for a single filter.
+type filterKeys struct {
+	// fieldIndexKey is the key for the index on the filtered field
+	fieldIndexKey string
+	// filterKey is a temporary key which holds the ids that match the filter
+	filterKey string
+	// origKey holds the ids which are intersected with the ids that match the
+	// filter, and destKey is where the result is stored
+	origKey string
+	destKey string
+}
+
+// intersectFilter adds commands to the transaction which intersect the ids that
+// fit the given filter criteria with keys.origKey and store the result in
+// keys.destKey. See Query.intersectFilter.
+func (t *Transaction) intersectFilter(filter filter, keys filterKeys) {
 	switch filter.fieldSpec.indexKind {
 	case numericIndex:
-		return q.intersectNumericFilter(filter, origKey, destKey)
+		t.intersectNumericFilter(filter, keys)
 	case booleanIndex:
-		return q.intersectBoolFilter(filter, origKey, destKey)
+		t.intersectBoolFilter(filter, keys)
 	case stringIndex:
-		return q.intersectStringFilter(filter, origKey, destKey)
+		t.intersectStringFilter(filter, keys)
 	}
-	return nil
 }
 
-// intersectNumericFilter adds commands to the query transaction which, when run, will
+// intersectNumericFilter adds commands to the transaction which, when run, will
 // create a temporary set which contains all the ids of models which match the given
-// numeric filter criteria, then intersect those ids with origKey and store the result
-// in destKey.
-func (q *Query) intersectNumericFilter(filter filter, origKey string, destKey string) error {
-	fieldIndexKey, err := q.modelSpec.fieldIndexKey(filter.fieldSpec.name)
-	if err != nil {
-		return err
-	}
+// numeric filter criteria, then intersect those ids with keys.origKey and store the
+// result in keys.destKey.
+func (t *Transaction) intersectNumericFilter(filter filter, keys filterKeys) {
+	fieldIndexKey, filterKey := keys.fieldIndexKey, keys.filterKey
 	if filter.op == notEqualOp {
 		// Special case for not equal. We need to use two separate commands
 		valueExclusive := fmt.Sprintf("(%v", filter.value.Interface())
-		filterKey := generateRandomKey("filter:" + fieldIndexKey)
 		// ZADD all ids greater than filter.value
-		q.tx.extractIdsFromFieldIndex(fieldIndexKey, filterKey, valueExclusive, "+inf")
+		t.extractIdsFromFieldIndex(fieldIndexKey, filterKey, valueExclusive, "+inf")
 		// ZADD all ids less than filter.value
-		q.tx.extractIdsFromFieldIndex(fieldIndexKey, filterKey, "-inf", valueExclusive)
+		t.extractIdsFromFieldIndex(fieldIndexKey, filterKey, "-inf", valueExclusive)
 		// Intersect filterKey with origKey and store result in destKey
-		q.tx.Command("ZINTERSTORE", redis.Args{destKey, 2, origKey, filterKey, "WEIGHTS", 1, 0}, nil)
+		t.Command("ZINTERSTORE", redis.Args{keys.destKey, 2, keys.origKey, filterKey, "WEIGHTS", 1, 0}, nil)
 		// Delete the temporary key
-		q.tx.Command("DEL", redis.Args{filterKey}, nil)
+		t.Command("DEL", redis.Args{filterKey}, nil)
 	} else {
 		var min, max interface{}
 		switch filter.op {
@@ -563,25 +672,20 @@ func (q *Query) intersectNumericFilter(filter filter, origKey string, destKey st
 			max = "+inf"
 		}
 		// Get all the ids that fit the filter criteria and store them in a temporary key caled filterKey
-		filterKey := generateRandomKey("filter:" + fieldIndexKey)
-		q.tx.extractIdsFromFieldIndex(fieldIndexKey, filterKey, min, max)
+		t.extractIdsFromFieldIndex(fieldIndexKey, filterKey, min, max)
 		// Intersect filterKey with origKey and store result in destKey
-		q.tx.Command("ZINTERSTORE", redis.Args{destKey, 2, origKey, filterKey, "WEIGHTS", 1, 0}, nil)
+		t.Command("ZINTERSTORE", redis.Args{keys.destKey, 2, keys.origKey, filterKey, "WEIGHTS", 1, 0}, nil)
 		// Delete the temporary key
-		q.tx.Command("DEL", redis.Args{filterKey}, nil)
+		t.Command("DEL", redis.Args{filterKey}, nil)
 	}
-	return nil
 }
 
-// intersectBoolFilter adds commands to the query transaction which, when run, will
+// intersectBoolFilter adds commands to the transaction which, when run, will
 // create a temporary set which contains all the ids of models which match the given
-// bool filter criteria, then intersect those ids with origKey and store the result
-// in destKey.
-func (q *Query) intersectBoolFilter(filter filter, origKey string, destKey string) error {
-	fieldIndexKey, err := q.modelSpec.fieldIndexKey(filter.fieldSpec.name)
-	if err != nil {
-		return err
-	}
+// bool filter criteria, then intersect those ids with keys.origKey and store the
+// result in keys.destKey.
+func (t *Transaction) intersectBoolFilter(filter filter, keys filterKeys) {
+	fieldIndexKey, filterKey := keys.fieldIndexKey, keys.filterKey
 	var min, max interface{}
 	switch filter.op {
 	case equalOp:
@@ -632,38 +736,32 @@ func (q *Query) intersectBoolFilter(filter filter, origKey string, destKey strin
 		}
 	}
 	// Get all the ids that fit the filter criteria and store them in a temporary key caled filterKey
-	filterKey := generateRandomKey("filter:" + fieldIndexKey)
-	q.tx.extractIdsFromFieldIndex(fieldIndexKey, filterKey, min, max)
+	t.extractIdsFromFieldIndex(fieldIndexKey, filterKey, min, max)
 	// Intersect filterKey with origKey and store result in destKey
-	q.tx.Command("ZINTERSTORE", redis.Args{destKey, 2, origKey, filterKey, "WEIGHTS", 1, 0}, nil)
+	t.Command("ZINTERSTORE", redis.Args{keys.destKey, 2, keys.origKey, filterKey, "WEIGHTS", 1, 0}, nil)
 	// Delete the temporary key
-	q.tx.Command("DEL", redis.Args{filterKey}, nil)
-	return nil
+	t.Command("DEL", redis.Args{filterKey}, nil)
 }
 
-// intersectStringFilter adds commands to the query transaction which, when run, will
+// intersectStringFilter adds commands to the transaction which, when run, will
 // create a temporary set which contains all the ids of models which match the given
-// string filter criteria, then intersect those ids with origKey and store the result
-// in destKey.
-func (q *Query) intersectStringFilter(filter filter, origKey string, destKey string) error {
-	fieldIndexKey, err := q.modelSpec.fieldIndexKey(filter.fieldSpec.name)
-	if err != nil {
-		return err
-	}
-	valString := filter.value.String()
+// string filter criteria, then intersect those ids with keys.origKey and store the
+// result in keys.destKey.
+func (t *Transaction) intersectStringFilter(filter filter, keys filterKeys) {
+	fieldIndexKey, filterKey := keys.fieldIndexKey, keys.filterKey
+	valString := stringValue(filter.value)
 	if filter.op == notEqualOp {
 		// Special case for not equal. We need to use two separate commands
-		filterKey := generateRandomKey("filter:" + fieldIndexKey)
 		// ZADD all ids greater than filter.value
 		min := "(" + valString + nullString + delString
-		q.tx.extractIdsFromStringIndex(fieldIndexKey, filterKey, min, "+")
+		t.extractIdsFromStringIndex(fieldIndexKey, filterKey, min, "+")
 		// ZADD all ids less than filter.value
 		max := "(" + valString
-		q.tx.extractIdsFromStringIndex(fieldIndexKey, filterKey, "-", max)
+		t.extractIdsFromStringIndex(fieldIndexKey, filterKey, "-", max)
 		// Intersect filterKey with origKey and store result in destKey
-		q.tx.Command("ZINTERSTORE", redis.Args{destKey, 2, origKey, filterKey, "WEIGHTS", 1, 0}, nil)
+		t.Command("ZINTERSTORE", redis.Args{keys.destKey, 2, keys.origKey, filterKey, "WEIGHTS", 1, 0}, nil)
 		// Delete the temporary key
-		q.tx.Command("DEL", redis.Args{filterKey}, nil)
+		t.Command("DEL", redis.Args{filterKey}, nil)
 	} else {
 		var min, max string
 		switch filter.op {
@@ -684,44 +782,39 @@ func (q *Query) intersectStringFilter(filter filter, origKey string, destKey str
 			max = "+"
 		}
 		// Get all the ids that fit the filter criteria and store them in a temporary key caled filterKey
-		filterKey := generateRandomKey("filter:" + fieldIndexKey)
-		q.tx.extractIdsFromStringIndex(fieldIndexKey, filterKey, min, max)
+		t.extractIdsFromStringIndex(fieldIndexKey, filterKey, min, max)
 		// Intersect filterKey with origKey and store result in destKey
-		q.tx.Command("ZINTERSTORE", redis.Args{destKey, 2, origKey, filterKey, "WEIGHTS", 1, 0}, nil)
+		t.Command("ZINTERSTORE", redis.Args{keys.destKey, 2, keys.origKey, filterKey, "WEIGHTS", 1, 0}, nil)
 		// Delete the temporary key
-		q.tx.Command("DEL", redis.Args{filterKey}, nil)
+		t.Command("DEL", redis.Args{filterKey}, nil)
 	}
-	return nil
 }
 
 // fieldNames parses the includes and excludes properties to return a list of
 // field names which should be included in all find operations. If there are no
-// includes or excludes, it returns all the field names.
+// includes or excludes, it returns all the field names except for lazy fields.
 func (q *Query) fieldNames() []string {
 	switch {
 	case q.hasIncludes():
 		return q.includes
 	case q.hasExcludes():
-		results := q.modelSpec.fieldNames()
+		results := q.modelSpec.eagerFieldNames()
 		for _, name := range q.excludes {
 			results = removeElementFromStringSlice(results, name)
 		}
 		return results
 	default:
-		return q.modelSpec.fieldNames()
+		return q.modelSpec.eagerFieldNames()
 	}
 }
 
 // redisFieldNames parses the includes and excludes properties to return a list of
 // redis names for each field which should be included in all find operations. If
-// there are no includes or excludes, it returns the redis names for all fields.
+// there are no includes or excludes, it returns the redis names for all fields. Only
+// fields which are stored in the main hash for the model are included.
 func (q *Query) redisFieldNames() []string {
-	fieldNames := q.fieldNames()
-	redisNames := []string{}
-	for _, fieldName := range fieldNames {
-		redisNames = append(redisNames, q.modelSpec.fieldsByName[fieldName].redisName)
-	}
-	return redisNames
+	fieldNames := q.modelSpec.hashFieldNames(q.modelSpec.withVersion(q.fieldNames()))
+	return q.modelSpec.redisNames(fieldNames)
 }
 
 // converts limit and offset to start and stop values for cases where redis
@@ -764,8 +857,9 @@ func (q *Query) hasError() bool {
 }
 
 // generateRandomKey generates a random string that is more or less
-// garunteed to be unique and then prepends the given prefix. It is
-// used to generate keys for temporary sorted sets in queries.
-func generateRandomKey(prefix string) string {
-	return prefix + ":" + generateRandomId()
+// garunteed to be unique and then prepends the given prefix and the
+// KeyPrefix for the pool. It is used to generate keys for temporary
+// sorted sets in queries.
+func (q *Query) generateRandomKey(prefix string) string {
+	return q.modelSpec.keyPrefix() + prefix + ":" + generateRandomId()
 }
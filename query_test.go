@@ -213,6 +213,33 @@ func TestQueryCombos(t *testing.T) {
 	}
 }
 
+func TestQueryParallel(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Use a batch size which does not evenly divide the number of models, and
+	// more workers than there are batches for some queries
+	queries := []*Query{
+		indexedTestModels.NewQuery().Parallel(3, 3),
+		indexedTestModels.NewQuery().Order("-Int").Parallel(2, 3),
+		indexedTestModels.NewQuery().Order("String").Limit(5).Offset(1).Parallel(8, 1),
+		indexedTestModels.NewQuery().Filter("Bool =", true).Parallel(4, 2),
+		indexedTestModels.NewQuery().Include("Int", "String").Parallel(3, 4),
+	}
+	for _, q := range queries {
+		testQueryRun(t, q, expectedResultsForQuery(q, models))
+	}
+
+	expectedString := `indexedTestModel.NewQuery().Parallel(3, 3)`
+	if got := queries[0].String(); got != expectedString {
+		t.Errorf("Expected String to return %s but got %s", expectedString, got)
+	}
+}
+
 func TestQueryRunOne(t *testing.T) {
 	testingSetUp()
 	defer testingTearDown()
@@ -372,7 +399,7 @@ func applyFilter(models []*indexedTestModel, filter filter) []*indexedTestModel
 	case numericIndex:
 		filterFunc = func(m *indexedTestModel) bool {
 			fieldVal := reflect.ValueOf(m).Elem().FieldByName(filter.fieldSpec.name).Convert(reflect.TypeOf(0.0)).Float()
-			filterVal := numericScore(filter.value)
+			filterVal, _ := numericScore(filter.value)
 			switch filter.op {
 			case equalOp:
 				return fieldVal == filterVal
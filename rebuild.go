@@ -0,0 +1,191 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File rebuild.go contains code related to rebuilding the field
+// indexes for a model type, e.g. after adding an index to a type
+// which already has models saved.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// defaultRebuildBatchSize is the batch size used by RebuildIndexes if
+// RebuildOptions.BatchSize is 0.
+const defaultRebuildBatchSize = 1000
+
+// RebuildOptions are the options for ModelType.RebuildIndexes.
+type RebuildOptions struct {
+	// BatchSize is the number of models which are read and reindexed in each
+	// round trip. If it is 0, a batch size of 1000 is used.
+	BatchSize int
+	// RateLimit is the maximum number of models to reindex per second, so that
+	// the rebuild does not slow down other clients. If it is 0, there is no
+	// limit.
+	RateLimit int
+	// Progress, if not nil, is called after each batch with the number of
+	// models which have been reindexed so far and the total number of models
+	// when the rebuild started. done may be greater than total if models are
+	// saved during the rebuild.
+	Progress func(done int, total int)
+}
+
+// RebuildIndexes rebuilds the indexes for all the indexed fields of the given
+// type from the values stored in the main hash of each model. This is needed
+// when an index is added to a type which already has models saved, or if the
+// indexes have become inconsistent with the models, e.g. because a model was
+// modified without using zoom.
+//
+// The models are read and reindexed in batches, with each batch sent to the
+// database in a pipeline instead of a transaction, so the rebuild never blocks
+// the database for long. Queries may return incomplete results while indexes
+// are being rebuilt. After every model has been reindexed, any index entries
+// for models which no longer exist are removed. A model which is saved
+// with zoom while its batch is being reindexed may be left with the old value
+// in its index entries, so it is best to rebuild indexes when models of the
+// type are not being changed. RebuildIndexes returns the number of models that
+// were reindexed.
+func (mt *ModelType) RebuildIndexes(options RebuildOptions) (int, error) {
+	if options.BatchSize < 0 {
+		return 0, fmt.Errorf("zoom: Error in RebuildIndexes: BatchSize cannot be negative but got %d", options.BatchSize)
+	}
+	if options.RateLimit < 0 {
+		return 0, fmt.Errorf("zoom: Error in RebuildIndexes: RateLimit cannot be negative but got %d", options.RateLimit)
+	}
+	batchSize := options.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultRebuildBatchSize
+	}
+	indexedFields := []*fieldSpec{}
+	for _, fs := range mt.spec.fields {
+		if fs.indexKind != noIndex {
+			indexedFields = append(indexedFields, fs)
+		}
+	}
+	if len(indexedFields) == 0 {
+		return 0, nil
+	}
+	total, err := mt.Count()
+	if err != nil {
+		return 0, fmt.Errorf("zoom: Error in RebuildIndexes: %s", err.Error())
+	}
+	done := 0
+	start := time.Now()
+	if err := mt.scanBatches(batchSize, func(batch reflect.Value) error {
+		pl := mt.spec.pool.NewPipeline()
+		futures := make([]*Future, batch.Len())
+		for i := 0; i < batch.Len(); i++ {
+			mr := &modelRef{
+				spec:  mt.spec,
+				model: batch.Index(i).Interface().(Model),
+			}
+			futures[i] = pl.queue(func(t *Transaction) { t.saveFieldIndexes(mr, indexedFields) })
+		}
+		if err := pl.Flush(); err != nil {
+			return err
+		}
+		// Errors which occurred while queuing are not returned by Flush
+		for _, f := range futures {
+			if err := f.Err(); err != nil {
+				return err
+			}
+		}
+		done += batch.Len()
+		if options.Progress != nil {
+			options.Progress(done, total)
+		}
+		throttle(start, done, options.RateLimit)
+		return nil
+	}); err != nil {
+		return done, fmt.Errorf("zoom: Error in RebuildIndexes: %s", err.Error())
+	}
+	for _, fs := range indexedFields {
+		if err := mt.removeOrphanedIndexEntries(fs, batchSize); err != nil {
+			return done, fmt.Errorf("zoom: Error in RebuildIndexes: %s", err.Error())
+		}
+	}
+	return done, nil
+}
+
+// throttle sleeps for as long as needed so that no more than rateLimit models
+// per second have been processed since start, given that done models have been
+// processed so far. It has no effect if rateLimit is 0.
+func throttle(start time.Time, done int, rateLimit int) {
+	if rateLimit <= 0 {
+		return
+	}
+	expected := time.Duration(float64(done) / float64(rateLimit) * float64(time.Second))
+	if elapsed := time.Since(start); elapsed < expected {
+		time.Sleep(expected - elapsed)
+	}
+}
+
+// removeOrphanedIndexEntries removes the entries from the index for the given
+// field which belong to models that are not in the set of all models of the
+// given type. The index is scanned batchSize entries at a time.
+func (mt *ModelType) removeOrphanedIndexEntries(fs *fieldSpec, batchSize int) error {
+	indexKey, err := mt.spec.fieldIndexKey(fs.name)
+	if err != nil {
+		return err
+	}
+	conn := mt.spec.pool.NewConn()
+	defer conn.Close()
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("ZSCAN", indexKey, cursor, "COUNT", batchSize))
+		if err != nil {
+			return err
+		}
+		var entries []string
+		if _, err := redis.Scan(values, &cursor, &entries); err != nil {
+			return err
+		}
+		// entries alternates between members and scores
+		members := []string{}
+		for i := 0; i < len(entries); i += 2 {
+			members = append(members, entries[i])
+		}
+		for _, member := range members {
+			if err := conn.Send("SISMEMBER", mt.AllIndexKey(), indexMemberId(fs, member)); err != nil {
+				return err
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		orphans := []interface{}{}
+		for _, member := range members {
+			exists, err := redis.Bool(conn.Receive())
+			if err != nil {
+				return err
+			}
+			if !exists {
+				orphans = append(orphans, member)
+			}
+		}
+		if len(orphans) > 0 {
+			if _, err := conn.Do("ZREM", redis.Args{indexKey}.Add(orphans...)...); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// indexMemberId returns the id of the model for the given member of the index
+// for fs. Members of string indexes consist of the value and the id separated
+// by a null character, and members of other indexes are just the id.
+func indexMemberId(fs *fieldSpec, member string) string {
+	if fs.indexKind != stringIndex {
+		return member
+	}
+	return member[strings.LastIndex(member, nullString)+1:]
+}
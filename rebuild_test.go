@@ -0,0 +1,104 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File rebuild_test.go tests the code in rebuild.go.
+
+package zoom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRebuildIndexes(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(10)
+	if err != nil {
+		t.Fatalf("Unexpected error saving indexed test models: %s", err.Error())
+	}
+	// Remove the indexes and add an entry for a model which does not exist
+	conn := NewConn()
+	defer conn.Close()
+	for _, fieldName := range []string{"Int", "String", "Bool"} {
+		indexKey, err := indexedTestModels.FieldIndexKey(fieldName)
+		if err != nil {
+			t.Fatalf("Unexpected error in FieldIndexKey: %s", err.Error())
+		}
+		if _, err := conn.Do("DEL", indexKey); err != nil {
+			t.Fatalf("Unexpected error in DEL: %s", err.Error())
+		}
+	}
+	intIndexKey, _ := indexedTestModels.FieldIndexKey("Int")
+	if _, err := conn.Do("ZADD", intIndexKey, 0, "orphan"); err != nil {
+		t.Fatalf("Unexpected error in ZADD: %s", err.Error())
+	}
+
+	progressCalls := 0
+	lastDone := 0
+	n, err := indexedTestModels.RebuildIndexes(RebuildOptions{
+		BatchSize: 3,
+		Progress: func(done, total int) {
+			progressCalls++
+			lastDone = done
+			if total != len(models) {
+				t.Errorf("Expected total to be %d but got %d", len(models), total)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in RebuildIndexes: %s", err.Error())
+	}
+	if n != len(models) {
+		t.Errorf("Expected %d models to be reindexed but got %d", len(models), n)
+	}
+	if progressCalls == 0 || lastDone != n {
+		t.Errorf("Expected Progress to be called with done = %d but got %d calls ending with %d", n, progressCalls, lastDone)
+	}
+	if score, err := conn.Do("ZSCORE", intIndexKey, "orphan"); err != nil {
+		t.Fatalf("Unexpected error in ZSCORE: %s", err.Error())
+	} else if score != nil {
+		t.Error("Expected the orphaned index entry to be removed")
+	}
+
+	// Queries on each index should work again
+	queries := []*Query{
+		indexedTestModels.NewQuery().Order("Int"),
+		indexedTestModels.NewQuery().Order("String"),
+		indexedTestModels.NewQuery().Filter("Bool =", true),
+	}
+	for _, q := range queries {
+		testQueryRun(t, q, expectedResultsForQuery(q, models))
+	}
+
+	// Validation
+	if _, err := indexedTestModels.RebuildIndexes(RebuildOptions{BatchSize: -1}); err == nil {
+		t.Error("Expected error with a negative BatchSize but got none")
+	}
+}
+
+func TestIndexMemberId(t *testing.T) {
+	numeric := &fieldSpec{indexKind: numericIndex}
+	if got := indexMemberId(numeric, "abc"); got != "abc" {
+		t.Errorf("Expected abc but got %s", got)
+	}
+	str := &fieldSpec{indexKind: stringIndex}
+	if got := indexMemberId(str, "value"+nullString+"abc"); got != "abc" {
+		t.Errorf("Expected abc but got %s", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	start := time.Now()
+	throttle(start, 5, 100)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected throttle to wait at least 50ms but it took %s", elapsed)
+	}
+	start = time.Now()
+	throttle(start, 1000, 0)
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("Expected throttle to return right away without a rate limit but it took %s", elapsed)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File reconnect.go contains code related to checking the health of
+// connections and retrying transactions which fail because of a
+// network error.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"strings"
+	"time"
+)
+
+// newHealthCheck returns a function suitable for redis.Pool.TestOnBorrow which
+// uses the PING command to check connections which have been idle for at least
+// interval. It returns nil if interval is negative. If the check fails, the
+// ConnectionDropped hooks for p are called.
+func (p *Pool) newHealthCheck(interval time.Duration) func(redis.Conn, time.Time) error {
+	if interval < 0 {
+		return nil
+	}
+	return func(c redis.Conn, lastUsed time.Time) error {
+		if time.Since(lastUsed) < interval {
+			return nil
+		}
+		if _, err := c.Do("PING"); err != nil {
+			p.runConnectionDroppedHooks(err)
+			return err
+		}
+		return nil
+	}
+}
+
+// readOnlyCommands is the set of commands which do not modify the database and
+// therefore can safely be sent more than once.
+var readOnlyCommands = map[string]bool{
+	"EXISTS":        true,
+	"GET":           true,
+	"HGET":          true,
+	"HGETALL":       true,
+	"HMGET":         true,
+	"LLEN":          true,
+	"LRANGE":        true,
+	"PTTL":          true,
+	"SCARD":         true,
+	"SISMEMBER":     true,
+	"SMEMBERS":      true,
+	"SORT":          true,
+	"ZCARD":         true,
+	"ZRANGE":        true,
+	"ZRANGEBYSCORE": true,
+	"ZREVRANGE":     true,
+	"ZSCORE":        true,
+}
+
+// isReadOnly returns true iff every action in t is a read-only command.
+func (t *Transaction) isReadOnly() bool {
+	for _, a := range t.actions {
+		if a.kind != CommandAction || !readOnlyCommands[strings.ToUpper(a.name)] {
+			return false
+		}
+		if strings.ToUpper(a.name) == "SORT" {
+			// SORT modifies the database if the STORE option is used
+			for _, arg := range a.args {
+				if s, ok := arg.(string); ok && strings.ToUpper(s) == "STORE" {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// replaceConn closes t.conn and replaces it with a new connection.
+func (t *Transaction) replaceConn() {
+	t.conn.Close()
+	t.conn = t.newConn()
+}
+
+// execWithRetries is like exec but retries up to t.pool.networkRetries times if the
+// connection is broken. A broken connection is always replaced if nothing has
+// been sent yet and t is not watching any keys. Otherwise the transaction is only retried if doing so can not
+// apply changes twice, i.e. if it is read-only and not watching any keys (since
+// a new connection would not be watching them).
+func (t *Transaction) execWithRetries() ([]interface{}, error) {
+	retries := t.pool.getState().networkRetries
+	for {
+		for retries > 0 && len(t.watching) == 0 && t.conn.Err() != nil {
+			t.pool.checkError(t.conn, t.conn.Err())
+			retries--
+			t.replaceConn()
+		}
+		replies, err := t.exec()
+		if err != nil {
+			t.pool.checkError(t.conn, err)
+		}
+		if err == nil || retries <= 0 || !t.canRetry(err) {
+			return replies, err
+		}
+		retries--
+		t.replaceConn()
+	}
+}
+
+// canRetry returns true iff t failed with the given err because of a network
+// error and can safely be retried.
+func (t *Transaction) canRetry(err error) bool {
+	if _, isRedisError := err.(redis.Error); isRedisError {
+		return false
+	}
+	if _, isWatchError := err.(WatchError); isWatchError {
+		return false
+	}
+	return t.conn.Err() != nil && len(t.watching) == 0 && t.isReadOnly()
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File reconnect_test.go tests the code in reconnect.go, i.e.
+// retrying transactions which fail because of a network error.
+
+package zoom
+
+import (
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"testing"
+)
+
+// brokenConn is a redis.Conn used for testing. If err is not nil, every
+// operation fails with err. Otherwise Do replies with "OK".
+type brokenConn struct {
+	err   error
+	calls *int
+}
+
+func (c brokenConn) Close() error { return nil }
+func (c brokenConn) Err() error   { return c.err }
+func (c brokenConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	*c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return "OK", nil
+}
+func (c brokenConn) Send(commandName string, args ...interface{}) error { return c.err }
+func (c brokenConn) Flush() error                                       { return c.err }
+func (c brokenConn) Receive() (interface{}, error)                      { return nil, c.err }
+
+// newBrokenConnGetter returns a function which returns numBroken broken
+// connections followed by healthy ones.
+func newBrokenConnGetter(numBroken int, calls *int) func() redis.Conn {
+	return func() redis.Conn {
+		if numBroken > 0 {
+			numBroken--
+			return brokenConn{err: errors.New("connection reset"), calls: calls}
+		}
+		return brokenConn{calls: calls}
+	}
+}
+
+func TestNetworkRetries(t *testing.T) {
+	p := &Pool{state: &poolState{networkRetries: 1}}
+
+	// A read-only transaction should be retried on a new connection
+	calls := 0
+	tx := newTransaction(p, newBrokenConnGetter(1, &calls))
+	var reply interface{}
+	tx.Command("HGET", redis.Args{"key", "field"}, func(r interface{}) error {
+		reply = r
+		return nil
+	})
+	if err := tx.Exec(); err != nil {
+		t.Fatalf("Unexpected error in Exec: %s", err.Error())
+	}
+	if reply != "OK" {
+		t.Errorf("Expected reply to be OK but got %v", reply)
+	}
+
+	// A transaction which writes should not be retried once it has been sent.
+	// We simulate this by using a connection which is healthy until Do is
+	// called.
+	calls = 0
+	tx = newTransaction(p, func() redis.Conn { return &breaksOnDoConn{calls: &calls} })
+	tx.Command("HSET", redis.Args{"key", "field", "value"}, nil)
+	if err := tx.Exec(); err == nil {
+		t.Error("Expected error from Exec but got none")
+	}
+	if calls != 1 {
+		t.Errorf("Expected HSET to be sent once but it was sent %d times", calls)
+	}
+
+	// Retries should be limited to networkRetries
+	calls = 0
+	tx = newTransaction(p, newBrokenConnGetter(3, &calls))
+	tx.Command("HGET", redis.Args{"key", "field"}, nil)
+	if err := tx.Exec(); err == nil {
+		t.Error("Expected error from Exec when every connection is broken but got none")
+	}
+}
+
+// breaksOnDoConn is a redis.Conn used for testing which becomes broken after
+// the first call to Do.
+type breaksOnDoConn struct {
+	err   error
+	calls *int
+}
+
+func (c *breaksOnDoConn) Close() error { return nil }
+func (c *breaksOnDoConn) Err() error   { return c.err }
+func (c *breaksOnDoConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	*c.calls++
+	c.err = errors.New("connection reset")
+	return nil, c.err
+}
+func (c *breaksOnDoConn) Send(commandName string, args ...interface{}) error { return c.err }
+func (c *breaksOnDoConn) Flush() error                                       { return c.err }
+func (c *breaksOnDoConn) Receive() (interface{}, error)                      { return nil, c.err }
@@ -0,0 +1,101 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File replicas.go contains code related to sending read operations
+// to read-only replicas of the database.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"sync/atomic"
+)
+
+// newReplicaPools creates a redis pool for each of config.ReplicaAddresses.
+// Other than the address, each pool uses the same options as the master.
+func (p *Pool) newReplicaPools(config *Configuration) ([]Driver, error) {
+	replicas := []Driver{}
+	for _, address := range config.ReplicaAddresses {
+		replicaConfig := *config
+		replicaConfig.Address = address
+		replica, err := p.newRedisPool(&replicaConfig)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
+
+// newReadConn returns a connection to one of the replicas, which are chosen in
+// round-robin order. If there are no replicas it returns a connection to the
+// master.
+func (p *Pool) newReadConn() redis.Conn {
+	replicas := p.getState().replicas
+	if len(replicas) == 0 {
+		return p.NewConn()
+	}
+	i := atomic.AddUint32(&p.nextReplica, 1)
+	return p.checkConn(replicas[int(i)%len(replicas)].Get())
+}
+
+// FromMaster returns a copy of mt which sends all reads to the master instead of
+// to a replica. Since replication is asynchronous, a model which was just saved
+// may not exist on the replicas yet, so FromMaster should be used whenever you
+// need to read your own writes. It has no effect if no ReplicaAddresses were
+// provided in the Configuration. Queries created with NewQuery on the returned
+// ModelType are also sent to the master.
+func (mt *ModelType) FromMaster() *ModelType {
+	return &ModelType{spec: mt.spec, fromMaster: true}
+}
+
+// newReadTransaction returns a new transaction which should only be used for
+// reads. It uses a replica unless mt.fromMaster is true.
+func (mt *ModelType) newReadTransaction() *Transaction {
+	if mt.fromMaster {
+		return mt.spec.pool.NewTransaction()
+	}
+	return newTransaction(mt.spec.pool, mt.spec.pool.newReadConn)
+}
+
+// FromMaster causes the query to be sent to the master instead of to a replica.
+// See ModelType.FromMaster. Note that queries which need to create temporary
+// keys, i.e. queries with filters or which are ordered by a string field, are
+// always sent to the master.
+func (q *Query) FromMaster() *Query {
+	q.fromMaster = true
+	return q
+}
+
+// newReadConn returns a connection which should only be used for reads. It
+// is a connection to a replica unless q.fromMaster is true.
+func (q *Query) newReadConn() redis.Conn {
+	if q.fromMaster {
+		return q.modelSpec.pool.NewConn()
+	}
+	return q.modelSpec.pool.newReadConn()
+}
+
+// newReadTransaction returns a new transaction for executing the query. It
+// uses a replica unless q.fromMaster is true or the query needs to create
+// temporary keys, which is not possible on a read-only replica.
+func (q *Query) newReadTransaction() *Transaction {
+	if q.needsTemporaryKeys() {
+		return q.modelSpec.pool.NewTransaction()
+	}
+	return newTransaction(q.modelSpec.pool, q.newReadConn)
+}
+
+// needsTemporaryKeys returns true iff executing the query requires creating
+// temporary keys, i.e. if it has filters or is ordered by a string field.
+func (q *Query) needsTemporaryKeys() bool {
+	if q.hasFilters() {
+		return true
+	}
+	if q.hasOrder() {
+		fs, found := q.modelSpec.fieldsByName[q.order.fieldName]
+		return found && fs.indexKind == stringIndex
+	}
+	return false
+}
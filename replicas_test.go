@@ -0,0 +1,80 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File replicas_test.go tests the code in replicas.go, i.e.
+// sending read operations to replicas.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplicaReads(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Use the same server as both the master and the replica so we can test
+	// the routing without actually setting up replication
+	replicaPool, err := NewPool(&Configuration{
+		Address:          *address,
+		Network:          *network,
+		Database:         *database,
+		ReplicaAddresses: []string{*address, *address},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in NewPool: %s", err.Error())
+	}
+	defer func() {
+		replicaPool.Close()
+		removeLastPool()
+	}()
+	if len(replicaPool.getState().replicas) != 2 {
+		t.Fatalf("Expected 2 replicas but got %d", len(replicaPool.getState().replicas))
+	}
+	replicaModels, err := replicaPool.Register(&indexedTestModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+	model := createIndexedTestModels(1)[0]
+	if err := replicaModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	for _, mt := range []*ModelType{replicaModels, replicaModels.FromMaster()} {
+		modelCopy := &indexedTestModel{}
+		if err := mt.Find(model.Id(), modelCopy); err != nil {
+			t.Fatalf("Unexpected error in Find: %s", err.Error())
+		}
+		if !reflect.DeepEqual(model, modelCopy) {
+			t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+		}
+		gotModels := []*indexedTestModel{}
+		if err := mt.NewQuery().Filter("Int =", model.Int).Run(&gotModels); err != nil {
+			t.Fatalf("Unexpected error in Run: %s", err.Error())
+		}
+		if len(gotModels) != 1 {
+			t.Errorf("Expected 1 model from Run but got %d", len(gotModels))
+		}
+	}
+}
+
+func TestQueryNeedsTemporaryKeys(t *testing.T) {
+	testingSetUp()
+	testCases := []struct {
+		query    *Query
+		expected bool
+	}{
+		{indexedTestModels.NewQuery(), false},
+		{indexedTestModels.NewQuery().Order("Int").Limit(10), false},
+		{indexedTestModels.NewQuery().Order("String"), true},
+		{indexedTestModels.NewQuery().Filter("Int >", 5), true},
+	}
+	for _, tc := range testCases {
+		if got := tc.query.needsTemporaryKeys(); got != tc.expected {
+			t.Errorf("Expected needsTemporaryKeys to be %v for %s but got %v", tc.expected, tc.query, got)
+		}
+	}
+}
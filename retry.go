@@ -0,0 +1,82 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File retry.go contains code related to automatically retrying
+// transactions which were aborted because a watched key was modified.
+
+package zoom
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy determines how many times a transaction run with RunTransaction
+// will be attempted and how long to wait between attempts. A transaction is
+// only retried if it was aborted because a watched key was modified, i.e. if
+// Exec returned a WatchError. RetryPolicy is also used for retrying failed
+// attempts to connect to the database (see Configuration.DialRetryPolicy), in
+// which case the defaults are different.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the transaction will be
+	// attempted, including the first attempt. Default: 5
+	MaxAttempts int
+	// MinBackoff is the base amount of time to wait before retrying. The actual
+	// amount of time is chosen randomly (i.e. with jitter) and grows exponentially
+	// with each failed attempt. Default: 5ms
+	MinBackoff time.Duration
+	// MaxBackoff is the upper limit on the amount of time to wait between
+	// attempts. Default: 500ms
+	MaxBackoff time.Duration
+}
+
+// RunTransaction creates a new transaction and passes it to fn. fn should
+// watch any keys it depends on (using Watch or WatchKey), read the values it
+// needs, and then add commands to the transaction. RunTransaction then executes
+// the transaction. If the transaction is aborted because a watched key was
+// modified, RunTransaction will wait according to the configured RetryPolicy
+// and then call fn again with a fresh transaction. If fn returns an error, the
+// transaction is not executed and the error is returned immediately. If the
+// transaction is still being aborted after the maximum number of attempts,
+// RunTransaction returns the last WatchError.
+func RunTransaction(fn func(t *Transaction) error) error {
+	return RunTransactionWithPolicy(getSettings().retryPolicy, fn)
+}
+
+// RunTransactionWithPolicy is like RunTransaction but uses the given policy
+// instead of the one provided in the Configuration passed to Init.
+func RunTransactionWithPolicy(policy RetryPolicy, fn func(t *Transaction) error) error {
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(policy.backoff(attempt))
+		}
+		t := NewTransaction()
+		if err := fn(t); err != nil {
+			t.conn.Close()
+			return err
+		}
+		err = t.Exec()
+		if _, aborted := err.(WatchError); !aborted {
+			return err
+		}
+	}
+	return err
+}
+
+// backoff returns a random duration between 0 and the exponential backoff
+// for the given attempt number, capped at p.MaxBackoff.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	max := p.MinBackoff
+	for i := 1; i < attempt && max < p.MaxBackoff; i++ {
+		max *= 2
+	}
+	if max > p.MaxBackoff {
+		max = p.MaxBackoff
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
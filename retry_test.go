@@ -0,0 +1,82 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File retry_test.go tests watching keys and automatically
+// retrying transactions (the code in retry.go).
+
+package zoom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchError(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveTestModels(1)
+	if err != nil {
+		t.Fatalf("Unexpected error saving test models: %s", err.Error())
+	}
+	model := models[0]
+
+	// Watch the model, then modify it from a different connection
+	tx := NewTransaction()
+	if err := tx.Watch(testModels, model); err != nil {
+		t.Fatalf("Unexpected error in tx.Watch: %s", err.Error())
+	}
+	model.Int++
+	if err := testModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// Executing the transaction should fail with a WatchError
+	tx.Save(testModels, model)
+	err = tx.Exec()
+	if err == nil {
+		t.Fatal("Expected a WatchError but got nil")
+	}
+	if _, ok := err.(WatchError); !ok {
+		t.Errorf("Expected a WatchError but got: %T: %s", err, err.Error())
+	}
+}
+
+func TestRunTransactionRetry(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveTestModels(1)
+	if err != nil {
+		t.Fatalf("Unexpected error saving test models: %s", err.Error())
+	}
+	model := models[0]
+
+	// Modify the watched model during the first attempt only. We expect the
+	// first attempt to be aborted and the second to succeed.
+	attempts := 0
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	err = RunTransactionWithPolicy(policy, func(tx *Transaction) error {
+		attempts++
+		if err := tx.Watch(testModels, model); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			if err := testModels.Save(model); err != nil {
+				return err
+			}
+		}
+		model.Int++
+		tx.Save(testModels, model)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in RunTransactionWithPolicy: %s", err.Error())
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts but got %d", attempts)
+	}
+	key, _ := testModels.ModelKey(model.Id())
+	expectFieldEquals(t, key, "Int", model.Int)
+}
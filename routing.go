@@ -0,0 +1,62 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File routing.go contains code related to storing different model
+// types in different databases or on different servers.
+
+package zoom
+
+import (
+	"fmt"
+)
+
+// UsePool is a ModelOption which causes models of the given type to be stored
+// using p instead of the pool the type was registered with. The type is still
+// registered with (and its name reserved in) the pool it was registered with,
+// e.g. the default pool when using RegisterWithOptions. This allows hot or
+// ephemeral types to live on a different server or database than durable
+// types without passing a Pool around. Note that transactions are bound to a
+// single pool, so a transaction which includes the type must be created with
+// p.NewTransaction.
+func UsePool(p *Pool) ModelOption {
+	return func(spec *modelSpec) error {
+		if p == nil {
+			return fmt.Errorf("zoom: UsePool requires a non-nil Pool")
+		}
+		spec.pool = p
+		return nil
+	}
+}
+
+// WithDatabase returns a new Pool which connects to the same server as p with
+// the same configuration, but uses the given database number. The returned pool
+// is independent of p and should be closed separately.
+func (p *Pool) WithDatabase(database int) (*Pool, error) {
+	state := p.getState()
+	if state == nil {
+		return nil, fmt.Errorf("zoom: Error in WithDatabase: pool has not been initialized")
+	}
+	config := *state.config
+	config.Database = database
+	config.URL = ""
+	return NewPool(&config)
+}
+
+// checkPool returns an error if mt uses a different pool than t. It has no
+// effect if the pool for t is unknown.
+func (t *Transaction) checkPool(mt *ModelType) error {
+	if t.pool != nil && mt.spec.pool != t.pool {
+		return fmt.Errorf("%s uses a different pool than the transaction. Create the transaction with the NewTransaction method of the same Pool", mt.Name())
+	}
+	return nil
+}
+
+// checkModelTypeAndPool returns an error if model is not the type of mt or if
+// mt uses a different pool than t.
+func (t *Transaction) checkModelTypeAndPool(mt *ModelType, model Model) error {
+	if err := mt.checkModelType(model); err != nil {
+		return err
+	}
+	return t.checkPool(mt)
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File routing_test.go tests the code in routing.go, i.e. binding
+// model types to a specific pool or database.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"strings"
+	"testing"
+)
+
+type routedModel struct {
+	Int    int
+	String string
+	DefaultData
+}
+
+func TestUsePool(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	otherDatabase := *database + 1
+	otherPool, err := defaultPool.WithDatabase(otherDatabase)
+	if err != nil {
+		t.Fatalf("Unexpected error in WithDatabase: %s", err.Error())
+	}
+	defer func() {
+		conn := otherPool.NewConn()
+		if _, err := conn.Do("FLUSHDB"); err != nil {
+			t.Errorf("Unexpected error in FLUSHDB: %s", err.Error())
+		}
+		conn.Close()
+		otherPool.Close()
+		removeLastPool()
+	}()
+	conn := otherPool.NewConn()
+	n, err := redis.Int(conn.Do("DBSIZE"))
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error in DBSIZE: %s", err.Error())
+	}
+	if n != 0 {
+		t.Skipf("Database #%d is not empty, skipping", otherDatabase)
+	}
+
+	routedModels := registerTestType(t, &routedModel{}, UsePool(otherPool))
+
+	// Save and find a model. It should be stored in the other database.
+	model := &routedModel{Int: 42, String: "routed"}
+	if err := routedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	found := &routedModel{}
+	if err := routedModels.Find(model.Id(), found); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if found.Int != model.Int || found.String != model.String {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, found)
+	}
+	key, err := routedModels.ModelKey(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in ModelKey: %s", err.Error())
+	}
+	conn = otherPool.NewConn()
+	exists, err := redis.Bool(conn.Do("EXISTS", key))
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error in EXISTS: %s", err.Error())
+	}
+	if !exists {
+		t.Errorf("Expected key %s to exist in database #%d", key, otherDatabase)
+	}
+	conn = NewConn()
+	exists, err = redis.Bool(conn.Do("EXISTS", key))
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error in EXISTS: %s", err.Error())
+	}
+	if exists {
+		t.Errorf("Expected key %s to not exist in the default database", key)
+	}
+
+	// Using a transaction from the default pool should result in an error.
+	tx := NewTransaction()
+	tx.Save(routedModels, &routedModel{})
+	if err := tx.Exec(); err == nil {
+		t.Error("Expected an error when using a transaction from a different pool but got none")
+	} else if !strings.Contains(err.Error(), "different pool") {
+		t.Errorf("Expected error to mention a different pool but got: %s", err.Error())
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File schedule.go contains code related to deleting models at
+// a scheduled time.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sync"
+	"time"
+)
+
+// deleteScheduleKey returns the key for a sorted set which holds the ids of
+// models of the given type which are scheduled to be deleted, with the time
+// they should be deleted (in milliseconds since the epoch) as the score.
+func (ms *modelSpec) deleteScheduleKey() string {
+	return ms.internalKey("deleteAt")
+}
+
+// DeleteAt schedules the model with the given id to be deleted at the given
+// time, which is useful for things like reservations or embargoes which must end
+// at an exact time. Unlike TTL or SaveWithTTL, the model is deleted exactly as
+// if Delete had been called, so it is removed from the set of all models and
+// from any field indexes. Models are only deleted while a Reaper is running for
+// the pool that the type was registered with (see StartReaper), and may be
+// deleted up to one reaper interval late. Calling DeleteAt again for the same
+// id replaces the scheduled time, and deleting the model cancels the schedule.
+func (mt *ModelType) DeleteAt(id string, at time.Time) error {
+	return runOp(&Op{Kind: DeleteAtOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.DeleteAt(mt, id, at)
+		return t.Exec()
+	})
+}
+
+// DeleteAt schedules the model with the given id to be deleted at the given
+// time when the transaction is executed. See ModelType.DeleteAt.
+func (t *Transaction) DeleteAt(mt *ModelType, id string, at time.Time) {
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in DeleteAt or Transaction.DeleteAt: %s", err.Error()))
+		return
+	}
+	if id == "" {
+		t.setError(fmt.Errorf("zoom: Error in DeleteAt or Transaction.DeleteAt: id cannot be empty"))
+		return
+	}
+	milliseconds := at.UnixNano() / int64(time.Millisecond)
+	t.Command("ZADD", redis.Args{mt.spec.deleteScheduleKey(), milliseconds, id}, nil)
+}
+
+// Reaper periodically deletes models which were scheduled to be deleted with
+// DeleteAt. It is created with StartReaper.
+type Reaper struct {
+	pool     *Pool
+	interval time.Duration
+	// err is the first error encountered by the reaper
+	err   error
+	errMu sync.Mutex
+	// stop is closed to stop the reaper and done is closed when it has stopped
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// StartReaper starts a Reaper for the default pool. See Pool.StartReaper.
+func StartReaper(interval time.Duration) (*Reaper, error) {
+	return defaultPool.StartReaper(interval)
+}
+
+// StartReaper starts a background goroutine which checks for models that are
+// due to be deleted every interval, and deletes them. It applies to all model
+// types registered with p. It is safe to run a reaper in more than one process,
+// and a model which is scheduled again or deleted while the reaper is running
+// will not be deleted based on its old schedule. The reaper runs until Close is
+// called.
+func (p *Pool) StartReaper(interval time.Duration) (*Reaper, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("zoom: Error in StartReaper: interval must be positive but got %s", interval)
+	}
+	r := &Reaper{
+		pool:     p,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// run deletes due models every interval until r is closed.
+func (r *Reaper) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			for _, spec := range r.pool.specs() {
+				if err := r.pool.deleteDueModels(spec, now); err != nil {
+					r.setError(err)
+				}
+			}
+		}
+	}
+}
+
+// deleteDueModels deletes the models of the given type which were scheduled to
+// be deleted at or before now. The schedule is watched, so if it is changed by
+// some other client the models will be deleted on the next attempt instead.
+func (p *Pool) deleteDueModels(ms *modelSpec, now time.Time) error {
+	scheduleKey := ms.deleteScheduleKey()
+	milliseconds := now.UnixNano() / int64(time.Millisecond)
+	// Check whether any models are due first, so that the schedule for every
+	// type does not need to be watched on every interval.
+	conn := p.NewConn()
+	due, err := redis.Int(conn.Do("ZCOUNT", scheduleKey, "-inf", milliseconds))
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("zoom: Error in Reaper: %s", err.Error())
+	}
+	if due == 0 {
+		return nil
+	}
+	t := p.NewTransaction()
+	if err := t.WatchKey(scheduleKey); err != nil {
+		t.setError(err)
+	} else if ids, err := redis.Strings(t.conn.Do("ZRANGEBYSCORE", scheduleKey, "-inf", milliseconds)); err != nil {
+		t.setError(err)
+	} else {
+		mt := &ModelType{spec: ms}
+		deleted := make([]bool, len(ids))
+		for i, id := range ids {
+			t.Delete(mt, id, &deleted[i])
+		}
+	}
+	if err := t.Exec(); err != nil {
+		if _, ok := err.(WatchError); ok {
+			return nil
+		}
+		return fmt.Errorf("zoom: Error in Reaper: %s", err.Error())
+	}
+	return nil
+}
+
+// setError sets the error for r if it does not already have one.
+func (r *Reaper) setError(err error) {
+	r.errMu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.errMu.Unlock()
+}
+
+// Err returns the first error encountered by the reaper, if any. Errors do not
+// stop the reaper, and models which could not be deleted are tried again after
+// the next interval.
+func (r *Reaper) Err() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.err
+}
+
+// Close stops the reaper and waits for it to finish deleting any models which
+// are currently being deleted. It returns the same error as Err.
+func (r *Reaper) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+	return r.Err()
+}
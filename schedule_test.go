@@ -0,0 +1,151 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File schedule_test.go tests the code in schedule.go.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"testing"
+	"time"
+)
+
+func TestDeleteAt(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(3)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	due, later, cancelled := models[0], models[1], models[2]
+	if err := indexedTestModels.DeleteAt(due.Id(), time.Now().Add(20*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error in DeleteAt: %s", err.Error())
+	}
+	if err := indexedTestModels.DeleteAt(later.Id(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Unexpected error in DeleteAt: %s", err.Error())
+	}
+	if err := indexedTestModels.DeleteAt(cancelled.Id(), time.Now()); err != nil {
+		t.Fatalf("Unexpected error in DeleteAt: %s", err.Error())
+	}
+	// Deleting a model should cancel the scheduled deletion
+	if _, err := indexedTestModels.Delete(cancelled.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	scheduleKey := indexedTestModels.spec.deleteScheduleKey()
+	if score, err := conn.Do("ZSCORE", scheduleKey, cancelled.Id()); err != nil {
+		t.Fatalf("Unexpected error in ZSCORE: %s", err.Error())
+	} else if score != nil {
+		t.Errorf("Expected deleted model to be removed from the schedule but got score %v", score)
+	}
+
+	reaper, err := StartReaper(10 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error in StartReaper: %s", err.Error())
+	}
+	defer func() {
+		if err := reaper.Close(); err != nil {
+			t.Errorf("Unexpected error in Reaper: %s", err.Error())
+		}
+	}()
+
+	// Wait for the reaper to delete the model which is due
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exists, err := redis.Bool(conn.Do("EXISTS", indexedTestModels.spec.keyName()+":"+due.Id()))
+		if err != nil {
+			t.Fatalf("Unexpected error in EXISTS: %s", err.Error())
+		}
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the reaper to delete the model which was due")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectSetDoesNotContain(t, indexedTestModels.AllIndexKey(), due.Id())
+	for _, fieldName := range []string{"Int", "String", "Bool"} {
+		expectIndexDoesNotExist(t, indexedTestModels, due, fieldName)
+	}
+	expectModelExists(t, indexedTestModels, later)
+	if n, err := redis.Int(conn.Do("ZCARD", scheduleKey)); err != nil {
+		t.Fatalf("Unexpected error in ZCARD: %s", err.Error())
+	} else if n != 1 {
+		t.Errorf("Expected 1 model to remain in the schedule but got %d", n)
+	}
+}
+
+func TestRenameAfterDeleteAt(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(1)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	model := models[0]
+	if err := indexedTestModels.DeleteAt(model.Id(), time.Now().Add(20*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error in DeleteAt: %s", err.Error())
+	}
+	oldId, newId := model.Id(), "renamed"+model.Id()
+	if _, err := indexedTestModels.Rename(oldId, newId); err != nil {
+		t.Fatalf("Unexpected error in Rename: %s", err.Error())
+	}
+	// The scheduled deletion should have moved to the new id
+	conn := NewConn()
+	defer conn.Close()
+	scheduleKey := indexedTestModels.spec.deleteScheduleKey()
+	if score, err := conn.Do("ZSCORE", scheduleKey, oldId); err != nil {
+		t.Fatalf("Unexpected error in ZSCORE: %s", err.Error())
+	} else if score != nil {
+		t.Errorf("Expected the old id to be removed from the schedule but got score %v", score)
+	}
+	if score, err := conn.Do("ZSCORE", scheduleKey, newId); err != nil {
+		t.Fatalf("Unexpected error in ZSCORE: %s", err.Error())
+	} else if score == nil {
+		t.Error("Expected the new id to be in the schedule")
+	}
+
+	reaper, err := StartReaper(10 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error in StartReaper: %s", err.Error())
+	}
+	defer func() {
+		if err := reaper.Close(); err != nil {
+			t.Errorf("Unexpected error in Reaper: %s", err.Error())
+		}
+	}()
+
+	// Wait for the reaper to delete the renamed model
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exists, err := redis.Bool(conn.Do("EXISTS", indexedTestModels.spec.keyName()+":"+newId))
+		if err != nil {
+			t.Fatalf("Unexpected error in EXISTS: %s", err.Error())
+		}
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the reaper to delete the renamed model")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectSetDoesNotContain(t, indexedTestModels.AllIndexKey(), newId)
+	if n, err := redis.Int(conn.Do("ZCARD", scheduleKey)); err != nil {
+		t.Fatalf("Unexpected error in ZCARD: %s", err.Error())
+	} else if n != 0 {
+		t.Errorf("Expected no models to remain in the schedule but got %d", n)
+	}
+}
+
+func TestStartReaperInvalidInterval(t *testing.T) {
+	if _, err := StartReaper(0); err == nil {
+		t.Error("Expected an error in StartReaper for a zero interval")
+	}
+}
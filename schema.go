@@ -0,0 +1,134 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File schema.go contains code related to schema versions and
+// migrating models which were saved with an older version.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"strconv"
+)
+
+// versionFieldName is the name of the field in the main hash which holds the
+// schema version. It cannot collide with the name of a struct field.
+const versionFieldName = "-version"
+
+// MigrationFunc converts the fields of a model which was saved with one schema
+// version into the format used by the next version. fields holds the contents of
+// the main hash for the model, keyed by redis name, exactly as they are stored in
+// the database. MigrationFunc should modify fields in place, e.g. by renaming keys
+// or converting values.
+type MigrationFunc func(fields map[string]string) error
+
+// SchemaVersion is a ModelOption which causes the given version to be written to
+// the main hash of every model of the type whenever it is saved. When a model that
+// was saved with an older version is found, the migrations added with AddMigration
+// are run on it before its fields are scanned. Models saved before the type had a
+// schema version are considered to be version 0. The migrated model is not written
+// back to the database until it is saved again.
+func SchemaVersion(version int) ModelOption {
+	return func(spec *modelSpec) error {
+		if version <= 0 {
+			return fmt.Errorf("zoom: SchemaVersion must be greater than 0. Got %d", version)
+		}
+		spec.version = version
+		spec.migrations = map[int]MigrationFunc{}
+		return nil
+	}
+}
+
+// AddMigration adds a MigrationFunc which converts models of the given type that
+// were saved with fromVersion into the format used by fromVersion + 1. It returns
+// an error if the type was not registered with the SchemaVersion option or if
+// fromVersion is not less than the current version.
+func (mt *ModelType) AddMigration(fromVersion int, fn MigrationFunc) error {
+	if mt.spec.version == 0 {
+		return fmt.Errorf("zoom: Error in AddMigration: %s was not registered with the SchemaVersion option", mt.Name())
+	}
+	if fromVersion < 0 || fromVersion >= mt.spec.version {
+		return fmt.Errorf("zoom: Error in AddMigration: fromVersion must be between 0 and %d. Got %d", mt.spec.version-1, fromVersion)
+	}
+	mt.spec.migrations[fromVersion] = fn
+	return nil
+}
+
+// withVersion returns fieldNames with the name of the version field appended if
+// the model type has a schema version. Otherwise it returns fieldNames unchanged.
+func (ms *modelSpec) withVersion(fieldNames []string) []string {
+	if ms.version == 0 {
+		return fieldNames
+	}
+	return append(append([]string{}, fieldNames...), versionFieldName)
+}
+
+// migrate checks the schema version in fieldValues (if any) and, if it is older
+// than the current version, runs the migrations for the model and replaces each
+// value in fieldValues with the migrated value. fieldNames and fieldValues should
+// be the same as the arguments to scanModel. It returns true iff the model was
+// migrated.
+func (mr *modelRef) migrate(fieldNames []string, fieldValues []interface{}) (bool, error) {
+	ms := mr.spec
+	if ms.version == 0 {
+		return false, nil
+	}
+	versionIndex := indexOfStringSlice(fieldNames, versionFieldName)
+	if versionIndex == -1 {
+		return false, nil
+	}
+	storedVersion := 0
+	if fieldValues[versionIndex] != nil {
+		versionString, err := redis.String(fieldValues[versionIndex], nil)
+		if err != nil {
+			return false, err
+		}
+		storedVersion, err = strconv.Atoi(versionString)
+		if err != nil {
+			return false, fmt.Errorf("zoom: could not convert schema version %s to int", versionString)
+		}
+	}
+	if storedVersion >= ms.version {
+		return false, nil
+	}
+	// Get the id, which may not have been set yet if we are scanning the results
+	// of a query
+	id := mr.model.Id()
+	if idIndex := indexOfStringSlice(fieldNames, "-"); idIndex != -1 {
+		var err error
+		id, err = redis.String(fieldValues[idIndex], nil)
+		if err != nil {
+			return false, err
+		}
+	}
+	// Get the full contents of the main hash, since the migrations may need fields
+	// which no longer exist in the model type
+	conn := ms.pool.NewConn()
+	defer conn.Close()
+	fields, err := redis.StringMap(conn.Do("HGETALL", ms.keyName()+":"+id))
+	if err != nil {
+		return false, err
+	}
+	for version := storedVersion; version < ms.version; version++ {
+		fn, found := ms.migrations[version]
+		if !found {
+			return false, fmt.Errorf("zoom: cannot migrate %s with id = %s because no migration was added for version %d", ms.name, id, version)
+		}
+		if err := fn(fields); err != nil {
+			return false, err
+		}
+	}
+	for i, name := range fieldNames {
+		if name == "-" {
+			continue
+		}
+		if value, found := fields[ms.redisName(name)]; found {
+			fieldValues[i] = []byte(value)
+		} else {
+			fieldValues[i] = nil
+		}
+	}
+	return true, nil
+}
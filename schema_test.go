@@ -0,0 +1,82 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File schema_test.go tests the code in schema.go, i.e. schema
+// versions and migrations.
+
+package zoom
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// schemaModel is a model type that is only used for testing schema
+// versions and migrations
+type schemaModel struct {
+	FullName string
+	Age      int
+	DefaultData
+}
+
+func TestSchemaMigrations(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Write a model in the old format directly. Version 0 had separate first and
+	// last names, and version 1 stored the age in months.
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("HMSET", "schemaModel:old", "First", "Alice", "Last", "Smith", "Age", 360); err != nil {
+		t.Fatalf("Unexpected error in HMSET: %s", err.Error())
+	}
+	if _, err := conn.Do("SADD", "schemaModel:all", "old"); err != nil {
+		t.Fatalf("Unexpected error in SADD: %s", err.Error())
+	}
+
+	schemaModels := registerTestType(t, &schemaModel{}, SchemaVersion(2))
+	if err := schemaModels.AddMigration(0, func(fields map[string]string) error {
+		fields["FullName"] = strings.Join([]string{fields["First"], fields["Last"]}, " ")
+		delete(fields, "First")
+		delete(fields, "Last")
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error in AddMigration: %s", err.Error())
+	}
+	if err := schemaModels.AddMigration(1, func(fields map[string]string) error {
+		fields["Age"] = fields["Age"][:len(fields["Age"])-1]
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error in AddMigration: %s", err.Error())
+	}
+	if err := schemaModels.AddMigration(2, nil); err == nil {
+		t.Error("Expected error when adding a migration from the current version but got none")
+	}
+
+	// The old model should be migrated when it is found, whether with Find or FindAll
+	expected := &schemaModel{FullName: "Alice Smith", Age: 36}
+	expected.SetId("old")
+	model := &schemaModel{}
+	if err := schemaModels.Find("old", model); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(expected, model) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", expected, model)
+	}
+	models := []*schemaModel{}
+	if err := schemaModels.FindAll(&models); err != nil {
+		t.Fatalf("Unexpected error in FindAll: %s", err.Error())
+	}
+	if len(models) != 1 || !reflect.DeepEqual(expected, models[0]) {
+		t.Errorf("Found models were incorrect.\nExpected: %+v\nGot:      %+v", []*schemaModel{expected}, models)
+	}
+
+	// Saving the model should write the current version
+	if err := schemaModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectFieldEquals(t, "schemaModel:old", versionFieldName, 2)
+	expectFieldEquals(t, "schemaModel:old", "FullName", "Alice Smith")
+}
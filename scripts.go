@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var (
@@ -20,6 +21,13 @@ var (
 	deleteStringIndexScript         *redis.Script
 	extractIdsFromFieldIndexScript  *redis.Script
 	extractIdsFromStringIndexScript *redis.Script
+	renameModelScript               *redis.Script
+	appendAuditRecordScript         *redis.Script
+	removeExpiredModelScript        *redis.Script
+	archiveModelScript              *redis.Script
+	dispatchOutboxScript            *redis.Script
+	coalesceChangeScript            *redis.Script
+	flushCoalescedChangesScript     *redis.Script
 )
 
 var (
@@ -54,6 +62,41 @@ func initScripts() error {
 			filename: "extract_ids_from_string_index.lua",
 			keyCount: 2,
 		},
+		{
+			script:   &renameModelScript,
+			filename: "rename_model.lua",
+			keyCount: 0,
+		},
+		{
+			script:   &appendAuditRecordScript,
+			filename: "append_audit_record.lua",
+			keyCount: 0,
+		},
+		{
+			script:   &removeExpiredModelScript,
+			filename: "remove_expired_model.lua",
+			keyCount: 0,
+		},
+		{
+			script:   &archiveModelScript,
+			filename: "archive_model.lua",
+			keyCount: 0,
+		},
+		{
+			script:   &dispatchOutboxScript,
+			filename: "dispatch_outbox.lua",
+			keyCount: 2,
+		},
+		{
+			script:   &coalesceChangeScript,
+			filename: "coalesce_change.lua",
+			keyCount: 0,
+		},
+		{
+			script:   &flushCoalescedChangesScript,
+			filename: "flush_coalesced_changes.lua",
+			keyCount: 0,
+		},
 	}
 	for _, s := range scriptsToParse {
 		// Parse the file corresponding to this script
@@ -71,9 +114,12 @@ func initScripts() error {
 // deleteModelsBySetIds is a small function wrapper around deleteModelsBySetIdsScript.
 // It offers some type safety and helps make sure the arguments you pass through to the are correct.
 // The script will delete the models corresponding to the ids in the given set and return the number
-// of models that were deleted. You can use the handler to capture the return value.
-func (t *Transaction) deleteModelsBySetIds(setKey string, modelName string, handler ReplyHandler) {
-	t.Script(deleteModelsBySetIdsScript, redis.Args{setKey, modelName}, handler)
+// of models that were deleted. You can use the handler to capture the return value. collectionFields
+// should be the redis names of any fields which are stored outside of the main hash (e.g. list fields),
+// so that the script can delete them as well.
+func (t *Transaction) deleteModelsBySetIds(setKey string, modelName string, handler ReplyHandler, collectionFields ...string) {
+	args := redis.Args{setKey, modelName}.Add(Interfaces(collectionFields)...)
+	t.Script(deleteModelsBySetIdsScript, args, handler)
 }
 
 // deleteStringIndex is a small function wrapper around deleteStringIndexScript.
@@ -98,3 +144,108 @@ func (t *Transaction) extractIdsFromFieldIndex(setKey string, destKey string, mi
 func (t *Transaction) extractIdsFromStringIndex(setKey, destKey, min, max string) {
 	t.Script(extractIdsFromStringIndexScript, redis.Args{setKey, destKey, min, max}, nil)
 }
+
+// renameModel is a small function wrapper around renameModelScript.
+// It offers some type safety and helps make sure the arguments you pass through to the are correct.
+// The script will atomically move the model with oldId to newId, updating all of the field indexes,
+// any fields stored outside of the main hash, the audit trail, and any other state which is keyed by
+// the id of the model (e.g. the delete schedule). It returns 1 if the model was renamed and 0 if it
+// did not exist. You can use the handler to capture the return value.
+func (t *Transaction) renameModel(spec *modelSpec, oldId string, newId string, handler ReplyHandler) {
+	args := redis.Args{spec.keyName(), oldId, newId, getSettings().nullSentinel}
+	args = append(args, spec.scriptFieldArgs()...)
+	// The audit trail uses the same format as a collection field key. It is
+	// moved even if the type no longer uses the Audit option, so that the
+	// history of the model is not lost.
+	args = append(args, "c:"+auditKeySuffix, "z:"+spec.deleteScheduleKey())
+	if spec.hotKeys != nil {
+		args = append(args, "z:"+spec.hotKeysKey())
+	}
+	if spec.coalescer != nil {
+		args = append(args, "z:"+spec.coalesceWindowKey(), "e:"+spec.coalescedEventsKey())
+	}
+	t.Script(renameModelScript, args, handler)
+}
+
+// removeExpiredModel is a small function wrapper around removeExpiredModelScript.
+// It offers some type safety and helps make sure the arguments you pass through to the are correct.
+// The script will remove the model with the given id from the set of all ids and all of the field
+// indexes, and delete any fields stored outside of the main hash. It should only be used after the
+// main hash for the model has expired. It returns 1 if the model was removed and 0 otherwise. You
+// can use the handler to capture the return value.
+func (t *Transaction) removeExpiredModel(spec *modelSpec, id string, handler ReplyHandler) {
+	args := redis.Args{spec.keyName(), id}
+	args = append(args, spec.scriptFieldArgs()...)
+	t.Script(removeExpiredModelScript, args, handler)
+}
+
+// scriptFieldArgs returns the arguments which describe the fields of ms for
+// scripts which need to update every field index and every field stored outside
+// of the main hash. Each argument is the redis name of a field prefixed with "n:"
+// for a numeric or boolean index, "s:" for a string index, or "c:" for a field
+// stored outside of the main hash.
+func (ms *modelSpec) scriptFieldArgs() redis.Args {
+	args := redis.Args{}
+	for _, fs := range ms.fields {
+		switch {
+		case !fs.storedInHash():
+			args = append(args, "c:"+fs.redisName)
+		case fs.indexKind == numericIndex, fs.indexKind == booleanIndex:
+			args = append(args, "n:"+fs.redisName)
+		case fs.indexKind == stringIndex:
+			args = append(args, "s:"+fs.redisName)
+		}
+	}
+	if ms.storeProtobuf {
+		// The protobuf key uses the same format as a collection field key
+		args = append(args, "c:"+protobufKeySuffix)
+	}
+	if ms.archiveOnExpire {
+		// So does the key which holds the expiration for the model
+		args = append(args, "c:"+expiresKeySuffix)
+	}
+	return args
+}
+
+// archiveModel is a small function wrapper around archiveModelScript.
+// It offers some type safety and helps make sure the arguments you pass through to the are correct.
+// The script will copy the main hash and any fields stored outside of the main hash for the model
+// with the given id to the archive keys for the model. It returns 1 if the model was archived and 0
+// if it did not exist. You can use the handler to capture the return value.
+func (t *Transaction) archiveModel(spec *modelSpec, id string, handler ReplyHandler) {
+	args := redis.Args{spec.keyName(), id}
+	args = append(args, spec.scriptFieldArgs()...)
+	t.Script(archiveModelScript, args, handler)
+}
+
+// dispatchOutbox is a small function wrapper around dispatchOutboxScript.
+// It offers some type safety and helps make sure the arguments you pass through to the are correct.
+// The script will remove up to limit messages from the front of the outbox and send each one to its
+// destination, moving any messages which could not be sent to the failed list. It returns the number
+// of messages that were removed from the outbox. You can use the handler to capture the return value.
+func (t *Transaction) dispatchOutbox(outboxKey string, failedKey string, limit int, handler ReplyHandler) {
+	t.Script(dispatchOutboxScript, redis.Args{outboxKey, failedKey, limit}, handler)
+}
+
+// coalesceChange is a small function wrapper around coalesceChangeScript.
+// It offers some type safety and helps make sure the arguments you pass through to the are correct.
+// The script will publish the encoded event for the model with the given id if no event has been
+// published for it during the current coalescing window, and otherwise merge it into the pending
+// event for the model. It returns 1 if the event was published and 0 if it is pending. You can use
+// the handler to capture the return value.
+func (t *Transaction) coalesceChange(spec *modelSpec, id string, data []byte, handler ReplyHandler) {
+	window := int64(spec.coalescer.window / time.Millisecond)
+	args := redis.Args{spec.keyName(), id, window, spec.changesChannel(), data}
+	t.Script(coalesceChangeScript, args, handler)
+}
+
+// flushCoalescedChanges is a small function wrapper around flushCoalescedChangesScript.
+// It offers some type safety and helps make sure the arguments you pass through to the are correct.
+// The script will publish the pending events for any models of the given type whose coalescing
+// window has ended. It returns the number of events which are still pending. You can use the
+// handler to capture the return value.
+func (t *Transaction) flushCoalescedChanges(spec *modelSpec, handler ReplyHandler) {
+	window := int64(spec.coalescer.window / time.Millisecond)
+	args := redis.Args{spec.keyName(), window, spec.changesChannel()}
+	t.Script(flushCoalescedChangesScript, args, handler)
+}
@@ -0,0 +1,64 @@
+-- Copyright 2015 Alex Browne.  All rights reserved.
+-- Use of this source code is governed by the MIT
+-- license, which can be found in the LICENSE file.
+
+-- append_audit_record is a lua script that takes the following arguments:
+-- 	1) The key of the list which holds the audit trail for a model
+--		2) The key of the main hash for the model
+--		3) The maximum number of records to keep in the audit trail
+--		4) The action, either "save" or "delete"
+--		5) The id of the model
+--		6) The actor who performed the action (may be empty)
+--		7) The time of the action, formatted as RFC3339
+--		8+) The redis names of the fields to include. If the action is "save", the
+--			names are followed by the new value for each field, in the same order.
+-- The script then compares the new values (or nil for "delete") to the old values
+-- in the main hash, and pushes a JSON record with any differences to the front of
+-- the list, trimming it to the maximum length. It returns 1 if a record was added
+-- and 0 if the action was "delete" and the model did not exist.
+-- NOTE: This script *must* be called before the main hash for the model is updated/deleted.
+
+-- Assign keys to variables for easy access
+local auditKey = ARGV[1]
+local modelKey = ARGV[2]
+local maxLen = tonumber(ARGV[3])
+local action = ARGV[4]
+local fieldArgs = {}
+for i = 8, #ARGV do
+	table.insert(fieldArgs, ARGV[i])
+end
+local changes = {}
+if action == "delete" then
+	if redis.call("EXISTS", modelKey) == 0 then
+		return 0
+	end
+	for _, field in ipairs(fieldArgs) do
+		local oldValue = redis.call("HGET", modelKey, field)
+		if oldValue ~= false then
+			changes[field] = {old = oldValue, new = cjson.null}
+		end
+	end
+else
+	local numFields = #fieldArgs / 2
+	for i = 1, numFields do
+		local field = fieldArgs[i]
+		local newValue = fieldArgs[numFields + i]
+		local oldValue = redis.call("HGET", modelKey, field)
+		if oldValue ~= newValue then
+			if oldValue == false then
+				oldValue = cjson.null
+			end
+			changes[field] = {old = oldValue, new = newValue}
+		end
+	end
+end
+local record = {
+	action = action,
+	id = ARGV[5],
+	actor = ARGV[6],
+	time = ARGV[7],
+	changes = changes
+}
+redis.call("LPUSH", auditKey, cjson.encode(record))
+redis.call("LTRIM", auditKey, 0, maxLen - 1)
+return 1
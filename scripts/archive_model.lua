@@ -0,0 +1,41 @@
+-- Copyright 2015 Alex Browne.  All rights reserved.
+-- Use of this source code is governed by the MIT
+-- license, which can be found in the LICENSE file.
+
+-- archive_model is a lua script that takes the following arguments:
+-- 	1) The name of a registered model
+--		2) The id of the model to archive
+--		3+) (Optional) The redis names of any fields which need to be archived,
+--			in the same format as for rename_model. Only fields with the "c" prefix
+--			(i.e. fields which are stored outside of the main hash) are used.
+-- The script then copies the main hash and any fields stored outside of the main
+-- hash to the archive keys for the model, replacing any existing archive for the
+-- same id. It does not modify the model. It returns 1 if the model was archived
+-- and 0 if it does not exist.
+
+-- Assign keys to variables for easy access
+local modelName = ARGV[1]
+local id = ARGV[2]
+local key = modelName .. ':' .. id
+local archiveKey = modelName .. ':archive:' .. id
+if redis.call('EXISTS', key) == 0 then
+	return 0
+end
+-- copy copies the value at src to dest, or deletes dest if src does not exist
+local function copy(src, dest)
+	local value = redis.call('DUMP', src)
+	if value then
+		redis.call('RESTORE', dest, 0, value, 'REPLACE')
+	else
+		redis.call('DEL', dest)
+	end
+end
+copy(key, archiveKey)
+for i = 3, #ARGV do
+	local kind = string.sub(ARGV[i], 1, 1)
+	local fieldName = string.sub(ARGV[i], 3)
+	if kind == 'c' then
+		copy(key .. ':' .. fieldName, archiveKey .. ':' .. fieldName)
+	end
+end
+return 1
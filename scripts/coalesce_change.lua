@@ -0,0 +1,69 @@
+-- Copyright 2015 Alex Browne.  All rights reserved.
+-- Use of this source code is governed by the MIT
+-- license, which can be found in the LICENSE file.
+
+-- coalesce_change is a lua script that takes the following arguments:
+-- 	1) The name of a registered model
+--		2) The id of the model which was changed
+--		3) The length of the coalescing window in milliseconds
+--		4) The channel where change events are published
+--		5) The change event, encoded as JSON
+-- If no event has been published for the model during the current window, the
+-- script publishes the event right away and starts a new window. Otherwise it
+-- merges the event into the pending event for the model, which is published by
+-- flush_coalesced_changes once the window ends. When two saves are merged, the
+-- pending event includes the fields from both. It returns 1 if the event was
+-- published and 0 if it is pending.
+
+-- TIME is not deterministic, so the effects of the script must be replicated
+-- instead of the script itself
+redis.replicate_commands()
+
+-- Assign keys to variables for easy access
+local modelName = ARGV[1]
+local id = ARGV[2]
+local window = tonumber(ARGV[3])
+local channel = ARGV[4]
+local encoded = ARGV[5]
+local windowKey = modelName .. ':_zoom:coalesce'
+local pendingKey = modelName .. ':_zoom:coalesced'
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local windowEnd = redis.call('ZSCORE', windowKey, id)
+if not windowEnd or tonumber(windowEnd) <= now then
+	-- There is no current window for the model. If an event is still pending
+	-- from the last window (e.g. because the process which would have flushed
+	-- it exited), publish it first so that it is not published again later.
+	local stale = redis.call('HGET', pendingKey, id)
+	if stale then
+		redis.call('HDEL', pendingKey, id)
+		redis.call('PUBLISH', channel, stale)
+	end
+	redis.call('ZADD', windowKey, now + window, id)
+	redis.call('PUBLISH', channel, encoded)
+	return 1
+end
+-- Merge the event into the pending event (if any)
+local existing = redis.call('HGET', pendingKey, id)
+if existing then
+	local old = cjson.decode(existing)
+	local new = cjson.decode(encoded)
+	if old['op'] == 'Save' and new['op'] == 'Save' then
+		local seen = {}
+		local fields = {}
+		for _, list in ipairs({old['fields'] or {}, new['fields'] or {}}) do
+			for _, field in ipairs(list) do
+				if not seen[field] then
+					seen[field] = true
+					table.insert(fields, field)
+				end
+			end
+		end
+		if #fields > 0 then
+			new['fields'] = fields
+		end
+		encoded = cjson.encode(new)
+	end
+end
+redis.call('HSET', pendingKey, id, encoded)
+return 0
@@ -5,6 +5,8 @@
 -- delete_models_by_set_ids is a lua script that takes the following arguments:
 -- 	1) The key of a set of model ids
 --		2) The name of a registered model
+--		3+) (Optional) The names of any fields which are stored outside of the main
+--			hash, e.g. list fields
 -- The script then deletes all the models corresponding to the ids in the given
 -- set. It returns the number of models that were deleted. It does not delete the
 -- given set.
@@ -21,6 +23,10 @@ if #ids > 0 then
 		-- Delete the main hash for each model
 		local key = modelName .. ':' .. id
 		count = count + redis.call('DEL', key)
+		-- Delete any fields which are stored outside of the main hash
+		for j = 2, #ARGV do
+			redis.call('DEL', key .. ':' .. ARGV[j])
+		end
 		-- Remove the model id from the set of all ids
 		-- NOTE: this is not necessarily the same as the
 		-- setName we were given
@@ -0,0 +1,45 @@
+-- Copyright 2015 Alex Browne.  All rights reserved.
+-- Use of this source code is governed by the MIT
+-- license, which can be found in the LICENSE file.
+
+-- dispatch_outbox is a lua script that takes the following arguments:
+-- 	1) The key of the outbox list
+--		2) The key of the list which holds messages that could not be sent
+--		3) The maximum number of messages to dispatch
+-- The script then removes messages from the front of the outbox one at a time
+-- and sends each one to its destination, either by publishing it to a pub/sub
+-- channel or by adding it to a stream under the field "payload". Each message
+-- is a JSON object with the fields "target", "destination", and "payload". If
+-- a message cannot be sent (e.g. because the destination is not a stream), it
+-- is moved to the failed list so that it does not block the rest of the outbox.
+-- It returns the number of messages that were removed from the outbox.
+
+-- XADD is not deterministic, so the effects of the script must be replicated
+-- instead of the script itself
+redis.replicate_commands()
+
+-- Assign keys to variables for easy access
+local outboxKey = KEYS[1]
+local failedKey = KEYS[2]
+local limit = tonumber(ARGV[1])
+local count = 0
+while count < limit do
+	local encoded = redis.call('LPOP', outboxKey)
+	if not encoded then
+		break
+	end
+	local ok, message = pcall(cjson.decode, encoded)
+	local reply
+	if not ok then
+		reply = {err = message}
+	elseif message['target'] == 'stream' then
+		reply = redis.pcall('XADD', message['destination'], '*', 'payload', message['payload'])
+	else
+		reply = redis.pcall('PUBLISH', message['destination'], message['payload'])
+	end
+	if type(reply) == 'table' and reply['err'] then
+		redis.call('RPUSH', failedKey, encoded)
+	end
+	count = count + 1
+end
+return count
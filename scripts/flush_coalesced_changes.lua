@@ -0,0 +1,37 @@
+-- Copyright 2015 Alex Browne.  All rights reserved.
+-- Use of this source code is governed by the MIT
+-- license, which can be found in the LICENSE file.
+
+-- flush_coalesced_changes is a lua script that takes the following arguments:
+-- 	1) The name of a registered model
+--		2) The length of the coalescing window in milliseconds
+--		3) The channel where change events are published
+-- The script publishes the pending event for each model whose coalescing
+-- window has ended (see coalesce_change) and starts a new window for it, so
+-- that there is still at most one event per window. It returns the number of
+-- events which are still pending.
+
+-- TIME is not deterministic, so the effects of the script must be replicated
+-- instead of the script itself
+redis.replicate_commands()
+
+-- Assign keys to variables for easy access
+local modelName = ARGV[1]
+local window = tonumber(ARGV[2])
+local channel = ARGV[3]
+local windowKey = modelName .. ':_zoom:coalesce'
+local pendingKey = modelName .. ':_zoom:coalesced'
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local ids = redis.call('ZRANGEBYSCORE', windowKey, '-inf', now)
+for _, id in ipairs(ids) do
+	local encoded = redis.call('HGET', pendingKey, id)
+	if encoded then
+		redis.call('HDEL', pendingKey, id)
+		redis.call('PUBLISH', channel, encoded)
+		redis.call('ZADD', windowKey, now + window, id)
+	else
+		redis.call('ZREM', windowKey, id)
+	end
+end
+return redis.call('HLEN', pendingKey)
@@ -0,0 +1,50 @@
+-- Copyright 2015 Alex Browne.  All rights reserved.
+-- Use of this source code is governed by the MIT
+-- license, which can be found in the LICENSE file.
+
+-- remove_expired_model is a lua script that takes the following arguments:
+-- 	1) The name of a registered model
+--		2) The id of a model whose main hash has expired
+--		3+) (Optional) The redis names of any fields which need to be cleaned up,
+--			each prefixed with a single character which indicates how the field is
+--			stored, followed by a colon. The prefix is "n" for a numeric or boolean
+--			index, "s" for a string index, and "c" for a field which is stored
+--			outside of the main hash (e.g. a list or set field).
+-- The script then removes the id from the set of all ids and from any field
+-- indexes, and deletes any fields which are stored outside of the main hash. It
+-- returns 1 if the model was removed and 0 if there was nothing to remove, i.e.
+-- if the model was saved again after it expired or was already removed.
+-- NOTE: Since the main hash no longer exists, the old values for string indexes
+-- are not known and this script needs to check every member of each string index.
+
+-- Assign keys to variables for easy access
+local modelName = ARGV[1]
+local id = ARGV[2]
+local key = modelName .. ':' .. id
+if redis.call('EXISTS', key) == 1 then
+	-- The model was saved again after it expired
+	return 0
+end
+if redis.call('SREM', modelName .. ':all', id) == 0 then
+	return 0
+end
+local suffix = '\0' .. id
+for i = 3, #ARGV do
+	local kind = string.sub(ARGV[i], 1, 1)
+	local fieldName = string.sub(ARGV[i], 3)
+	if kind == 'n' then
+		redis.call('ZREM', modelName .. ':' .. fieldName, id)
+	elseif kind == 's' then
+		-- String index. Members are of the form value + NULL + id.
+		local indexKey = modelName .. ':' .. fieldName
+		local members = redis.call('ZRANGE', indexKey, 0, -1)
+		for j, member in ipairs(members) do
+			if string.sub(member, -#suffix) == suffix then
+				redis.call('ZREM', indexKey, member)
+			end
+		end
+	elseif kind == 'c' then
+		redis.call('DEL', key .. ':' .. fieldName)
+	end
+end
+return 1
@@ -0,0 +1,88 @@
+-- Copyright 2015 Alex Browne.  All rights reserved.
+-- Use of this source code is governed by the MIT
+-- license, which can be found in the LICENSE file.
+
+-- rename_model is a lua script that takes the following arguments:
+-- 	1) The name of a registered model
+--		2) The old id of the model
+--		3) The new id of the model
+--		4) The value stored in the main hash for nil pointers (see NullSentinel)
+--		5+) (Optional) The redis names of any fields which need to be updated, each
+--			prefixed with a single character which indicates how the field is stored,
+--			followed by a colon. The prefix is "n" for a numeric or boolean index, "s"
+--			for a string index, "c" for a field which is stored outside of the main
+--			hash (e.g. a list or set field), "z" for some other sorted set which uses
+--			the id of the model as a member (e.g. the delete schedule), and "e" for a
+--			hash which holds a pending change event for each model, keyed by id. For
+--			"z" and "e", the name is the full key of the sorted set or hash.
+-- The script then moves the main hash and any list or set fields to keys which
+-- use the new id, and replaces the old id with the new one in the set of all ids,
+-- in any field indexes, and in any other sorted sets or event hashes. It returns 1 if the model was renamed, 0 if there was
+-- no model with the old id, and an error if a model with the new id already exists.
+
+-- Assign keys to variables for easy access
+local modelName = ARGV[1]
+local oldId = ARGV[2]
+local newId = ARGV[3]
+local nullSentinel = ARGV[4]
+local oldKey = modelName .. ':' .. oldId
+local newKey = modelName .. ':' .. newId
+if redis.call('EXISTS', oldKey) == 0 then
+	return 0
+end
+if redis.call('EXISTS', newKey) == 1 then
+	return redis.error_reply('a model with id ' .. newId .. ' already exists')
+end
+-- Move the main hash
+redis.call('RENAME', oldKey, newKey)
+-- Update the set of all ids
+local allKey = modelName .. ':all'
+redis.call('SREM', allKey, oldId)
+redis.call('SADD', allKey, newId)
+-- Update the indexes and other fields
+for i = 5, #ARGV do
+	local kind = string.sub(ARGV[i], 1, 1)
+	local fieldName = string.sub(ARGV[i], 3)
+	if kind == 'n' then
+		-- Numeric or boolean index. Move the score to the new id.
+		local indexKey = modelName .. ':' .. fieldName
+		local score = redis.call('ZSCORE', indexKey, oldId)
+		if score ~= false then
+			redis.call('ZREM', indexKey, oldId)
+			redis.call('ZADD', indexKey, score, newId)
+		end
+	elseif kind == 's' then
+		-- String index. Members are of the form value + NULL + id. Nil pointers
+		-- are not indexed, whether they are stored as the sentinel or omitted.
+		local indexKey = modelName .. ':' .. fieldName
+		local value = redis.call('HGET', newKey, fieldName)
+		if value ~= false and value ~= nullSentinel then
+			redis.call('ZREM', indexKey, value .. '\0' .. oldId)
+			redis.call('ZADD', indexKey, 0, value .. '\0' .. newId)
+		end
+	elseif kind == 'c' then
+		-- A field stored outside of the main hash
+		local oldFieldKey = oldKey .. ':' .. fieldName
+		if redis.call('EXISTS', oldFieldKey) == 1 then
+			redis.call('RENAME', oldFieldKey, newKey .. ':' .. fieldName)
+		end
+	elseif kind == 'z' then
+		-- A sorted set which uses the id as a member. Move the score to the new id.
+		local score = redis.call('ZSCORE', fieldName, oldId)
+		if score ~= false then
+			redis.call('ZREM', fieldName, oldId)
+			redis.call('ZADD', fieldName, score, newId)
+		end
+	elseif kind == 'e' then
+		-- A hash of pending change events keyed by id. Move the event to the new
+		-- id and update the id in the event itself.
+		local encoded = redis.call('HGET', fieldName, oldId)
+		if encoded ~= false then
+			local event = cjson.decode(encoded)
+			event['id'] = newId
+			redis.call('HDEL', fieldName, oldId)
+			redis.call('HSET', fieldName, newId, cjson.encode(event))
+		end
+	end
+end
+return 1
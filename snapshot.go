@@ -0,0 +1,208 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File snapshot.go contains code related to taking snapshots of the
+// keys managed by zoom and restoring them later, e.g. so that tests can
+// share expensive setup.
+
+package zoom
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"io"
+	"os"
+	"sort"
+)
+
+// snapshotScanCount is the COUNT argument for SCAN when finding the keys for a
+// snapshot.
+const snapshotScanCount = 1000
+
+// Snapshot holds the contents of the keys managed by zoom at a point in time.
+// It is created with TakeSnapshot and restored with RestoreSnapshot, and can be
+// kept in memory or written to a file with WriteFile. A Snapshot is immutable,
+// so it can be restored any number of times, e.g. once before each test.
+type Snapshot struct {
+	entries []snapshotEntry
+}
+
+// snapshotEntry is the contents of a single key. It is exported (via its
+// fields) so that it can be encoded with gob.
+type snapshotEntry struct {
+	Key string
+	// Value is the serialized value returned by DUMP
+	Value []byte
+	// TTL is the remaining time to live in milliseconds, or 0 if the key does
+	// not expire
+	TTL int64
+}
+
+// snapshotFile is the format used to encode a Snapshot.
+type snapshotFile struct {
+	Entries []snapshotEntry
+}
+
+// Len returns the number of keys in the snapshot.
+func (s *Snapshot) Len() int {
+	return len(s.entries)
+}
+
+// TakeSnapshot takes a snapshot of the keys managed by the default pool. See
+// Pool.TakeSnapshot.
+func TakeSnapshot() (*Snapshot, error) {
+	return defaultPool.TakeSnapshot()
+}
+
+// TakeSnapshot returns a snapshot of every key managed by p, i.e. every key
+// used to store the models of the types registered with p (including indexes
+// and fields stored outside of the main hash) and the keys zoom uses
+// internally, such as the outbox and change streams. Each key is copied with
+// DUMP, along with its remaining time to live. The keys are found with SCAN
+// and are not copied atomically, so the database should not be changed while
+// the snapshot is taken. Since DUMP uses a format which is specific to the
+// version of redis, the snapshot should be restored into the same version.
+func (p *Pool) TakeSnapshot() (*Snapshot, error) {
+	conn := p.NewConn()
+	defer conn.Close()
+	keys, err := p.managedKeys(conn)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in TakeSnapshot: %s", err.Error())
+	}
+	for _, key := range keys {
+		if err := conn.Send("DUMP", key); err != nil {
+			return nil, err
+		}
+		if err := conn.Send("PTTL", key); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	for _, key := range keys {
+		value, err := redis.Bytes(conn.Receive())
+		if err != nil && err != redis.ErrNil {
+			return nil, fmt.Errorf("zoom: Error in TakeSnapshot: %s", err.Error())
+		}
+		ttl, ttlErr := redis.Int64(conn.Receive())
+		if ttlErr != nil {
+			return nil, fmt.Errorf("zoom: Error in TakeSnapshot: %s", ttlErr.Error())
+		}
+		if err == redis.ErrNil {
+			// The key was deleted or expired after it was found
+			continue
+		}
+		if ttl < 0 {
+			ttl = 0
+		}
+		s.entries = append(s.entries, snapshotEntry{Key: key, Value: value, TTL: ttl})
+	}
+	return s, nil
+}
+
+// RestoreSnapshot restores s with the default pool. See Pool.RestoreSnapshot.
+func RestoreSnapshot(s *Snapshot) error {
+	return defaultPool.RestoreSnapshot(s)
+}
+
+// RestoreSnapshot restores the keys managed by p to the contents they had when
+// s was taken. Any keys managed by p which are not in s, e.g. for models which
+// were saved after s was taken, are deleted. Keys which had a time to live
+// when s was taken are restored with the time to live they had remaining. The
+// keys to delete are found with SCAN, and then the keys are deleted and
+// restored atomically in a single transaction. s should have been taken with a
+// pool which uses the same KeyPrefix as p.
+func (p *Pool) RestoreSnapshot(s *Snapshot) error {
+	conn := p.NewConn()
+	keys, err := p.managedKeys(conn)
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("zoom: Error in RestoreSnapshot: %s", err.Error())
+	}
+	t := p.NewTransaction()
+	if len(keys) > 0 {
+		t.Command("DEL", redis.Args{}.AddFlat(keys), nil)
+	}
+	for _, entry := range s.entries {
+		t.Command("RESTORE", redis.Args{entry.Key, entry.TTL, entry.Value, "REPLACE"}, nil)
+	}
+	return t.Exec()
+}
+
+// managedKeys returns every key managed by p, in sorted order, using conn.
+func (p *Pool) managedKeys(conn redis.Conn) ([]string, error) {
+	patterns := []string{escapePattern(p.getState().keyPrefix) + "zoom:*"}
+	for _, spec := range p.specs() {
+		patterns = append(patterns, escapePattern(spec.keyName())+":*")
+	}
+	found := map[string]bool{}
+	for _, pattern := range patterns {
+		cursor := "0"
+		for {
+			values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", snapshotScanCount))
+			if err != nil {
+				return nil, err
+			}
+			var keys []string
+			if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				found[key] = true
+			}
+			if cursor == "0" {
+				break
+			}
+		}
+	}
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Encode writes s to w, so that it can be read later with DecodeSnapshot.
+func (s *Snapshot) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(snapshotFile{Entries: s.entries})
+}
+
+// DecodeSnapshot reads a snapshot which was written with Snapshot.Encode from r.
+func DecodeSnapshot(r io.Reader) (*Snapshot, error) {
+	var file snapshotFile
+	if err := gob.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("zoom: Error in DecodeSnapshot: %s", err.Error())
+	}
+	return &Snapshot{entries: file.Entries}, nil
+}
+
+// WriteFile writes s to the file at path, creating it if needed and replacing
+// its contents if it already exists. The file can be read with
+// ReadSnapshotFile.
+func (s *Snapshot) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadSnapshotFile reads a snapshot which was written with Snapshot.WriteFile
+// from the file at path.
+func ReadSnapshotFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeSnapshot(f)
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File snapshot_test.go tests the code for taking and restoring
+// snapshots.
+
+package zoom
+
+import (
+	"bytes"
+	"github.com/garyburd/redigo/redis"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(5)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	key, _ := indexedTestModels.ModelKey(models[0].Id())
+	if _, err := conn.Do("PEXPIRE", key, 100000); err != nil {
+		t.Fatalf("Unexpected error in PEXPIRE: %s", err.Error())
+	}
+	snapshot, err := TakeSnapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error in TakeSnapshot: %s", err.Error())
+	}
+	if snapshot.Len() == 0 {
+		t.Fatal("Expected snapshot to contain keys but it was empty")
+	}
+
+	// Change the database after taking the snapshot
+	if _, err := indexedTestModels.Delete(models[1].Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	models[2].Int++
+	changed := *models[2]
+	if err := indexedTestModels.Save(&changed); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	models[2].Int--
+	newModels, err := createAndSaveIndexedTestModels(3)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	if _, err := conn.Do("SET", "unmanaged", "foo"); err != nil {
+		t.Fatalf("Unexpected error in SET: %s", err.Error())
+	}
+
+	if err := RestoreSnapshot(snapshot); err != nil {
+		t.Fatalf("Unexpected error in RestoreSnapshot: %s", err.Error())
+	}
+	got := []*indexedTestModel{}
+	if err := indexedTestModels.NewQuery().Order("Int").Run(&got); err != nil {
+		t.Fatalf("Unexpected error in Query.Run: %s", err.Error())
+	}
+	expected := expectedResultsForQuery(indexedTestModels.NewQuery().Order("Int"), models)
+	if err := expectModelsToBeEqual(expected, got, true); err != nil {
+		t.Errorf("Models were not restored correctly: %s", err.Error())
+	}
+	for _, model := range newModels {
+		expectModelDoesNotExist(t, indexedTestModels, model)
+	}
+	ttl, err := redis.Int(conn.Do("PTTL", key))
+	if err != nil {
+		t.Fatalf("Unexpected error in PTTL: %s", err.Error())
+	}
+	if ttl <= 0 || ttl > 100000 {
+		t.Errorf("Expected restored key to have a TTL of at most 100000 ms but got %d", ttl)
+	}
+	value, err := redis.String(conn.Do("GET", "unmanaged"))
+	if err != nil {
+		t.Fatalf("Unexpected error in GET: %s", err.Error())
+	}
+	if value != "foo" {
+		t.Errorf("Expected key not managed by zoom to be unchanged but got %s", value)
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveIndexedTestModels(3)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	snapshot, err := TakeSnapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error in TakeSnapshot: %s", err.Error())
+	}
+	dir, err := ioutil.TempDir("", "zoomsnapshot")
+	if err != nil {
+		t.Fatalf("Unexpected error in ioutil.TempDir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot")
+	if err := snapshot.WriteFile(path); err != nil {
+		t.Fatalf("Unexpected error in WriteFile: %s", err.Error())
+	}
+	testingTearDown()
+	read, err := ReadSnapshotFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error in ReadSnapshotFile: %s", err.Error())
+	}
+	if err := RestoreSnapshot(read); err != nil {
+		t.Fatalf("Unexpected error in RestoreSnapshot: %s", err.Error())
+	}
+	for _, model := range models {
+		expectModelExists(t, indexedTestModels, model)
+	}
+}
+
+func TestSnapshotEncode(t *testing.T) {
+	snapshot := &Snapshot{entries: []snapshotEntry{
+		{Key: "a", Value: []byte("foo"), TTL: 0},
+		{Key: "b", Value: []byte{0, 1, 2}, TTL: 500},
+	}}
+	buf := &bytes.Buffer{}
+	if err := snapshot.Encode(buf); err != nil {
+		t.Fatalf("Unexpected error in Encode: %s", err.Error())
+	}
+	got, err := DecodeSnapshot(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error in DecodeSnapshot: %s", err.Error())
+	}
+	if !reflect.DeepEqual(snapshot, got) {
+		t.Errorf("Expected %v but got %v", snapshot, got)
+	}
+	if _, err := DecodeSnapshot(bytes.NewBufferString("not a snapshot")); err == nil {
+		t.Error("Expected an error decoding an invalid snapshot but got none")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File stats.go contains code related to collecting statistics
+// about a connection pool.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"sync/atomic"
+	"time"
+)
+
+// PoolStats contains statistics about the connections in a Pool. It can be
+// used to monitor connection pressure and tune MaxIdle and MaxActive.
+type PoolStats struct {
+	// ActiveCount is the number of connections in the pool, including idle
+	// connections and connections which are in use.
+	ActiveCount int
+	// IdleCount is the number of idle connections in the pool.
+	IdleCount int
+	// WaitCount is the number of times a connection was requested while
+	// MaxActive connections were in use, causing the caller to wait because
+	// Wait was true.
+	WaitCount int64
+	// WaitDuration is the total amount of time spent waiting for a connection.
+	WaitDuration time.Duration
+}
+
+// connCounter is implemented by drivers which can report the number of
+// connections they hold, including *redis.Pool.
+type connCounter interface {
+	ActiveCount() int
+	IdleCount() int
+}
+
+// Stats returns statistics about the connections in the default pool.
+func Stats() PoolStats {
+	return defaultPool.Stats()
+}
+
+// Stats returns statistics about the connections in p. It does not include
+// connections to replicas. ActiveCount and IdleCount are only available if the
+// Driver for p has ActiveCount and IdleCount methods, which is true for the
+// default Driver. WaitCount and WaitDuration are only counted if MaxActive is
+// not zero and Wait is true, and are approximate since other goroutines may
+// return connections to the pool concurrently.
+func (p *Pool) Stats() PoolStats {
+	stats := PoolStats{
+		WaitCount:    atomic.LoadInt64(&p.waitCount),
+		WaitDuration: time.Duration(atomic.LoadInt64(&p.waitDuration)),
+	}
+	if counter, ok := p.getState().driver.(connCounter); ok {
+		stats.ActiveCount = counter.ActiveCount()
+		stats.IdleCount = counter.IdleCount()
+	}
+	return stats
+}
+
+// getConn gets a connection from the driver for p, recording the time spent
+// waiting for it if all of the connections were in use.
+func (p *Pool) getConn() redis.Conn {
+	state := p.getState()
+	counter, ok := state.driver.(connCounter)
+	if !ok || !state.wait || state.maxActive <= 0 || counter.ActiveCount() < state.maxActive {
+		return state.driver.Get()
+	}
+	start := time.Now()
+	conn := state.driver.Get()
+	atomic.AddInt64(&p.waitCount, 1)
+	atomic.AddInt64(&p.waitDuration, int64(time.Since(start)))
+	return conn
+}
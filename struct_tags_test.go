@@ -10,6 +10,7 @@ package zoom
 
 import (
 	"github.com/garyburd/redigo/redis"
+	"reflect"
 	"testing"
 )
 
@@ -238,3 +239,284 @@ func TestIndexAndCustomName(t *testing.T) {
 		expectIndexExists(t, customIndexModels, model, field.Name)
 	}
 }
+
+// Test that the redisType list struct tag causes a field to be stored in
+// a separate list, and that we can push new elements onto the list
+func TestRedisTypeListOption(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	type listFieldModel struct {
+		Ints    []int    `redisType:"list"`
+		Strings []string `redisType:"list"`
+		DefaultData
+	}
+	listFieldModels, err := Register(&listFieldModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+
+	// Save a model and make sure the fields were stored in lists
+	model := &listFieldModel{
+		Ints:    []int{randomInt(), randomInt()},
+		Strings: []string{randomString(), randomString()},
+	}
+	if err := listFieldModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	listKey := listFieldModels.spec.fieldKey(model.Id(), listFieldModels.spec.fieldsByName["Strings"])
+	gotStrings, err := redis.Strings(conn.Do("LRANGE", listKey, 0, -1))
+	if err != nil {
+		t.Fatalf("Unexpected error in LRANGE: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model.Strings, gotStrings) {
+		t.Errorf("List was incorrect.\nExpected: %v\nGot:      %v", model.Strings, gotStrings)
+	}
+
+	// Push some new elements and make sure they are included when we find
+	// the model again, both with Find and with FindAll
+	newInt := randomInt()
+	if err := listFieldModels.PushToField(model.Id(), "Ints", newInt); err != nil {
+		t.Fatalf("Unexpected error in PushToField: %s", err.Error())
+	}
+	model.Ints = append(model.Ints, newInt)
+	modelCopy := &listFieldModel{}
+	if err := listFieldModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+	modelsCopy := []*listFieldModel{}
+	if err := listFieldModels.FindAll(&modelsCopy); err != nil {
+		t.Fatalf("Unexpected error in FindAll: %s", err.Error())
+	}
+	if len(modelsCopy) != 1 || !reflect.DeepEqual(model, modelsCopy[0]) {
+		t.Errorf("Found models were incorrect.\nExpected: %+v\nGot:      %+v", []*listFieldModel{model}, modelsCopy)
+	}
+
+	// Pushing a value of the wrong type should cause an error
+	if err := listFieldModels.PushToField(model.Id(), "Ints", "foo"); err == nil {
+		t.Error("Expected error when pushing a value of the wrong type but got none")
+	}
+
+	// Deleting the model should also delete the lists
+	if _, err := listFieldModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	expectKeyDoesNotExist(t, listKey)
+}
+
+// Test that the redisType set struct tag causes a field to be stored in
+// a separate set, and that we can add, remove, and check for members
+func TestRedisTypeSetOption(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	type setFieldModel struct {
+		Tags []string `redisType:"set"`
+		DefaultData
+	}
+	setFieldModels, err := Register(&setFieldModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+
+	// Save a model and make sure the field was stored in a set
+	model := &setFieldModel{
+		Tags: []string{"foo", "bar"},
+	}
+	if err := setFieldModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	setKey := setFieldModels.spec.fieldKey(model.Id(), setFieldModels.spec.fieldsByName["Tags"])
+	expectSetContains(t, setKey, "foo")
+	expectSetContains(t, setKey, "bar")
+
+	// Add and remove some members
+	if err := setFieldModels.AddToSetField(model.Id(), "Tags", "baz", "foo"); err != nil {
+		t.Fatalf("Unexpected error in AddToSetField: %s", err.Error())
+	}
+	if err := setFieldModels.RemoveFromSetField(model.Id(), "Tags", "bar"); err != nil {
+		t.Fatalf("Unexpected error in RemoveFromSetField: %s", err.Error())
+	}
+	for _, tag := range []string{"foo", "baz"} {
+		if contains, err := setFieldModels.SetFieldContains(model.Id(), "Tags", tag); err != nil {
+			t.Errorf("Unexpected error in SetFieldContains: %s", err.Error())
+		} else if !contains {
+			t.Errorf("Expected set field to contain %s but it did not", tag)
+		}
+	}
+	if contains, err := setFieldModels.SetFieldContains(model.Id(), "Tags", "bar"); err != nil {
+		t.Errorf("Unexpected error in SetFieldContains: %s", err.Error())
+	} else if contains {
+		t.Error("Expected set field to not contain bar but it did")
+	}
+
+	// Find the model and make sure the field has the correct members
+	modelCopy := &setFieldModel{}
+	if err := setFieldModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if equal, msg := compareAsStringSet([]string{"foo", "baz"}, modelCopy.Tags); !equal {
+		t.Errorf("Found set field was incorrect: %s", msg)
+	}
+
+	// Using a set method on a field which is not a set should cause an error
+	if err := setFieldModels.AddToSetField(model.Id(), "Tags", 42); err == nil {
+		t.Error("Expected error when adding a value of the wrong type but got none")
+	}
+}
+
+// Test that modifying a list or set field in place records a change and adds
+// a record to the audit trail, just like saving the model
+func TestCollectionFieldChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	type collectionChangesModel struct {
+		Name string
+		Ints []int    `redisType:"list"`
+		Tags []string `redisType:"set"`
+		DefaultData
+	}
+	collectionChangesModels := registerTestType(t, &collectionChangesModel{}, Audit(0), StreamChanges(StreamOptions{}))
+	model := &collectionChangesModel{Name: randomString()}
+	if err := collectionChangesModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if err := collectionChangesModels.PushToField(model.Id(), "Ints", randomInt()); err != nil {
+		t.Fatalf("Unexpected error in PushToField: %s", err.Error())
+	}
+	if err := collectionChangesModels.AddToSetField(model.Id(), "Tags", "foo", "bar"); err != nil {
+		t.Fatalf("Unexpected error in AddToSetField: %s", err.Error())
+	}
+	if err := collectionChangesModels.RemoveFromSetField(model.Id(), "Tags", "foo"); err != nil {
+		t.Fatalf("Unexpected error in RemoveFromSetField: %s", err.Error())
+	}
+	// Reads should not record anything
+	if _, err := collectionChangesModels.SetFieldContains(model.Id(), "Tags", "bar"); err != nil {
+		t.Fatalf("Unexpected error in SetFieldContains: %s", err.Error())
+	}
+
+	events := []ChangeEvent{}
+	if _, err := collectionChangesModels.ReplayChanges("", func(event ChangeEvent) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error in ReplayChanges: %s", err.Error())
+	}
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events but got %d: %v", len(events), events)
+	}
+	for i, expectedFields := range [][]string{{"Ints"}, {"Tags"}, {"Tags"}} {
+		event := events[i+1]
+		if event.Id != model.Id() || event.Kind != SaveOp || !reflect.DeepEqual(event.Fields, expectedFields) {
+			t.Errorf("Unexpected event %d: %#v", i+1, event)
+		}
+	}
+
+	history, err := collectionChangesModels.History(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in History: %s", err.Error())
+	}
+	if len(history) != 4 {
+		t.Fatalf("Expected 4 audit records but got %d", len(history))
+	}
+	for _, record := range history[:3] {
+		if record.Action != "save" || len(record.Changes) != 0 {
+			t.Errorf("Unexpected audit record: %+v", record)
+		}
+	}
+}
+
+// Test that the flatten option causes the fields of a nested struct to be
+// stored as separate fields in the main hash and that they can be indexed
+func TestFlattenOption(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	type address struct {
+		City string `zoom:"index"`
+		Zip  int    `redis:"zip"`
+	}
+	type flattenModel struct {
+		Name    string
+		Address address `zoom:"flatten"`
+		DefaultData
+	}
+	flattenModels, err := Register(&flattenModel{})
+	if err != nil {
+		t.Fatalf("Unexpected error in Register: %s", err.Error())
+	}
+
+	models := []*flattenModel{}
+	for _, city := range []string{"Boston", "Chicago"} {
+		model := &flattenModel{
+			Name:    randomString(),
+			Address: address{City: city, Zip: randomInt()},
+		}
+		if err := flattenModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		models = append(models, model)
+	}
+	key, _ := flattenModels.ModelKey(models[0].Id())
+	expectFieldEquals(t, key, "Address.City", models[0].Address.City)
+	expectFieldEquals(t, key, "Address.zip", models[0].Address.Zip)
+
+	modelCopy := &flattenModel{}
+	if err := flattenModels.Find(models[0].Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(models[0], modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", models[0], modelCopy)
+	}
+
+	got := []*flattenModel{}
+	if err := flattenModels.NewQuery().Filter("Address.City =", "Chicago").Run(&got); err != nil {
+		t.Fatalf("Unexpected error in Query.Run: %s", err.Error())
+	}
+	if len(got) != 1 || !reflect.DeepEqual(models[1], got[0]) {
+		t.Errorf("Query results were incorrect.\nExpected: %+v\nGot:      %+v", []*flattenModel{models[1]}, got)
+	}
+}
+
+// Test that specFieldValue returns the same field as looking it up by name,
+// including for the fields of flattened structs and for byte arrays.
+func TestSpecFieldValue(t *testing.T) {
+	type inner struct {
+		City string
+	}
+	type accessorModel struct {
+		Name    string
+		Hash    [4]byte
+		HashPtr *[4]byte
+		Address inner `zoom:"flatten"`
+		DefaultData
+	}
+	spec, err := compileModelSpec(reflect.TypeOf(&accessorModel{}))
+	if err != nil {
+		t.Fatalf("Unexpected error in compileModelSpec: %s", err.Error())
+	}
+	model := &accessorModel{Name: "foo", Address: inner{City: "Chicago"}}
+	mr := &modelRef{model: model, spec: spec}
+	expected := map[string]interface{}{
+		"Name":         "foo",
+		"Hash":         [4]byte{},
+		"Address.City": "Chicago",
+	}
+	for name, value := range expected {
+		got := mr.specFieldValue(spec.fieldsByName[name]).Interface()
+		if !reflect.DeepEqual(value, got) {
+			t.Errorf("Expected %s to be %v but got %v", name, value, got)
+		}
+	}
+	for name, byteArray := range map[string]bool{"Name": false, "Hash": true, "HashPtr": true} {
+		if got := spec.fieldsByName[name].byteArray; got != byteArray {
+			t.Errorf("Expected byteArray for %s to be %v but got %v", name, byteArray, got)
+		}
+	}
+}
@@ -262,6 +262,45 @@ func registerTestingTypes() {
 	}
 }
 
+// registerTestType registers the type of model with the default pool using the
+// given options and unregisters it when the test or benchmark finishes. It is
+// used for model types which are only needed by a single test.
+func registerTestType(t testing.TB, model Model, options ...ModelOption) *ModelType {
+	mt, err := RegisterWithOptions(model, options...)
+	if err != nil {
+		t.Fatalf("Unexpected error in RegisterWithOptions: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		if err := Unregister(model); err != nil {
+			t.Errorf("Unexpected error in Unregister: %s", err.Error())
+		}
+	})
+	return mt
+}
+
+// removeLastPool removes the pool which was created most recently with NewPool
+// from otherPools. It is used by tests which create their own pool.
+func removeLastPool() {
+	otherPoolsMu.Lock()
+	otherPools = otherPools[:len(otherPools)-1]
+	otherPoolsMu.Unlock()
+}
+
+// setEncryptionKey changes the key used to encrypt and decrypt fields without
+// changing any of the other settings. If key is empty, encryption is disabled.
+func setEncryptionKey(key []byte) error {
+	aead, err := newEncryptionAEAD(key)
+	if err != nil {
+		return err
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	newSettings := *currentSettings
+	newSettings.encryptionAEAD = aead
+	currentSettings = &newSettings
+	return nil
+}
+
 // checkDatabaseEmpty panics if the database to be used for testing
 // is not empty.
 func checkDatabaseEmpty() {
@@ -336,7 +375,7 @@ func expectFieldEquals(t *testing.T, key string, fieldName string, expected inte
 	case typ.Kind() == reflect.Ptr:
 		err = scanPointerVal(srcBytes, dest)
 	default:
-		err = scanInconvertibleVal(srcBytes, dest)
+		err = scanInconvertibleVal(srcBytes, dest, getSettings().marshalerUnmarshaler)
 	}
 	if err != nil {
 		t.Errorf("Unexpected error scanning value for field %s: %s", fieldName, err)
@@ -481,7 +520,10 @@ func numericIndexExists(modelType *ModelType, model Model, fieldName string) (bo
 		return false, err
 	}
 	fieldValue := reflect.ValueOf(model).Elem().FieldByName(fieldName)
-	score := numericScore(fieldValue)
+	score, err := numericScore(fieldValue)
+	if err != nil {
+		return false, err
+	}
 	conn := NewConn()
 	defer conn.Close()
 	gotIds, err := redis.Strings(conn.Do("ZRANGEBYSCORE", indexKey, score, score))
@@ -500,10 +542,7 @@ func stringIndexExists(modelType *ModelType, model Model, fieldName string) (boo
 		return false, err
 	}
 	fieldValue := reflect.ValueOf(model).Elem().FieldByName(fieldName)
-	for fieldValue.Kind() == reflect.Ptr {
-		fieldValue = fieldValue.Elem()
-	}
-	memberKey := fieldValue.String() + nullString + model.Id()
+	memberKey := stringValue(fieldValue) + nullString + model.Id()
 	conn := NewConn()
 	defer conn.Close()
 	reply, err := conn.Do("ZRANK", indexKey, memberKey)
@@ -0,0 +1,140 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File text.go contains code related to storing fields which implement
+// encoding.TextMarshaler, such as big.Int and most decimal types.
+
+package zoom
+
+import (
+	"encoding"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	float64erType       = reflect.TypeOf((*interface {
+		Float64() (float64, bool)
+	})(nil)).Elem()
+)
+
+// typeIsText returns true iff a pointer to typ implements both encoding.TextMarshaler
+// and encoding.TextUnmarshaler. If typ is a pointer, the same is checked for the
+// type it points to.
+func typeIsText(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	ptrType := reflect.PtrTo(typ)
+	return ptrType.Implements(textMarshalerType) && ptrType.Implements(textUnmarshalerType)
+}
+
+// typeIsNumericText returns true iff typ is a text type (see typeIsText) whose
+// text representation is a number, so that it can be indexed. This includes
+// big.Int, big.Float, and decimal types with a Float64() (float64, bool) method
+// (e.g. github.com/shopspring/decimal). If typ is a pointer, the same is checked
+// for the type it points to.
+func typeIsNumericText(typ reflect.Type) bool {
+	if !typeIsText(typ) {
+		return false
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case reflect.TypeOf(big.Int{}), reflect.TypeOf(big.Float{}):
+		return true
+	}
+	return reflect.PtrTo(typ).Implements(float64erType)
+}
+
+// textScore returns the score for val, which must be a numeric text type (see
+// typeIsNumericText), in a sorted set. Very large or very precise values may lose
+// precision, since scores in redis are float64s, and values which are outside
+// the range of a float64 are clamped to +Inf or -Inf. big.Int and big.Float are
+// converted directly and types with a Float64() (float64, bool) method use it.
+// Other types are converted by parsing their text representation, which returns
+// an error if it is not a number.
+func textScore(val reflect.Value) (float64, error) {
+	// Get a pointer to the value, since the methods may have pointer receivers
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	switch v := ptr.Interface().(type) {
+	case *big.Int:
+		// Float64 on a big.Float returns +Inf or -Inf if the value is out of range
+		score, _ := new(big.Float).SetInt(v).Float64()
+		return score, nil
+	case *big.Float:
+		score, _ := v.Float64()
+		return score, nil
+	case interface {
+		Float64() (float64, bool)
+	}:
+		score, _ := v.Float64()
+		return score, nil
+	}
+	text, err := textMarshalerUnmarshaler{}.Marshal(val.Interface())
+	if err != nil {
+		return 0, fmt.Errorf("zoom: could not convert %s to text: %s", val.Type().String(), err.Error())
+	}
+	score, err := strconv.ParseFloat(string(text), 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			// ParseFloat returns +Inf or -Inf if the value is out of range
+			return score, nil
+		}
+		return 0, fmt.Errorf("zoom: could not convert %s to a score: %s", string(text), err.Error())
+	}
+	return score, nil
+}
+
+// textMarshalerUnmarshaler is an implementation of MarshalerUnmarshaler which uses
+// the encoding.TextMarshaler and encoding.TextUnmarshaler interfaces. It is used
+// automatically for any inconvertible field whose type implements them. Values
+// which were stored with gob by older versions of zoom can still be read.
+type textMarshalerUnmarshaler struct{}
+
+// Marshal calls MarshalText on v.
+func (textMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	if marshaler, ok := v.(encoding.TextMarshaler); ok {
+		return marshaler.MarshalText()
+	}
+	val := reflect.ValueOf(v)
+	if !val.IsValid() || !reflect.PtrTo(val.Type()).Implements(textMarshalerType) {
+		return nil, fmt.Errorf("zoom: cannot marshal %T because it does not implement encoding.TextMarshaler", v)
+	}
+	// Copy the value so we have something addressable
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	return ptr.Interface().(encoding.TextMarshaler).MarshalText()
+}
+
+// Unmarshal calls UnmarshalText on v, which must be a pointer to an
+// encoding.TextUnmarshaler or a pointer to a (possibly nil) pointer to one. If
+// UnmarshalText fails, it tries to decode data with gob instead, since these
+// fields were stored with gob before they were stored as text.
+func (textMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	unmarshaler, ok := v.(encoding.TextUnmarshaler)
+	if !ok {
+		val := reflect.ValueOf(v)
+		if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Ptr || !val.Elem().Type().Implements(textUnmarshalerType) {
+			return fmt.Errorf("zoom: cannot unmarshal into %T because it does not implement encoding.TextUnmarshaler", v)
+		}
+		if val.Elem().IsNil() {
+			val.Elem().Set(reflect.New(val.Elem().Type().Elem()))
+		}
+		unmarshaler = val.Elem().Interface().(encoding.TextUnmarshaler)
+	}
+	err := unmarshaler.UnmarshalText(data)
+	if err != nil {
+		if gobErr := GobMarshalerUnmarshaler.Unmarshal(data, unmarshaler); gobErr == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File text_test.go tests the code in text.go, i.e. storing and
+// indexing fields which implement encoding.TextMarshaler.
+
+package zoom
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// bigModel is a model type that is only used for testing big.Int fields
+type bigModel struct {
+	Balance *big.Int `zoom:"index"`
+	Total   big.Int
+	DefaultData
+}
+
+func TestBigIntFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	bigModels := registerTestType(t, &bigModel{})
+
+	models := []*bigModel{}
+	for _, balance := range []string{"-5", "100", "123456789012345678901234567890"} {
+		model := &bigModel{Balance: new(big.Int)}
+		model.Balance.SetString(balance, 10)
+		model.Total.SetString(balance+"0", 10)
+		if err := bigModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		models = append(models, model)
+	}
+
+	// The values should be stored as decimal strings
+	key, _ := bigModels.ModelKey(models[2].Id())
+	expectFieldEquals(t, key, "Balance", "123456789012345678901234567890")
+	expectFieldEquals(t, key, "Total", "1234567890123456789012345678900")
+
+	modelCopy := &bigModel{}
+	if err := bigModels.Find(models[2].Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(models[2], modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", models[2], modelCopy)
+	}
+
+	// Filter and order by the indexed field
+	got := []*bigModel{}
+	q := bigModels.NewQuery().Filter("Balance >", big.NewInt(0)).Order("-Balance")
+	if err := q.Run(&got); err != nil {
+		t.Fatalf("Unexpected error in Query.Run: %s", err.Error())
+	}
+	expected := []*bigModel{models[2], models[1]}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Query results were incorrect.\nExpected: %+v\nGot:      %+v", expected, got)
+	}
+}
+
+// centsValue is a numeric text type whose text representation is not a plain
+// number, so its score must come from its Float64 method
+type centsValue int64
+
+func (c centsValue) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("$%d.%02d", c/100, c%100)), nil
+}
+
+func (c *centsValue) UnmarshalText(text []byte) error {
+	var dollars, cents int64
+	if _, err := fmt.Sscanf(string(text), "$%d.%d", &dollars, &cents); err != nil {
+		return err
+	}
+	*c = centsValue(dollars*100 + cents)
+	return nil
+}
+
+func (c centsValue) Float64() (float64, bool) {
+	return float64(c) / 100, true
+}
+
+func TestTextScore(t *testing.T) {
+	huge := new(big.Int).Exp(big.NewInt(10), big.NewInt(400), nil)
+	testCases := []struct {
+		value    interface{}
+		expected float64
+	}{
+		{big.NewInt(-5), -5},
+		{huge, math.Inf(1)},
+		{new(big.Int).Neg(huge), math.Inf(-1)},
+		{big.NewFloat(1.5), 1.5},
+		{centsValue(250), 2.5},
+	}
+	for _, tc := range testCases {
+		got, err := numericScore(reflect.ValueOf(tc.value))
+		if err != nil {
+			t.Errorf("Unexpected error in numericScore for %v: %s", tc.value, err.Error())
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("Score for %v was incorrect. Expected %v but got %v", tc.value, tc.expected, got)
+		}
+	}
+}
+
+func TestTextLegacyGob(t *testing.T) {
+	// Text fields were stored with gob before they were stored as text, so gob
+	// values should still be readable
+	expected := big.NewInt(1234567890123)
+	data, err := GobMarshalerUnmarshaler.Marshal(expected)
+	if err != nil {
+		t.Fatalf("Unexpected error in Marshal: %s", err.Error())
+	}
+	got := new(big.Int)
+	if err := (textMarshalerUnmarshaler{}).Unmarshal(data, got); err != nil {
+		t.Errorf("Unexpected error in Unmarshal: %s", err.Error())
+	} else if got.Cmp(expected) != 0 {
+		t.Errorf("Expected %s but got %s", expected, got)
+	}
+	var gotPtr *big.Int
+	if err := (textMarshalerUnmarshaler{}).Unmarshal(data, &gotPtr); err != nil {
+		t.Errorf("Unexpected error in Unmarshal: %s", err.Error())
+	} else if gotPtr.Cmp(expected) != 0 {
+		t.Errorf("Expected %s but got %s", expected, gotPtr)
+	}
+	if err := (textMarshalerUnmarshaler{}).Unmarshal([]byte("not a number"), got); err == nil {
+		t.Error("Expected an error in Unmarshal for an invalid value but got none")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File time.go contains code related to storing time.Time fields
+// in a readable and sortable format.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeIsTime returns true iff typ is time.Time or *time.Time.
+func typeIsTime(typ reflect.Type) bool {
+	return typ == timeType || (typ.Kind() == reflect.Ptr && typ.Elem() == timeType)
+}
+
+// timeMarshalerUnmarshaler is an implementation of MarshalerUnmarshaler for
+// time.Time values. It is used automatically for fields of type time.Time or
+// *time.Time. Times are stored in UTC, either in RFC 3339 format (the default)
+// or as the number of nanoseconds since the unix epoch if unixNano is true. The
+// zero time is stored as an empty string. Values which were stored with gob by
+// older versions of zoom can still be read.
+type timeMarshalerUnmarshaler struct {
+	unixNano bool
+}
+
+// newTimeMarshalerUnmarshaler returns a timeMarshalerUnmarshaler for the given
+// format, which should be the value of the "time" option in the zoom struct tag.
+func newTimeMarshalerUnmarshaler(format string) (MarshalerUnmarshaler, error) {
+	switch format {
+	case "", "rfc3339":
+		return timeMarshalerUnmarshaler{}, nil
+	case "unixnano":
+		return timeMarshalerUnmarshaler{unixNano: true}, nil
+	default:
+		return nil, fmt.Errorf("zoom: unrecognized time format: %s. Should be rfc3339 or unixnano", format)
+	}
+}
+
+// Marshal converts v, which must be a time.Time or *time.Time, to bytes.
+func (mu timeMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		t = *v
+	default:
+		return nil, fmt.Errorf("zoom: cannot marshal %T as a time", v)
+	}
+	if t.IsZero() {
+		return []byte{}, nil
+	}
+	if mu.unixNano {
+		return []byte(strconv.FormatInt(t.UnixNano(), 10)), nil
+	}
+	return []byte(t.UTC().Format(time.RFC3339Nano)), nil
+}
+
+// Unmarshal parses data and stores the result in v, which must be a *time.Time
+// or a **time.Time.
+func (mu timeMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	var dest *time.Time
+	switch v := v.(type) {
+	case *time.Time:
+		dest = v
+	case **time.Time:
+		if *v == nil {
+			*v = new(time.Time)
+		}
+		dest = *v
+	default:
+		return fmt.Errorf("zoom: cannot unmarshal time into %T", v)
+	}
+	if len(data) == 0 {
+		*dest = time.Time{}
+		return nil
+	}
+	if mu.unixNano {
+		nanos, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return unmarshalLegacyTime(data, dest, err)
+		}
+		*dest = time.Unix(0, nanos).UTC()
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(data))
+	if err != nil {
+		return unmarshalLegacyTime(data, dest, err)
+	}
+	*dest = t.UTC()
+	return nil
+}
+
+// unmarshalLegacyTime decodes data, which could not be parsed in the expected
+// format, with gob, since time fields were stored with gob before they were
+// stored in a readable format. If that fails too, it returns an error which
+// includes parseErr.
+func unmarshalLegacyTime(data []byte, dest *time.Time, parseErr error) error {
+	var t time.Time
+	if err := GobMarshalerUnmarshaler.Unmarshal(data, &t); err != nil {
+		return fmt.Errorf("zoom: could not convert %s to time: %s", string(data), parseErr.Error())
+	}
+	*dest = t.UTC()
+	return nil
+}
+
+// timeScore returns the score for t in a sorted set, i.e. the number of
+// nanoseconds since the unix epoch as a float64. Unlike t.UnixNano, it does not
+// overflow for times far from the epoch (at the cost of some precision).
+func timeScore(t time.Time) float64 {
+	return float64(t.Unix())*1e9 + float64(t.Nanosecond())
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File time_test.go tests the code in time.go, i.e. storing and
+// indexing time.Time fields.
+
+package zoom
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// timeModel is a model type that is only used for testing time.Time fields
+type timeModel struct {
+	Created time.Time  `zoom:"index"`
+	Updated *time.Time `zoom:"time=unixnano"`
+	Deleted *time.Time
+	Zero    time.Time
+	DefaultData
+}
+
+func TestTimeFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	timeModels := registerTestType(t, &timeModel{})
+
+	// Create some models with increasing Created times
+	base := time.Unix(1420070400, 123456789).UTC()
+	models := []*timeModel{}
+	for i := 0; i < 3; i++ {
+		updated := base.Add(time.Duration(i) * time.Minute)
+		model := &timeModel{
+			Created: base.Add(time.Duration(i) * time.Hour),
+			Updated: &updated,
+		}
+		if err := timeModels.Save(model); err != nil {
+			t.Fatalf("Unexpected error in Save: %s", err.Error())
+		}
+		models = append(models, model)
+	}
+
+	// Check the stored formats
+	key, _ := timeModels.ModelKey(models[0].Id())
+	expectFieldEquals(t, key, "Created", models[0].Created.Format(time.RFC3339Nano))
+	expectFieldEquals(t, key, "Updated", strconv.FormatInt(models[0].Updated.UnixNano(), 10))
+	expectFieldEquals(t, key, "Zero", "")
+
+	modelCopy := &timeModel{}
+	if err := timeModels.Find(models[0].Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(models[0], modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", models[0], modelCopy)
+	}
+
+	// Filter and order by the indexed time field
+	got := []*timeModel{}
+	q := timeModels.NewQuery().Filter("Created >", models[0].Created).Order("-Created")
+	if err := q.Run(&got); err != nil {
+		t.Fatalf("Unexpected error in Query.Run: %s", err.Error())
+	}
+	expected := []*timeModel{models[2], models[1]}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Query results were incorrect.\nExpected: %+v\nGot:      %+v", expected, got)
+	}
+}
+
+func TestTimeLegacyGob(t *testing.T) {
+	// Time fields were stored with gob before they were stored in a readable
+	// format, so gob values should still be readable
+	expected := time.Date(2015, 6, 1, 12, 30, 0, 500, time.UTC)
+	data, err := GobMarshalerUnmarshaler.Marshal(expected)
+	if err != nil {
+		t.Fatalf("Unexpected error in Marshal: %s", err.Error())
+	}
+	for _, mu := range []timeMarshalerUnmarshaler{{}, {unixNano: true}} {
+		var got time.Time
+		if err := mu.Unmarshal(data, &got); err != nil {
+			t.Errorf("Unexpected error in Unmarshal: %s", err.Error())
+		} else if !got.Equal(expected) {
+			t.Errorf("Expected %s but got %s", expected, got)
+		}
+	}
+	var got time.Time
+	if err := (timeMarshalerUnmarshaler{}).Unmarshal([]byte("not a time"), &got); err == nil {
+		t.Error("Expected an error in Unmarshal for an invalid time but got none")
+	}
+}
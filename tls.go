@@ -0,0 +1,52 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File tls.go contains code related to connecting to the database
+// over TLS.
+
+package zoom
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// buildTLSConfig returns the tls.Config that should be used for connections
+// based on config. If config.TLSConfig is not nil, a copy of it is used as the
+// base. Any TLS file, server name, or skip verify options in config are then
+// applied on top.
+func buildTLSConfig(config *Configuration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("zoom: could not load TLS certificate: %s", err.Error())
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	if config.TLSCAFile != "" {
+		caCert, err := ioutil.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("zoom: could not read TLS CA file: %s", err.Error())
+		}
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("zoom: could not parse any certificates in TLS CA file %s", config.TLSCAFile)
+		}
+	}
+	if config.TLSServerName != "" {
+		tlsConfig.ServerName = config.TLSServerName
+	}
+	if config.TLSSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File tls_test.go tests the code in tls.go, i.e. building the
+// configuration for TLS connections.
+
+package zoom
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestBuildTLSConfig(t *testing.T) {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	config := &Configuration{
+		UseTLS:        true,
+		TLSConfig:     base,
+		TLSServerName: "redis.example.com",
+		TLSSkipVerify: true,
+	}
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		t.Fatalf("Unexpected error in buildTLSConfig: %s", err.Error())
+	}
+	if tlsConfig.ServerName != "redis.example.com" {
+		t.Errorf("Expected ServerName to be %q but got %q", "redis.example.com", tlsConfig.ServerName)
+	}
+	if !tlsConfig.InsecureSkipVerify {
+		t.Error("Expected InsecureSkipVerify to be true")
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected MinVersion to be copied from TLSConfig but got %d", tlsConfig.MinVersion)
+	}
+	if base.ServerName != "" {
+		t.Error("Expected TLSConfig to be copied instead of modified")
+	}
+
+	// Files which do not exist should cause an error
+	config = &Configuration{UseTLS: true, TLSCAFile: "/does/not/exist.pem"}
+	if _, err := buildTLSConfig(config); err == nil {
+		t.Error("Expected error when TLSCAFile does not exist but got none")
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File tracking.go contains code related to caching models locally
+// using the client tracking feature of redis 6, which notifies
+// zoom whenever a cached model is modified.
+
+package zoom
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"sync"
+	"time"
+)
+
+// invalidateChannel is the channel redis uses to send invalidation messages
+// when client tracking is redirected to a RESP2 connection.
+const invalidateChannel = "__redis__:invalidate"
+
+// UseClientTracking is a ModelOption which causes zoom to keep a local cache of
+// the models of the given type which are retrieved with ModelType.Find. Repeat
+// calls to Find for the same model are answered from the cache without touching
+// the database. Entries are invalidated automatically by the database whenever
+// the model is modified by any client, using the client tracking feature added
+// in redis 6 (see https://redis.io/topics/client-side-caching). Since
+// invalidation is asynchronous, Find may briefly return stale values after a
+// different client modifies a model. Saves and deletes made through ModelType
+// methods or transactions in this process are reflected immediately.
+//
+// When the option is used, two connections per pool are reserved for the
+// cache: one for reading models which are not yet cached, and one for receiving
+// invalidation messages. If either connection is lost, the cache is cleared.
+// Only Find uses the cache, and model types with fields which are stored
+// outside of the main hash (e.g. lists or sets) are never cached.
+func UseClientTracking() ModelOption {
+	return func(spec *modelSpec) error {
+		spec.clientTracking = true
+		return nil
+	}
+}
+
+// tracker holds the local cache for a Pool along with the connections needed
+// to keep it up to date.
+type tracker struct {
+	// conn is used to read models which are not cached. Since reads on conn
+	// are tracked by the database, connMu must be held while using it.
+	conn   redis.Conn
+	connMu sync.Mutex
+	// sub is subscribed to invalidateChannel and busChannel
+	sub        redis.Conn
+	busChannel string
+	// entries maps the key for a model to its cached entry
+	entries map[string]*trackedEntry
+	// lrus holds the keys for the cached models of each type which uses the
+	// UseLocalCache option, starting with the most recently used
+	lrus      map[*modelSpec]*list.List
+	entriesMu sync.Mutex
+	// clientTracking is true if client tracking was enabled on conn
+	clientTracking bool
+	// stopOnce ensures the connections are only closed once
+	stopOnce sync.Once
+}
+
+// trackedEntry is the cached reply from HMGET for a single model. reply is nil
+// while the model is being read from the database.
+type trackedEntry struct {
+	reply []interface{}
+	spec  *modelSpec
+	// cachedAt and elem are only set for types which use the UseLocalCache
+	// option. elem is the element for the entry in the list for its type.
+	cachedAt time.Time
+	elem     *list.Element
+}
+
+// getTracker returns the tracker for p, starting it first if needed. If
+// clientTracking is true and client tracking is not enabled for the current
+// tracker (e.g. because it was started before the first type which uses the
+// UseClientTracking option was registered), the current tracker is replaced
+// with one that has client tracking enabled.
+func (p *Pool) getTracker(clientTracking bool) (*tracker, error) {
+	p.trackerMu.Lock()
+	oldTracker := p.tracker
+	if oldTracker != nil && (oldTracker.clientTracking || !clientTracking) {
+		p.trackerMu.Unlock()
+		return oldTracker, nil
+	}
+	p.tracker = nil
+	tr, err := p.startTracker(clientTracking)
+	if err == nil {
+		p.tracker = tr
+	}
+	p.trackerMu.Unlock()
+	if oldTracker != nil {
+		p.stopTracker(oldTracker)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// startTracker creates a new tracker, subscribes to invalidation messages, and
+// enables client tracking on the connection used for reads if clientTracking is
+// true or any of the types registered with p use the UseClientTracking option.
+func (p *Pool) startTracker(clientTracking bool) (*tracker, error) {
+	state := p.getState()
+	clientTracking = clientTracking || p.usesClientTracking()
+	sub := state.driver.Get()
+	var subId int64
+	if clientTracking {
+		var err error
+		subId, err = redis.Int64(sub.Do("CLIENT", "ID"))
+		if err != nil {
+			sub.Close()
+			return nil, fmt.Errorf("zoom: Error enabling client tracking: %s", err.Error())
+		}
+	}
+	busChannel := state.keyPrefix + invalidationBusChannel
+	if _, err := sub.Do("SUBSCRIBE", invalidateChannel, busChannel); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("zoom: Error enabling client tracking: %s", err.Error())
+	}
+	conn := state.driver.Get()
+	if clientTracking {
+		if _, err := conn.Do("CLIENT", "TRACKING", "ON", "REDIRECT", subId); err != nil {
+			sub.Close()
+			conn.Close()
+			return nil, fmt.Errorf("zoom: Error enabling client tracking: %s", err.Error())
+		}
+	}
+	tr := &tracker{
+		conn:           conn,
+		sub:            sub,
+		busChannel:     busChannel,
+		entries:        map[string]*trackedEntry{},
+		lrus:           map[*modelSpec]*list.List{},
+		clientTracking: clientTracking,
+	}
+	go p.listenForInvalidations(tr)
+	return tr, nil
+}
+
+// listenForInvalidations removes entries from the cache for tr as invalidation
+// messages are received. If there is an error, tr is stopped and the next call
+// to getTracker will start a new one.
+func (p *Pool) listenForInvalidations(tr *tracker) {
+	for {
+		reply, err := receiveWithoutTimeout(tr.sub)
+		if err != nil {
+			p.stopTracker(tr)
+			return
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 3 {
+			continue
+		}
+		if kind, _ := redis.String(values[0], nil); kind != "message" {
+			continue
+		}
+		if channel, _ := redis.String(values[1], nil); channel == tr.busChannel {
+			// Messages from the invalidation bus hold a single key, or "*" if
+			// every entry should be removed
+			key, err := redis.String(values[2], nil)
+			if err != nil {
+				continue
+			}
+			if key == "*" {
+				tr.clear()
+			} else {
+				tr.forget(key)
+			}
+			continue
+		}
+		if values[2] == nil {
+			// A nil message means the entire database was flushed
+			tr.clear()
+			continue
+		}
+		keys, err := redis.Strings(values[2], nil)
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			tr.forget(key)
+		}
+	}
+}
+
+// stopTracker closes the connections for tr and clears its cache. It has no
+// effect if tr has already been stopped.
+func (p *Pool) stopTracker(tr *tracker) {
+	p.trackerMu.Lock()
+	if p.tracker == tr {
+		p.tracker = nil
+	}
+	p.trackerMu.Unlock()
+	tr.stopOnce.Do(func() {
+		tr.clear()
+		tr.sub.Close()
+		tr.connMu.Lock()
+		tr.conn.Close()
+		tr.connMu.Unlock()
+	})
+}
+
+// hmget returns the reply to HMGET with the given args for the model of the
+// given type with the given key, using the cached reply if there is one.
+func (tr *tracker) hmget(ms *modelSpec, key string, args redis.Args) ([]interface{}, error) {
+	tr.entriesMu.Lock()
+	if entry, found := tr.entries[key]; found && entry.reply != nil {
+		if !entry.expired() {
+			tr.touch(entry)
+			tr.entriesMu.Unlock()
+			return entry.reply, nil
+		}
+		tr.remove(key, entry)
+	}
+	entry := &trackedEntry{spec: ms}
+	tr.entries[key] = entry
+	tr.entriesMu.Unlock()
+
+	tr.connMu.Lock()
+	reply, err := redis.Values(tr.conn.Do("HMGET", args...))
+	tr.connMu.Unlock()
+	if err != nil {
+		tr.forget(key)
+		return nil, err
+	}
+	// Only cache the reply if the entry was not invalidated while we were
+	// reading it
+	tr.entriesMu.Lock()
+	if tr.entries[key] == entry {
+		entry.reply = reply
+		tr.addToLRU(key, entry)
+	}
+	tr.entriesMu.Unlock()
+	return reply, nil
+}
+
+// forget removes the entry for the given key from the cache.
+func (tr *tracker) forget(key string) {
+	tr.entriesMu.Lock()
+	if entry, found := tr.entries[key]; found {
+		tr.remove(key, entry)
+	}
+	tr.entriesMu.Unlock()
+}
+
+// clear removes all entries from the cache.
+func (tr *tracker) clear() {
+	tr.entriesMu.Lock()
+	tr.entries = map[string]*trackedEntry{}
+	tr.lrus = map[*modelSpec]*list.List{}
+	tr.entriesMu.Unlock()
+}
+
+// forgetSpec removes all entries for models of the given type from the cache.
+func (tr *tracker) forgetSpec(ms *modelSpec) {
+	tr.entriesMu.Lock()
+	for key, entry := range tr.entries {
+		if entry.spec == ms {
+			tr.remove(key, entry)
+		}
+	}
+	tr.entriesMu.Unlock()
+}
+
+// usesLocalCache returns true iff models of the type can be cached.
+func (ms *modelSpec) usesLocalCache() bool {
+	return (ms.clientTracking || ms.invalidationBus || ms.localCache) && len(ms.collectionFields(ms.fieldNames())) == 0
+}
+
+// findTracked is like Find but uses the local cache. See UseClientTracking.
+func (mt *ModelType) findTracked(id string, model Model) error {
+	if err := mt.checkModelType(model); err != nil {
+		return fmt.Errorf("zoom: Error in Find: %s", err.Error())
+	}
+	tr, err := mt.spec.pool.getTracker(mt.spec.clientTracking)
+	if err != nil {
+		return err
+	}
+	model.SetId(id)
+	mr := &modelRef{
+		spec:  mt.spec,
+		model: model,
+	}
+	fieldNames, args := mr.findArgs()
+	reply, err := tr.hmget(mt.spec, mr.key(), args)
+	if err != nil {
+		return err
+	}
+	return newScanModelHandler(fieldNames, mr)(reply)
+}
+
+// newForgetTrackedHandler returns a handler which removes the model with the
+// given key from the local cache and then calls handler (if not nil). It is
+// used so that changes made in this process are reflected immediately instead
+// of waiting for an invalidation message. It returns handler if models of the
+// type are not cached.
+func (ms *modelSpec) newForgetTrackedHandler(key string, handler ReplyHandler) ReplyHandler {
+	if !ms.usesLocalCache() {
+		return handler
+	}
+	return func(reply interface{}) error {
+		ms.pool.trackerMu.Lock()
+		tr := ms.pool.tracker
+		ms.pool.trackerMu.Unlock()
+		if tr != nil {
+			tr.forget(key)
+		}
+		if handler != nil {
+			return handler(reply)
+		}
+		return nil
+	}
+}
+
+// newForgetAllTrackedHandler is like newForgetTrackedHandler but removes every
+// model of the type from the local cache, e.g. after DeleteAll.
+func (ms *modelSpec) newForgetAllTrackedHandler(handler ReplyHandler) ReplyHandler {
+	if !ms.usesLocalCache() {
+		return handler
+	}
+	return func(reply interface{}) error {
+		ms.pool.trackerMu.Lock()
+		tr := ms.pool.tracker
+		ms.pool.trackerMu.Unlock()
+		if tr != nil {
+			tr.forgetSpec(ms)
+		}
+		if handler != nil {
+			return handler(reply)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File tracking_test.go tests the code in tracking.go, i.e.
+// caching models locally using client tracking.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clientTrackedModel is a model type that is only used for testing
+// the UseClientTracking option
+type clientTrackedModel struct {
+	Int    int
+	String string
+	DefaultData
+}
+
+func TestClientTracking(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	clientTrackedModels := registerTestType(t, &clientTrackedModel{}, UseClientTracking())
+	model := &clientTrackedModel{Int: randomInt(), String: randomString()}
+	if err := clientTrackedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// The first Find should read from the database and cache the model
+	modelCopy := &clientTrackedModel{}
+	if err := clientTrackedModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+	tr, err := defaultPool.getTracker(true)
+	if err != nil {
+		t.Fatalf("Unexpected error in getTracker: %s", err.Error())
+	}
+	defer defaultPool.stopTracker(tr)
+	key, _ := clientTrackedModels.ModelKey(model.Id())
+	tr.entriesMu.Lock()
+	_, cached := tr.entries[key]
+	tr.entriesMu.Unlock()
+	if !cached {
+		t.Error("Expected model to be cached after Find")
+	}
+
+	// Modifying the model directly should invalidate the cache
+	conn := NewConn()
+	defer conn.Close()
+	newString := randomString()
+	if _, err := conn.Do("HSET", key, "String", newString); err != nil {
+		t.Fatalf("Unexpected error in HSET: %s", err.Error())
+	}
+	model.String = newString
+	for i := 0; i < 100; i++ {
+		tr.entriesMu.Lock()
+		_, cached = tr.entries[key]
+		tr.entriesMu.Unlock()
+		if !cached {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if cached {
+		t.Fatal("Expected model to be removed from the cache after it was modified")
+	}
+	modelCopy = &clientTrackedModel{}
+	if err := clientTrackedModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+
+	// Saving the model with zoom should be reflected immediately
+	model.Int++
+	if err := clientTrackedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	modelCopy = &clientTrackedModel{}
+	if err := clientTrackedModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
+
+func TestClientTrackingRegisteredLater(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// Start the tracker for a type which does not use client tracking
+	localCachedModels := registerTestType(t, &localCachedModel{}, UseLocalCache(2, 0))
+	localModel := &localCachedModel{Int: randomInt()}
+	if err := localCachedModels.Save(localModel); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if err := localCachedModels.Find(localModel.Id(), &localCachedModel{}); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	oldTracker, err := defaultPool.getTracker(false)
+	if err != nil {
+		t.Fatalf("Unexpected error in getTracker: %s", err.Error())
+	}
+	if oldTracker.clientTracking {
+		t.Fatal("Expected client tracking to be disabled before a type which uses it was registered")
+	}
+
+	// Registering a type which uses client tracking afterwards should cause the
+	// tracker to be replaced with one that has client tracking enabled
+	clientTrackedModels := registerTestType(t, &clientTrackedModel{}, UseClientTracking())
+	model := &clientTrackedModel{Int: randomInt(), String: randomString()}
+	if err := clientTrackedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if err := clientTrackedModels.Find(model.Id(), &clientTrackedModel{}); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	tr, err := defaultPool.getTracker(true)
+	if err != nil {
+		t.Fatalf("Unexpected error in getTracker: %s", err.Error())
+	}
+	defer defaultPool.stopTracker(tr)
+	if tr == oldTracker || !tr.clientTracking {
+		t.Fatal("Expected the tracker to be replaced with one that uses client tracking")
+	}
+
+	// Modifying the model directly should invalidate the cache
+	key, _ := clientTrackedModels.ModelKey(model.Id())
+	conn := NewConn()
+	defer conn.Close()
+	if _, err := conn.Do("HSET", key, "String", randomString()); err != nil {
+		t.Fatalf("Unexpected error in HSET: %s", err.Error())
+	}
+	cached := true
+	for i := 0; i < 100 && cached; i++ {
+		time.Sleep(time.Millisecond)
+		tr.entriesMu.Lock()
+		_, cached = tr.entries[key]
+		tr.entriesMu.Unlock()
+	}
+	if cached {
+		t.Error("Expected model to be removed from the cache after it was modified")
+	}
+}
@@ -18,9 +18,21 @@ import (
 // commands or lua scripts. Transactions feature delayed execution,
 // so nothing toches the database until you call Exec.
 type Transaction struct {
-	conn    redis.Conn
-	actions []*Action
-	err     error
+	conn redis.Conn
+	// newConn is used to replace conn if it is broken by a network error
+	newConn func() redis.Conn
+	// pool is the Pool that conn came from
+	pool     *Pool
+	actions  []*Action
+	watching []string
+	hooks    []TransactionHooks
+	err      error
+	parent   *Transaction
+	// actor is recorded in the audit trail. See SetActor.
+	actor string
+	// uniqueClaims maps the value of each unique field saved in the
+	// transaction to the id of the model which has it. See checkUniqueFields.
+	uniqueClaims map[string]string
 }
 
 // Action is a single step in a transaction and must be either a command
@@ -45,14 +57,83 @@ const (
 // command or script.
 type ReplyHandler func(interface{}) error
 
-// NewTransaction instantiates and returns a new transaction.
+// NewTransaction instantiates and returns a new transaction which uses the
+// default pool.
 func NewTransaction() *Transaction {
+	return defaultPool.NewTransaction()
+}
+
+// NewTransaction instantiates and returns a new transaction which uses p. Any
+// ModelTypes passed to the methods of the transaction should be registered
+// with p.
+func (p *Pool) NewTransaction() *Transaction {
+	return newTransaction(p, p.NewConn)
+}
+
+// newTransaction returns a new transaction which gets connections by calling
+// newConn, which should return connections from p.
+func newTransaction(p *Pool, newConn func() redis.Conn) *Transaction {
 	t := &Transaction{
-		conn: NewConn(),
+		conn:    newConn(),
+		newConn: newConn,
+		pool:    p,
+		hooks:   append([]TransactionHooks{}, globalTransactionHooks...),
 	}
 	return t
 }
 
+// Begin starts a child transaction inside of t. Commands and scripts added to
+// the child are not added to t right away. Instead, when Exec is called on the
+// child, everything that was added to the child (including any errors, hooks,
+// and watched keys) is merged into t, and nothing is sent to the database until
+// Exec is called on t. If Rollback is called on the child instead, everything
+// that was added to the child is discarded and t is left unchanged. This allows
+// code which creates and executes its own transactions to compose with callers
+// that also use transactions, by accepting an optional parent transaction and
+// calling Begin on it. Child transactions share a connection with their parent,
+// so keys watched by the child remain watched even if the child is rolled back.
+func (t *Transaction) Begin() *Transaction {
+	return &Transaction{
+		conn:   t.conn,
+		pool:   t.pool,
+		parent: t,
+		actor:  t.actor,
+	}
+}
+
+// Rollback discards everything that was added to a child transaction created
+// with Begin, leaving the parent transaction unchanged. It has no effect if t
+// is not a child transaction.
+func (t *Transaction) Rollback() {
+	if t.parent == nil {
+		return
+	}
+	t.actions = nil
+	t.hooks = nil
+	t.err = nil
+	t.uniqueClaims = nil
+}
+
+// mergeIntoParent adds everything in t, which must be a child transaction, to
+// its parent and then resets t. If t has an error, the error will also be set
+// on the parent, causing the parent to fail when it is executed.
+func (t *Transaction) mergeIntoParent() error {
+	err := t.err
+	t.parent.setError(err)
+	t.parent.actions = append(t.parent.actions, t.actions...)
+	t.parent.watching = append(t.parent.watching, t.watching...)
+	t.parent.hooks = append(t.parent.hooks, t.hooks...)
+	for key, id := range t.uniqueClaims {
+		t.parent.claimUniqueValue(key, id)
+	}
+	t.actions = nil
+	t.watching = nil
+	t.hooks = nil
+	t.err = nil
+	t.uniqueClaims = nil
+	return err
+}
+
 // SetError sets the err property of the transaction iff it was not already
 // set. This will cause exec to fail immediately.
 func (t *Transaction) setError(err error) {
@@ -61,6 +142,35 @@ func (t *Transaction) setError(err error) {
 	}
 }
 
+// Watch marks the main hash for model as watched. If the model is modified by
+// some other client after Watch is called but before the transaction is
+// executed, none of the commands in the transaction will be executed and
+// Exec will return a WatchError. See http://redis.io/topics/transactions.
+// Watch returns an error if model is the wrong type, if the model does not
+// have an id, or if there was a problem connecting to the database.
+func (t *Transaction) Watch(mt *ModelType, model Model) error {
+	if err := mt.checkModelType(model); err != nil {
+		return fmt.Errorf("zoom: Error in Transaction.Watch: %s", err.Error())
+	}
+	key, err := mt.ModelKey(model.Id())
+	if err != nil {
+		return err
+	}
+	return t.WatchKey(key)
+}
+
+// WatchKey is like Watch but accepts an arbitrary key instead of a model.
+// Unlike most transaction methods, Watch and WatchKey immediately send the
+// WATCH command to the database, so they should be called before reading any
+// values which the transaction depends on.
+func (t *Transaction) WatchKey(key string) error {
+	if _, err := t.conn.Do("WATCH", key); err != nil {
+		return err
+	}
+	t.watching = append(t.watching, key)
+	return nil
+}
+
 // Command adds a command action to the transaction with the given args.
 // handler will be called with the reply from this specific command when
 // the transaction is executed.
@@ -109,57 +219,91 @@ func (t *Transaction) doAction(a *Action) (interface{}, error) {
 }
 
 // Exec executes the transaction, sequentially sending each action and
-// calling all the action handlers with the corresponding replies.
+// calling all the action handlers with the corresponding replies. Any
+// hooks added to the transaction are run before the transaction is sent
+// to the database and after it either commits or aborts. If t is a child
+// transaction created with Begin, Exec does not touch the database and
+// instead merges everything in t into its parent. In that case Exec returns
+// the first error (if any) that occurred while adding to t.
 func (t *Transaction) Exec() error {
-	// Return the connection to the pool when we are done
-	defer t.conn.Close()
+	if t.parent != nil {
+		return t.mergeIntoParent()
+	}
+
+	// Return the connection to the pool when we are done. t.conn may be
+	// replaced if there is a network error, so we can't defer t.conn.Close
+	// directly.
+	defer func() {
+		t.conn.Close()
+	}()
+
+	// Give the BeforeExec hooks a chance to cancel the transaction
+	if t.err == nil {
+		t.setError(t.runBeforeExecHooks())
+	}
 
 	// If the transaction had an error from a previous command, return it
 	// and don't continue
 	if t.err != nil {
+		t.runAfterAbortHooks(t.err)
 		return t.err
 	}
 
-	if len(t.actions) == 1 {
-		// If there is only one command, no need to use MULTI/EXEC
-		a := t.actions[0]
-		reply, err := t.doAction(a)
-		if err != nil {
-			return err
-		}
+	replies, err := t.execWithRetries()
+	if err != nil {
+		t.runAfterAbortHooks(err)
+		return err
+	}
+
+	// Iterate through the replies, calling the corresponding handler functions
+	// Since the transaction was committed, the AfterCommit hooks always run,
+	// even if one of the handlers returns an error.
+	defer t.runAfterCommitHooks()
+	for i, reply := range replies {
+		a := t.actions[i]
 		if a.handler != nil {
 			if err := a.handler(reply); err != nil {
 				return err
 			}
 		}
-	} else {
-		// Send all the commands and scripts at once using MULTI/EXEC
-		if err := t.conn.Send("MULTI"); err != nil {
-			return err
-		}
-		for _, a := range t.actions {
-			if err := t.sendAction(a); err != nil {
-				return err
-			}
-		}
+	}
+	return nil
+}
 
-		// Invoke redis driver to execute the transaction
-		replies, err := redis.Values(t.conn.Do("EXEC"))
+// exec sends all the actions to the database and returns the replies, which
+// are in the same order as the actions. It does not call any of the handlers.
+func (t *Transaction) exec() ([]interface{}, error) {
+	if len(t.actions) == 1 && len(t.watching) == 0 {
+		// If there is only one command and we are not watching any keys,
+		// no need to use MULTI/EXEC
+		reply, err := t.doAction(t.actions[0])
 		if err != nil {
-			return err
+			return nil, err
 		}
+		return []interface{}{reply}, nil
+	}
 
-		// Iterate through the replies, calling the corresponding handler functions
-		for i, reply := range replies {
-			a := t.actions[i]
-			if a.handler != nil {
-				if err := a.handler(reply); err != nil {
-					return err
-				}
-			}
+	// Send all the commands and scripts at once using MULTI/EXEC
+	if err := t.conn.Send("MULTI"); err != nil {
+		return nil, err
+	}
+	for _, a := range t.actions {
+		if err := t.sendAction(a); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+
+	// Invoke redis driver to execute the transaction
+	replies, err := redis.Values(t.conn.Do("EXEC"))
+	if err != nil {
+		if err == redis.ErrNil && len(t.watching) > 0 {
+			// A nil reply from EXEC means the transaction was aborted
+			// because one of the watched keys was modified
+			return nil, WatchError{keys: t.watching}
+		}
+		return nil, err
+	}
+	return replies, nil
 }
 
 // newScanIntHandler returns a ReplyHandler which will set the value of i to the
@@ -228,7 +372,7 @@ func newScanModelHandler(fieldNames []string, mr *modelRef) ReplyHandler {
 		if err != nil {
 			return err
 		}
-		if len(fieldValues) == 0 {
+		if len(fieldValues) == 0 || allNil(fieldValues) {
 			var msg string
 			if mr.model.Id() != "" {
 				msg = fmt.Sprintf("Could not find %s with id = %s", mr.spec.name, mr.model.Id())
@@ -271,9 +415,19 @@ func newScanModelsHandler(spec *modelSpec, fieldNames []string, models interface
 		if err != nil {
 			return err
 		}
-		numFields := len(fieldNames)
+		// Fields which are not stored in the main hash are not included in the reply
+		collectionFields := spec.collectionFields(fieldNames)
+		hashFieldNames := spec.hashFieldNames(fieldNames)
+		numFields := len(hashFieldNames)
 		numModels := len(allFields) / numFields
+		mrs := make([]*modelRef, 0, numModels)
 		modelsVal := reflect.ValueOf(models).Elem()
+		if modelsVal.Kind() == reflect.Slice && modelsVal.Cap() < numModels {
+			// Grow the slice once up front instead of once per append below
+			grown := reflect.MakeSlice(modelsVal.Type(), modelsVal.Len(), numModels)
+			reflect.Copy(grown, modelsVal)
+			modelsVal.Set(grown)
+		}
 		for i := 0; i < numModels; i++ {
 			start := i * numFields
 			stop := i*numFields + numFields
@@ -296,9 +450,10 @@ func newScanModelsHandler(spec *modelSpec, fieldNames []string, models interface
 				spec:  spec,
 				model: modelVal.Interface().(Model),
 			}
-			if err := scanModel(fieldNames, fieldValues, mr); err != nil {
+			if err := scanModel(hashFieldNames, fieldValues, mr); err != nil {
 				return err
 			}
+			mrs = append(mrs, mr)
 		}
 		// Trim the slice if it is longer than the number of models we scanned
 		// in.
@@ -306,6 +461,40 @@ func newScanModelsHandler(spec *modelSpec, fieldNames []string, models interface
 			modelsVal.SetLen(numModels)
 			modelsVal.SetCap(numModels)
 		}
+		if len(collectionFields) > 0 && len(mrs) > 0 {
+			return findCollectionFields(collectionFields, mrs)
+		}
 		return nil
 	}
 }
+
+// newScanCollectionHandler returns a reply handler which will scan all the values
+// in reply into dest, which must be a slice. It expects a reply which looks like the
+// output of an LRANGE command. The returned replyHandler will replace any existing
+// value of dest. Elements which are not primatives are unmarshaled using mu.
+func newScanCollectionHandler(dest reflect.Value, mu MarshalerUnmarshaler) ReplyHandler {
+	return func(reply interface{}) error {
+		replies, err := redis.Values(reply, nil)
+		if err != nil {
+			return err
+		}
+		return scanCollectionVal(replies, dest, mu)
+	}
+}
+
+// findCollectionFields retrieves the given fields, which must be stored outside
+// of the main hash, for each model in mrs using a separate transaction. It is used
+// when the ids of the models are not known until after a transaction has been
+// executed, e.g. in FindAll and queries.
+func findCollectionFields(fields []*fieldSpec, mrs []*modelRef) error {
+	if len(mrs) == 0 {
+		return nil
+	}
+	t := mrs[0].spec.pool.NewTransaction()
+	for _, mr := range mrs {
+		for _, fs := range fields {
+			t.findCollectionField(mr, fs)
+		}
+	}
+	return t.Exec()
+}
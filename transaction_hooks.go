@@ -0,0 +1,79 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File transaction_hooks.go contains code related to hooks
+// which run at different points in the lifecycle of a
+// transaction.
+
+package zoom
+
+// TransactionHooks is a set of functions which are called at different points
+// in the lifecycle of a transaction. Any of the functions may be nil. Hooks
+// can be added to a single transaction with AddHooks or to every transaction
+// with AddGlobalTransactionHooks.
+type TransactionHooks struct {
+	// BeforeExec is called when Exec is called, just before the transaction is
+	// sent to the database. If it returns an error, the transaction is aborted
+	// and the error is returned from Exec.
+	BeforeExec func(t *Transaction) error
+	// AfterCommit is called after the transaction has been successfully
+	// executed and all of the reply handlers have been called.
+	AfterCommit func(t *Transaction)
+	// AfterAbort is called if the transaction was not executed, e.g. because
+	// of an error that occurred while adding commands to the transaction, an
+	// error returned by a BeforeExec hook, a problem connecting to the
+	// database, or a watched key being modified. err is the error that caused
+	// the transaction to be aborted, which is also returned from Exec.
+	AfterAbort func(t *Transaction, err error)
+}
+
+// globalTransactionHooks are added to every new transaction.
+var globalTransactionHooks = []TransactionHooks{}
+
+// AddGlobalTransactionHooks adds hooks which will run for every transaction
+// created after AddGlobalTransactionHooks is called, including the transactions
+// that zoom uses internally for methods like Save and Find. It is not safe to call
+// AddGlobalTransactionHooks concurrently with other zoom functions, so it should
+// typically be called during application startup.
+func AddGlobalTransactionHooks(hooks TransactionHooks) {
+	globalTransactionHooks = append(globalTransactionHooks, hooks)
+}
+
+// AddHooks adds hooks which will run when the transaction is executed. Hooks
+// run in the order they were added, after any global hooks.
+func (t *Transaction) AddHooks(hooks TransactionHooks) {
+	t.hooks = append(t.hooks, hooks)
+}
+
+// runBeforeExecHooks calls each BeforeExec hook and returns the first error
+// encountered, if any. If a hook returns an error, the remaining hooks are not
+// called.
+func (t *Transaction) runBeforeExecHooks() error {
+	for _, hooks := range t.hooks {
+		if hooks.BeforeExec != nil {
+			if err := hooks.BeforeExec(t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runAfterCommitHooks calls each AfterCommit hook.
+func (t *Transaction) runAfterCommitHooks() {
+	for _, hooks := range t.hooks {
+		if hooks.AfterCommit != nil {
+			hooks.AfterCommit(t)
+		}
+	}
+}
+
+// runAfterAbortHooks calls each AfterAbort hook with the given error.
+func (t *Transaction) runAfterAbortHooks(err error) {
+	for _, hooks := range t.hooks {
+		if hooks.AfterAbort != nil {
+			hooks.AfterAbort(t, err)
+		}
+	}
+}
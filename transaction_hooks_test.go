@@ -0,0 +1,76 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File transaction_hooks_test.go tests the code in
+// transaction_hooks.go.
+
+package zoom
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransactionHooksCommit(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	calls := []string{}
+	tx := NewTransaction()
+	tx.AddHooks(TransactionHooks{
+		BeforeExec: func(*Transaction) error {
+			calls = append(calls, "BeforeExec")
+			return nil
+		},
+		AfterCommit: func(*Transaction) {
+			calls = append(calls, "AfterCommit")
+		},
+		AfterAbort: func(*Transaction, error) {
+			calls = append(calls, "AfterAbort")
+		},
+	})
+	model := createTestModels(1)[0]
+	tx.Save(testModels, model)
+	if err := tx.Exec(); err != nil {
+		t.Fatalf("Unexpected error in tx.Exec: %s", err.Error())
+	}
+	expectModelExists(t, testModels, model)
+	if equal, msg := compareAsStringSet([]string{"BeforeExec", "AfterCommit"}, calls); !equal {
+		t.Errorf("Hooks were not called correctly: %s", msg)
+	}
+}
+
+func TestTransactionHooksAbort(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// An error returned from BeforeExec should abort the transaction
+	hookErr := errors.New("hook error")
+	var abortErr error
+	committed := false
+	tx := NewTransaction()
+	tx.AddHooks(TransactionHooks{
+		BeforeExec: func(*Transaction) error {
+			return hookErr
+		},
+		AfterCommit: func(*Transaction) {
+			committed = true
+		},
+		AfterAbort: func(_ *Transaction, err error) {
+			abortErr = err
+		},
+	})
+	model := createTestModels(1)[0]
+	tx.Save(testModels, model)
+	if err := tx.Exec(); err != hookErr {
+		t.Errorf("Expected tx.Exec to return the hook error but got: %v", err)
+	}
+	if abortErr != hookErr {
+		t.Errorf("Expected AfterAbort to be called with the hook error but got: %v", abortErr)
+	}
+	if committed {
+		t.Error("Expected AfterCommit to not be called but it was")
+	}
+	expectModelDoesNotExist(t, testModels, model)
+}
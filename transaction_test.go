@@ -0,0 +1,77 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File transaction_test.go contains unit tests for the
+// code in transaction.go
+
+package zoom
+
+import (
+	"testing"
+)
+
+func TestChildTransactionExec(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models := createTestModels(2)
+	parent := NewTransaction()
+	parent.Save(testModels, models[0])
+
+	// Saving in the child transaction should not touch the database
+	// until the parent is executed
+	child := parent.Begin()
+	child.Save(testModels, models[1])
+	if err := child.Exec(); err != nil {
+		t.Fatalf("Unexpected error in child.Exec: %s", err.Error())
+	}
+	expectModelDoesNotExist(t, testModels, models[1])
+
+	if err := parent.Exec(); err != nil {
+		t.Fatalf("Unexpected error in parent.Exec: %s", err.Error())
+	}
+	expectModelsExist(t, testModels, Models(models))
+}
+
+func TestChildTransactionRollback(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models := createTestModels(2)
+	parent := NewTransaction()
+	parent.Save(testModels, models[0])
+
+	// Nothing added to the child should be executed after a rollback
+	child := parent.Begin()
+	child.Save(testModels, models[1])
+	child.Rollback()
+	if err := child.Exec(); err != nil {
+		t.Fatalf("Unexpected error in child.Exec: %s", err.Error())
+	}
+
+	if err := parent.Exec(); err != nil {
+		t.Fatalf("Unexpected error in parent.Exec: %s", err.Error())
+	}
+	expectModelExists(t, testModels, models[0])
+	expectModelDoesNotExist(t, testModels, models[1])
+}
+
+func TestChildTransactionError(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	// An error in the child should cause the parent to fail
+	model := createTestModels(1)[0]
+	parent := NewTransaction()
+	parent.Save(testModels, model)
+	child := parent.Begin()
+	child.Save(indexedTestModels, model)
+	if err := child.Exec(); err == nil {
+		t.Error("Expected an error in child.Exec but got none")
+	}
+	if err := parent.Exec(); err == nil {
+		t.Error("Expected an error in parent.Exec but got none")
+	}
+	expectModelDoesNotExist(t, testModels, model)
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File transitions.go contains code related to restricting the
+// values of a field to a set of allowed transitions, i.e. a simple
+// state machine.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+)
+
+// Transitions maps each state to the states which may follow it. The empty
+// string is used for the initial state, i.e. the key "" holds the states which
+// are allowed when a model is first saved.
+type Transitions map[string][]string
+
+// TransitionError is returned from Save if the value of a field with
+// Transitions was changed to a state which is not allowed to follow the
+// current state.
+type TransitionError struct {
+	ModelName string
+	Id        string
+	Field     string
+	// From is the current state, or an empty string if the model has not been
+	// saved yet
+	From string
+	// To is the state which is not allowed
+	To string
+}
+
+func (e TransitionError) Error() string {
+	if e.From == "" {
+		return fmt.Sprintf("zoom: TransitionError: %s with id = %s cannot have an initial %s of %q", e.ModelName, e.Id, e.Field, e.To)
+	}
+	return fmt.Sprintf("zoom: TransitionError: %s with id = %s cannot change %s from %q to %q", e.ModelName, e.Id, e.Field, e.From, e.To)
+}
+
+// UseTransitions is a ModelOption which restricts the values of the given
+// field, which must be a string field, to the states in transitions. When a
+// model is saved, the value of the field may stay the same or change to any
+// state which is allowed to follow the value currently stored in the database.
+// If transitions does not include an initial state (the key ""), a new model
+// may have any value for the field. The check is atomic: the main hash for the
+// model is watched before it is read, so if another client changes the model
+// concurrently, Save returns a WatchError. Otherwise Save returns a
+// TransitionError for an illegal transition and nothing is saved.
+func UseTransitions(field string, transitions Transitions) ModelOption {
+	return func(spec *modelSpec) error {
+		fs, found := spec.fieldsByName[field]
+		if !found {
+			return fmt.Errorf("zoom: Error in UseTransitions: %s has no field named %s", spec.typ.String(), field)
+		}
+		if fs.kind != primativeField || fs.typ.Kind() != reflect.String {
+			return fmt.Errorf("zoom: Error in UseTransitions: %s.%s must be a string field but has type %s", spec.typ.String(), field, fs.typ.String())
+		}
+		if fs.encrypted || fs.compressed {
+			return fmt.Errorf("zoom: Error in UseTransitions: %s.%s cannot be encrypted or compressed", spec.typ.String(), field)
+		}
+		allowed := map[string]map[string]bool{}
+		for from, tos := range transitions {
+			allowed[from] = map[string]bool{}
+			for _, to := range tos {
+				allowed[from][to] = true
+			}
+		}
+		fs.transitions = allowed
+		return nil
+	}
+}
+
+// checkTransitions checks that the value of each field in fields which has
+// transitions is allowed to follow the value currently stored in the database.
+// Unlike most Transaction methods, it reads from the database immediately, after
+// watching the main hash for the model. It returns a TransitionError for the
+// first illegal transition.
+func (t *Transaction) checkTransitions(mr *modelRef, fields []*fieldSpec) error {
+	watched := false
+	for _, fs := range fields {
+		if fs.transitions == nil {
+			continue
+		}
+		if t.conn == nil {
+			return fmt.Errorf("zoom: %s has fields with transitions, which can only be saved in a Transaction", mr.spec.name)
+		}
+		key := mr.key()
+		if !watched {
+			if err := t.WatchKey(key); err != nil {
+				return err
+			}
+			watched = true
+		}
+		from, err := redis.String(t.conn.Do("HGET", key, fs.redisName))
+		if err != nil && err != redis.ErrNil {
+			return err
+		}
+		to := mr.specFieldValue(fs).String()
+		if to == from {
+			continue
+		}
+		if err == redis.ErrNil {
+			// The model does not exist yet. If there are no initial states,
+			// any value is allowed.
+			if initial, found := fs.transitions[""]; !found || initial[to] {
+				continue
+			}
+		} else if fs.transitions[from][to] {
+			continue
+		}
+		return TransitionError{
+			ModelName: mr.spec.name,
+			Id:        mr.model.Id(),
+			Field:     fs.name,
+			From:      from,
+			To:        to,
+		}
+	}
+	return nil
+}
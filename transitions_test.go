@@ -0,0 +1,81 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File transitions_test.go tests the code in transitions.go, i.e.
+// restricting the values of a field to a set of allowed transitions.
+
+package zoom
+
+import (
+	"testing"
+)
+
+type orderModel struct {
+	Status string
+	Total  int
+	DefaultData
+}
+
+func TestTransitions(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	orderModels := registerTestType(t, &orderModel{}, UseTransitions("Status", Transitions{
+		"":        {"pending"},
+		"pending": {"active", "closed"},
+		"active":  {"closed"},
+	}))
+
+	// New models must start in an initial state
+	if err := orderModels.Save(&orderModel{Status: "active"}); err == nil {
+		t.Error("Expected a TransitionError for an illegal initial state but got none")
+	} else if _, ok := err.(TransitionError); !ok {
+		t.Errorf("Expected a TransitionError but got %T: %s", err, err.Error())
+	}
+	order := &orderModel{Status: "pending"}
+	if err := orderModels.Save(order); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// Saving without changing the state is always allowed
+	order.Total = 42
+	if err := orderModels.Save(order); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	order.Status = "active"
+	if err := orderModels.Save(order); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// Illegal transitions should be rejected and nothing should be saved
+	order.Status = "pending"
+	order.Total = 0
+	err := orderModels.Save(order)
+	if err == nil {
+		t.Fatal("Expected a TransitionError for an illegal transition but got none")
+	}
+	transitionErr, ok := err.(TransitionError)
+	if !ok {
+		t.Fatalf("Expected a TransitionError but got %T: %s", err, err.Error())
+	}
+	if transitionErr.Field != "Status" || transitionErr.From != "active" || transitionErr.To != "pending" {
+		t.Errorf("TransitionError was incorrect: %+v", transitionErr)
+	}
+	found := &orderModel{}
+	if err := orderModels.Find(order.Id(), found); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if found.Status != "active" || found.Total != 42 {
+		t.Errorf("Expected model to be unchanged after an illegal transition but got %+v", found)
+	}
+}
+
+func TestTransitionsInvalid(t *testing.T) {
+	if _, err := RegisterWithOptions(&orderModel{}, UseTransitions("Total", Transitions{})); err == nil {
+		t.Error("Expected an error when using UseTransitions on a non-string field but got none")
+	}
+	if _, err := RegisterWithOptions(&orderModel{}, UseTransitions("Missing", Transitions{})); err == nil {
+		t.Error("Expected an error when using UseTransitions on a field which does not exist but got none")
+	}
+}
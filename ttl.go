@@ -0,0 +1,254 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File ttl.go contains code related to models which expire
+// automatically after some amount of time.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"time"
+)
+
+// TTL is a ModelOption which causes models of the given type to expire ttl after
+// they were last saved, which is useful for session or cache-like data. The
+// expiration is set on the main hash for the model and any keys which belong
+// only to the model (e.g. list and set fields) every time the model is saved.
+// The TTL can also be declared next to the model definition with a struct tag on
+// the embedded DefaultData (or on a blank field), e.g.:
+//
+//	type Session struct {
+//		UserId           string
+//		zoom.DefaultData `zoom:"ttl=24h"`
+//	}
+//
+// The value is parsed with time.ParseDuration. If both are used, the TTL option
+// takes precedence over the struct tag.
+//
+// Note that the expiration is handled by the database, so expired models are not
+// removed from the set of all models or from any field indexes unless there is an
+// ExpirationListener running. See ListenForExpirations.
+func TTL(ttl time.Duration) ModelOption {
+	return func(spec *modelSpec) error {
+		if ttl <= 0 {
+			return fmt.Errorf("zoom: TTL must be positive but got %s", ttl)
+		}
+		spec.ttl = ttl
+		return nil
+	}
+}
+
+// modelKeys returns the main hash key for the model with the given id and any
+// other keys which belong only to the model, i.e. the keys for list and set
+// fields and the protobuf key.
+func (ms *modelSpec) modelKeys(id string) []string {
+	keys := []string{ms.keyName() + ":" + id}
+	for _, fs := range ms.fields {
+		if !fs.storedInHash() {
+			keys = append(keys, ms.fieldKey(id, fs))
+		}
+	}
+	if ms.storeProtobuf {
+		keys = append(keys, ms.protobufKey(id))
+	}
+	return keys
+}
+
+// expiration describes when a model should expire, either relative to when the
+// transaction is executed (ttl) or at an absolute time (at). The zero value
+// means the model does not expire.
+type expiration struct {
+	ttl time.Duration
+	at  time.Time
+}
+
+// isZero returns true iff exp means the model does not expire.
+func (exp expiration) isZero() bool {
+	return exp.ttl <= 0 && exp.at.IsZero()
+}
+
+// command returns the name and arguments for a command which sets the
+// expiration for key to exp.
+func (exp expiration) command(key string) (string, redis.Args) {
+	if !exp.at.IsZero() {
+		return "PEXPIREAT", redis.Args{key, exp.at.UnixNano() / int64(time.Millisecond)}
+	}
+	return "PEXPIRE", redis.Args{key, int64(exp.ttl / time.Millisecond)}
+}
+
+// expireModel adds commands to the transaction which set the expiration for
+// all the keys of the model with the given id to exp. handler (if any) is called
+// with the reply for the main hash, which is 1 if the model exists and 0 if it
+// does not.
+func (t *Transaction) expireModel(ms *modelSpec, id string, exp expiration, handler ReplyHandler) {
+	if ms.archiveOnExpire {
+		// The model is archived and deleted by an ExpirationListener when the
+		// expires key expires
+		if handler != nil {
+			t.Command("EXISTS", redis.Args{ms.keyName() + ":" + id}, handler)
+		}
+		t.Command("SET", redis.Args{ms.expiresKey(id), 1}, nil)
+		name, args := exp.command(ms.expiresKey(id))
+		t.Command(name, args, nil)
+		return
+	}
+	for i, key := range ms.modelKeys(id) {
+		name, args := exp.command(key)
+		if i == 0 {
+			t.Command(name, args, handler)
+		} else {
+			t.Command(name, args, nil)
+		}
+	}
+}
+
+// SaveWithTTL is like Save but causes the model to expire ttl after it is saved,
+// which is useful for things like temporary tokens or trial accounts. ttl takes
+// precedence over the TTL option for the type (if any) and only applies to this
+// save. If the model is saved again with Save, its expiration is reset to the
+// TTL for the type if there is one, and is otherwise left unchanged.
+func (mt *ModelType) SaveWithTTL(model Model, ttl time.Duration) error {
+	return runOp(&Op{Kind: SaveOp, ModelName: mt.Name(), Model: model}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.SaveWithTTL(mt, model, ttl)
+		return t.Exec()
+	})
+}
+
+// SaveWithTTL is like Save but causes the model to expire ttl after the
+// transaction is executed. See ModelType.SaveWithTTL.
+func (t *Transaction) SaveWithTTL(mt *ModelType, model Model, ttl time.Duration) {
+	if ttl <= 0 {
+		t.setError(fmt.Errorf("zoom: Error in SaveWithTTL: ttl must be positive but got %s", ttl))
+		return
+	}
+	t.save(mt, model, expiration{ttl: ttl})
+}
+
+// SaveWithExpireAt is like SaveWithTTL but causes the model to expire at the
+// given time instead of after some duration, which is useful for retention rules
+// based on the calendar, e.g. deleting data at the end of a billing period. The
+// expiration is set with PEXPIREAT, so it is based on the clock of the database
+// rather than the clock of the client. If at is in the past, the model expires
+// immediately.
+func (mt *ModelType) SaveWithExpireAt(model Model, at time.Time) error {
+	return runOp(&Op{Kind: SaveOp, ModelName: mt.Name(), Model: model}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.SaveWithExpireAt(mt, model, at)
+		return t.Exec()
+	})
+}
+
+// SaveWithExpireAt is like Save but causes the model to expire at the given
+// time. See ModelType.SaveWithExpireAt.
+func (t *Transaction) SaveWithExpireAt(mt *ModelType, model Model, at time.Time) {
+	if at.IsZero() {
+		t.setError(fmt.Errorf("zoom: Error in SaveWithExpireAt: at cannot be the zero time"))
+		return
+	}
+	t.save(mt, model, expiration{at: at})
+}
+
+// Touch sets the expiration for the model with the given id (including any
+// keys which belong only to the model, e.g. list and set fields) to ttl from
+// now, which is useful for sliding expiration, e.g. extending a session each
+// time it is used. The first return value is true if the model existed and
+// false otherwise.
+func (mt *ModelType) Touch(id string, ttl time.Duration) (bool, error) {
+	touched := false
+	err := runOp(&Op{Kind: TouchOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.Touch(mt, id, ttl, &touched)
+		return t.Exec()
+	})
+	return touched, err
+}
+
+// Touch sets the expiration for the model with the given id to ttl from when
+// the transaction is executed. touched will be set to true if the model existed
+// and false otherwise. See ModelType.Touch.
+func (t *Transaction) Touch(mt *ModelType, id string, ttl time.Duration, touched *bool) {
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in Touch or Transaction.Touch: %s", err.Error()))
+		return
+	}
+	if id == "" {
+		t.setError(fmt.Errorf("zoom: Error in Touch or Transaction.Touch: id cannot be empty"))
+		return
+	}
+	if ttl <= 0 {
+		t.setError(fmt.Errorf("zoom: Error in Touch or Transaction.Touch: ttl must be positive but got %s", ttl))
+		return
+	}
+	t.expireModel(mt.spec, id, expiration{ttl: ttl}, newScanBoolHandler(touched))
+}
+
+// TTL returns the remaining lifetime of the model with the given id, which is
+// useful for showing when a model will expire or deciding whether to call
+// Touch. If the model exists but does not expire, TTL returns -1. If the model
+// does not exist, TTL returns a ModelNotFoundError.
+func (mt *ModelType) TTL(id string) (time.Duration, error) {
+	var ttl time.Duration
+	err := runOp(&Op{Kind: TTLOp, ModelName: mt.Name(), Id: id}, func() error {
+		t := mt.spec.pool.NewTransaction()
+		t.TTL(mt, id, &ttl)
+		return t.Exec()
+	})
+	return ttl, err
+}
+
+// TTL sets ttl to the remaining lifetime of the model with the given id when
+// the transaction is executed. See ModelType.TTL.
+func (t *Transaction) TTL(mt *ModelType, id string, ttl *time.Duration) {
+	if err := t.checkPool(mt); err != nil {
+		t.setError(fmt.Errorf("zoom: Error in TTL or Transaction.TTL: %s", err.Error()))
+		return
+	}
+	key, err := mt.spec.modelKey(id)
+	if err != nil {
+		t.setError(fmt.Errorf("zoom: Error in TTL or Transaction.TTL: %s", err.Error()))
+		return
+	}
+	if mt.spec.archiveOnExpire {
+		// The expiration is stored in a separate key, which does not exist if
+		// the model is persistent
+		exists := false
+		t.Command("EXISTS", redis.Args{key}, newScanBoolHandler(&exists))
+		t.Command("PTTL", redis.Args{mt.spec.expiresKey(id)}, func(reply interface{}) error {
+			if !exists {
+				msg := fmt.Sprintf("Could not find %s with id = %s", mt.spec.name, id)
+				return ModelNotFoundError{Msg: msg}
+			}
+			if milliseconds, err := redis.Int64(reply, nil); err == nil && milliseconds == -2 {
+				reply = int64(-1)
+			}
+			return newScanTTLHandler(mt.spec, id, ttl)(reply)
+		})
+		return
+	}
+	t.Command("PTTL", redis.Args{key}, newScanTTLHandler(mt.spec, id, ttl))
+}
+
+// newScanTTLHandler returns a ReplyHandler which will set the value of ttl to
+// the converted value of a reply to PTTL for the model with the given id.
+func newScanTTLHandler(ms *modelSpec, id string, ttl *time.Duration) ReplyHandler {
+	return func(reply interface{}) error {
+		milliseconds, err := redis.Int64(reply, nil)
+		if err != nil {
+			return err
+		}
+		switch milliseconds {
+		case -2:
+			msg := fmt.Sprintf("Could not find %s with id = %s", ms.name, id)
+			return ModelNotFoundError{Msg: msg}
+		case -1:
+			(*ttl) = -1
+		default:
+			(*ttl) = time.Duration(milliseconds) * time.Millisecond
+		}
+		return nil
+	}
+}
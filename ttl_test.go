@@ -0,0 +1,239 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File ttl_test.go tests the code in ttl.go, i.e. models which
+// expire automatically.
+
+package zoom
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type sessionModel struct {
+	UserId string
+	Roles  []string `redisType:"list"`
+	DefaultData
+}
+
+func TestTTLOption(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	sessionModels := registerTestType(t, &sessionModel{}, TTL(time.Minute))
+
+	session := &sessionModel{UserId: "alice", Roles: []string{"admin"}}
+	if err := sessionModels.Save(session); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	// The main hash and the list field should both expire
+	for _, key := range sessionModels.spec.modelKeys(session.Id()) {
+		expectKeyTTL(t, key, time.Minute)
+	}
+}
+
+func TestTTLOptionInvalid(t *testing.T) {
+	if _, err := RegisterWithOptions(&sessionModel{}, TTL(0)); err == nil {
+		t.Error("Expected an error when using a TTL of 0 but got none")
+	}
+}
+
+// expectKeyTTL calls t.Errorf if the key does not exist or does not have a TTL
+// which is greater than 0 and no greater than max.
+func expectKeyTTL(t *testing.T, key string, max time.Duration) {
+	conn := NewConn()
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("PTTL", key))
+	if err != nil {
+		t.Fatalf("Unexpected error in PTTL: %s", err.Error())
+	}
+	if ttl <= 0 || time.Duration(ttl)*time.Millisecond > max {
+		t.Errorf("Expected %s to have a TTL between 0 and %s but got PTTL %d", key, max, ttl)
+	}
+}
+
+func TestSaveWithTTL(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	model := createTestModels(1)[0]
+	if err := testModels.SaveWithTTL(model, time.Minute); err != nil {
+		t.Fatalf("Unexpected error in SaveWithTTL: %s", err.Error())
+	}
+	key, err := testModels.ModelKey(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in ModelKey: %s", err.Error())
+	}
+	expectKeyTTL(t, key, time.Minute)
+
+	// Other models of the same type should not expire
+	other := createTestModels(1)[0]
+	if err := testModels.Save(other); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	otherKey, err := testModels.ModelKey(other.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in ModelKey: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	ttl, err := redis.Int(conn.Do("TTL", otherKey))
+	if err != nil {
+		t.Fatalf("Unexpected error in TTL: %s", err.Error())
+	}
+	if ttl != -1 {
+		t.Errorf("Expected model saved with Save to not expire but got TTL %d", ttl)
+	}
+
+	if err := testModels.SaveWithTTL(model, 0); err == nil {
+		t.Error("Expected an error when using a ttl of 0 but got none")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	sessionModels := registerTestType(t, &sessionModel{}, TTL(time.Minute))
+
+	session := &sessionModel{UserId: "alice", Roles: []string{"admin"}}
+	if err := sessionModels.Save(session); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	touched, err := sessionModels.Touch(session.Id(), time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error in Touch: %s", err.Error())
+	}
+	if !touched {
+		t.Error("Expected Touch to return true for an existing model")
+	}
+	for _, key := range sessionModels.spec.modelKeys(session.Id()) {
+		expectKeyTTL(t, key, time.Hour)
+		conn := NewConn()
+		pttl, err := redis.Int64(conn.Do("PTTL", key))
+		conn.Close()
+		if err != nil {
+			t.Fatalf("Unexpected error in PTTL: %s", err.Error())
+		}
+		if time.Duration(pttl)*time.Millisecond <= time.Minute {
+			t.Errorf("Expected Touch to extend the TTL for %s but got PTTL %d", key, pttl)
+		}
+	}
+
+	touched, err = sessionModels.Touch("missing", time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error in Touch: %s", err.Error())
+	}
+	if touched {
+		t.Error("Expected Touch to return false for a model which does not exist")
+	}
+}
+
+func TestModelTypeTTL(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	persistent := createIndexedTestModels(1)[0]
+	if err := indexedTestModels.Save(persistent); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	ttl, err := indexedTestModels.TTL(persistent.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in TTL: %s", err.Error())
+	}
+	if ttl != -1 {
+		t.Errorf("Expected TTL to be -1 for a persistent model but got %s", ttl)
+	}
+
+	expiring := createIndexedTestModels(1)[0]
+	if err := indexedTestModels.SaveWithTTL(expiring, time.Minute); err != nil {
+		t.Fatalf("Unexpected error in SaveWithTTL: %s", err.Error())
+	}
+	ttl, err = indexedTestModels.TTL(expiring.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in TTL: %s", err.Error())
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected TTL to be between 0 and %s but got %s", time.Minute, ttl)
+	}
+
+	if _, err := indexedTestModels.TTL("missing"); err == nil {
+		t.Error("Expected an error in TTL for a model which does not exist")
+	} else if _, ok := err.(ModelNotFoundError); !ok {
+		t.Errorf("Expected a ModelNotFoundError but got: %s", err.Error())
+	}
+}
+
+type taggedSessionModel struct {
+	UserId      string
+	DefaultData `zoom:"ttl=24h"`
+}
+
+type blankTaggedSessionModel struct {
+	_      struct{} `zoom:"ttl=30m"`
+	UserId string
+	DefaultData
+}
+
+type invalidTTLTagModel struct {
+	UserId      string
+	DefaultData `zoom:"ttl=forever"`
+}
+
+func TestTTLStructTag(t *testing.T) {
+	testCases := []struct {
+		model    Model
+		expected time.Duration
+	}{
+		{&taggedSessionModel{}, 24 * time.Hour},
+		{&blankTaggedSessionModel{}, 30 * time.Minute},
+	}
+	for _, tc := range testCases {
+		spec, err := compileModelSpec(reflect.TypeOf(tc.model))
+		if err != nil {
+			t.Fatalf("Unexpected error in compileModelSpec for %T: %s", tc.model, err.Error())
+		}
+		if spec.ttl != tc.expected {
+			t.Errorf("Expected ttl for %T to be %s but got %s", tc.model, tc.expected, spec.ttl)
+		}
+		if _, found := spec.fieldsByName["_"]; found {
+			t.Errorf("Expected blank field of %T to be skipped", tc.model)
+		}
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&invalidTTLTagModel{})); err == nil {
+		t.Error("Expected an error in compileModelSpec for an invalid ttl")
+	}
+}
+
+func TestSaveWithExpireAt(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	sessionModels := registerTestType(t, &sessionModel{})
+
+	session := &sessionModel{UserId: "alice", Roles: []string{"admin"}}
+	at := time.Now().Add(time.Hour)
+	if err := sessionModels.SaveWithExpireAt(session, at); err != nil {
+		t.Fatalf("Unexpected error in SaveWithExpireAt: %s", err.Error())
+	}
+	conn := NewConn()
+	defer conn.Close()
+	for _, key := range sessionModels.spec.modelKeys(session.Id()) {
+		expectKeyTTL(t, key, time.Hour)
+		pttl, err := redis.Int64(conn.Do("PTTL", key))
+		if err != nil {
+			t.Fatalf("Unexpected error in PTTL: %s", err.Error())
+		}
+		if time.Duration(pttl)*time.Millisecond < 59*time.Minute {
+			t.Errorf("Expected %s to expire at %s but got PTTL %d", key, at, pttl)
+		}
+	}
+
+	if err := sessionModels.SaveWithExpireAt(session, time.Time{}); err == nil {
+		t.Error("Expected an error when using the zero time but got none")
+	}
+}
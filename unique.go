@@ -0,0 +1,195 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File unique.go contains code related to validating fields
+// with the "unique" option.
+
+package zoom
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// UniqueViolation describes a single field whose value is already used by
+// another model of the same type.
+type UniqueViolation struct {
+	// Field is the name of the field
+	Field string
+	// Value is the value of the field
+	Value interface{}
+	// ConflictingId is the id of the other model which has the same value
+	ConflictingId string
+}
+
+// UniqueViolationError is returned from Save if one or more fields with the
+// "unique" option have the same value as another model of the same type. It
+// contains every violation for the model, not just the first one, so that
+// (e.g.) form handling code can report all of them at once.
+type UniqueViolationError struct {
+	ModelName  string
+	Violations []UniqueViolation
+}
+
+func (e UniqueViolationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = fmt.Sprintf("%s = %v is already used by id = %s", v.Field, v.Value, v.ConflictingId)
+	}
+	return fmt.Sprintf("zoom: UniqueViolationError: %s %s", e.ModelName, strings.Join(msgs, "; "))
+}
+
+// Fields returns the names of the fields which were violated.
+func (e UniqueViolationError) Fields() []string {
+	fields := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		fields[i] = v.Field
+	}
+	return fields
+}
+
+// checkUniqueFields checks that the values of the unique fields in fields
+// are not used by any other model of the same type. It uses the field index
+// for each unique field, which is watched before it is checked so that the
+// transaction is aborted with a WatchError if another client changes the
+// index before the transaction is executed. Since the index does not include
+// models which are saved in the same transaction, it also checks the values
+// claimed by earlier saves in t (or its parents). Unlike most Transaction
+// methods, checkUniqueFields reads from the database immediately. It returns a
+// UniqueViolationError if there were any violations.
+func (t *Transaction) checkUniqueFields(mr *modelRef, fields []*fieldSpec) error {
+	var violations []UniqueViolation
+	claims := map[string]string{}
+	for _, fs := range fields {
+		if !fs.unique {
+			continue
+		}
+		if t.conn == nil {
+			return fmt.Errorf("zoom: %s has unique fields, which can only be saved in a Transaction", mr.spec.name)
+		}
+		fieldValue := mr.specFieldValue(fs)
+		for fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				break
+			}
+			fieldValue = fieldValue.Elem()
+		}
+		if fieldValue.Kind() == reflect.Ptr {
+			// Nil values are never considered duplicates
+			continue
+		}
+		indexKey, err := mr.spec.fieldIndexKey(fs.name)
+		if err != nil {
+			return err
+		}
+		if err := t.WatchKey(indexKey); err != nil {
+			return err
+		}
+		claimKey, err := uniqueClaimKey(fs, indexKey, fieldValue)
+		if err != nil {
+			return err
+		}
+		if id, found := t.claimedUniqueValue(claimKey); found && id != mr.model.Id() {
+			violations = append(violations, UniqueViolation{
+				Field:         fs.name,
+				Value:         fieldValue.Interface(),
+				ConflictingId: id,
+			})
+			continue
+		}
+		claims[claimKey] = mr.model.Id()
+		ids, err := t.findIdsByIndexValue(fs, indexKey, fieldValue)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id != mr.model.Id() {
+				violations = append(violations, UniqueViolation{
+					Field:         fs.name,
+					Value:         fieldValue.Interface(),
+					ConflictingId: id,
+				})
+				break
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return UniqueViolationError{ModelName: mr.spec.name, Violations: violations}
+	}
+	for key, id := range claims {
+		t.claimUniqueValue(key, id)
+	}
+	return nil
+}
+
+// uniqueClaimKey returns a string which identifies the given value of the field
+// identified by fs, using the same representation as the index stored at
+// indexKey, so that equal values have equal keys.
+func uniqueClaimKey(fs *fieldSpec, indexKey string, fieldValue reflect.Value) (string, error) {
+	switch fs.indexKind {
+	case numericIndex:
+		score, err := numericScore(fieldValue)
+		if err != nil {
+			return "", err
+		}
+		return indexKey + nullString + strconv.FormatFloat(score, 'g', -1, 64), nil
+	case booleanIndex:
+		return indexKey + nullString + strconv.Itoa(boolScore(fieldValue)), nil
+	case stringIndex:
+		return indexKey + nullString + stringValue(fieldValue), nil
+	}
+	return "", fmt.Errorf("zoom: field %s is not indexed", fs.name)
+}
+
+// claimUniqueValue records that the model with the given id has the unique
+// value identified by key in t.
+func (t *Transaction) claimUniqueValue(key string, id string) {
+	if t.uniqueClaims == nil {
+		t.uniqueClaims = map[string]string{}
+	}
+	t.uniqueClaims[key] = id
+}
+
+// claimedUniqueValue returns the id of the model which has the unique value
+// identified by key in t or any of its parents, if any.
+func (t *Transaction) claimedUniqueValue(key string) (string, bool) {
+	for ; t != nil; t = t.parent {
+		if id, found := t.uniqueClaims[key]; found {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// findIdsByIndexValue immediately returns the ids of all models which have the
+// given value for the field identified by fs, using the index stored at
+// indexKey.
+func (t *Transaction) findIdsByIndexValue(fs *fieldSpec, indexKey string, fieldValue reflect.Value) ([]string, error) {
+	switch fs.indexKind {
+	case numericIndex:
+		score, err := numericScore(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+		return redis.Strings(t.conn.Do("ZRANGEBYSCORE", indexKey, score, score))
+	case booleanIndex:
+		score := boolScore(fieldValue)
+		return redis.Strings(t.conn.Do("ZRANGEBYSCORE", indexKey, score, score))
+	case stringIndex:
+		prefix := stringValue(fieldValue) + nullString
+		members, err := redis.Strings(t.conn.Do("ZRANGEBYLEX", indexKey, "["+prefix, "("+prefix+delString))
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(members))
+		for i, member := range members {
+			ids[i] = strings.TrimPrefix(member, prefix)
+		}
+		return ids, nil
+	}
+	return nil, fmt.Errorf("zoom: field %s is not indexed", fs.name)
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File unique_test.go tests the code in unique.go, i.e.
+// validating fields with the "unique" option.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+)
+
+type uniqueModel struct {
+	Email    string  `zoom:"unique"`
+	Username string  `zoom:"unique"`
+	Age      int     `zoom:"unique"`
+	Nickname *string `zoom:"unique"`
+	DefaultData
+}
+
+func TestUniqueFields(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	uniqueModels := registerTestType(t, &uniqueModel{})
+
+	first := &uniqueModel{Email: "alice@example.com", Username: "alice", Age: 30}
+	if err := uniqueModels.Save(first); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	// Saving the same model again should not be a violation
+	if err := uniqueModels.Save(first); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+
+	// A second model with the same Email and Username should result in a
+	// single error which includes both violations. Nil pointers are never
+	// considered duplicates.
+	second := &uniqueModel{Email: "alice@example.com", Username: "alice", Age: 31}
+	err := uniqueModels.Save(second)
+	if err == nil {
+		t.Fatal("Expected a UniqueViolationError but got none")
+	}
+	uniqueErr, ok := err.(UniqueViolationError)
+	if !ok {
+		t.Fatalf("Expected a UniqueViolationError but got %T: %s", err, err.Error())
+	}
+	if expected := []string{"Email", "Username"}; !reflect.DeepEqual(uniqueErr.Fields(), expected) {
+		t.Errorf("Expected violated fields to be %v but got %v", expected, uniqueErr.Fields())
+	}
+	for _, violation := range uniqueErr.Violations {
+		if violation.ConflictingId != first.Id() {
+			t.Errorf("Expected ConflictingId to be %s but got %s", first.Id(), violation.ConflictingId)
+		}
+	}
+	// Nothing should have been saved
+	count, err := uniqueModels.Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 model to be saved but got %d", count)
+	}
+
+	// Once the first model changes its Email and Username, the second model
+	// should be able to use the old values.
+	first.Email = "alice@example.org"
+	first.Username = "alice2"
+	if err := uniqueModels.Save(first); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	if err := uniqueModels.Save(second); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+}
+
+func TestUniqueFieldsSameTransaction(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	uniqueModels := registerTestType(t, &uniqueModel{})
+
+	// Two models with the same Email in a single SaveAll should be a violation
+	// even though neither one is in the index yet
+	first := &uniqueModel{Email: "bob@example.com", Username: "bob", Age: 40}
+	second := &uniqueModel{Email: "bob@example.com", Username: "bobby", Age: 41}
+	err := uniqueModels.SaveAll([]*uniqueModel{first, second})
+	if err == nil {
+		t.Fatal("Expected a UniqueViolationError but got none")
+	}
+	uniqueErr, ok := err.(UniqueViolationError)
+	if !ok {
+		t.Fatalf("Expected a UniqueViolationError but got %T: %s", err, err.Error())
+	}
+	if expected := []string{"Email"}; !reflect.DeepEqual(uniqueErr.Fields(), expected) {
+		t.Errorf("Expected violated fields to be %v but got %v", expected, uniqueErr.Fields())
+	}
+	if uniqueErr.Violations[0].ConflictingId != first.Id() {
+		t.Errorf("Expected ConflictingId to be %s but got %s", first.Id(), uniqueErr.Violations[0].ConflictingId)
+	}
+	count, err := uniqueModels.Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("Expected no models to be saved but got %d", count)
+	}
+
+	// The same applies to two calls to Save in one transaction
+	tx := NewTransaction()
+	tx.Save(uniqueModels, &uniqueModel{Email: "carol@example.com", Username: "carol", Age: 50})
+	tx.Save(uniqueModels, &uniqueModel{Email: "caroline@example.com", Username: "carol", Age: 51})
+	if err := tx.Exec(); err == nil {
+		t.Error("Expected a UniqueViolationError in Exec but got none")
+	} else if _, ok := err.(UniqueViolationError); !ok {
+		t.Errorf("Expected a UniqueViolationError but got %T: %s", err, err.Error())
+	}
+}
+
+func TestUniqueFieldsInvalid(t *testing.T) {
+	type encryptedUniqueModel struct {
+		Secret string `zoom:"unique,encrypted"`
+		DefaultData
+	}
+	if _, err := compileModelSpec(reflect.TypeOf(&encryptedUniqueModel{})); err == nil {
+		t.Error("Expected an error when using the unique option with the encrypted option but got none")
+	}
+}
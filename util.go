@@ -73,6 +73,16 @@ func Interfaces(in interface{}) []interface{} {
 	return results
 }
 
+// allNil returns true iff every element of values is nil.
+func allNil(values []interface{}) bool {
+	for _, value := range values {
+		if value != nil {
+			return false
+		}
+	}
+	return true
+}
+
 // indexOfStringSlice returns the index of s in strings, or
 // -1 if a is not found in strings
 func indexOfStringSlice(strings []string, s string) int {
@@ -144,6 +154,35 @@ func typeIsString(typ reflect.Type) bool {
 	return k == reflect.String || ((k == reflect.Slice || k == reflect.Array) && typ.Elem().Kind() == reflect.Uint8)
 }
 
+// typeIsByteArray returns true iff typ is an array (not a slice) of bytes
+func typeIsByteArray(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Array && typ.Elem().Kind() == reflect.Uint8
+}
+
+// stringValue returns the value of val, which must be a string or an array or
+// slice of bytes, as a string. If val is a pointer, it will keep dereferencing
+// until it reaches the underlying value.
+func stringValue(val reflect.Value) string {
+	for val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Kind() == reflect.String {
+		return val.String()
+	}
+	return string(byteSliceValue(val))
+}
+
+// byteSliceValue returns the contents of val, which must be an array or slice of
+// bytes, as a []byte. Arrays are copied.
+func byteSliceValue(val reflect.Value) []byte {
+	if val.Kind() == reflect.Slice {
+		return val.Bytes()
+	}
+	bytes := make([]byte, val.Len())
+	reflect.Copy(reflect.ValueOf(bytes), val)
+	return bytes
+}
+
 // typeIsNumeric returns true iff typ is one of the numeric primative types
 func typeIsNumeric(typ reflect.Type) bool {
 	k := typ.Kind()
@@ -169,20 +208,29 @@ func typeIsPrimative(typ reflect.Type) bool {
 
 // numericScore returns a float64 which is the score for val in a sorted set.
 // If val is a pointer, it will keep dereferencing until it reaches the underlying
-// value. It panics if val is not a numeric type or a pointer to a numeric type.
-func numericScore(val reflect.Value) float64 {
+// value. time.Time values are converted with timeScore and numeric text types such
+// as big.Int are converted with textScore, which returns an error if the value
+// cannot be converted. It panics if val is not a numeric type, a time, a numeric
+// text type, or a pointer to one of those.
+func numericScore(val reflect.Value) (float64, error) {
 	for val.Kind() == reflect.Ptr {
 		val = val.Elem()
 	}
+	if val.Type() == timeType {
+		return timeScore(val.Interface().(time.Time)), nil
+	}
+	if typeIsNumericText(val.Type()) {
+		return textScore(val)
+	}
 	switch val.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		integer := val.Int()
-		return float64(integer)
+		return float64(integer), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		uinteger := val.Uint()
-		return float64(uinteger)
+		return float64(uinteger), nil
 	case reflect.Float32, reflect.Float64:
-		return val.Float()
+		return val.Float(), nil
 	default:
 		msg := fmt.Sprintf("zoom: attempt to call numericScore on non-numeric type %s", val.Type().String())
 		panic(msg)
@@ -0,0 +1,82 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File valuer.go contains the Valuer and Scanner interfaces, which
+// allow custom types to control how they are stored in redis.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Valuer is implemented by types which know how to convert themselves into a
+// format suitable for storing in redis. If a field type implements Valuer (either
+// directly or with a pointer receiver) and a pointer to the type implements
+// Scanner, zoom will use RedisValue and RedisScan instead of converting or
+// marshaling the field itself. Fields whose type implements Valuer cannot be
+// indexed.
+type Valuer interface {
+	RedisValue() ([]byte, error)
+}
+
+// Scanner is implemented by types which know how to set their value from the
+// format returned by Valuer. RedisScan should expect src to be the bytes that
+// were returned by RedisValue.
+type Scanner interface {
+	RedisScan(src []byte) error
+}
+
+var (
+	valuerType  = reflect.TypeOf((*Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*Scanner)(nil)).Elem()
+)
+
+// typeIsValuerScanner returns true iff typ (or a pointer to typ) implements
+// Valuer and a pointer to typ implements Scanner. If typ is a pointer, the same
+// is checked for the type it points to.
+func typeIsValuerScanner(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	ptrType := reflect.PtrTo(typ)
+	return ptrType.Implements(valuerType) && ptrType.Implements(scannerType)
+}
+
+// valuerScannerMarshalerUnmarshaler is an implementation of MarshalerUnmarshaler
+// which uses the Valuer and Scanner interfaces. It is used automatically for any
+// field whose type implements them.
+type valuerScannerMarshalerUnmarshaler struct{}
+
+// Marshal calls RedisValue on v.
+func (valuerScannerMarshalerUnmarshaler) Marshal(v interface{}) ([]byte, error) {
+	if valuer, ok := v.(Valuer); ok {
+		return valuer.RedisValue()
+	}
+	val := reflect.ValueOf(v)
+	if !val.IsValid() || !reflect.PtrTo(val.Type()).Implements(valuerType) {
+		return nil, fmt.Errorf("zoom: cannot get redis value of %T because it does not implement Valuer", v)
+	}
+	// Copy the value so we have something addressable
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	return ptr.Interface().(Valuer).RedisValue()
+}
+
+// Unmarshal calls RedisScan on v, which must be a pointer to a Scanner or a
+// pointer to a (possibly nil) pointer to a Scanner.
+func (valuerScannerMarshalerUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	if scanner, ok := v.(Scanner); ok {
+		return scanner.RedisScan(data)
+	}
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Ptr || !val.Elem().Type().Implements(scannerType) {
+		return fmt.Errorf("zoom: cannot scan into %T because it does not implement Scanner", v)
+	}
+	if val.Elem().IsNil() {
+		val.Elem().Set(reflect.New(val.Elem().Type().Elem()))
+	}
+	return val.Elem().Interface().(Scanner).RedisScan(data)
+}
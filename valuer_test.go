@@ -0,0 +1,66 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File valuer_test.go tests the code in valuer.go, i.e. custom
+// types which implement Valuer and Scanner.
+
+package zoom
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testMoney is a custom type used for testing Valuer and Scanner. It is
+// stored as a decimal string instead of an integer number of cents.
+type testMoney int64
+
+func (m testMoney) RedisValue() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%02d", int64(m)/100, int64(m)%100)), nil
+}
+
+func (m *testMoney) RedisScan(src []byte) error {
+	var dollars, cents int64
+	if _, err := fmt.Sscanf(string(src), "%d.%d", &dollars, &cents); err != nil {
+		return err
+	}
+	*m = testMoney(dollars*100 + cents)
+	return nil
+}
+
+// valuerModel is a model type that is only used for testing Valuer
+// and Scanner
+type valuerModel struct {
+	Price    testMoney
+	PricePtr *testMoney
+	DefaultData
+}
+
+func TestValuerScanner(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	valuerModels := registerTestType(t, &valuerModel{})
+
+	otherPrice := testMoney(505)
+	model := &valuerModel{
+		Price:    testMoney(1234),
+		PricePtr: &otherPrice,
+	}
+	if err := valuerModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	key, _ := valuerModels.ModelKey(model.Id())
+	expectFieldEquals(t, key, "Price", "12.34")
+	expectFieldEquals(t, key, "PricePtr", "5.05")
+
+	modelCopy := &valuerModel{}
+	if err := valuerModels.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if !reflect.DeepEqual(model, modelCopy) {
+		t.Errorf("Found model was incorrect.\nExpected: %+v\nGot:      %+v", model, modelCopy)
+	}
+}
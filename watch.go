@@ -0,0 +1,135 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File watch.go contains code related to watching a single model
+// for changes made by any process.
+
+package zoom
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"sync"
+)
+
+// ModelWatcher delivers the latest version of a model every time it changes.
+// It is created with ModelType.Watch.
+type ModelWatcher struct {
+	// Changes receives a newly allocated copy of the model every time it is
+	// changed. If the model is deleted (or expires), nil is sent instead. It is
+	// closed when the watcher is closed.
+	Changes <-chan Model
+	changes chan Model
+	// closeChanges ensures changes is only closed once
+	closeChanges sync.Once
+	mt           *ModelType
+	id           string
+	*subscriber
+}
+
+// Watch returns a ModelWatcher which delivers the model with the given id every
+// time it is changed by any process, which is useful for building live views
+// without polling. Note that unlike Transaction.Watch, it does not affect any
+// transactions. The model is read from the master (never from a replica) after
+// each change, so if the model is changed several times in quick succession,
+// the same version may be delivered more than once.
+//
+// If the type uses the PublishChanges option, the watcher uses the change events
+// published by zoom, which only include changes made through zoom. Otherwise it
+// uses keyspace notifications (see SubscribeKeyspace), which also include
+// changes made by other clients and models which expire. Changes should be read
+// promptly, since the watcher stops receiving notifications while the channel
+// is full. If the connection is lost, the watcher reconnects automatically but
+// may miss changes made in the meantime. Call Close when the watcher is no
+// longer needed.
+func (mt *ModelType) Watch(id string) (*ModelWatcher, error) {
+	key, err := mt.spec.modelKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ModelType.Watch: %s", err.Error())
+	}
+	changes := make(chan Model, subscriptionBufferSize)
+	w := &ModelWatcher{
+		Changes: changes,
+		changes: changes,
+		mt:      mt.FromMaster(),
+		id:      id,
+	}
+	var sub *subscriber
+	if mt.spec.publishChanges {
+		sub, err = mt.spec.pool.newSubscriber("SUBSCRIBE", []string{mt.spec.changesChannel()}, nil, w.handleChangeEvent)
+	} else {
+		// Subscribe to the keyspace notifications for the main hash and any
+		// fields stored outside of it
+		channelPrefix := fmt.Sprintf("__keyspace@%d__:", mt.spec.pool.getState().config.Database)
+		channels := []string{channelPrefix + key}
+		for _, fs := range mt.spec.collectionFields(mt.spec.fieldNames()) {
+			channels = append(channels, channelPrefix+mt.spec.fieldKey(id, fs))
+		}
+		onConnect := func(conn redis.Conn) error {
+			return enableNotifications(conn, keyspaceNotificationFlags)
+		}
+		sub, err = mt.spec.pool.newSubscriber("SUBSCRIBE", channels, onConnect, w.handleKeyspaceEvent)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in ModelType.Watch: %s", err.Error())
+	}
+	w.subscriber = sub
+	sub.start()
+	return w, nil
+}
+
+// handleChangeEvent sends the latest version of the model if the event applies
+// to it.
+func (w *ModelWatcher) handleChangeEvent(_ string, data []byte) {
+	event := ChangeEvent{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		w.setError(fmt.Errorf("zoom: Error decoding ChangeEvent: %s", err.Error()))
+		return
+	}
+	if event.Id == w.id || event.Kind == DeleteAllOp {
+		w.sendLatest()
+	}
+}
+
+// handleKeyspaceEvent sends the latest version of the model. Since w is only
+// subscribed to the keys for the model, every event applies to it.
+func (w *ModelWatcher) handleKeyspaceEvent(_ string, _ []byte) {
+	w.sendLatest()
+}
+
+// sendLatest finds the model and sends it to w.changes, or sends nil if it
+// does not exist.
+func (w *ModelWatcher) sendLatest() {
+	model := reflect.New(w.mt.spec.typ.Elem()).Interface().(Model)
+	if err := w.mt.Find(w.id, model); err != nil {
+		if _, notFound := err.(ModelNotFoundError); !notFound {
+			w.setError(err)
+			return
+		}
+		model = nil
+	}
+	select {
+	case w.changes <- model:
+	case <-w.closed:
+	}
+}
+
+// Err returns the first error encountered by the watcher, if any, including
+// errors from finding the model and from connections which were lost and then
+// reestablished.
+func (w *ModelWatcher) Err() error {
+	return w.subscriber.Err()
+}
+
+// Close stops the watcher and closes the Changes channel. It returns the same
+// error as Err.
+func (w *ModelWatcher) Close() error {
+	err := w.subscriber.Close()
+	w.closeChanges.Do(func() {
+		close(w.changes)
+	})
+	return err
+}
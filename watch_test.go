@@ -0,0 +1,85 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File watch_test.go tests the code in watch.go.
+
+package zoom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// expectWatchedModel receives a model from w and reports an error via t.Errorf
+// if it does not equal expected, which may be nil.
+func expectWatchedModel(t *testing.T, w *ModelWatcher, expected Model) {
+	select {
+	case got, ok := <-w.Changes:
+		if !ok {
+			t.Fatalf("Expected %v but Changes was closed. Err: %v", expected, w.Err())
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("Wrong model from ModelWatcher.\n\tExpected: %#v\n\tBut got:  %#v", expected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %v", expected)
+	}
+}
+
+func TestModelTypeWatch(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	models, err := createAndSaveTestModels(1)
+	if err != nil {
+		t.Fatalf("Unexpected error saving models: %s", err.Error())
+	}
+	model := models[0]
+	w, err := testModels.Watch(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in Watch: %s", err.Error())
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			t.Errorf("Unexpected error in ModelWatcher.Close: %s", err.Error())
+		}
+	}()
+
+	model.String = "updated"
+	if err := testModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectWatchedModel(t, w, model)
+	if _, err := testModels.Delete(model.Id()); err != nil {
+		t.Fatalf("Unexpected error in Delete: %s", err.Error())
+	}
+	expectWatchedModel(t, w, nil)
+}
+
+func TestModelTypeWatchWithPublishChanges(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t)
+	model := &publishedModel{Name: "Alice", Status: "active"}
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	w, err := publishedModels.Watch(model.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error in Watch: %s", err.Error())
+	}
+	defer w.Close()
+
+	// Changes to other models should be ignored
+	if err := publishedModels.Save(&publishedModel{Name: "Bob"}); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	model.Status = "inactive"
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expectWatchedModel(t, w, model)
+}
@@ -0,0 +1,233 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File webhooks.go contains code related to sending change events
+// to HTTP endpoints.
+
+package zoom
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultWebhookRetryPolicy is used for webhooks which do not specify a
+// RetryPolicy.
+var defaultWebhookRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// Webhook is an HTTP endpoint which receives change events. See
+// ModelType.EmitWebhooks.
+type Webhook struct {
+	// URL is where events are sent with a POST request.
+	URL string
+	// Secret (if not empty) is used to sign each request. The signature is the
+	// hex-encoded HMAC-SHA256 of the request body, and is sent in the
+	// X-Zoom-Signature header as "sha256=<signature>".
+	Secret string
+	// Client is used to send requests. Default: a client with a 10 second
+	// timeout
+	Client *http.Client
+	// RetryPolicy determines how many times each event is sent and how long to
+	// wait between attempts if the endpoint cannot be reached or does not
+	// respond with a 2xx status code. Default: 5 attempts with a backoff
+	// between 100ms and 10s
+	RetryPolicy RetryPolicy
+}
+
+// defaultWebhookClient is used for webhooks which do not specify a Client.
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookEmitter sends the change events for a registered type to one or more
+// webhooks. It is created with ModelType.EmitWebhooks.
+type WebhookEmitter struct {
+	sub *Subscription
+	// err is the first error encountered by the emitter
+	err   error
+	errMu sync.Mutex
+	// closed is closed to stop the emitter and wg tracks the goroutines which
+	// send events
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// EmitWebhooks starts sending a ChangeEvent encoded as JSON to each of the given
+// webhooks every time a model of the given type is saved or deleted, so that
+// external systems can react to changes without connecting to the database.
+// The type must use the PublishChanges option. Each webhook receives events in
+// order in a separate goroutine, so a slow endpoint does not delay the others.
+// If an event still cannot be delivered after the number of attempts in the
+// RetryPolicy for the webhook, it is dropped and the error is reported by Err.
+// Since every emitter sends every event, usually only one process should run
+// an emitter for each type. Call Close when the emitter is no longer needed.
+func (mt *ModelType) EmitWebhooks(webhooks ...Webhook) (*WebhookEmitter, error) {
+	if len(webhooks) == 0 {
+		return nil, fmt.Errorf("zoom: Error in EmitWebhooks: at least one webhook is required")
+	}
+	for _, webhook := range webhooks {
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("zoom: Error in EmitWebhooks: webhook URL cannot be empty")
+		}
+	}
+	sub, err := mt.Subscribe()
+	if err != nil {
+		return nil, fmt.Errorf("zoom: Error in EmitWebhooks: %s", err.Error())
+	}
+	e := &WebhookEmitter{
+		sub:    sub,
+		closed: make(chan struct{}),
+	}
+	queues := make([]chan []byte, len(webhooks))
+	for i, webhook := range webhooks {
+		queues[i] = make(chan []byte, subscriptionBufferSize)
+		e.wg.Add(1)
+		go e.send(webhook, queues[i])
+	}
+	e.wg.Add(1)
+	go e.dispatch(queues)
+	return e, nil
+}
+
+// dispatch encodes each event received by e.sub and adds it to each queue.
+// Each queue is closed when e.sub is closed.
+func (e *WebhookEmitter) dispatch(queues []chan []byte) {
+	defer e.wg.Done()
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+	for event := range e.sub.Events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			e.setError(fmt.Errorf("zoom: Error encoding ChangeEvent: %s", err.Error()))
+			continue
+		}
+		for _, queue := range queues {
+			select {
+			case queue <- body:
+			case <-e.closed:
+				return
+			}
+		}
+	}
+}
+
+// send delivers each body in queue to webhook until queue is closed.
+func (e *WebhookEmitter) send(webhook Webhook, queue <-chan []byte) {
+	defer e.wg.Done()
+	for body := range queue {
+		select {
+		case <-e.closed:
+			return
+		default:
+		}
+		if err := webhook.deliver(body, e.closed); err != nil {
+			e.setError(err)
+		}
+	}
+}
+
+// deliver sends body to the webhook, retrying according to its RetryPolicy.
+// It stops retrying early if stop is closed.
+func (webhook Webhook) deliver(body []byte, stop <-chan struct{}) error {
+	policy := webhook.RetryPolicy
+	if policy.MaxAttempts == 0 {
+		policy = defaultWebhookRetryPolicy
+	}
+	var err error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-stop:
+				return err
+			case <-time.After(policy.backoff(attempt)):
+			}
+		}
+		if err = webhook.post(body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// post sends a single request with the given body to the webhook.
+func (webhook Webhook) post(body []byte) error {
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("zoom: Error sending webhook to %s: %s", webhook.URL, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhook.Secret != "" {
+		req.Header.Set("X-Zoom-Signature", "sha256="+signWebhookBody(webhook.Secret, body))
+	}
+	client := webhook.Client
+	if client == nil {
+		client = defaultWebhookClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("zoom: Error sending webhook to %s: %s", webhook.URL, err.Error())
+	}
+	// Read the body so the connection can be reused
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("zoom: Error sending webhook to %s: unexpected status %s", webhook.URL, res.Status)
+	}
+	return nil
+}
+
+// signWebhookBody returns the hex-encoded HMAC-SHA256 of body using secret as
+// the key.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// setError sets the error for e if it does not already have one.
+func (e *WebhookEmitter) setError(err error) {
+	e.errMu.Lock()
+	if e.err == nil {
+		e.err = err
+	}
+	e.errMu.Unlock()
+}
+
+// Err returns the first error encountered by the emitter, if any, including
+// events which could not be delivered. Errors do not stop the emitter.
+func (e *WebhookEmitter) Err() error {
+	e.errMu.Lock()
+	defer e.errMu.Unlock()
+	if e.err == nil {
+		return e.sub.Err()
+	}
+	return e.err
+}
+
+// Close stops the emitter and waits for any requests which are in progress to
+// finish. Events which have been received but not yet sent are dropped. It
+// returns the same error as Err.
+func (e *WebhookEmitter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.closed)
+	})
+	e.sub.Close()
+	e.wg.Wait()
+	return e.Err()
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File webhooks_test.go tests the code in webhooks.go.
+
+package zoom
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliverRetriesAndSigns(t *testing.T) {
+	body := []byte(`{"model":"testModel","id":"abc","op":"Save"}`)
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := ioutil.ReadAll(r.Body)
+		if string(got) != string(body) {
+			t.Errorf("Expected body %s but got %s", body, got)
+		}
+		expectedSignature := "sha256=" + signWebhookBody("secret", body)
+		if sig := r.Header.Get("X-Zoom-Signature"); sig != expectedSignature {
+			t.Errorf("Expected signature %s but got %s", expectedSignature, sig)
+		}
+		// Fail the first attempt
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	webhook := Webhook{
+		URL:         server.URL,
+		Secret:      "secret",
+		RetryPolicy: RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	}
+	if err := webhook.deliver(body, nil); err != nil {
+		t.Errorf("Unexpected error in deliver: %s", err.Error())
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("Expected 2 attempts but got %d", n)
+	}
+
+	// After MaxAttempts, deliver should give up and return an error
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	webhook.URL = failing.URL
+	if err := webhook.deliver(body, nil); err == nil {
+		t.Error("Expected an error in deliver when every attempt fails")
+	}
+}
+
+func TestEmitWebhooks(t *testing.T) {
+	testingSetUp()
+	defer testingTearDown()
+
+	publishedModels := registerPublishedModels(t)
+	received := make(chan ChangeEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := ChangeEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Unexpected error decoding webhook body: %s", err.Error())
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	emitter, err := publishedModels.EmitWebhooks(Webhook{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error in EmitWebhooks: %s", err.Error())
+	}
+	defer func() {
+		if err := emitter.Close(); err != nil {
+			t.Errorf("Unexpected error in WebhookEmitter.Close: %s", err.Error())
+		}
+	}()
+
+	model := &publishedModel{Name: "Alice"}
+	if err := publishedModels.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	expected := ChangeEvent{
+		ModelName: publishedModels.Name(),
+		Id:        model.Id(),
+		Kind:      SaveOp,
+		Fields:    []string{"Name", "Status"},
+	}
+	select {
+	case got := <-received:
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("Wrong event.\n\tExpected: %#v\n\tBut got:  %#v", expected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for webhook")
+	}
+}
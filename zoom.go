@@ -9,21 +9,131 @@
 // directly if needed.
 package zoom
 
+import (
+	"crypto/cipher"
+	"sync"
+)
+
+// initMu ensures that only one goroutine initializes the default pool at a
+// time.
+var initMu sync.Mutex
+
+// settings holds the package-wide options which are set by Init. Like a
+// poolState, a settings is never modified after it is created. It is replaced
+// as a whole whenever Init is called, so it must only be accessed via
+// getSettings.
+type settings struct {
+	// retryPolicy is the policy used by RunTransaction
+	retryPolicy RetryPolicy
+	// marshalerUnmarshaler is used for inconvertible fields whenever a custom
+	// MarshalerUnmarshaler is not provided for the model type or field
+	marshalerUnmarshaler MarshalerUnmarshaler
+	// nullStrategy is the NullStrategy for model types which did not specify one
+	nullStrategy NullStrategy
+	// nullSentinel is the value stored for nil pointers if the NullStrategy is
+	// NullSentinel
+	nullSentinel string
+	// encryptionAEAD is used to encrypt and decrypt fields with the "encrypted"
+	// option. It is nil if no EncryptionKey was provided.
+	encryptionAEAD cipher.AEAD
+}
+
+var (
+	// currentSettings holds the settings from the last call to Init, or the
+	// defaults if Init has not been called
+	currentSettings = &settings{
+		retryPolicy:          defaultConfiguration.RetryPolicy,
+		marshalerUnmarshaler: defaultConfiguration.MarshalerUnmarshaler,
+		nullStrategy:         defaultConfiguration.NullStrategy,
+		nullSentinel:         defaultConfiguration.NullSentinel,
+	}
+	settingsMu sync.RWMutex
+)
+
+// getSettings returns the current package-wide settings.
+func getSettings() *settings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return currentSettings
+}
+
+// setSettings replaces the current package-wide settings with s.
+func setSettings(s *settings) {
+	settingsMu.Lock()
+	currentSettings = s
+	settingsMu.Unlock()
+}
+
 // Init starts the Zoom library and creates a connection pool. It accepts
 // a Configuration struct as an argument. Any zero values in the configuration
-// will fallback to their default values. Init should be called once during
-// application startup.
+// will fallback to their default values. Init is typically called once during
+// application startup, but calling it is optional: if the default pool is used
+// before Init is called, it is initialized with the default configuration.
+// Model types may be registered before or after Init is called.
+//
+// Init may also be called again with a new configuration, e.g. to reload
+// configuration at runtime. The new connection pool replaces the old one, which
+// is closed. Connections (and transactions) which are already in use continue
+// to use the old pool until they are closed.
 func Init(config *Configuration) error {
+	initMu.Lock()
+	defer initMu.Unlock()
+	return initLocked(config)
+}
+
+// initLocked is like Init but assumes initMu is held. Everything in config is
+// validated before anything is changed, so if it returns an error other than
+// one from waiting for the connection, the previous configuration is still in
+// use.
+func initLocked(config *Configuration) error {
 	config = parseConfig(config)
-	initPool(config.Network, config.Address, config.Database, config.Password)
+	if err := applyURL(config); err != nil {
+		return err
+	}
+	aead, err := newEncryptionAEAD(config.EncryptionKey)
+	if err != nil {
+		return err
+	}
 	if err := initScripts(); err != nil {
 		return err
 	}
-	return nil
+	state, err := defaultPool.newState(config)
+	if err != nil {
+		return err
+	}
+	setSettings(&settings{
+		retryPolicy:          config.RetryPolicy,
+		marshalerUnmarshaler: config.MarshalerUnmarshaler,
+		nullStrategy:         config.NullStrategy,
+		nullSentinel:         config.NullSentinel,
+		encryptionAEAD:       aead,
+	})
+	return defaultPool.setState(state)
+}
+
+// initDefaultPool initializes the default pool with the default configuration
+// if it has not already been initialized and returns its state. If the default
+// pool can not be initialized, every connection from it will return the error.
+func initDefaultPool() *poolState {
+	initMu.Lock()
+	defer initMu.Unlock()
+	defaultPool.stateMu.RLock()
+	state := defaultPool.state
+	defaultPool.stateMu.RUnlock()
+	if state != nil {
+		return state
+	}
+	err := initLocked(nil)
+	defaultPool.stateMu.Lock()
+	defer defaultPool.stateMu.Unlock()
+	if defaultPool.state == nil {
+		defaultPool.state = &poolState{driver: errorDriver{err: err}}
+	}
+	return defaultPool.state
 }
 
-// Close closes the connection pool and shuts down the Zoom library.
+// Close closes the default connection pool and shuts down the Zoom library.
 // It should be run when application exits, e.g. using defer.
 func Close() error {
-	return pool.Close()
+	return defaultPool.Close()
 }
@@ -0,0 +1,108 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// Package zoomtest helps test code which uses zoom. Instead of connecting to a
+// real redis server (and requiring a database which is reserved for tests and
+// must be empty), each test gets its own in-memory server, provided by
+// miniredis (https://github.com/alicebob/miniredis), which is thrown away when
+// the test finishes.
+//
+// A typical test looks like this:
+//
+//	func TestCreateUser(t *testing.T) {
+//		h := zoomtest.New(t, &User{})
+//		users := h.ModelType(&User{})
+//		if err := users.Save(&User{Name: "Bob"}); err != nil {
+//			t.Fatal(err)
+//		}
+//		...
+//	}
+//
+// New points the default zoom pool at the in-memory server, so tests which use
+// zoomtest must not be run in parallel with each other (i.e. they must not call
+// t.Parallel). miniredis implements most, but not all, redis commands, so
+// features of zoom which rely on commands it lacks will return an error.
+package zoomtest
+
+import (
+	"github.com/albrow/zoom"
+	"github.com/alicebob/miniredis"
+	"reflect"
+	"testing"
+)
+
+// Harness holds the in-memory server for a single test and the model types
+// registered for it. It is created with New.
+type Harness struct {
+	// Server is the in-memory redis server. It can be used to inspect or modify
+	// the data directly, or to fast-forward time so that keys expire (see
+	// miniredis.Miniredis.FastForward).
+	Server *miniredis.Miniredis
+	t      testing.TB
+	types  map[reflect.Type]*zoom.ModelType
+}
+
+// New starts an in-memory redis server, initializes zoom with the default pool
+// connected to it, and registers the types of the given models with the default
+// pool. Everything is torn down when the test finishes, including the
+// registration for each type, so the same types can be registered again by the
+// next test. New stops the test with t.Fatal if anything goes wrong.
+func New(t testing.TB, models ...zoom.Model) *Harness {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("zoomtest: Error starting miniredis: %s", err.Error())
+	}
+	t.Cleanup(server.Close)
+	if err := zoom.Init(&zoom.Configuration{Address: server.Addr()}); err != nil {
+		t.Fatalf("zoomtest: Error in zoom.Init: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		zoom.Close()
+	})
+	h := &Harness{
+		Server: server,
+		t:      t,
+		types:  map[reflect.Type]*zoom.ModelType{},
+	}
+	for _, model := range models {
+		h.Register(model)
+	}
+	return h
+}
+
+// Register registers the type of model with the default pool using the given
+// options (if any) and returns the ModelType. The registration is removed when
+// the test finishes. It stops the test with t.Fatal if the type cannot be
+// registered, e.g. because it was already registered.
+func (h *Harness) Register(model zoom.Model, options ...zoom.ModelOption) *zoom.ModelType {
+	h.t.Helper()
+	mt, err := zoom.RegisterWithOptions(model, options...)
+	if err != nil {
+		h.t.Fatalf("zoomtest: Error registering %T: %s", model, err.Error())
+	}
+	h.types[reflect.TypeOf(model)] = mt
+	h.t.Cleanup(func() {
+		zoom.Unregister(model)
+	})
+	return mt
+}
+
+// ModelType returns the ModelType for the type of model, which must have been
+// registered with New or Register. It stops the test with t.Fatal if the type
+// was not registered.
+func (h *Harness) ModelType(model zoom.Model) *zoom.ModelType {
+	h.t.Helper()
+	mt, found := h.types[reflect.TypeOf(model)]
+	if !found {
+		h.t.Fatalf("zoomtest: Type %T was not registered with the harness", model)
+	}
+	return mt
+}
+
+// Reset removes all the data from the in-memory server, e.g. between subtests.
+// The model types remain registered.
+func (h *Harness) Reset() {
+	h.Server.FlushAll()
+}
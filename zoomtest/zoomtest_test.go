@@ -0,0 +1,58 @@
+// Copyright 2015 Alex Browne.  All rights reserved.
+// Use of this source code is governed by the MIT
+// license, which can be found in the LICENSE file.
+
+// File zoomtest_test.go tests the code in zoomtest.go.
+
+package zoomtest
+
+import (
+	"github.com/albrow/zoom"
+	"testing"
+)
+
+type harnessModel struct {
+	Name string
+	zoom.DefaultData
+}
+
+func TestNew(t *testing.T) {
+	h := New(t, &harnessModel{})
+	models := h.ModelType(&harnessModel{})
+	model := &harnessModel{Name: "Bob"}
+	if err := models.Save(model); err != nil {
+		t.Fatalf("Unexpected error in Save: %s", err.Error())
+	}
+	modelCopy := &harnessModel{}
+	if err := models.Find(model.Id(), modelCopy); err != nil {
+		t.Fatalf("Unexpected error in Find: %s", err.Error())
+	}
+	if modelCopy.Name != model.Name {
+		t.Errorf("Expected Name to be %s but got %s", model.Name, modelCopy.Name)
+	}
+	// The model should be stored in the in-memory server
+	key, _ := models.ModelKey(model.Id())
+	if !h.Server.Exists(key) {
+		t.Errorf("Expected key %s to exist in the server", key)
+	}
+
+	h.Reset()
+	if count, err := models.Count(); err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	} else if count != 0 {
+		t.Errorf("Expected 0 models after Reset but got %d", count)
+	}
+}
+
+// TestNewAgain makes sure that the same type can be registered by more than
+// one test, and that each test gets an empty database.
+func TestNewAgain(t *testing.T) {
+	h := New(t, &harnessModel{})
+	count, err := h.ModelType(&harnessModel{}).Count()
+	if err != nil {
+		t.Fatalf("Unexpected error in Count: %s", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("Expected a new database to be empty but it had %d models", count)
+	}
+}